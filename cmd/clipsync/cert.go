@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"clipsync/internal/pki"
+)
+
+/*──────── mutual TLS (-tls-cert) ───────────────────────────────*/
+
+// runCert implements `clipsync cert init` and `clipsync cert issue
+// [-server host,…] name`: a CA for the deployment and certificates for
+// the relay and each device, in one directory.
+func runCert(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: clipsync cert init [-dir d] [-days n] [-org o]\n"+
+			"       clipsync cert issue [-dir d] [-days n] [-server host,…] <name>")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	fs := flag.NewFlagSet("cert "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", configFile("pki"), "where the CA and the certificates live")
+	days := fs.Int("days", 365, "validity; reissue before it runs out")
+	org := fs.String("org", "clipsync", "init: the CA's name")
+	hosts := fs.String("server", "", "issue: a relay certificate for these comma-separated names or IPs, instead of a device's")
+	fs.Parse(args[1:])
+
+	var err error
+	switch {
+	case args[0] == "init" && fs.NArg() == 0:
+		if *days == 365 {
+			*days = 10 * 365 // the CA outlives what it signs
+		}
+		if err = pki.InitCA(*dir, *org, *days); err == nil {
+			ca, _ := pki.Paths(*dir, pki.CA)
+			fmt.Printf("CA in %s; give %s to the relay (-client-ca) and every device (-tls-ca)\n", *dir, ca)
+		}
+	case args[0] == "issue" && fs.NArg() == 1:
+		var hs []string
+		for _, h := range strings.Split(*hosts, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hs = append(hs, h)
+			}
+		}
+		if err = pki.Issue(*dir, fs.Arg(0), hs, *days); err == nil {
+			cert, key := pki.Paths(*dir, fs.Arg(0))
+			fmt.Printf("%s\n%s\n", cert, key)
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"clipsync/internal/conformance"
+)
+
+/*──────── server conformance (clipsync conformance) ───────────*/
+// runConformance implements `clipsync conformance [-ws url] -key k url`:
+// the conformance battery against a relay at url, one line per check,
+// exit status 1 if a required one failed.
+func runConformance(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	key := fs.String("key", keyPlaceholder, "the server's shared key (16 hex characters or a passphrase)")
+	ws := fs.String("ws", "", "also check WebSocket fan-out at this ws:// or wss:// URL")
+	room := fs.String("room", "", "run in this room (default: a fresh random one)")
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up on the whole battery after this long")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: clipsync conformance [-ws url] [-room name] -key k http://host:port/clip")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	rs := conformance.Run(ctx, conformance.Config{
+		URL:  fs.Arg(0),
+		WS:   *ws,
+		Key:  transportKey(*key),
+		Room: *room,
+	})
+	failed := 0
+	for _, r := range rs {
+		fmt.Println(r)
+		if !r.Optional && !r.OK {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d required checks failed: this client won't work reliably with the server\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("\nconforms; optional features marked no are simply not used")
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/a11y"
+	"clipsync/internal/ctl"
+	"clipsync/internal/fts"
+	"clipsync/internal/hook"
+	"clipsync/internal/textdiff"
+	"clipsync/pkg/clipsync"
+)
+
+/*──────── pause / resume ───────────────────────────────────────*/
+// setPaused flips sync on/off and logs the transition.
+func setPaused(s *clipsync.Syncer, p bool, why string) {
+	if !s.SetPaused(p) {
+		return // no change
+	}
+	if p {
+		log.Printf("%s ⏸  sync paused (%s)", ts(), why)
+	} else {
+		log.Printf("%s ▶  sync resumed (%s)", ts(), why)
+	}
+}
+
+func stateWord(s *clipsync.Syncer) string {
+	if s.Paused() {
+		return "paused"
+	}
+	return "running"
+}
+
+/*──────── control socket (daemon side) ─────────────────────────*/
+
+// spoken passes a human-readable command's output through a11y.Plain
+// when on; JSON replies carry clip text and are left alone.
+func spoken(on bool, h ctl.Handler) ctl.Handler {
+	if !on {
+		return h
+	}
+	return func(args []string) (string, error) {
+		out, err := h(args)
+		return a11y.Plain(out), err
+	}
+}
+
+// plain is -accessible: status text goes out without icons.
+func startControl(ctx context.Context, addr string, sy *clipsync.Syncer, plain bool) *ctl.Server {
+	s := ctl.NewServer()
+	s.Handle("pause", func([]string) (string, error) {
+		setPaused(sy, true, "control")
+		return stateWord(sy), nil
+	})
+	s.Handle("resume", func([]string) (string, error) {
+		setPaused(sy, false, "control")
+		return stateWord(sy), nil
+	})
+	s.Handle("toggle", func([]string) (string, error) {
+		setPaused(sy, !sy.Paused(), "control")
+		return stateWord(sy), nil
+	})
+	s.Handle("status", spoken(plain, func([]string) (string, error) {
+		state := stateWord(sy)
+		if sy.Metered() {
+			state += " (metered: text only)"
+		}
+		return state + "\n" + sy.Status(), nil
+	}))
+	// clip text for `clipsync provider`, base64 so it fits on one line
+	s.Handle("copy", func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", errors.New("usage: copy <base64 text>")
+		}
+		text, err := base64.StdEncoding.DecodeString(args[0])
+		if err != nil {
+			return "", err
+		}
+		return "", sy.Copy([]clipsync.Item{clipsync.TextItem(text)})
+	})
+	s.Handle("paste", func([]string) (string, error) {
+		items, err := sy.Paste()
+		if err != nil {
+			return "", err
+		}
+		text, _ := clipsync.Text(items)
+		return base64.StdEncoding.EncodeToString(text), nil
+	})
+	// recent clips (-history), for the dashboard; `history search q…`
+	// for people
+	s.Handle("history", func(args []string) (string, error) {
+		if len(args) == 1 && args[0] == "pinned" {
+			return clipLines(pinned(sy.History()), ""), nil
+		}
+		if len(args) > 0 {
+			return historySearch(sy, args)
+		}
+		out := []clipView{}
+		for _, c := range sy.History() {
+			out = append(out, viewClip(c))
+		}
+		b, err := json.Marshal(out)
+		return string(b), err
+	})
+	// what dedupe compares, per history clip: why two count as the same
+	s.Handle("keys", func([]string) (string, error) {
+		var b strings.Builder
+		for _, c := range sy.History() {
+			fmt.Fprintf(&b, "%d %s\n", c.ID, clipsync.VerboseKey(c.Items))
+		}
+		return strings.TrimSuffix(b.String(), "\n"), nil
+	})
+	s.Handle("stats", func(args []string) (string, error) {
+		st := sy.Stats()
+		if len(args) == 1 && args[0] == "json" {
+			b, err := json.Marshal(st)
+			return string(b), err
+		}
+		return statsText(st, time.Now()), nil
+	})
+	s.Handle("transfers", func([]string) (string, error) {
+		b, err := json.Marshal(sy.Transfers())
+		return string(b), err
+	})
+	s.Handle("diff", func(args []string) (string, error) {
+		return clipDiff(sy, args)
+	})
+	s.Handle("repush", func(args []string) (string, error) {
+		id, err := clipID(args)
+		if err != nil {
+			return "", err
+		}
+		return "", sy.Repush(ctx, id)
+	})
+	s.Handle("pin", func(args []string) (string, error) {
+		id, err := clipID(args)
+		if err != nil {
+			return "", err
+		}
+		return "", sy.Pin(id, true)
+	})
+	s.Handle("unpin", func(args []string) (string, error) {
+		id, err := clipID(args)
+		if err != nil {
+			return "", err
+		}
+		return "", sy.Pin(id, false)
+	})
+	s.Handle("forget", func(args []string) (string, error) {
+		id, err := clipID(args)
+		if err != nil {
+			return "", err
+		}
+		return "", sy.Forget(id)
+	})
+	// whatever reads, fingerprints, moves or drops clips
+	s.Private("copy", "paste", "history", "diff", "keys", "repush", "pin", "unpin", "forget")
+
+	if addr != "" {
+		go func() {
+			if err := s.Serve(ctx, addr); err != nil {
+				log.Printf("%s control socket: %v", ts(), err)
+			}
+		}()
+	}
+	return s
+}
+
+// statsText is `clipsync stats`: what the session moved each way and
+// how quickly peers confirmed it.
+func statsText(st clipsync.Stats, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "since %s (%s)\n", st.Since.Format("2006-01-02 15:04"), now.Sub(st.Since).Round(time.Second))
+	fmt.Fprintf(&b, "sent       %d clips, %s\n", st.Sent, hook.Size(int(st.SentBytes)))
+	fmt.Fprintf(&b, "received   %d clips, %s\n", st.Recv, hook.Size(int(st.RecvBytes)))
+	if st.Receipts > 0 {
+		fmt.Fprintf(&b, "delivered  %d receipts, %d ms on average", st.Receipts, st.MeanDelivery().Milliseconds())
+	} else {
+		b.WriteString("delivered  no receipts yet")
+	}
+	return b.String()
+}
+
+func clipID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("usage: <cmd> <clip id>, see `clipsync history`")
+	}
+	return strconv.Atoi(args[0])
+}
+
+// historySearch implements `history search <query>`: one line per
+// matching clip, newest first.
+func historySearch(sy *clipsync.Syncer, args []string) (string, error) {
+	if len(args) < 2 || args[0] != "search" {
+		return "", errors.New("usage: history [-pinned | search <query>]")
+	}
+	query := strings.Join(args[1:], " ")
+	hits := sy.SearchHistory(query)
+	if len(hits) == 0 {
+		return fmt.Sprintf("no clip in the history matches %q", query), nil
+	}
+	return clipLines(hits, query), nil
+}
+
+func pinned(clips []clipsync.Clip) []clipsync.Clip {
+	return slices.DeleteFunc(clips, func(c clipsync.Clip) bool { return !c.Pinned })
+}
+
+// clipLines is one line per clip: id, time, direction, device and the
+// line of its text query matches (the first line with no query).
+func clipLines(clips []clipsync.Clip, query string) string {
+	if len(clips) == 0 {
+		return "no clips"
+	}
+	var b strings.Builder
+	for _, c := range clips {
+		text, _ := clipsync.Text(c.Items)
+		from := c.Origin
+		if c.Name != "" {
+			from = c.Name
+		}
+		mark := " "
+		if c.Pinned {
+			mark = "*"
+		}
+		fmt.Fprintf(&b, "%4d%s %s  %-8s %-12s %s\n", c.ID, mark, c.At.Format("Mon 2006-01-02 15:04"), c.Dir, from,
+			fts.Snippet(string(text), query, 60))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// clipDiff implements `diff [a [b]]`: history clip a against clip b, or
+// against the local clipboard; no a means the latest received clip.
+func clipDiff(sy *clipsync.Syncer, args []string) (string, error) {
+	if len(args) > 2 {
+		return "", errors.New("usage: diff [clip id [clip id]]")
+	}
+	hist := sy.History()
+	find := func(arg string) (clipsync.Clip, error) {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return clipsync.Clip{}, err
+		}
+		for _, c := range hist {
+			if c.ID == id {
+				return c, nil
+			}
+		}
+		return clipsync.Clip{}, fmt.Errorf("no clip %d in the history, see `clipsync history`", id)
+	}
+	text := func(c clipsync.Clip) (string, string, error) {
+		t, ok := clipsync.Text(c.Items)
+		if !ok {
+			return "", "", fmt.Errorf("clip %d has no text", c.ID)
+		}
+		from := c.Origin
+		if c.Name != "" {
+			from = c.Name
+		}
+		return fmt.Sprintf("clip %d (%s %s, %s)", c.ID, c.Dir, from, c.At.Format(time.TimeOnly)), string(t), nil
+	}
+
+	var a clipsync.Clip
+	var err error
+	switch {
+	case len(args) > 0:
+		a, err = find(args[0])
+	default:
+		i := slices.IndexFunc(hist, func(c clipsync.Clip) bool { return c.Dir == "received" })
+		if i < 0 {
+			return "", errors.New("no received clip in the history (-history 0, or nothing arrived yet)")
+		}
+		a = hist[i]
+	}
+	if err != nil {
+		return "", err
+	}
+	aName, aText, err := text(a)
+	if err != nil {
+		return "", err
+	}
+
+	bName, bText := "local clipboard", ""
+	if len(args) == 2 {
+		b, err := find(args[1])
+		if err != nil {
+			return "", err
+		}
+		if bName, bText, err = text(b); err != nil {
+			return "", err
+		}
+	} else {
+		items, err := sy.Paste()
+		if err != nil {
+			return "", err
+		}
+		t, ok := clipsync.Text(items)
+		if !ok {
+			return "", errors.New("the local clipboard holds no text")
+		}
+		bText = string(t)
+	}
+
+	d, err := textdiff.Unified(aName, bName, aText, bText)
+	if d == "" && err == nil {
+		return aName + " and " + bName + " are identical", nil
+	}
+	return strings.TrimSuffix(d, "\n"), err
+}
+
+// clipView is one history entry as `history` reports it: the content
+// itself stays in the daemon, only previews go out.
+type clipView struct {
+	ID     int    `json:"id"`
+	Dir    string `json:"dir"`
+	Origin string `json:"origin"`
+	Name   string `json:"name,omitempty"`
+	At     int64  `json:"at"` // Unix ms
+	Kind   string `json:"kind"`
+	Bytes  int    `json:"bytes"`
+	Text   string `json:"text,omitempty"`  // first previewText runes
+	Image  string `json:"image,omitempty"` // data: URL, small images only
+	Pinned bool   `json:"pinned,omitempty"`
+}
+
+const (
+	previewText  = 200
+	previewImage = 256 << 10
+)
+
+func viewClip(c clipsync.Clip) clipView {
+	v := clipView{ID: c.ID, Dir: c.Dir, Origin: c.Origin, Name: c.Name, At: c.At.UnixMilli(), Kind: "clip", Pinned: c.Pinned}
+	for i, it := range c.Items {
+		if i == 0 {
+			if k := core.FormatClass(it); k != "" {
+				v.Kind = k
+			}
+		}
+		v.Bytes += it.ByteLen
+		if v.Image == "" && it.Blob == "" && it.ByteLen <= previewImage &&
+			(it.MimeType == "image/png" || it.MimeType == "image/jpeg" || it.MimeType == "image/webp") {
+			v.Image = "data:" + it.MimeType + ";base64," + it.Payload
+		}
+	}
+	if text, ok := clipsync.Text(c.Items); ok {
+		if r := []rune(string(text)); len(r) > previewText {
+			text = []byte(string(r[:previewText]) + "…")
+		}
+		v.Text = string(text)
+	}
+	return v
+}
+
+/*──────── control socket (CLI side) ────────────────────────────*/
+// ctlCommands are the subcommands that just forward to the daemon.
+var ctlCommands = map[string]bool{
+	"pause": true, "resume": true, "toggle": true, "status": true,
+	"resend": true, "conn": true, "acks": true, "peers": true,
+	"history": true, "repush": true, "forget": true, "transfers": true,
+	"pin": true, "unpin": true,
+	"diff": true, "presence": true, "keys": true, "stats": true,
+}
+
+// runCtl implements `clipsync <cmd> [-control addr] [args…]`.
+func runCtl(cmd string, args []string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	addr := fs.String("control", ctl.DefaultAddr, "daemon control address")
+	var pinnedOnly *bool
+	var to *string
+	switch cmd {
+	case "history":
+		pinnedOnly = fs.Bool("pinned", false, "list the pinned clips, one per line")
+	case "send":
+		to = fs.String("to", "", "the one device to send the clipboard to: its id or name, see `clipsync peers`")
+	}
+	fs.Parse(args)
+
+	call := append([]string{cmd}, fs.Args()...)
+	switch {
+	case pinnedOnly != nil && *pinnedOnly:
+		call = []string{cmd, "pinned"}
+	case to != nil:
+		if *to == "" {
+			fmt.Fprintln(os.Stderr, "usage: clipsync send -to <device>")
+			os.Exit(2)
+		}
+		call = []string{cmd, *to}
+	}
+	out, err := ctl.Call(*addr, call...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if out != "" {
+		fmt.Println(out)
+	}
+}
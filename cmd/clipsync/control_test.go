@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"clipsync/internal/ctl"
+	"clipsync/pkg/clipsync"
+)
+
+// keys shows the hashes of every history clip, so it needs the token
+// like the commands that show the clips themselves.
+func TestKeysNeedsToken(t *testing.T) {
+	d := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", d)
+	t.Setenv("HOME", d)
+	t.Setenv("LocalAppData", d)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sy, err := clipsync.New(clipsync.WithServer("http://"+addr+"/clip", "0123456789abcdef"), // never run
+		clipsync.WithClipboard(clipsync.NewMemClipboard()), clipsync.WithHistory(5), clipsync.WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startControl(ctx, addr, sy, false)
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := ctl.Call(addr, "keys"); err != nil {
+		t.Fatalf("with the token: %v", err)
+	}
+	os.Remove(ctl.TokenFile(addr))
+	if out, err := ctl.Call(addr, "keys"); err == nil {
+		t.Fatalf("without the token: got %q", out)
+	}
+	if _, err := ctl.Call(addr, "status"); err != nil {
+		t.Fatalf("status without the token: %v", err)
+	}
+}
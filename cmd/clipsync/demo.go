@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	netw "clipsync/internal/net"
+	"clipsync/internal/persist"
+	"clipsync/internal/server"
+	"clipsync/pkg/clipsync"
+)
+
+/*──────── simulated devices (clipsync demo) ───────────────────*/
+// runDemo implements `clipsync demo`: an in-process server and two
+// virtual devices with memory clipboards run a fixed script of copies
+// over real HTTP, and every component's log goes to stdout, prefixed
+// with who said it.  Nothing touches the system clipboard or the disk;
+// the output is the event flow to paste into a bug report.
+func runDemo(args []string) {
+	fs := flag.NewFlagSet("demo", flag.ExitOnError)
+	step := fs.Duration("step", time.Second, "pause between scripted copies")
+	compress := fs.Bool("compress", false, "gzip chunked uploads, as -compress does")
+	fs.Parse(args)
+	persist.Disable()
+
+	out := func(who string) *log.Logger {
+		return log.New(os.Stdout, fmt.Sprintf("%-8s ", who), 0)
+	}
+	say := out("script")
+
+	key := make([]byte, 8)
+	rand.Read(key)
+	keyHex := hex.EncodeToString(key)
+	srv, err := server.New(keyHex, out("server"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go http.Serve(ln, srv)
+	endpoint := "http://" + ln.Addr().String() + "/clip"
+	say.Printf("%s server on %s", ts(), endpoint)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	device := func(name string) (*clipsync.Syncer, *clipsync.MemClipboard) {
+		id := uuid.NewString()[:8]
+		cli, err := netw.NewHTTP(endpoint, id, keyHex, netw.WithCompression(*compress))
+		if err != nil {
+			log.Fatal(err)
+		}
+		cb := clipsync.NewMemClipboard()
+		s, err := clipsync.New(
+			clipsync.WithDeviceID(id),
+			clipsync.WithDeviceName(name),
+			clipsync.WithTransport(cli),
+			clipsync.WithClipboard(cb),
+			clipsync.WithEphemeral(true),
+			clipsync.WithNetWatch(false),
+			clipsync.WithLogger(out(name)),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go s.Run(ctx)
+		say.Printf("%s started %s (id %s)", ts(), name, id)
+		return s, cb
+	}
+	laptop, cbLaptop := device("laptop")
+	desktop, cbDesktop := device("desktop")
+	time.Sleep(*step) // let the capability lists cross
+
+	paste := func(cb *clipsync.MemClipboard) string {
+		items, _ := cb.Read()
+		text, _ := clipsync.Text(items)
+		return string(text)
+	}
+	copyOn := func(name string, s *clipsync.Syncer, text string) {
+		preview := text
+		if len(preview) > 40 {
+			preview = fmt.Sprintf("%.40s… (%d bytes)", preview, len(text))
+		}
+		say.Printf("%s copy on %s: %q", ts(), name, preview)
+		s.Copy([]clipsync.Item{clipsync.TextItem([]byte(text))})
+	}
+	expect := func(name string, cb *clipsync.MemClipboard, want string) bool {
+		for end := time.Now().Add(10 * *step); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+			if paste(cb) == want {
+				say.Printf("%s ✓ %s has it", ts(), name)
+				return true
+			}
+		}
+		say.Printf("%s ✗ %s never got it (has %.40q)", ts(), name, paste(cb))
+		return false
+	}
+
+	ok := true
+	copyOn("laptop", laptop, "hello from the laptop")
+	ok = expect("desktop", cbDesktop, "hello from the laptop") && ok
+	time.Sleep(*step)
+
+	copyOn("desktop", desktop, "and back from the desktop")
+	ok = expect("laptop", cbLaptop, "and back from the desktop") && ok
+	time.Sleep(*step)
+
+	big := strings.Repeat("a clip too big for one request, so it goes up in chunks\n", 8000)
+	copyOn("laptop", laptop, big)
+	ok = expect("desktop", cbDesktop, big) && ok
+	time.Sleep(*step)
+
+	for _, l := range strings.Split(strings.TrimSpace(laptop.Deliveries()), "\n") {
+		say.Printf("%s laptop's deliveries: %s", ts(), l)
+	}
+	for _, l := range strings.Split(strings.TrimSpace(laptop.Peers()), "\n") {
+		say.Printf("%s laptop's peers: %s", ts(), l)
+	}
+	if !ok {
+		say.Printf("%s demo failed", ts())
+		os.Exit(1)
+	}
+	say.Printf("%s demo done", ts())
+}
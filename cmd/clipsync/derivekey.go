@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"clipsync/internal/kdf"
+)
+
+/*──────── passphrase keys ─────────────────────────────────────*/
+
+// keyPlaceholder is -key's default, which must be replaced.
+const keyPlaceholder = "your-secret-key-here"
+
+// transportKey resolves -key for the HTTP and WebSocket transports: 16
+// hex characters as is, anything else a passphrase run through Argon2id.
+func transportKey(key string) string {
+	if key == keyPlaceholder {
+		log.Fatalf("-key: set the shared key, 16 hex characters or a passphrase")
+	}
+	k, derived, err := kdf.TransportKey(key)
+	if err != nil {
+		log.Fatalf("-key: %v", err)
+	}
+	if derived {
+		log.Printf("%s 🔑 transport key derived from the passphrase (Argon2id)", ts())
+	}
+	return k
+}
+
+// runDeriveKey implements `clipsync derive-key [passphrase]`: print the
+// hex key a passphrase -key stands for, for the server's config.  The
+// passphrase is read from stdin when not given, to keep it out of shell
+// history.
+func runDeriveKey(args []string) {
+	pass := strings.Join(args, " ")
+	if pass == "" {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		pass = strings.TrimRight(line, "\r\n")
+	}
+	k, _, err := kdf.TransportKey(pass)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(k)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"clipsync/internal/interop"
+)
+
+/*──────── interop vectors ──────────────────────────────────────*/
+// runInterop implements `clipsync interop gen [-o file]` and
+// `clipsync interop check file`.
+func runInterop(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: clipsync interop gen [-o file] | check <file>")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "gen":
+		fs := flag.NewFlagSet("interop gen", flag.ExitOnError)
+		out := fs.String("o", "", "write vectors here (default stdout)")
+		fs.Parse(args[1:])
+
+		vs, err := interop.Generate()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		b, _ := json.MarshalIndent(vs, "", "  ")
+		b = append(b, '\n')
+		if *out == "" {
+			os.Stdout.Write(b)
+			return
+		}
+		if err := os.WriteFile(*out, b, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "check":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: clipsync interop check <file>")
+			os.Exit(2)
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		var vs []interop.Vector
+		if err := json.Unmarshal(data, &vs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		errs := interop.Check(vs)
+		for _, e := range errs {
+			fmt.Println("FAIL", e)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("ok  %d vectors\n", len(vs))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown interop command %q\n", args[0])
+		os.Exit(2)
+	}
+}
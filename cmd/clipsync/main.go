@@ -2,159 +2,574 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
-	"clipsync/internal"
-	"clipsync/internal/clip"
+	"clipsync/internal/a11y"
+	"clipsync/internal/crash"
+	"clipsync/internal/ctl"
+	"clipsync/internal/hook"
+	"clipsync/internal/keychain"
 	netw "clipsync/internal/net"
+	"clipsync/internal/osc52"
+	"clipsync/internal/persist"
+	"clipsync/internal/pki"
+	"clipsync/pkg/clipsync"
 
 	"github.com/google/uuid"
 )
 
 /*──────── pretty helpers ───────────────────────────────────────*/
-var (
-	icSend  = "↗"
-	icRecv  = "🛰 "
-	icLocal = "🖳"
-)
-
 func ts() string { return time.Now().Format("15:04:05.000") }
 
+// cacheDir is <user cache>/clipsync/<sub>, or "" if unknown.
+func cacheDir(sub string) string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(d, "clipsync", sub)
+}
+
+// configFile is <user config>/clipsync/<name>, or name if unknown.
+func configFile(name string) string {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(d, "clipsync", name)
+}
+
+// firer is a -on-* command or the -webhook.
+type firer interface {
+	Fire(event string, snap clipsync.Snapshot) error
+}
+
+// runHooks adapts the configured hooks to a Syncer callback.
+func runHooks(event string, hs ...firer) func(clipsync.Snapshot) {
+	return func(snap clipsync.Snapshot) {
+		for _, h := range hs {
+			if err := h.Fire(event, snap); err != nil {
+				log.Printf("%s %v", ts(), err)
+			}
+		}
+	}
+}
+
+// notifier is -notify's hook, or a no-op.
+func notifier(on bool, n hook.Notify) firer {
+	if !on {
+		return hook.Hook{}
+	}
+	return n
+}
+
+// secretMatch turns -secret-match into a rule (nil: every clip).
+func secretMatch(expr string) func([]clipsync.Item) bool {
+	if expr == "" {
+		return nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		log.Fatalf("secret-match: %v", err)
+	}
+	return func(items []clipsync.Item) bool {
+		text, ok := clipsync.Text(items)
+		return ok && re.Match(text)
+	}
+}
+
+// scriptFilter adapts -filter to the Syncer (nil if unset): a .star
+// file runs in process, anything else as a command.
+func scriptFilter(cmd string) clipsync.Filter {
+	if cmd == "" {
+		return nil
+	}
+	if strings.HasSuffix(cmd, ".star") {
+		s, err := hook.LoadStarlark(cmd)
+		if err != nil {
+			log.Fatalf("filter: %v", err)
+		}
+		return s.Filter
+	}
+	return hook.Script{Cmd: cmd}.Filter
+}
+
 /*──────────────────────── main ─────────────────────────────────*/
 func main() {
+	/* subcommands talk to a running daemon */
+	if len(os.Args) > 1 && ctlCommands[os.Args[1]] {
+		runCtl(os.Args[1], os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "provider" {
+		runProvider(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "device-key" {
+		runDeviceKey(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sign-key" {
+		runSignKey(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "derive-key" {
+		runDeriveKey(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cert" {
+		runCert(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ring" {
+		runRing(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "tui" {
+		runTUI(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "demo" {
+		runDemo(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "interop" {
+		runInterop(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		runReport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "conformance" {
+		runConformance(os.Args[2:])
+		return
+	}
+
 	/* CLI flags */
-	srv := flag.String("http", "http://localhost:5002/clip", "endpoint")
-	key := flag.String("key", "your-secret-key-here", "shared secret")
+	srv := flag.String("http", "http://localhost:5002/clip", "endpoint; several, comma-separated, fail over in order and return to the first")
+	healthEvery := flag.Duration("health-interval", 10*time.Second, "with several -http endpoints: how often to health-check the active one (and the first, while away from it)")
+	key := flag.String("key", keyPlaceholder, "shared secret: 16 hex characters, or a passphrase (Argon2id; \"argon2id:m=65536,t=3,p=4,salt=...:passphrase\" sets the costs)")
 	poll := flag.Int("interval", 200, "poll interval ms")
-	trans := flag.String("transport", "poll", "poll | ws")
+	trans := flag.String("transport", "poll", "poll | ws | s3 (-http s3://bucket/prefix) | redis (-http redis://host:6379) | nats (-http nats://host:4222)")
+	room := flag.String("room", "", "sync room: only devices in the same room share clips")
+	name := flag.String("name", "", "this device's name in peers' logs, peer lists and notifications (empty = host name)")
+	proxy := flag.String("proxy", "", "reach the server through this proxy: http://, https:// or socks5://host:port, user:password@ allowed; none = ignore HTTP(S)_PROXY (empty = from the environment)")
 	postTO := flag.Duration("timeout", 15*time.Second, "HTTP POST timeout")
+	bodyCap := flag.Int("body-cap", 32<<20, "largest snapshot sent in one piece; bigger items go out of band (server may lower it)")
+	chunkSize := flag.Int("chunk-size", 300<<10, "HTTP upload chunk size (server may lower it)")
+	workers := flag.Int("upload-workers", 4, "chunks uploaded in parallel (poll transport)")
+	maxUp := flag.Int("max-upload-kbps", 0, "cap uploads at this many kilobits per second, across parallel chunks (0 = unlimited)")
+	useQUIC := flag.Bool("quic", false, "poll transport: HTTP/3 over QUIC to the https:// server's UDP port (clipsyncd -quic); re-dials resume with 0-RTT")
+	compress := flag.Bool("compress", false, "gzip large snapshots on the wire (peers detect it)")
+	adaptive := flag.Bool("adaptive", true, "report round trip, loss and throughput to the server and follow its chunk size, poll and compression hints")
+	wsDeflate := flag.Bool("ws-deflate", true, "ws transport: offer permessage-deflate, compressing every frame (never with -noise)")
+	wsPing := flag.Duration("ws-ping", 15*time.Second, "ws transport: ping this often and re-dial when a pong is 5s late (0 = never)")
+	wsBackoff := flag.Duration("ws-backoff", netw.DefaultReconnect.Initial, "ws transport: wait this long after the first failed dial")
+	wsBackoffFactor := flag.Float64("ws-backoff-factor", netw.DefaultReconnect.Factor, "ws transport: multiply the wait by this after each further failure")
+	wsBackoffMax := flag.Duration("ws-backoff-max", netw.DefaultReconnect.Max, "ws transport: never wait longer than this between dials (0 = no cap)")
+	wsJitter := flag.Float64("ws-jitter", netw.DefaultReconnect.Jitter, "ws transport: vary each wait by ± this fraction")
+	wsMaxRetries := flag.Int("ws-max-retries", netw.DefaultReconnect.MaxRetries, "ws transport: after this many failed retries in a row, stop and let the transport restart (0 = never)")
+	noise := flag.Bool("noise", false, "ws transport: Noise_XX handshake per connection, frames sealed with its session keys (server must support it)")
+	noisePin := flag.String("noise-server-key", "", "with -noise: the server's static public key, hex; refuse any other (empty = any)")
+	tlsCert := flag.String("tls-cert", "", "http/ws: this device's client certificate for mutual TLS (clipsync cert issue); needs -tls-key")
+	tlsKey := flag.String("tls-key", "", "http/ws: the key of -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "http/ws: trust only servers signed by this CA, e.g. clipsync cert's ca.crt (empty = system roots)")
+	devToken := flag.String("device-token", "", "http/ws: this device's own token from the relay's admin API, <name>.<secret>, sent with every request (empty = shared key only)")
+	ctlAddr := flag.String("control", ctl.DefaultAddr, "control socket address (empty = off)")
+	maxItem := flag.Int("max-item-bytes", 16<<20, "skip clipboard items larger than this (0 = no limit)")
+	limits := flag.String("limits", "", "per-format size budgets, e.g. image/png=8MiB:convert,text=1MiB,files=100MiB; :convert shrinks instead of skipping, :ask sends if you click a notification (empty = -max-item-bytes for all)")
+	maxPix := flag.Int("max-pixels", 0, "downscale images above this pixel count, e.g. 3686400 for 2560×1440; lossy, so opt-in (0 = never)")
+	textFile := flag.Int("text-as-file", 0, "paste received text above this many bytes as a .txt file (0 = off)")
+	eol := flag.String("eol", "keep", "line endings of received text: lf, crlf, auto (this platform's) or keep")
+	trimSpace := flag.Bool("trim-trailing-space", false, "drop spaces and tabs at the end of each line of received text")
+	jpegQ := flag.Int("jpeg-quality", 0, "send photographic images as JPEG at this quality 1-100 (0 = always PNG)")
+	webpQ := flag.Int("webp-quality", 0, "send photographic images as WebP at this quality 1-100, ahead of -jpeg-quality (0 = off)")
+	lossyMin := flag.Int("lossy-min-bytes", 1<<20, "only consider JPEG or WebP for PNGs larger than this")
+	urls := flag.Bool("urls", true, "send copied links as text/uri-list too, and paste received ones as text and as the platform's link format")
+	primary := flag.Bool("primary", false, "Linux: also sync the PRIMARY selection (middle-click paste), with peers that have one")
+	passthru := flag.Bool("passthrough", false, "also sync app-specific clipboard formats verbatim (Windows ↔ Windows)")
+	dupN := flag.Int("dedupe-count", 1, "treat a copy as duplicate if among the last N clips (0 = off)")
+	dupWin := flag.Duration("dedupe-window", 0, "...and seen less than this long ago (0 = forever)")
+	debounce := flag.Duration("debounce", 300*time.Millisecond, "send a copy only after the clipboard has been quiet this long (0 = at once)")
+	drainTO := flag.Duration("shutdown-timeout", 5*time.Second, "on Ctrl-C, how long copies not yet sent get to go out before exiting")
+	maxAge := flag.Duration("max-age", 0, "drop remote clips copied longer ago than this, e.g. replayed after sleep (0 = keep all)")
+	echoGrace := flag.Duration("echo-grace", time.Second, "after writing a remote clip, don't send the same content back for this long (0 = off)")
+	force := flag.Bool("force-resend", false, "send every local copy, even identical ones, and make peers re-apply it")
+	qDir := flag.String("queue-dir", cacheDir("queue"), "persist unsent snapshots here while offline (empty = off)")
+	onSend := flag.String("on-send", "", "run this command after each clip is sent (empty = off)")
+	onRecv := flag.String("on-receive", "", "run this command after each received clip is applied (empty = off)")
+	webhook := flag.String("webhook", "", "POST a JSON event for every sent / received clip to this URL (empty = off)")
+	filter := flag.String("filter", "", "Starlark file (.star) or command that may rewrite or block every clip (empty = off)")
+	filterTO := flag.Duration("filter-timeout", 2*time.Second, "stop a -filter that takes longer; the clip is dropped")
+	notify := flag.Bool("notify", false, "show a desktop notification for every received clip")
+	notifyVerb := flag.String("notify-verbosity", "normal", "how much a notification says: brief (sender only), normal (kind, size, sender) or full (also formats and time)")
+	accessible := flag.Bool("accessible", false, "screen-reader friendly text: words instead of icons and emoji in logs, status and notifications, sizes spelled out")
+	notifyHold := flag.Duration("notify-hold", 0, "with -notify: wait this long before applying a received clip; clicking the notification skips it (0 = apply at once)")
+	hookStdin := flag.Bool("hook-stdin", false, "pipe the clip's content into -on-send / -on-receive")
+	resumeDir := flag.String("resume-dir", cacheDir("partial"), "keep partly downloaded snapshots here across restarts (empty = off)")
+	osc := flag.Bool("osc52", false, "take copies from OSC 52 sequences on stdin (tmux / SSH bridge) instead of the system clipboard; stdin is copied to stdout")
+	oscEmit := flag.Bool("osc52-emit", false, "print received text to stdout as OSC 52 so the attached terminal copies it (implies the OSC 52 clipboard)")
+	oscTmux := flag.Bool("osc52-tmux", false, "wrap -osc52-emit sequences for tmux passthrough")
+	oscExec := flag.String("osc52-exec", "", "run this command on a PTY and take copies from its output, e.g. \"tmux attach\" (Linux; empty = off)")
+	listEvery := flag.Duration("list-interval", 2*time.Second, "how often the s3 transport lists the bucket for new clips")
+	ring := flag.String("ring", "", "seal clips end to end with this room key ring (comma-separated files during a rotation; empty = off)")
+	devKey := flag.String("device-key", configFile("device.key"), "this device's private key, for -ring")
+	signOn := flag.Bool("sign", false, "sign every snapshot with this device's Ed25519 key and check peers' signatures")
+	signKey := flag.String("sign-key", configFile("sign.key"), "this device's signing key, for -sign")
+	trusted := flag.String("trusted-keys", "", "file of peers' signing keys, one \"key [name]\" per line; only these are believed (empty = pin each device name's key on first use)")
+	requireSigned := flag.Bool("require-signed", false, "with -sign, also drop snapshots that carry no signature")
+	secretTTL := flag.Duration("secret-ttl", 0, "clear secret clips from the clipboard this long after the copy, here and on peers (0 = off)")
+	secretRe := flag.String("secret-match", "", "regexp a copied text must match to count as secret for -secret-ttl (empty = every clip)")
+	guard := flag.String("secret-guard", "off", "hold back copies that look like secrets (private keys, JWTs, API tokens, generated passwords): block, ask (send if you click a notification) or off")
+	formats := flag.String("sync-formats", "all", "what to sync, both ways: text, image, files or all; comma-separate several")
+	strict := flag.Duration("strict-order", 0, "apply each device's clips in copy order, holding one that overtakes an earlier one up to this long (0 = off)")
+	netWatch := flag.Bool("net-watch", true, "re-dial the moment the network changes (Wi-Fi switch, docking) instead of waiting for a timeout")
+	peerExpiry := flag.Duration("peer-expiry", 7*24*time.Hour, "forget a peer that has been silent this long (0 = never)")
+	metered := flag.String("metered", "auto", "on metered networks sync text only, compressed, and poll less: auto (as the OS marks the connection), on or off")
+	history := flag.Int("history", 10, "keep this many recent clips in memory, for clipsync history / repush and the -ui dashboard (0 = none)")
+	histDir := flag.String("history-dir", "", "also keep the -history clips on disk here, so they survive a restart; with -queue-dir empty the offline queue goes here too (empty = memory only)")
+	histEncrypt := flag.Bool("history-encrypt", false, "encrypt what -history-dir keeps with a key held in the OS keychain; entries kept in the clear are sealed at startup")
+	ui := flag.String("ui", "", "serve a local web dashboard on this loopback address, e.g. 127.0.0.1:5080; needs -control (empty = off)")
+	crashReports := flag.Bool("crash-reports", false, "on a panic, write a report (stacks, build; no clipboard content) for `clipsync report` to bundle")
+	ephemeral := flag.Bool("ephemeral", false, "write nothing to disk: no offline queue, resume files or text-as-file spool")
 	flag.Parse()
+	if *accessible {
+		log.SetOutput(a11y.Writer(os.Stderr))
+	}
+	verbosity, err := a11y.ParseVerbosity(*notifyVerb)
+	if err != nil {
+		log.Fatalf("-notify-verbosity: %v", err)
+	}
+	if *ephemeral {
+		*qDir, *resumeDir, *histDir, *textFile = "", "", "", 0
+		persist.Disable()
+	}
+	if *crashReports && !*ephemeral {
+		crash.Enable(cacheDir("crashes"))
+		defer crash.Recover()
+	}
 
 	myID := uuid.NewString()[:8]
+	switch {
+	case *wsBackoff <= 0:
+		log.Fatalf("-ws-backoff: want a positive duration")
+	case *wsBackoffFactor < 1:
+		log.Fatalf("-ws-backoff-factor: want 1 or more")
+	case *wsJitter < 0 || *wsJitter > 1:
+		log.Fatalf("-ws-jitter: want a fraction between 0 and 1")
+	}
+	opts := []netw.Option{
+		netw.WithRoom(*room),
+		netw.WithLimits(netw.Limits{BodyCap: *bodyCap, ChunkSize: *chunkSize}),
+		netw.WithCompression(*compress),
+		netw.WithAdaptive(*adaptive),
+		netw.WithMaxUpload(*maxUp),
+		netw.WithQUIC(*useQUIC),
+		netw.WithWSDeflate(*wsDeflate),
+		netw.WithKeepalive(*wsPing, 5*time.Second),
+		netw.WithReconnect(netw.ReconnectPolicy{Initial: *wsBackoff, Factor: *wsBackoffFactor,
+			Max: *wsBackoffMax, Jitter: *wsJitter, MaxRetries: *wsMaxRetries}),
+		netw.WithOnWSState(func(e netw.WSEvent) { log.Printf("%s ws: %s", ts(), e) }),
+	}
+	if *proxy != "" {
+		u, err := netw.ParseProxy(*proxy)
+		if err != nil {
+			log.Fatalf("-proxy: %v", err)
+		}
+		opts = append(opts, netw.WithProxy(u))
+	}
+	if *noise {
+		pin, err := hex.DecodeString(*noisePin)
+		if err != nil || (len(pin) != 0 && len(pin) != 32) {
+			log.Fatalf("-noise-server-key: want 64 hex characters")
+		}
+		if len(pin) == 0 {
+			pin = nil
+		}
+		opts = append(opts, netw.WithNoise(pin))
+	}
+
+	if *tlsCert != "" || *tlsKey != "" || *tlsCA != "" {
+		tc, err := pki.ClientConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			log.Fatalf("-tls-cert: %v", err)
+		}
+		opts = append(opts, netw.WithTLSConfig(tc))
+	}
+	if *devToken != "" {
+		tok, err := netw.ParseDeviceToken(*devToken)
+		if err != nil {
+			log.Fatalf("-device-token: %v", err)
+		}
+		opts = append(opts, netw.WithDeviceToken(tok))
+	}
 
 	/* network client */
 	var cli netw.Client
-	var err error
-	if *trans == "ws" {
-		cli, err = netw.NewWS(*srv, myID, *key)
+	switch *trans {
+	case "redis", "nats", "s3": // authenticate their own way
+	default:
+		*key = transportKey(*key)
+	}
+	dial := func(srv string) (netw.Client, error) {
+		switch *trans {
+		case "ws":
+			return netw.NewWS(srv, myID, *key, opts...)
+		case "redis":
+			return netw.NewRedis(srv, myID, append(opts, netw.WithTimeout(*postTO))...)
+		case "nats":
+			return netw.NewNATS(srv, myID, append(opts, netw.WithTimeout(*postTO))...)
+		case "s3":
+			return netw.NewS3(srv, myID, append(opts,
+				netw.WithTimeout(*postTO),
+				netw.WithListInterval(*listEvery))...)
+		}
+		return netw.NewHTTP(srv, myID, *key, append(opts,
+			netw.WithTimeout(*postTO),
+			netw.WithUploadWorkers(*workers),
+			netw.WithResumeDir(*resumeDir))...)
+	}
+	if urls := netw.SplitEndpoints(*srv); len(urls) > 1 {
+		eps := make([]netw.Endpoint, len(urls))
+		for i, u := range urls {
+			if eps[i].Client, err = dial(u); err != nil {
+				log.Fatalf("net client %s: %v", u, err)
+			}
+			eps[i].URL = u
+		}
+		cli, err = netw.NewFailover(eps, append(opts,
+			netw.WithHealthCheck(*healthEvery),
+			netw.WithOnFailover(func(from, to string) {
+				log.Printf("%s ↗ failover: %s → %s", ts(), from, to)
+			}))...)
 	} else {
-		cli, err = netw.NewHTTP(*srv, myID, *key, *postTO)
+		cli, err = dial(*srv)
 	}
 	if err != nil {
 		log.Fatalf("net client: %v", err)
 	}
 
-	log.Printf("🎬 clipsync id=%s  srv=%s  %s  poll=%d ms",
-		myID, *srv, *trans, *poll)
-
-	/* clipboard goroutine */
-	cbCh := clip.StartThread()
-
-	/* channels */
-	toUp := make(chan internal.Snapshot, 8)
-	fromSrv := make(chan internal.Snapshot, 8)
-
-	/* watcher */
-	go watcher(cbCh, toUp, time.Duration(*poll)*time.Millisecond, myID)
+	log.Printf("🎬 clipsync id=%s  srv=%s  %s  poll=%d ms  room=%q",
+		myID, *srv, *trans, *poll, *room)
+	if *ephemeral {
+		log.Printf("%s ephemeral: nothing is written to disk", ts())
+	}
 
-	/* uploader */
-	go func() {
-		for s := range toUp {
-			start := time.Now()
-			if err := cli.Send(s); err != nil {
-				log.Printf("%s %s send error: %v", ts(), icSend, err)
-			} else {
-				el := time.Since(start).Milliseconds()
-				log.Printf("%s %s sent snapshot  %d items (%d ms)",
-					ts(), icSend, len(s.Items), el)
+	/* the sync engine lives in pkg/clipsync */
+	wh := hook.Webhook{URL: *webhook, Device: myID}
+	sopts := []clipsync.Option{}
+	var oscIn io.Reader
+	var session <-chan error // -osc52-exec: the command's exit
+	if *oscExec != "" {
+		r, restore, done, err := osc52.Exec(exec.Command("sh", "-c", *oscExec))
+		if err != nil {
+			log.Fatalf("osc52-exec: %v", err)
+		}
+		defer restore()
+		oscIn, session = r, done
+	} else if *osc {
+		oscIn = os.Stdin
+	}
+	if oscIn != nil || *oscEmit {
+		sopts = append(sopts, clipsync.WithClipboard(osc52.New(oscIn, os.Stdout,
+			osc52.Options{Emit: *oscEmit, Tmux: *oscTmux})))
+	} else if !clipsync.HasSystemClipboard() {
+		// no system clipboard: sync what `clipsync provider` copies
+		sopts = append(sopts, clipsync.WithClipboard(clipsync.NewMemClipboard()))
+		log.Printf("%s no system clipboard here: syncing `clipsync provider` copies only", ts())
+	}
+	nt := hook.Notify{Hold: *notifyHold, Verbosity: verbosity, Spoken: *accessible}
+	if *notify && nt.Hold > 0 {
+		sopts = append(sopts, clipsync.WithConfirm(nt.Confirm))
+	}
+	sopts = append(sopts, clipsync.WithOversizeAsk(nt.AskOversize)) // -limits …:ask
+	sopts = append(sopts, clipsync.WithSecretGuard(*guard, nt.AskSecret))
+	if *secretTTL > 0 {
+		sopts = append(sopts, clipsync.WithSecretTTL(*secretTTL, secretMatch(*secretRe)))
+	}
+	if *ring != "" {
+		sopts = append(sopts, clipsync.WithSealer(ringSealer(*ring, *devKey, *room)))
+	}
+	if *signOn {
+		pins := configFile("sign.pins")
+		if *ephemeral {
+			pins = ""
+		}
+		sopts = append(sopts, clipsync.WithSigner(signer(*signKey, *trusted, pins, *room, *requireSigned)))
+	}
+	budgets, err := clipsync.ParseBudgets(*limits)
+	if err != nil {
+		log.Fatalf("-limits: %v", err)
+	}
+	if len(budgets) > 0 {
+		// the flat cap becomes the budget of everything not listed
+		if *maxItem > 0 && !slices.ContainsFunc(budgets, func(b clipsync.Budget) bool { return b.Key == "*" }) {
+			budgets = append(budgets, clipsync.Budget{Key: "*", Max: *maxItem, Policy: "skip"})
+		}
+		*maxItem = 0
+		sopts = append(sopts, clipsync.WithSizeBudgets(budgets...))
+	}
+	if *histDir != "" {
+		st := clipsync.DirStorage(*histDir)
+		if *histEncrypt {
+			key, err := keychain.Key("history")
+			if err != nil {
+				log.Fatalf("-history-encrypt: %v (without it the history is kept in the clear)", err)
+			}
+			if st, err = clipsync.SealedStorage(st, key); err != nil {
+				log.Fatalf("-history-encrypt: %v", err)
 			}
 		}
-	}()
+		sopts = append(sopts, clipsync.WithStorage(st))
+	}
+	s, err := clipsync.New(append(sopts,
+		clipsync.WithDeviceID(myID),
+		clipsync.WithDeviceName(*name),
+		clipsync.WithTransport(cli),
+		clipsync.WithClipOptions(clipsync.ClipOptions{
+			MaxItemBytes:  *maxItem,
+			MaxPixels:     *maxPix,
+			TextFileBytes: *textFile,
+			JPEGQuality:   *jpegQ,
+			WebPQuality:   *webpQ,
+			LossyMinBytes: *lossyMin,
+			Passthrough:   *passthru,
+			Primary:       *primary,
+		}),
+		clipsync.WithInterval(time.Duration(*poll)*time.Millisecond),
+		clipsync.WithDebounce(*debounce),
+		clipsync.WithEchoGrace(*echoGrace),
+		clipsync.WithDrainTimeout(*drainTO),
+		clipsync.WithMaxAge(*maxAge),
+		clipsync.WithDedupe(*dupN, *dupWin),
+		clipsync.WithForceResend(*force),
+		clipsync.WithQueueDir(*qDir),
+		clipsync.WithEphemeral(*ephemeral),
+		clipsync.WithPeerExpiry(*peerExpiry),
+		clipsync.WithHistory(*history),
+		clipsync.WithStrictOrder(*strict),
+		clipsync.WithNetWatch(*netWatch),
+		clipsync.WithMetered(*metered),
+		clipsync.WithTextNormalization(*eol, *trimSpace),
+		clipsync.WithURLs(*urls),
+		clipsync.WithSyncFormats(strings.Split(*formats, ",")...),
+		clipsync.WithFilter(scriptFilter(*filter), *filterTO),
+		clipsync.WithOnSend(runHooks("send", hook.Hook{Cmd: *onSend, Stdin: *hookStdin}, wh)),
+		clipsync.WithOnReceive(runHooks("receive", hook.Hook{Cmd: *onRecv, Stdin: *hookStdin}, wh, notifier(*notify, nt))),
+	)...)
+	if err != nil {
+		log.Fatalf("clipsync: %v", err)
+	}
 
-	/* poller */
 	ctx, cancel := context.WithCancel(context.Background())
-	go cli.Poll(ctx, fromSrv)
-	go poller(cbCh, fromSrv, myID)
-
-	/* Ctrl-C shutdown */
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	<-sig
-	log.Println("⏻  shutting down…")
-	cancel()
-	time.Sleep(300 * time.Millisecond)
-}
-
-/*──────── watcher (local → send, seq-based) ───────────────────*/
-func watcher(cbCh chan<- clip.Req,
-	out chan<- internal.Snapshot,
-	interval time.Duration, myID string) {
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	lastSeq := clip.GetSeq() // cheap kernel counter
-	var lastQuick string
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
 
-	for range ticker.C {
-		seq := clip.GetSeq()
-		if seq == lastSeq {
-			continue // clipboard unchanged
+	/* control socket + SIGUSR1 pause toggle */
+	cs := startControl(ctx, *ctlAddr, s, *accessible)
+	cs.Handle("resend", func([]string) (string, error) {
+		n, err := s.Resend(ctx)
+		if err != nil {
+			return "", err
 		}
-		lastSeq = seq
-
-		items, err := askClipboard(cbCh) // opens clipboard only now
-		if err != nil || len(items) == 0 {
-			continue // sentinel / unsupported
+		return fmt.Sprintf("re-sent %d items", n), nil
+	})
+	cs.Handle("send", func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", errors.New("usage: send -to <device id or name>")
 		}
-
-		qk := internal.QuickKey(items)
-		if qk == lastQuick { // duplicate user copy
-			continue
+		n, err := s.SendTo(ctx, args[0])
+		if err != nil {
+			return "", err
 		}
-		lastQuick = qk
-
-		log.Printf("%s %s local → %s (%d items)",
-			ts(), icLocal, items[0].Fmt, len(items))
-
-		out <- internal.Snapshot{
-			Origin: myID,
-			TS:     time.Now().Unix(),
-			Items:  items,
+		return fmt.Sprintf("sent %d items to %s", n, args[0]), nil
+	})
+	cs.Handle("acks", spoken(*accessible, func([]string) (string, error) {
+		return s.Deliveries(), nil
+	}))
+	cs.Handle("peers", spoken(*accessible, func([]string) (string, error) {
+		peers, downloads := s.Purged()
+		return fmt.Sprintf("%s\npurged: %d silent peers, %d stalled downloads",
+			s.Peers(), peers, downloads), nil
+	}))
+	cs.Handle("presence", func([]string) (string, error) {
+		peers, downloads := s.Purged()
+		b, err := json.Marshal(map[string]any{
+			"peers": s.PeerList(), "purged_peers": peers, "purged_downloads": downloads,
+		})
+		return string(b), err
+	})
+	cs.Handle("conn", func([]string) (string, error) {
+		out := fmt.Sprintf("clock-offset=%v", netw.ClockOffset())
+		if m, ok := cli.(interface{ ConnStats() netw.ConnStats }); ok {
+			out = fmt.Sprintf("%s %s", m.ConnStats(), out)
 		}
-	}
-}
-
-/*──────── poller (recv → clipboard) ───────────────────────────*/
-func poller(cbCh chan<- clip.Req, in <-chan internal.Snapshot, myID string) {
-	var lastRemoteQuick string
-
-	for snap := range in {
-		qk := internal.QuickKey(snap.Items)
-		if qk == lastRemoteQuick {
-			continue
+		if e, ok := cli.(interface{ Endpoints() string }); ok {
+			out += "\n" + e.Endpoints()
 		}
-		lastRemoteQuick = qk
-
-		reply := make(chan clip.Resp, 1)
-		cbCh <- clip.Req{Kind: clip.ReqWrite, WriteData: snap.Items, Resp: reply}
-		if err := (<-reply).Err; err != nil {
-			log.Printf("%s clipboard write: %v", ts(), err)
-		} else {
-			log.Printf("%s %s remote ← %s (%d items)",
-				ts(), icRecv, snap.Items[0].Fmt, len(snap.Items))
+		if a, ok := cli.(interface {
+			NetStats() netw.NetStats
+			Hints() netw.Hints
+		}); ok {
+			out += fmt.Sprintf("\nnet: %s  hints: %s", a.NetStats(), a.Hints())
+		}
+		if d, ok := cli.(interface{ Deflate() bool }); ok && *trans == "ws" {
+			state := "off"
+			if d.Deflate() {
+				state = "on"
+			}
+			out += "\nws: permessage-deflate " + state
+		}
+		return out, nil
+	})
+	if *ui != "" {
+		if *ctlAddr == "" {
+			log.Fatalf("-ui needs the control socket (-control)")
 		}
+		go func() {
+			if err := serveUI(ctx, *ui, *ctlAddr); err != nil {
+				log.Printf("%s dashboard: %v", ts(), err)
+			}
+		}()
 	}
-}
+	toggle := make(chan os.Signal, 1)
+	notifyToggle(toggle)
+	go func() {
+		for range toggle {
+			setPaused(s, !s.Paused(), "signal")
+		}
+	}()
 
-/*──────── helper: ask clipboard thread ─────────────────────────*/
-func askClipboard(cbCh chan<- clip.Req) ([]internal.Item, error) {
-	reply := make(chan clip.Resp, 1)
-	cbCh <- clip.Req{Kind: clip.ReqRead, Resp: reply}
-	r := <-reply
-	return r.Items, r.Err
+	/* Ctrl-C shutdown (or the -osc52-exec session ending) */
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	select {
+	case <-sig:
+	case err := <-session:
+		log.Printf("%s osc52-exec: session ended (%v)", ts(), err)
+	}
+	log.Println("⏻  shutting down…")
+	cancel()
+	select {
+	case <-stopped:
+	case <-sig: // a second Ctrl-C doesn't wait for the drain
+	}
 }
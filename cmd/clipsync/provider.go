@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"clipsync/internal/ctl"
+)
+
+/*──────── clipboard provider (neovim, tmux) ────────────────────*/
+// runProvider implements `clipsync provider get|set`: set copies stdin
+// through the running daemon, get prints its clipboard text.  It never
+// starts a daemon itself, so editors don't wait on one.
+func runProvider(args []string) {
+	fs := flag.NewFlagSet("provider", flag.ExitOnError)
+	addr := fs.String("control", ctl.DefaultAddr, "daemon control address")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: clipsync provider [-control addr] get|set")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var err error
+	switch fs.Arg(0) {
+	case "get":
+		err = providerGet(*addr)
+	case "set":
+		err = providerSet(*addr)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "clipsync provider:", err)
+		os.Exit(1)
+	}
+}
+
+func providerGet(addr string) error {
+	out, err := ctl.Call(addr, "paste")
+	if err != nil {
+		return err
+	}
+	text, err := base64.StdEncoding.DecodeString(out)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(text)
+	return err
+}
+
+func providerSet(addr string) error {
+	text, err := io.ReadAll(io.LimitReader(os.Stdin, ctl.MaxLine/2))
+	if err != nil {
+		return err
+	}
+	if len(text) == 0 {
+		return nil // nothing copied
+	}
+	_, err = ctl.Call(addr, "copy", base64.StdEncoding.EncodeToString(text))
+	return err
+}
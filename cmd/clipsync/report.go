@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"clipsync/internal/crash"
+	"clipsync/internal/ctl"
+)
+
+/*──────── crash reports (clipsync report) ─────────────────────*/
+// runReport implements `clipsync report`: the crash reports -crash-reports
+// left behind, the build and platform, and what a running daemon says
+// about itself (status, conn, peers), zipped into one file to attach to
+// a bug report.  Nothing in it is clipboard content; unzip it and look.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	out := fs.String("o", "clipsync-report-"+time.Now().Format("20060102-150405")+".zip", "write the bundle here")
+	addr := fs.String("control", ctl.DefaultAddr, "daemon control address (empty = don't ask a daemon)")
+	fs.Parse(args)
+
+	dir := cacheDir("crashes")
+	extra := map[string]string{
+		"system.txt": fmt.Sprintf("build: %s\ncpus: %d\ncrash reports: %s (%d)\ncollected: %s\n",
+			crash.Build(), runtime.NumCPU(), dir, len(crash.Reports(dir)), time.Now().UTC().Format(time.RFC3339)),
+	}
+	if *addr != "" {
+		var b strings.Builder
+		for _, cmd := range []string{"status", "conn", "peers"} {
+			reply, err := ctl.Call(*addr, cmd)
+			if err != nil {
+				reply = "(" + err.Error() + ")"
+			}
+			fmt.Fprintf(&b, "$ clipsync %s\n%s\n\n", cmd, reply)
+		}
+		extra["daemon.txt"] = b.String()
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names, err := crash.Bundle(f, dir, extra)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %s:\n", *out)
+	for _, n := range names {
+		fmt.Printf("  %s\n", n)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyToggle delivers SIGUSR1 (pause/resume toggle) on ch.
+func notifyToggle(ch chan<- os.Signal) { signal.Notify(ch, syscall.SIGUSR1) }
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyToggle is a no-op: Windows has no SIGUSR1, use `clipsync toggle`.
+func notifyToggle(ch chan<- os.Signal) {}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"clipsync/internal/sign"
+	"clipsync/pkg/clipsync"
+)
+
+/*──────── snapshot signatures (-sign) ─────────────────────────*/
+
+// runSignKey implements `clipsync sign-key`: print this device's
+// signing public key (creating the key on first use), for the other
+// devices' -trusted-keys.
+func runSignKey(args []string) {
+	fs := flag.NewFlagSet("sign-key", flag.ExitOnError)
+	path := fs.String("sign-key", configFile("sign.key"), "this device's signing key file")
+	fs.Parse(args)
+
+	k, err := sign.LoadKey(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(k.Public())
+}
+
+// signer builds the -sign Signer.  Without a trusted keys file, keys
+// are pinned per device name on first use, in pinsFile.
+func signer(keyPath, trusted, pinsFile, room string, require bool) clipsync.Signer {
+	k, err := sign.LoadKey(keyPath)
+	if err != nil {
+		log.Fatalf("sign key: %v", err)
+	}
+	t, err := sign.NewTrust(trusted, pinsFile)
+	if err != nil {
+		log.Fatalf("trusted keys: %v", err)
+	}
+	t.OnPin = func(name, key string) {
+		log.Printf("%s ✍️ pinned %s to signing key %s", ts(), printable(name), key)
+	}
+	how := "pinned on first use"
+	if trusted != "" {
+		how = "from " + trusted
+	}
+	log.Printf("%s ✍️ snapshots signed (key %s; peers' keys %s)", ts(), k.Public(), how)
+	return sign.NewSigner(k, t, room, require)
+}
@@ -0,0 +1,6 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+// termCols can't ask the console here; termWidth falls back to $COLUMNS.
+func termCols() int { return 0 }
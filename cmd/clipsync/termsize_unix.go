@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// termCols asks the terminal on stdout for its width; 0 if it isn't one.
+func termCols() int {
+	var ws [4]uint16 // rows, cols, xpixel, ypixel
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if e != 0 {
+		return 0
+	}
+	return int(ws[1])
+}
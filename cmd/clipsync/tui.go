@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"clipsync/internal/ctl"
+	"clipsync/internal/hook"
+	"clipsync/pkg/clipsync"
+)
+
+/*──────── terminal monitor (clipsync tui) ─────────────────────*/
+// runTUI implements `clipsync tui`: a full-screen view of a running
+// daemon, redrawn from the control socket every -refresh, for a tmux
+// pane.  It only reads; Ctrl-C leaves.
+func runTUI(args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	addr := fs.String("control", ctl.DefaultAddr, "daemon control address")
+	every := fs.Duration("refresh", 500*time.Millisecond, "redraw interval")
+	fs.Parse(args)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l") // alternate screen, no cursor
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	t := time.NewTicker(*every)
+	defer t.Stop()
+	for {
+		os.Stdout.Write(append(frame(*addr, termWidth()), "\x1b[J"...)) // clear what's left below
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// frame renders one screen.  A daemon that isn't up yet is shown as
+// such; the next frame tries again.
+func frame(addr string, width int) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x1b[H") // overwrite in place, no flicker
+	line := func(format string, a ...any) {
+		b.WriteString(clipLine(fmt.Sprintf(format, a...), width) + "\x1b[K\r\n")
+	}
+
+	status, err := ctl.Call(addr, "status")
+	if err != nil {
+		line("clipsync — not reachable at %s: %v", addr, err)
+		return b.Bytes()
+	}
+	state, supervised, _ := strings.Cut(status, "\n")
+	line("\x1b[1mclipsync — %s\x1b[0m  %s", state, time.Now().Format("15:04:05"))
+	for _, l := range strings.Split(supervised, "\n") {
+		if l != "" {
+			line("  %s", l)
+		}
+	}
+
+	line("")
+	line("\x1b[1mTransfers\x1b[0m")
+	var xfers []clipsync.Transfer
+	if out, err := ctl.Call(addr, "transfers"); err == nil {
+		json.Unmarshal([]byte(out), &xfers)
+	}
+	if len(xfers) == 0 {
+		line("  none")
+	}
+	for _, x := range xfers {
+		arrow := "↑"
+		if x.Dir == "down" {
+			arrow = "↓"
+		}
+		line("  %s %-4s %s %s %d/%d chunks", arrow, x.Dir, x.ID, bar(x.Done, x.Total, 24), x.Done, x.Total)
+	}
+
+	line("")
+	line("\x1b[1mPeers\x1b[0m")
+	var presence struct{ Peers []clipsync.Peer }
+	if out, err := ctl.Call(addr, "presence"); err == nil {
+		json.Unmarshal([]byte(out), &presence)
+	}
+	if len(presence.Peers) == 0 {
+		line("  none heard from yet")
+	}
+	for _, p := range presence.Peers {
+		dot := "\x1b[2m○\x1b[0m"
+		if p.Online {
+			dot = "\x1b[32m●\x1b[0m"
+		}
+		line("  %s %-16s %s  %8s ago  %s", dot, printable(who(p.Name, "-")), p.ID,
+			time.Since(p.Seen).Round(time.Second), printable(strings.Join(p.Accepts, ",")))
+	}
+
+	line("")
+	line("\x1b[1mRecent clips\x1b[0m")
+	var clips []clipView
+	if out, err := ctl.Call(addr, "history"); err == nil {
+		json.Unmarshal([]byte(out), &clips)
+	}
+	if len(clips) == 0 {
+		line("  none yet")
+	}
+	for _, c := range clips {
+		arrow := "→ sent"
+		if c.Dir == "received" {
+			arrow = "← recv"
+		}
+		preview := printable(strings.NewReplacer("\r\n", "⏎", "\n", "⏎", "\t", " ").Replace(c.Text))
+		if preview == "" && c.Image != "" {
+			preview = "[image]"
+		}
+		line("  %s %s %s  %s, %s  %s", time.UnixMilli(c.At).Format("15:04:05"), arrow, printable(who(c.Name, c.Origin)),
+			c.Kind, hook.Size(c.Bytes), preview)
+	}
+	return b.Bytes()
+}
+
+func who(name, id string) string {
+	if name == "" {
+		return id
+	}
+	return name
+}
+
+// bar draws done/total as a width-cell progress bar.
+func bar(done, total, width int) string {
+	fill := 0
+	if total > 0 {
+		fill = min(width, done*width/total)
+	}
+	return "[" + strings.Repeat("█", fill) + strings.Repeat("░", width-fill) + "]"
+}
+
+// clipLine cuts s to width visible runes; escape sequences don't count.
+func clipLine(s string, width int) string {
+	var b strings.Builder
+	n, esc := 0, false
+	for _, r := range s {
+		switch {
+		case esc:
+			esc = r != 'm'
+		case r == '\x1b':
+			esc = true
+		case n == width:
+			return b.String() + "\x1b[0m"
+		default:
+			n++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// printable replaces control characters, so a copied escape sequence
+// can't drive the terminal.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return '·'
+		}
+		return r
+	}, s)
+}
+
+// termWidth is the terminal's width, else $COLUMNS, else 80.
+func termWidth() int {
+	if n := termCols(); n > 0 {
+		return n
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
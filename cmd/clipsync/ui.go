@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"clipsync/internal/ctl"
+)
+
+/*──────── web dashboard (-ui) ─────────────────────────────────*/
+// The dashboard is a static page plus /api/<cmd>, which forwards to the
+// control socket, so it can do nothing the CLI can't.  It only listens
+// on loopback, and commands that change anything must be POSTs that
+// carry X-Clipsync: other sites can't send that header, and a page
+// rebound to our address fails the Host check.
+
+//go:embed ui.html
+var uiPage []byte
+
+// uiCommands are the control commands the page may use, and whether
+// each needs a POST.
+var uiCommands = map[string]bool{
+	"status": false, "conn": false, "presence": false, "acks": false, "history": false,
+	"pause": true, "resume": true, "resend": true, "repush": true, "forget": true,
+	"pin": true, "unpin": true,
+}
+
+func serveUI(ctx context.Context, addr, ctlAddr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if !loopback(host) {
+		return fmt.Errorf("-ui %s: the dashboard only listens on loopback", addr)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src data:; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+		w.Write(uiPage)
+	})
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		cmd := strings.TrimPrefix(r.URL.Path, "/api/")
+		post, ok := uiCommands[cmd]
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+			return
+		case !loopback(host):
+			http.Error(w, "bad Host", http.StatusForbidden)
+			return
+		case post && (r.Method != http.MethodPost || r.Header.Get("X-Clipsync") != "1"):
+			http.Error(w, "POST with X-Clipsync: 1", http.StatusMethodNotAllowed)
+			return
+		}
+		args := []string{cmd}
+		if id := r.URL.Query().Get("id"); id != "" {
+			args = append(args, id)
+		}
+		out, err := ctl.Call(ctlAddr, args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, out)
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Printf("%s dashboard on http://%s/", ts(), addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
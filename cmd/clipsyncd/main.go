@@ -0,0 +1,187 @@
+// Command clipsyncd is a self-hosted relay for clipsync's HTTP polling
+// transport: the reference server of internal/server behind a listener,
+// with its snapshots kept in memory, in a directory, in a BoltDB file or
+// in Redis.
+//
+//	clipsyncd -listen :5002 -key <same -key as the clients> -store dir:/var/lib/clipsyncd
+//
+// Clients point -http at http://host:5002/clip (ws:// with -transport
+// ws).  Serve TLS itself with -tls-cert or a Let's Encrypt certificate
+// (-acme-domain), and with -client-ca mutual TLS, or put a reverse
+// proxy in front of it, for anything beyond a trusted network.  With TLS, -quic adds HTTP/3 on
+// the same port over UDP, for clients started with -quic, and
+// -noise-key answers WS clients started with -noise.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/acme"
+	"clipsync/internal/kdf"
+	netw "clipsync/internal/net"
+	"clipsync/internal/pki"
+	"clipsync/internal/server"
+	"clipsync/internal/store"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func main() {
+	listen := flag.String("listen", ":5002", "address to serve the poll protocol on")
+	key := flag.String("key", "", "shared key, as the clients' -key: 16 hex characters or a passphrase")
+	storeSpec := flag.String("store", "memory", "where snapshots live between restarts: memory, dir:<path>, bolt:<path>, or a redis:// / rediss:// URL")
+	rate := flag.Float64("rate", 0, "requests per second allowed per device; 0 = unlimited")
+	burst := flag.Int("burst", 0, "requests per device allowed back to back above -rate (default 2s worth)")
+	bandwidth := flag.String("bandwidth", "0", "bytes per second allowed per device, up plus down, e.g. 512KiB; 0 = unlimited")
+	adminToken := flag.String("admin-token", "", "bearer token for the admin API under /admin/ (or $CLIPSYNCD_ADMIN_TOKEN); empty = no admin API")
+	devTokens := flag.Bool("device-tokens", false, "refuse clients without a device token issued through the admin API (clipsync -device-token)")
+	needNonce := flag.Bool("require-nonce", true, "refuse auth tokens without a nonce, which can be replayed while fresh; false lets clients too old to send one in")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with this certificate, e.g. from clipsync cert issue -server; needs -tls-key")
+	tlsKey := flag.String("tls-key", "", "the key of -tls-cert")
+	clientCA := flag.String("client-ca", "", "with -tls-cert or -acme-domain: require client certificates signed by this CA (clipsync cert's ca.crt)")
+	acmeDomain := flag.String("acme-domain", "", "get and renew a certificate for these comma-separated names from Let's Encrypt; port 443 of each must reach -listen")
+	acmeEmail := flag.String("acme-email", "", "with -acme-domain: contact address for the CA's expiry notices")
+	acmeCache := flag.String("acme-cache", cacheDir("acme"), "with -acme-domain: where the account key and certificates are kept")
+	acmeDir := flag.String("acme-directory", acme.LetsEncrypt, "with -acme-domain: the CA's ACME directory URL, e.g. Let's Encrypt staging for trials")
+	serveQUIC := flag.Bool("quic", false, "with TLS: also serve HTTP/3 over QUIC on -listen's UDP port, accepting 0-RTT (clipsync -quic)")
+	noiseKey := flag.String("noise-key", "", "answer ws clients started with -noise, with the static key kept in this file (created if missing); empty = no Noise")
+	quiet := flag.Bool("quiet", false, "don't log every snapshot and receipt relayed")
+	flag.Parse()
+
+	if *key == "" {
+		log.Fatal("clipsyncd: -key is required")
+	}
+	keyHex, _, err := kdf.TransportKey(*key)
+	if err != nil {
+		log.Fatalf("-key: %v", err)
+	}
+	bps, err := core.ParseSize(*bandwidth)
+	if err != nil {
+		log.Fatalf("-bandwidth: %v", err)
+	}
+	st, err := openStore(*storeSpec)
+	if err != nil {
+		log.Fatalf("-store: %v", err)
+	}
+	var relayLog *log.Logger
+	if !*quiet {
+		relayLog = log.New(os.Stderr, "", 0)
+	}
+	opts := []server.Option{server.WithLimits(server.Limits{Requests: *rate, Burst: *burst, Bytes: int64(bps)})}
+	if *needNonce {
+		opts = append(opts, server.WithRequireNonce())
+	}
+	if st != nil {
+		opts = append(opts, server.WithStorage(st))
+	}
+	if *adminToken == "" {
+		*adminToken = os.Getenv("CLIPSYNCD_ADMIN_TOKEN")
+	}
+	if *adminToken != "" {
+		opts = append(opts, server.WithAdmin(*adminToken))
+	}
+	if *devTokens {
+		if *adminToken == "" {
+			log.Fatal("-device-tokens: tokens are issued through the admin API, which needs -admin-token")
+		}
+		opts = append(opts, server.WithDeviceTokens())
+	}
+	if *noiseKey != "" {
+		k, err := netw.LoadNoiseKey(*noiseKey)
+		if err != nil {
+			log.Fatalf("-noise-key: %v", err)
+		}
+		log.Printf("noise: clients pin -noise-server-key %x", k.Public)
+		opts = append(opts, server.WithNoise(k))
+	}
+	srv, err := server.New(keyHex, relayLog, opts...)
+	if err != nil {
+		log.Fatalf("clipsyncd: %v", err)
+	}
+	hs := &http.Server{Addr: *listen, Handler: srv, ReadHeaderTimeout: 10 * time.Second}
+	switch {
+	case *acmeDomain != "" && *tlsCert != "":
+		log.Fatal("-acme-domain: the certificate comes from the CA, drop -tls-cert")
+	case *acmeDomain != "":
+		m := &acme.Manager{Email: *acmeEmail, Directory: *acmeDir, Cache: store.Dir(*acmeCache), Logf: log.Printf}
+		for _, d := range strings.Split(*acmeDomain, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				m.Domains = append(m.Domains, d)
+			}
+		}
+		go m.Run(context.Background())
+		hs.TLSConfig = m.TLSConfig()
+		if *clientCA != "" {
+			if err := pki.RequireClients(hs.TLSConfig, *clientCA); err != nil {
+				log.Fatalf("-client-ca: %v", err)
+			}
+		}
+	case *tlsCert != "":
+		if hs.TLSConfig, err = pki.ServerConfig(*tlsCert, *tlsKey, *clientCA); err != nil {
+			log.Fatalf("-tls-cert: %v", err)
+		}
+	default:
+		if *clientCA != "" {
+			log.Fatal("-client-ca: needs -tls-cert or -acme-domain")
+		}
+		if *serveQUIC {
+			log.Fatal("-quic: QUIC is always encrypted, it needs -tls-cert or -acme-domain")
+		}
+		log.Printf("clipsyncd on %s, snapshots in %s", *listen, *storeSpec)
+		log.Fatal(hs.ListenAndServe())
+	}
+	mode := "TLS"
+	if *clientCA != "" {
+		mode = "mutual TLS"
+	}
+	if *serveQUIC {
+		h3 := &http3.Server{Addr: *listen, Handler: srv, TLSConfig: http3.ConfigureTLSConfig(hs.TLSConfig),
+			QUICConfig: &quic.Config{Allow0RTT: true}}
+		go func() { log.Fatalf("-quic: %v", h3.ListenAndServe()) }()
+		mode += ", HTTP/3"
+	}
+	log.Printf("clipsyncd on %s (%s), snapshots in %s", *listen, mode, *storeSpec)
+	log.Fatal(hs.ListenAndServeTLS("", ""))
+}
+
+// cacheDir is name under clipsyncd's cache directory.
+func cacheDir(name string) string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(d, "clipsyncd", name)
+}
+
+// openStore reads -store; nil is memory.
+func openStore(spec string) (store.Storage, error) {
+	switch {
+	case spec == "memory" || spec == "":
+		return nil, nil
+	case strings.HasPrefix(spec, "dir:"):
+		dir := strings.TrimPrefix(spec, "dir:")
+		if dir == "" {
+			return nil, errors.New("dir: needs a path")
+		}
+		return store.Dir(dir), nil
+	case strings.HasPrefix(spec, "bolt:"):
+		path := strings.TrimPrefix(spec, "bolt:")
+		if path == "" {
+			return nil, errors.New("bolt: needs a path")
+		}
+		return store.OpenBolt(path)
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		return netw.NewRedisStorage(spec, "clipsyncd")
+	}
+	return nil, errors.New("want memory, dir:<path>, bolt:<path> or a redis:// URL")
+}
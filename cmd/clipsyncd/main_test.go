@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	netw "clipsync/internal/net"
+	"clipsync/internal/server"
+	"clipsync/internal/store"
+)
+
+// A clip posted to a server on -store bolt:<path> is there after a
+// restart on the same file.
+func TestBoltStoreSurvivesRestart(t *testing.T) {
+	const key = "0123456789abcdef"
+	path := filepath.Join(t.TempDir(), "state", "clipsyncd.db")
+	n := uint64(0)
+	do := func(srv *server.Server, method, body string) string {
+		req := httptest.NewRequest(method, "/clip", strings.NewReader(body))
+		n++
+		tok, _ := netw.AuthTokenNonce(key, time.Now().Unix(), "0123abcd", n)
+		req.Header.Set("X-Auth-Token", tok)
+		req.Header.Set("X-Room", "r")
+		if method == "POST" {
+			req.Header.Set("X-Inline", "1")
+			req.Header.Set("X-Chunk-Id", "c1")
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	start := func() (*server.Server, *store.Bolt) {
+		st, err := openStore("bolt:" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv, err := server.New(key, nil, server.WithStorage(st), server.WithRequireNonce())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return srv, st.(*store.Bolt)
+	}
+
+	srv, st := start()
+	do(srv, "POST", `{"origin":"aaaaaaaa"}`)
+	st.Close()
+
+	srv, st = start()
+	defer st.Close()
+	if b := do(srv, "GET", ""); !strings.Contains(b, `"cid":"c1"`) {
+		t.Fatalf("after restart: %s", b)
+	}
+	if _, err := openStore("bolt:"); err == nil {
+		t.Fatal("bolt: without a path accepted")
+	}
+}
@@ -0,0 +1,111 @@
+// Package a11y makes clipsync's text easy to follow with a screen
+// reader: the icons log lines and status output lead with become words,
+// any other emoji or pictograph is dropped, and notifications come in
+// three lengths.
+package a11y
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+/*──────── plain text ─────────────────────────────────────────*/
+
+// words replaces the icons clipsync prints with what they mean.  Longer
+// keys come first, so "local →" wins over "→".
+var words = strings.NewReplacer(
+	"local →", "read local clipboard, format",
+	"remote ←", "applied remote clip, format",
+	"🖳", "clipboard:",
+	"↗", "network:",
+	"🛰", "received:",
+	"✍️", "signing:",
+	"✍", "signing:",
+	"🔑", "key:",
+	"🔒", "encryption:",
+	"🎬", "starting:",
+	"⏸", "paused:",
+	"⏻", "",
+	"↻", "restart:",
+	"✓", "success:",
+	"✗", "failure:",
+	"→", " to ",
+	"←", " from ",
+	"↔", " and ",
+	"↑", "up",
+	"↓", "down",
+	"…", "...",
+)
+
+// Plain rewrites s for a screen reader: icons as words, other symbols
+// gone, runs of spaces collapsed.
+func Plain(s string) string {
+	s = words.Replace(s)
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == '️' || r == '‍' || (unicode.Is(unicode.So, r) && r > 0x2000) {
+			continue // emoji, dingbats, their joiners and variation selectors
+		}
+		if r == ' ' {
+			if space {
+				continue
+			}
+			space = true
+		} else {
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Writer passes everything written through Plain; for log.SetOutput,
+// which writes a line at a time.
+func Writer(w io.Writer) io.Writer { return plainWriter{w} }
+
+type plainWriter struct{ w io.Writer }
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, Plain(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+/*──────── verbosity ──────────────────────────────────────────*/
+
+// Verbosity is how much a notification says.  The zero value is
+// Normal.
+type Verbosity int
+
+const (
+	Brief  Verbosity = -1 // who sent a clip, nothing more
+	Normal Verbosity = 0  // kind, size and sender
+	Full   Verbosity = 1  // also every format and the time
+)
+
+// ParseVerbosity reads "brief", "normal" or "full".
+func ParseVerbosity(s string) (Verbosity, error) {
+	switch strings.ToLower(s) {
+	case "brief":
+		return Brief, nil
+	case "normal", "":
+		return Normal, nil
+	case "full":
+		return Full, nil
+	}
+	return Normal, fmt.Errorf("verbosity %q: want brief, normal or full", s)
+}
+
+func (v Verbosity) String() string {
+	switch v {
+	case Brief:
+		return "brief"
+	case Full:
+		return "full"
+	}
+	return "normal"
+}
@@ -0,0 +1,42 @@
+package a11y
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestPlain(t *testing.T) {
+	for in, want := range map[string]string{
+		"12:00:00.000 🖳 local → 13 (2 items)":               "12:00:00.000 clipboard: read local clipboard, format 13 (2 items)",
+		"12:00:00.000 🛰  remote ← 13 (1 items) from laptop": "12:00:00.000 received: applied remote clip, format 13 (1 items) from laptop",
+		"12:00:00.000 ✍️ snapshots signed":                  "12:00:00.000 signing: snapshots signed",
+		"⏻  shutting down…":                                 " shutting down...",
+		"party 🎉🎉 time":                                     "party time",
+		"Windows ↔ Windows":                                 "Windows and Windows",
+	} {
+		if got := Plain(in); got != want {
+			t.Errorf("Plain(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWriterForLogs(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.New(Writer(&buf), "", 0)
+	l.Printf("%s sync paused (%s)", "⏸ ", "control")
+	if got := buf.String(); got != "paused: sync paused (control)\n" {
+		t.Fatalf("log line %q", got)
+	}
+}
+
+func TestParseVerbosity(t *testing.T) {
+	for _, v := range []Verbosity{Brief, Normal, Full} {
+		if got, err := ParseVerbosity(v.String()); err != nil || got != v {
+			t.Errorf("ParseVerbosity(%q) = %v, %v", v, got, err)
+		}
+	}
+	if _, err := ParseVerbosity("chatty"); err == nil {
+		t.Error("ParseVerbosity accepted chatty")
+	}
+}
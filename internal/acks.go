@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*──────── delivery receipts ───────────────────────────────────*/
+// Acks tracks which devices confirmed each of our last n sends.
+type Acks struct {
+	mu   sync.Mutex
+	n    int
+	keys []string                        // oldest first
+	sent map[string]time.Time            // key → send time
+	to   map[string]string               // key → the one device it was sent to (Snapshot.To)
+	got  map[string]map[string]time.Time // key → device → ack time
+}
+
+func NewAcks(n int) *Acks {
+	return &Acks{
+		n:    n,
+		sent: make(map[string]time.Time),
+		to:   make(map[string]string),
+		got:  make(map[string]map[string]time.Time),
+	}
+}
+
+// Sent starts tracking key, forgetting the oldest beyond n.
+func (a *Acks) Sent(key string, now time.Time) { a.SentTo(key, "", now) }
+
+// SentTo is Sent for a snapshot addressed to one device ("" = all).
+func (a *Acks) SentTo(key, to string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.sent[key]; ok {
+		return
+	}
+	a.keys = append(a.keys, key)
+	a.sent[key] = now
+	if to != "" {
+		a.to[key] = to
+	}
+	a.got[key] = make(map[string]time.Time)
+	if len(a.keys) > a.n {
+		old := a.keys[0]
+		a.keys = a.keys[1:]
+		delete(a.sent, old)
+		delete(a.to, old)
+		delete(a.got, old)
+	}
+}
+
+// Target is the device key was addressed to, "" if every peer.
+func (a *Acks) Target(key string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.to[key]
+}
+
+// Applied is how many of the tracked sends device confirmed, of how
+// many, and when it last confirmed one.
+func (a *Acks) Applied(device string) (n, of int, last time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, k := range a.keys {
+		if to := a.to[k]; to != "" && to != device {
+			continue // not meant for device
+		}
+		of++
+		if at, ok := a.got[k][device]; ok {
+			n++
+			if at.After(last) {
+				last = at
+			}
+		}
+	}
+	return n, of, last
+}
+
+// Ack records device's receipt of key and returns the delivery latency;
+// ok is false if key is not one of ours (or already forgotten), or if
+// device already acked it.
+func (a *Acks) Ack(key, device string, now time.Time) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t0, ok := a.sent[key]
+	if !ok {
+		return 0, false
+	}
+	if _, dup := a.got[key][device]; dup {
+		return 0, false
+	}
+	a.got[key][device] = now
+	return now.Sub(t0), true
+}
+
+// Status lists recent sends, newest first, with the devices that acked.
+// A send addressed to one device says so, and a device that applied it
+// without being the one is flagged: a peer too old to know addressing.
+func (a *Acks) Status() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var b strings.Builder
+	for i := len(a.keys) - 1; i >= 0; i-- {
+		k := a.keys[i]
+		to := a.to[k]
+		devs := make([]string, 0, len(a.got[k]))
+		for d, at := range a.got[k] {
+			ms := at.Sub(a.sent[k]).Milliseconds()
+			if to != "" && d != to {
+				devs = append(devs, fmt.Sprintf("%s(+%dms, not addressed)", d, ms))
+			} else {
+				devs = append(devs, fmt.Sprintf("%s(+%dms)", d, ms))
+			}
+		}
+		sort.Strings(devs)
+		if len(devs) == 0 {
+			devs = append(devs, "unconfirmed")
+		}
+		if to != "" {
+			fmt.Fprintf(&b, "%s %s to %s: %s\n", a.sent[k].Format("15:04:05"), k, to, strings.Join(devs, " "))
+		} else {
+			fmt.Fprintf(&b, "%s %s %s\n", a.sent[k].Format("15:04:05"), k, strings.Join(devs, " "))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
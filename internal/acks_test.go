@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcksTrackAndForget(t *testing.T) {
+	a := NewAcks(2)
+	t0 := time.Now()
+	a.Sent("k1", t0)
+	if d, ok := a.Ack("k1", "peer1", t0.Add(40*time.Millisecond)); !ok || d != 40*time.Millisecond {
+		t.Fatalf("ack k1: %v %v", d, ok)
+	}
+	if _, ok := a.Ack("k1", "peer1", t0); ok {
+		t.Fatalf("repeated ack reported twice")
+	}
+	if _, ok := a.Ack("other", "peer1", t0); ok {
+		t.Fatalf("ack for a key we never sent accepted")
+	}
+	a.Sent("k2", t0)
+	a.Sent("k3", t0) // pushes k1 out
+	if _, ok := a.Ack("k1", "peer2", t0); ok {
+		t.Fatalf("k1 should have been forgotten")
+	}
+	st := a.Status()
+	if !strings.Contains(st, "k3 unconfirmed") || strings.Contains(st, "k1") {
+		t.Fatalf("unexpected status:\n%s", st)
+	}
+}
+
+func TestAckKeyStable(t *testing.T) {
+	s := Snapshot{TS: 7, Items: []Item{{Payload: "aGk="}}}
+	if AckKey(s) != AckKey(s) || !strings.HasSuffix(AckKey(s), "-7") {
+		t.Fatalf("AckKey: %q", AckKey(s))
+	}
+}
+
+func TestAcksAddressed(t *testing.T) {
+	a := NewAcks(4)
+	t0 := time.Now()
+	a.Sent("all", t0)
+	a.SentTo("one", "laptop", t0)
+	if a.Target("one") != "laptop" || a.Target("all") != "" {
+		t.Fatalf("targets %q %q", a.Target("one"), a.Target("all"))
+	}
+	a.Ack("all", "laptop", t0.Add(10*time.Millisecond))
+	a.Ack("all", "phone", t0.Add(20*time.Millisecond))
+	a.Ack("one", "laptop", t0.Add(30*time.Millisecond))
+	a.Ack("one", "phone", t0.Add(40*time.Millisecond)) // doesn't know To
+
+	if n, of, last := a.Applied("laptop"); n != 2 || of != 2 || !last.Equal(t0.Add(30*time.Millisecond)) {
+		t.Fatalf("laptop applied %d of %d, last %v", n, of, last)
+	}
+	if n, of, _ := a.Applied("phone"); n != 1 || of != 1 {
+		t.Fatalf("phone applied %d of %d", n, of)
+	}
+	st := a.Status()
+	if !strings.Contains(st, "one to laptop: laptop(+30ms) phone(+40ms, not addressed)") ||
+		!strings.Contains(st, "all laptop(+10ms) phone(+20ms)") {
+		t.Fatalf("report:\n%s", st)
+	}
+}
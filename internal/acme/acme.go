@@ -0,0 +1,553 @@
+// Package acme obtains and renews TLS certificates from an ACME CA
+// (RFC 8555; Let's Encrypt unless told otherwise) for clipsyncd
+// -acme-domain.  It answers the tls-alpn-01 challenge (RFC 8737) on the
+// server's own TLS listener, so nothing but that port has to be
+// reachable, though for Let's Encrypt that port must be 443.  The
+// account key and the certificates are kept in a store.Storage, so a
+// restart doesn't ask the CA again.
+//
+// Only what one relay needs is here: one account, one certificate for
+// a fixed list of names, ECDSA P-256 throughout.
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"clipsync/internal/store"
+)
+
+// LetsEncrypt is the production directory of Let's Encrypt.
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+const (
+	// RenewBefore is how long before expiry a certificate is renewed.
+	RenewBefore = 30 * 24 * time.Hour
+	// CheckEvery is how often Run looks at the expiry date.
+	CheckEvery = 12 * time.Hour
+
+	alpnProto = "acme-tls/1"
+	ns        = "acme" // in Cache
+)
+
+// pollEvery is the wait between looks at a pending authorization or
+// order; tests shorten it.
+var pollEvery = time.Second
+
+// idPeAcmeIdentifier marks a tls-alpn-01 challenge certificate.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// Manager keeps a certificate for Domains, from Directory, in Cache.
+// Serve with TLSConfig and keep Run going.
+type Manager struct {
+	Domains    []string
+	Email      string        // the CA's contact for expiry notices; optional
+	Directory  string        // "" = LetsEncrypt
+	Cache      store.Storage // required
+	Logf       func(format string, a ...any)
+	HTTPClient *http.Client // nil = http.DefaultClient
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+	chal map[string]*tls.Certificate // domain → tls-alpn-01 answer
+}
+
+// TLSConfig serves the managed certificate, and the challenge answers
+// to the CA's validation handshakes.  Those get a config of their own,
+// so asking clients for certificates on this one doesn't fail them.
+func (m *Manager) TLSConfig() *tls.Config {
+	challenge := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{alpnProto},
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", alpnProto},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if slices.Contains(hello.SupportedProtos, alpnProto) {
+				return challenge, nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+// GetCertificate is tls.Config's hook.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.Contains(hello.SupportedProtos, alpnProto) {
+		if c := m.chal[strings.ToLower(hello.ServerName)]; c != nil {
+			return c, nil
+		}
+		return nil, fmt.Errorf("acme: no challenge pending for %q", hello.ServerName)
+	}
+	if m.cert == nil {
+		return nil, errors.New("acme: no certificate yet")
+	}
+	return m.cert, nil
+}
+
+// Run loads the cached certificate, gets one if there is none or it is
+// due, and then keeps it renewed until ctx is done.  Failures are
+// logged and retried, backing off to an hour.
+func (m *Manager) Run(ctx context.Context) {
+	if err := m.load(); err != nil {
+		m.logf("acme: cache: %v", err)
+	}
+	retry := time.Minute
+	for {
+		wait := CheckEvery
+		if m.due(time.Now()) {
+			if err := m.renew(ctx); err != nil {
+				m.logf("acme: %s: %v; trying again in %v", strings.Join(m.Domains, ", "), err, retry)
+				wait, retry = retry, min(2*retry, time.Hour)
+			} else {
+				retry = time.Minute
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (m *Manager) logf(format string, a ...any) {
+	if m.Logf != nil {
+		m.Logf(format, a...)
+	}
+}
+
+// due reports whether there is no certificate, or it expires within
+// RenewBefore.
+func (m *Manager) due(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cert == nil || now.Add(RenewBefore).After(m.cert.Leaf.NotAfter)
+}
+
+func (m *Manager) certKeys() (cert, key string) {
+	name := strings.ToLower(m.Domains[0])
+	return name + ".crt", name + ".key"
+}
+
+// load reads a certificate for the same names back from Cache.
+func (m *Manager) load() error {
+	ck, kk := m.certKeys()
+	chain, err := m.Cache.Get(ns, ck)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	key, err := m.Cache.Get(ns, kk)
+	if err != nil {
+		return err
+	}
+	c, err := keyPair(chain, key)
+	if err != nil {
+		return err
+	}
+	have, want := slices.Clone(c.Leaf.DNSNames), slices.Clone(m.Domains)
+	slices.Sort(have)
+	slices.Sort(want)
+	if !slices.Equal(have, want) {
+		return nil // -acme-domain changed: a new certificate
+	}
+	m.mu.Lock()
+	m.cert = c
+	m.mu.Unlock()
+	return nil
+}
+
+func keyPair(chain, key []byte) (*tls.Certificate, error) {
+	c, err := tls.X509KeyPair(chain, key)
+	if err != nil {
+		return nil, err
+	}
+	if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+/*──────── issuance ────────────────────────────────────────────*/
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type  string   `json:"type"`
+	URL   string   `json:"url"`
+	Token string   `json:"token"`
+	Error *problem `json:"error"`
+}
+
+// renew orders a certificate for Domains, answers its challenges and
+// keeps the result.
+func (m *Manager) renew(ctx context.Context) error {
+	c, err := m.account(ctx)
+	if err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+	var ids []map[string]string
+	for _, d := range m.Domains {
+		ids = append(ids, map[string]string{"type": "dns", "value": d})
+	}
+	var o order
+	resp, err := c.post(ctx, c.dir.NewOrder, map[string]any{"identifiers": ids}, &o)
+	if err != nil {
+		return fmt.Errorf("new order: %w", err)
+	}
+	orderURL := resp.Header.Get("Location")
+	for _, u := range o.Authorizations {
+		if err := m.authorize(ctx, c, u); err != nil {
+			return err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: m.Domains[0]}, DNSNames: m.Domains}, key)
+	if err != nil {
+		return err
+	}
+	if _, err := c.post(ctx, o.Finalize, map[string]string{"csr": b64(csr)}, &o); err != nil {
+		return fmt.Errorf("finalize: %w", err)
+	}
+	for tries := 0; o.Status != "valid"; tries++ {
+		if o.Status == "invalid" || tries == 60 {
+			return fmt.Errorf("order %s: %v", o.Status, o.Error)
+		}
+		if err := sleep(ctx, pollEvery); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, orderURL, nil, &o); err != nil {
+			return fmt.Errorf("order: %w", err)
+		}
+	}
+	var chain []byte
+	if _, err := c.post(ctx, o.Certificate, nil, &chain); err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	cert, err := keyPair(chain, keyPEM)
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	ck, kk := m.certKeys()
+	if err := m.Cache.Put(ns, kk, keyPEM); err != nil {
+		return err
+	}
+	if err := m.Cache.Put(ns, ck, chain); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	m.logf("acme: certificate for %s, valid until %s", strings.Join(m.Domains, ", "), cert.Leaf.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+// authorize answers the tls-alpn-01 challenge of one authorization and
+// waits for the CA to be satisfied.
+func (m *Manager) authorize(ctx context.Context, c *client, url string) error {
+	var a authorization
+	if _, err := c.post(ctx, url, nil, &a); err != nil {
+		return fmt.Errorf("authorization: %w", err)
+	}
+	if a.Status == "valid" {
+		return nil // still valid from an earlier order
+	}
+	domain := a.Identifier.Value
+	i := slices.IndexFunc(a.Challenges, func(ch challenge) bool { return ch.Type == "tls-alpn-01" })
+	if i < 0 {
+		return fmt.Errorf("%s: the CA offers no tls-alpn-01 challenge", domain)
+	}
+	ch := a.Challenges[i]
+	answer, err := challengeCert(domain, ch.Token+"."+c.thumbprint())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.chal == nil {
+		m.chal = make(map[string]*tls.Certificate)
+	}
+	m.chal[strings.ToLower(domain)] = answer
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.chal, strings.ToLower(domain))
+		m.mu.Unlock()
+	}()
+
+	if _, err := c.post(ctx, ch.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("%s: challenge: %w", domain, err)
+	}
+	for tries := 0; a.Status != "valid"; tries++ {
+		if a.Status == "invalid" || tries == 60 {
+			var why *problem
+			for _, ch := range a.Challenges {
+				if ch.Error != nil {
+					why = ch.Error
+				}
+			}
+			return fmt.Errorf("%s: authorization %s: %v (is port 443 reaching this server?)", domain, a.Status, why)
+		}
+		if err := sleep(ctx, pollEvery); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, url, nil, &a); err != nil {
+			return fmt.Errorf("authorization: %w", err)
+		}
+	}
+	return nil
+}
+
+// challengeCert is the self-signed certificate RFC 8737 wants served
+// for domain: it carries the SHA-256 of the key authorization.
+func challengeCert(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	ext, _ := asn1.Marshal(sum[:])
+	now := time.Now()
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: domain},
+		DNSNames:        []string{domain},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: idPeAcmeIdentifier, Critical: true, Value: ext}},
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: domain}}, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+/*──────── the ACME session (JWS over HTTPS) ───────────────────*/
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// problem is an RFC 7807 error from the CA.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *problem) Error() string {
+	return strings.TrimPrefix(p.Type, "urn:ietf:params:acme:error:") + ": " + p.Detail
+}
+
+type client struct {
+	hc    *http.Client
+	key   *ecdsa.PrivateKey
+	kid   string // account URL; "" until registered
+	dir   directory
+	nonce string
+}
+
+// account loads or makes the account key and registers it (the CA
+// hands back the existing account for a known key).
+func (m *Manager) account(ctx context.Context) (*client, error) {
+	c := &client{hc: m.HTTPClient}
+	if c.hc == nil {
+		c.hc = http.DefaultClient
+	}
+	b, err := m.Cache.Get(ns, "account.key")
+	if errors.Is(err, store.ErrNotFound) {
+		c.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, _ := x509.MarshalPKCS8PrivateKey(c.key)
+		err = m.Cache.Put(ns, "account.key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	} else if err == nil {
+		err = errors.New("account.key is not an ECDSA key")
+		if blk, _ := pem.Decode(b); blk != nil {
+			if k, perr := x509.ParsePKCS8PrivateKey(blk.Bytes); perr == nil {
+				if ek, ok := k.(*ecdsa.PrivateKey); ok {
+					c.key, err = ek, nil
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dirURL := m.Directory
+	if dirURL == "" {
+		dirURL = LetsEncrypt
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", dirURL, nil)
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&c.dir); err != nil || c.dir.NewOrder == "" {
+		return nil, fmt.Errorf("directory %s: %v", dirURL, err)
+	}
+
+	acct := map[string]any{"termsOfServiceAgreed": true}
+	if m.Email != "" {
+		acct["contact"] = []string{"mailto:" + m.Email}
+	}
+	resp, err = c.post(ctx, c.dir.NewAccount, acct, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.kid = resp.Header.Get("Location")
+	return c, nil
+}
+
+// post sends payload (nil for POST-as-GET) signed with the account key
+// and decodes the reply into out: JSON, or the raw body for *[]byte.
+// A stale nonce is retried.
+func (c *client) post(ctx context.Context, url string, payload, out any) (*http.Response, error) {
+	body := []byte{}
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	for tries := 0; ; tries++ {
+		if c.nonce == "" {
+			req, _ := http.NewRequestWithContext(ctx, "HEAD", c.dir.NewNonce, nil)
+			resp, err := c.hc.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+			c.nonce = resp.Header.Get("Replay-Nonce")
+		}
+		jws, err := c.sign(url, body)
+		if err != nil {
+			return nil, err
+		}
+		req, _ := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(jws)))
+		req.Header.Set("Content-Type", "application/jose+json")
+		resp, err := c.hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		c.nonce = resp.Header.Get("Replay-Nonce")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 400 {
+			p := &problem{Type: resp.Status, Detail: string(raw)}
+			json.Unmarshal(raw, p)
+			if p.Type == "urn:ietf:params:acme:error:badNonce" && tries < 3 {
+				continue
+			}
+			return nil, p
+		}
+		switch o := out.(type) {
+		case nil:
+		case *[]byte:
+			*o = raw
+		default:
+			if err := json.Unmarshal(raw, out); err != nil {
+				return nil, fmt.Errorf("%s: %w", url, err)
+			}
+		}
+		return resp, nil
+	}
+}
+
+// sign wraps payload in a flattened JWS (RFC 7515) with ES256: the
+// account's JWK until it is registered, its URL after.
+func (c *client) sign(url string, payload []byte) ([]byte, error) {
+	hdr := map[string]any{"alg": "ES256", "nonce": c.nonce, "url": url}
+	if c.kid == "" {
+		hdr["jwk"] = c.jwk()
+	} else {
+		hdr["kid"] = c.kid
+	}
+	h, _ := json.Marshal(hdr)
+	protected, body := b64(h), b64(payload)
+	sum := sha256.Sum256([]byte(protected + "." + body))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return json.Marshal(map[string]string{"protected": protected, "payload": body, "signature": b64(sig)})
+}
+
+// jwk is the account's public key as RFC 7638 orders it for the
+// thumbprint.
+func (c *client) jwk() json.RawMessage {
+	var x, y [32]byte
+	c.key.X.FillBytes(x[:])
+	c.key.Y.FillBytes(y[:])
+	return json.RawMessage(`{"crv":"P-256","kty":"EC","x":"` + b64(x[:]) + `","y":"` + b64(y[:]) + `"}`)
+}
+
+func (c *client) thumbprint() string {
+	sum := sha256.Sum256(c.jwk())
+	return b64(sum[:])
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
@@ -0,0 +1,259 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"clipsync/internal/store"
+)
+
+// fakeCA is just enough of an ACME server: it checks JWS signatures
+// and nonces, validates tls-alpn-01 by dialling target, and signs CSRs.
+type fakeCA struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	target string // the manager's TLS listener
+
+	mu       sync.Mutex
+	nonces   map[string]bool
+	account  *ecdsa.PublicKey
+	thumb    string
+	orders   int
+	badNonce bool // refuse the next order's nonce once
+	authz    map[string]string
+	polled   int // order polls after finalize
+	issued   []byte
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	f := &fakeCA{t: t, nonces: map[string]bool{}, authz: map[string]string{}, badNonce: true}
+	f.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "fake CA"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &f.key.PublicKey, f.key)
+	f.cert, _ = x509.ParseCertificate(der)
+	f.srv = httptest.NewTLSServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeCA) nonce(w http.ResponseWriter) {
+	n := fmt.Sprint(len(f.nonces), time.Now().UnixNano())
+	f.nonces[n] = true
+	w.Header().Set("Replay-Nonce", n)
+}
+
+func (f *fakeCA) fail(w http.ResponseWriter, typ string, code int) {
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"type":"urn:ietf:params:acme:error:%s","detail":"fake"}`, typ)
+}
+
+func (f *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.srv.URL
+	f.nonce(w)
+	switch {
+	case r.URL.Path == "/dir":
+		fmt.Fprintf(w, `{"newNonce":"%s/nonce","newAccount":"%s/account","newOrder":"%s/order"}`, u, u, u)
+		return
+	case r.URL.Path == "/nonce":
+		return
+	}
+
+	var jws struct{ Protected, Payload, Signature string }
+	json.NewDecoder(r.Body).Decode(&jws)
+	dec := func(s string) []byte { b, _ := base64.RawURLEncoding.DecodeString(s); return b }
+	var hdr struct {
+		Nonce, URL, Kid string
+		JWK             struct{ X, Y string }
+	}
+	json.Unmarshal(dec(jws.Protected), &hdr)
+	if !f.nonces[hdr.Nonce] || (r.URL.Path == "/order" && f.badNonce) {
+		f.badNonce = false
+		f.fail(w, "badNonce", http.StatusBadRequest)
+		return
+	}
+	delete(f.nonces, hdr.Nonce)
+	pub := f.account
+	if hdr.Kid == "" {
+		pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(dec(hdr.JWK.X)), Y: new(big.Int).SetBytes(dec(hdr.JWK.Y))}
+	}
+	sum := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	sig := dec(jws.Signature)
+	if pub == nil || hdr.URL != u+r.URL.Path || len(sig) != 64 ||
+		!ecdsa.Verify(pub, sum[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		f.fail(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	payload := dec(jws.Payload)
+
+	switch path := r.URL.Path; {
+	case path == "/account":
+		f.account = pub
+		f.thumb = b64(sha256Of(fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, hdr.JWK.X, hdr.JWK.Y)))
+		w.Header().Set("Location", u+"/acct/1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"status":"valid"}`)
+
+	case path == "/order":
+		f.orders++
+		var req struct{ Identifiers []struct{ Value string } }
+		json.Unmarshal(payload, &req)
+		var authz []string
+		for _, id := range req.Identifiers {
+			f.authz[id.Value] = "pending"
+			authz = append(authz, fmt.Sprintf(`"%s/authz/%s"`, u, id.Value))
+		}
+		w.Header().Set("Location", u+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"status":"pending","authorizations":[%s],"finalize":"%s/finalize/1"}`, strings.Join(authz, ","), u)
+
+	case strings.HasPrefix(path, "/authz/"):
+		d := strings.TrimPrefix(path, "/authz/")
+		fmt.Fprintf(w, `{"status":"%s","identifier":{"type":"dns","value":"%s"},"challenges":[`+
+			`{"type":"http-01","url":"%s/nope","token":"x"},{"type":"tls-alpn-01","url":"%s/chal/%s","token":"tok-%s"}]}`,
+			f.authz[d], d, u, u, d, d)
+
+	case strings.HasPrefix(path, "/chal/"):
+		d := strings.TrimPrefix(path, "/chal/")
+		f.authz[d] = "invalid"
+		conn, err := tls.Dial("tcp", f.target, &tls.Config{ServerName: d, NextProtos: []string{"acme-tls/1"}, InsecureSkipVerify: true})
+		if err == nil {
+			st := conn.ConnectionState()
+			conn.Close()
+			want, _ := asn1.Marshal(sha256Of("tok-" + d + "." + f.thumb))
+			for _, e := range st.PeerCertificates[0].Extensions {
+				if e.Id.Equal(idPeAcmeIdentifier) && e.Critical && bytes.Equal(e.Value, want) && st.NegotiatedProtocol == "acme-tls/1" {
+					f.authz[d] = "valid"
+				}
+			}
+		}
+		fmt.Fprint(w, `{}`)
+
+	case path == "/finalize/1":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		csr, err := x509.ParseCertificateRequest(dec(req.CSR))
+		if err != nil {
+			f.fail(w, "badCSR", http.StatusBadRequest)
+			return
+		}
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: csr.Subject, DNSNames: csr.DNSNames,
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(0, 0, 90),
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+		der, _ := x509.CreateCertificate(rand.Reader, tmpl, f.cert, csr.PublicKey, f.key)
+		f.issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.cert.Raw})...)
+		fmt.Fprint(w, `{"status":"processing"}`)
+
+	case path == "/order/1":
+		if f.polled++; f.polled < 2 {
+			fmt.Fprint(w, `{"status":"processing"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"valid","certificate":"%s/cert/1"}`, u)
+
+	case path == "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(f.issued)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func sha256Of(s string) []byte { sum := sha256.Sum256([]byte(s)); return sum[:] }
+
+func TestObtainsAndCachesCertificate(t *testing.T) {
+	pollEvery = 10 * time.Millisecond
+	ca := newFakeCA(t)
+	cache := store.Memory()
+	m := &Manager{Domains: []string{"relay.test", "alt.relay.test"}, Directory: ca.srv.URL + "/dir",
+		Cache: cache, HTTPClient: ca.srv.Client()}
+
+	// as with clipsyncd -client-ca: challenges must still get through
+	tc := m.TLSConfig()
+	tc.ClientAuth = tls.RequireAnyClientCert
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "ok") }))
+	defer ln.Close()
+	ca.target = ln.Addr().String()
+
+	if !m.due(time.Now()) {
+		t.Fatal("no certificate yet, but not due")
+	}
+	if err := m.renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	var seen *x509.Certificate
+	for _, name := range m.Domains {
+		conn, err := tls.Dial("tcp", ca.target, &tls.Config{RootCAs: roots, ServerName: name,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return m.GetCertificate(&tls.ClientHelloInfo{}) // any certificate will do here
+			}})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		seen = conn.ConnectionState().PeerCertificates[0]
+		conn.Close()
+	}
+	if seen.Issuer.CommonName != "fake CA" {
+		t.Fatalf("served a certificate from %q", seen.Issuer.CommonName)
+	}
+
+	again := &Manager{Domains: []string{"relay.test", "alt.relay.test"}, Directory: ca.srv.URL + "/dir", Cache: cache}
+	if err := again.load(); err != nil {
+		t.Fatal(err)
+	}
+	if again.due(time.Now()) || ca.orders != 1 {
+		t.Fatalf("cached certificate not reused (%d orders)", ca.orders)
+	}
+	if !again.due(time.Now().AddDate(0, 0, 61)) {
+		t.Fatal("not due 29 days before expiry")
+	}
+	other := &Manager{Domains: []string{"new.relay.test"}, Cache: cache}
+	if other.load(); !other.due(time.Now()) {
+		t.Fatal("certificate for other names reused")
+	}
+}
+
+func TestChallengeFailureReported(t *testing.T) {
+	pollEvery = 10 * time.Millisecond
+	ca := newFakeCA(t)
+	m := &Manager{Domains: []string{"relay.test"}, Directory: ca.srv.URL + "/dir",
+		Cache: store.Memory(), HTTPClient: ca.srv.Client()}
+	ca.target = "127.0.0.1:1" // nothing listening: validation fails
+	err := m.renew(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "authorization invalid") {
+		t.Fatalf("renew: %v", err)
+	}
+}
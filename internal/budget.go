@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*──────── per-format size budgets ─────────────────────────────*/
+// A budget caps the size of one format's items as they are read from
+// the clipboard: "image/png=8MiB:convert,text=1MiB,files=100MiB".  The
+// key is a format key (FormatKey, "*" suffix as in caps), a class name
+// (ClassText, ClassImage, ClassFiles) or "*" for everything else.  An
+// item over budget is dropped ("skip", the default), made to fit
+// ("convert": text is cut short, images are shrunk) where that is
+// possible and dropped where it is not, or sent only if the user says so
+// ("ask").
+
+// Budget policies.
+const (
+	BudgetSkip    = "skip"
+	BudgetConvert = "convert"
+	BudgetAsk     = "ask"
+)
+
+// Budget is one key's limit.
+type Budget struct {
+	Key    string
+	Max    int // bytes
+	Policy string
+}
+
+// Budgets are matched most specific first: an exact format key, then
+// the longest "*" pattern, then the item's class, then "*".
+type Budgets []Budget
+
+// ParseBudgets reads the comma-separated form above; "" is no budgets.
+func ParseBudgets(spec string) (Budgets, error) {
+	var bs Budgets
+	for _, f := range strings.Split(spec, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("budget %q: want format=size[:policy]", f)
+		}
+		size, policy, _ := strings.Cut(val, ":")
+		if policy == "" {
+			policy = BudgetSkip
+		}
+		if policy != BudgetSkip && policy != BudgetConvert && policy != BudgetAsk {
+			return nil, fmt.Errorf("budget %q: policy must be skip, convert or ask", f)
+		}
+		n, err := ParseSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("budget %q: %w", f, err)
+		}
+		bs = append(bs, Budget{Key: strings.TrimSpace(key), Max: n, Policy: policy})
+	}
+	return bs, nil
+}
+
+// For returns the budget that applies to it, if any.
+func (bs Budgets) For(it Item) (Budget, bool) {
+	key, class := FormatKey(it), FormatClass(it)
+	best, rank := Budget{}, 0
+	for _, b := range bs {
+		r := 0
+		switch {
+		case b.Key == key:
+			r = 1 << 20
+		case b.Key == "*":
+			r = 1
+		case strings.HasSuffix(b.Key, "*") && capMatch(b.Key, key):
+			r = 3 + len(b.Key)
+		case b.Key == class && class != "":
+			r = 2
+		}
+		if r > rank {
+			best, rank = b, r
+		}
+	}
+	return best, rank > 0
+}
+
+// Max is the largest budget, 0 if there are none.
+func (bs Budgets) Max() int {
+	m := 0
+	for _, b := range bs {
+		m = max(m, b.Max)
+	}
+	return m
+}
+
+var sizeUnits = []struct {
+	suffix string
+	n      int
+}{
+	{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1},
+}
+
+// ParseSize reads a byte count such as 1048576, 1MiB or 1.5MB.
+func ParseSize(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	unit := 1
+	for _, u := range sizeUnits {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, unit = strings.TrimSpace(num), u.n
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return int(f * float64(unit)), nil
+}
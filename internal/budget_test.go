@@ -0,0 +1,52 @@
+package internal
+
+import "testing"
+
+func TestParseBudgets(t *testing.T) {
+	bs, err := ParseBudgets("image/png=8MiB:convert, text=1.5KB ,raw:*=10,*=2GiB:skip,files=100MiB:ask")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Budgets{
+		{"image/png", 8 << 20, BudgetConvert},
+		{"text", 1500, BudgetSkip},
+		{"raw:*", 10, BudgetSkip},
+		{"*", 2 << 30, BudgetSkip},
+		{"files", 100 << 20, BudgetAsk},
+	}
+	if len(bs) != len(want) {
+		t.Fatalf("got %+v", bs)
+	}
+	for i := range want {
+		if bs[i] != want[i] {
+			t.Errorf("budget %d: got %+v, want %+v", i, bs[i], want[i])
+		}
+	}
+	for _, bad := range []string{"image/png", "text=lots", "text=1MiB:squash", "text=-1"} {
+		if _, err := ParseBudgets(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestBudgetsForPicksMostSpecific(t *testing.T) {
+	bs, _ := ParseBudgets("*=1,image=2,raw:*=3,raw:HTML*=4,text/plain=5")
+	for _, c := range []struct {
+		it   Item
+		want int
+	}{
+		{Item{MimeType: "text/plain"}, 5},
+		{Item{MimeType: "text/html"}, 1}, // no text class budget
+		{Item{MimeType: "image/jpeg"}, 2},
+		{Item{MimeType: "application/x-clipboard-format", FmtName: "HTML Format"}, 4},
+		{Item{MimeType: "application/x-clipboard-format", FmtName: "Biff8"}, 3},
+		{Item{Fmt: 99}, 1},
+	} {
+		if b, ok := bs.For(c.it); !ok || b.Max != c.want {
+			t.Errorf("%s: got %+v", FormatKey(c.it), b)
+		}
+	}
+	if _, ok := Budgets(nil).For(Item{MimeType: "text/plain"}); ok {
+		t.Errorf("no budgets matched")
+	}
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+/*──────── capability negotiation ─────────────────────────────*/
+// Devices broadcast the formats they can put on their clipboard as a
+// KindCaps snapshot (Snapshot.Caps).  Senders then skip items no live
+// peer can consume.  A format is named by FormatKey; a trailing "*" in
+// a capability matches any suffix ("raw:*" = every passthrough format).
+
+// KindCaps carries the sender's capability list in Snapshot.Caps.
+const KindCaps = "caps"
+
+// FormatKey is the capability name of an item's format.
+func FormatKey(it Item) string {
+	switch {
+	case it.MimeType == "application/x-clipboard-format":
+		return "raw:" + it.FmtName
+	case it.MimeType != "":
+		return it.MimeType
+	}
+	return "fmt:" + strconv.FormatUint(uint64(it.Fmt), 10)
+}
+
+// Format classes, for users who only want some kinds of clip synced.
+const (
+	ClassText  = "text"
+	ClassImage = "image"
+	ClassFiles = "files"
+)
+
+// fileFormats are the Windows formats Explorer puts on a file copy.
+var fileFormats = map[string]bool{
+	"raw:FileName": true, "raw:FileNameW": true, "raw:Shell IDList Array": true,
+	"raw:FileGroupDescriptor": true, "raw:FileGroupDescriptorW": true, "raw:FileContents": true,
+}
+
+// FormatClass sorts an item into ClassText, ClassImage or ClassFiles;
+// "" for anything else (app-specific passthrough formats).
+func FormatClass(it Item) string { return KeyClass(FormatKey(it)) }
+
+// KeyClass is FormatClass for a format key, as carried in Caps.
+func KeyClass(key string) string {
+	switch {
+	case key == "text/uri-list" || fileFormats[key]:
+		return ClassFiles
+	case strings.HasPrefix(key, "text/"), key == "raw:HTML Format", key == "raw:Rich Text Format":
+		return ClassText
+	case strings.HasPrefix(key, "image/"):
+		return ClassImage
+	}
+	return ""
+}
+
+func capMatch(pattern, key string) bool {
+	if p, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(key, p)
+	}
+	return pattern == key
+}
+
+// Caps remembers what each peer accepts, and what it calls itself.  A
+// peer counts as live (online) for ttl after its last announcement;
+// Purge forgets it for good.
+type Caps struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	peers map[string]peerCaps
+	names map[string]string // Snapshot.Name, from caps and data alike
+}
+
+type peerCaps struct {
+	formats []string
+	seen    time.Time
+}
+
+func NewCaps(ttl time.Duration) *Caps {
+	return &Caps{ttl: ttl, peers: make(map[string]peerCaps), names: make(map[string]string)}
+}
+
+// SetName records the name origin goes by; "" changes nothing.
+func (c *Caps) SetName(origin, name string) {
+	if name == "" {
+		return
+	}
+	c.mu.Lock()
+	c.names[origin] = name
+	c.mu.Unlock()
+}
+
+// Who is origin for people: "name (id)", or the id while its name is
+// unknown.
+func (c *Caps) Who(origin string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := c.names[origin]; n != "" {
+		return n + " (" + origin + ")"
+	}
+	return origin
+}
+
+// Update records origin's formats; it reports whether origin was new
+// (or had expired), so the caller can answer with its own list.
+func (c *Caps) Update(origin string, formats []string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, ok := c.peers[origin]
+	c.peers[origin] = peerCaps{formats: formats, seen: now}
+	return !ok || now.Sub(old.seen) > c.ttl
+}
+
+// Filter drops items that no live peer accepts.  With no live peer
+// known (old peers never announce) everything is kept.
+func (c *Caps) Filter(items []Item, now time.Time) []Item {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var live [][]string
+	for _, p := range c.peers {
+		if now.Sub(p.seen) <= c.ttl {
+			live = append(live, p.formats)
+		}
+	}
+	if len(live) == 0 {
+		return items
+	}
+	var kept []Item
+	for _, it := range items {
+		key := FormatKey(it)
+	peers:
+		for _, formats := range live {
+			for _, f := range formats {
+				if capMatch(f, key) {
+					kept = append(kept, it)
+					break peers
+				}
+			}
+		}
+	}
+	return kept
+}
+
+// Purge forgets peers not heard from in maxAge and returns how many.
+func (c *Caps) Purge(now time.Time, maxAge time.Duration) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for id, p := range c.peers {
+		if now.Sub(p.seen) > maxAge {
+			delete(c.peers, id)
+			delete(c.names, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Peer is one remembered device, as List reports it.
+type Peer struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name,omitempty"`
+	Online  bool      `json:"online"` // announced within the ttl
+	Seen    time.Time `json:"seen"`
+	Accepts []string  `json:"accepts"`
+}
+
+// List is the remembered peers, most recently seen first.
+func (c *Caps) List(now time.Time) []Peer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Peer, 0, len(c.peers))
+	for id, p := range c.peers {
+		out = append(out, Peer{ID: id, Name: c.names[id], Online: now.Sub(p.seen) <= c.ttl, Seen: p.seen, Accepts: p.formats})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seen.After(out[j].Seen) })
+	return out
+}
+
+// Peers is List as a table: id, name, online or offline, how long ago
+// it was heard from and what it accepts.
+func (c *Caps) Peers(now time.Time) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, p := range c.List(now) {
+		name, state := p.Name, "online"
+		if name == "" {
+			name = "-"
+		}
+		if !p.Online {
+			state = "offline"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\n", p.ID, name, state, now.Sub(p.Seen).Round(time.Second), strings.Join(p.Accepts, ","))
+	}
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
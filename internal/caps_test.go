@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCapsFilter(t *testing.T) {
+	c := NewCaps(time.Minute)
+	now := time.Now()
+	items := []Item{
+		{MimeType: "text/plain"},
+		{MimeType: "image/png"},
+		{MimeType: "application/x-clipboard-format", FmtName: "Rich Text Format"},
+	}
+	if got := c.Filter(items, now); len(got) != 3 {
+		t.Fatalf("no peers known: everything must pass, got %d", len(got))
+	}
+	if !c.Update("phone", []string{"text/plain"}, now) {
+		t.Fatalf("first caps from phone should be new")
+	}
+	if got := c.Filter(items, now); len(got) != 1 || got[0].MimeType != "text/plain" {
+		t.Fatalf("phone only takes text, got %+v", got)
+	}
+	c.Update("desk", []string{"image/png", "raw:*"}, now)
+	if got := c.Filter(items, now); len(got) != 3 {
+		t.Fatalf("desk takes the rest, got %d", len(got))
+	}
+	// desk expires; phone refreshed
+	c.Update("phone", []string{"text/plain"}, now.Add(50*time.Second))
+	if got := c.Filter(items, now.Add(90*time.Second)); len(got) != 1 {
+		t.Fatalf("expired peer still counted, got %d", len(got))
+	}
+	c.SetName("phone", "Pixel")
+	lines := strings.Split(c.Peers(now.Add(90*time.Second)), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[0]), " ") != "phone Pixel online 40s ago text/plain" ||
+		!strings.HasPrefix(strings.Join(strings.Fields(lines[1]), " "), "desk - offline 1m30s ago") {
+		t.Fatalf("peers: %q", lines)
+	}
+	if c.Who("phone") != "Pixel (phone)" || c.Who("desk") != "desk" {
+		t.Fatalf("who: %q, %q", c.Who("phone"), c.Who("desk"))
+	}
+	if n := c.Purge(now.Add(90*time.Second), time.Minute); n != 1 || strings.Contains(c.Peers(now), "desk") {
+		t.Fatalf("purged %d, left %q", n, c.Peers(now))
+	}
+}
+
+func TestFormatKey(t *testing.T) {
+	for want, it := range map[string]Item{
+		"text/plain": {Fmt: 13, MimeType: "text/plain"},
+		"raw:HTML":   {MimeType: "application/x-clipboard-format", FmtName: "HTML"},
+		"fmt:2":      {Fmt: 2},
+	} {
+		if got := FormatKey(it); got != want {
+			t.Errorf("FormatKey(%+v) = %q, want %q", it, got, want)
+		}
+	}
+}
+
+func TestFormatClass(t *testing.T) {
+	for want, it := range map[string]Item{
+		ClassText:  {MimeType: "application/x-clipboard-format", FmtName: "HTML Format"},
+		ClassImage: {MimeType: "image/jpeg"},
+		ClassFiles: {MimeType: "application/x-clipboard-format", FmtName: "FileNameW"},
+		"":         {MimeType: "application/x-clipboard-format", FmtName: "Art::GVML ClipFormat"},
+	} {
+		if got := FormatClass(it); got != want {
+			t.Errorf("FormatClass(%+v) = %q, want %q", it, got, want)
+		}
+	}
+}
@@ -4,17 +4,20 @@ package clip
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"image"
+	"image/jpeg"
 	"image/png"
 	"runtime"
 	"time"
 	"unsafe"
 
 	core "clipsync/internal"
+	"clipsync/internal/persist"
+	"clipsync/internal/webp"
 
 	"golang.org/x/sys/windows"
 )
@@ -33,6 +36,8 @@ var (
 	procRegisterClipboardFormatW = user32.NewProc("RegisterClipboardFormatW")
 	procEnumClipboardFormats     = user32.NewProc("EnumClipboardFormats")
 	procGetClipboardSequenceNum  = user32.NewProc("GetClipboardSequenceNumber")
+	procGetClipboardOwner        = user32.NewProc("GetClipboardOwner")
+	procSendMessageTimeoutW      = user32.NewProc("SendMessageTimeoutW")
 
 	procGlobalAlloc  = kernel32.NewProc("GlobalAlloc")
 	procGlobalLock   = kernel32.NewProc("GlobalLock")
@@ -49,20 +54,21 @@ const (
 var (
 	fmtIDPng      uint32
 	fmtIDImagePng uint32
+	fmtIDJfif     uint32
+	fmtIDWebP     uint32
+	fmtIDURL      uint32 // ANSI
+	fmtIDURLW     uint32 // UTF-16
 )
 
 func init() {
 	fmtIDPng = regFormat("PNG")
 	fmtIDImagePng = regFormat("image/png")
+	fmtIDJfif = regFormat("JFIF")
+	fmtIDWebP = regFormat("image/webp")
+	fmtIDURL = regFormat("UniformResourceLocator")
+	fmtIDURLW = regFormat("UniformResourceLocatorW")
 }
 
-/*────── errors ───────────────────────────────────────────────*/
-var (
-	ErrClipboardBusy     = errors.New("clipboard busy")
-	ErrUnsupportedFormat = errors.New("unsupported clipboard format")
-	ErrBadDIB            = errors.New("malformed DIB")
-)
-
 /*────── API struct (build─tag windows) ─────────────────────*/
 type ReqKind uint8
 
@@ -83,26 +89,72 @@ type Resp struct {
 	Err   error
 }
 
+/*────── read-side limits ─────────────────────────────────────*/
+type Options struct {
+	MaxItemBytes int // drop items larger than this (0 = no limit)
+	MaxPixels    int // downscale images above this many pixels (0 = never)
+
+	TextFileBytes int // paste received text above this as a .txt file (0 = off)
+
+	JPEGQuality   int // re-encode photographic images as JPEG (0 = keep PNG)
+	WebPQuality   int // ...or as WebP, which wins if both are set
+	LossyMinBytes int // ...but only PNGs larger than this
+
+	Passthrough bool // also carry every registered custom format verbatim
+}
+
+var opts Options // set once by Configure, read only by the clip thread
+
 /*────── thread entry-point ──────────────────────────────────*/
 // StartThread runs a goroutine that owns the clipboard.
 // Returns the request channel.
-func StartThread() chan<- Req {
+func StartThread(o Options) chan<- Req {
+	Configure(o)
 	ch := make(chan Req)
-	go clipThread(ch)
+	go Serve(context.Background(), ch)
 	return ch
 }
 
-func clipThread(in <-chan Req) {
+// Configure sets the options; call it before the first Serve.
+func Configure(o Options) { opts = o }
+
+// Serve owns the clipboard on a locked OS thread, answering requests
+// from in until ctx ends.  A panic inside a read or write is answered as
+// an error and returned, so a supervisor can run Serve again (on a
+// fresh thread: the locked one exits with this goroutine).
+func Serve(ctx context.Context, in <-chan Req) (err error) {
 	runtime.LockOSThread() // critical
-	for req := range in {
+	var cur *Req
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("clip thread panic: %v", r)
+			if cur != nil {
+				cur.Resp <- Resp{Err: err}
+			}
+		}
+	}()
+	for {
+		var req Req
+		select {
+		case <-ctx.Done():
+			runtime.UnlockOSThread()
+			return nil
+		case req = <-in:
+		}
+		cur = &req
+		if !Accessible() {
+			req.Resp <- Resp{Err: ErrNoDesktop}
+			continue
+		}
 		switch req.Kind {
 		case ReqRead:
 			items, err := readSnapshot()
 			req.Resp <- Resp{Items: items, Err: err}
 		case ReqWrite:
-			err := writeSnapshot(req.WriteData)
+			err := writeVerified(req.WriteData)
 			req.Resp <- Resp{Err: err}
 		}
+		cur = nil
 	}
 }
 
@@ -146,8 +198,39 @@ func writeSnapshot(items []core.Item) error {
 		}
 		payload, _ := base64.StdEncoding.DecodeString(it.Payload)
 
+		if it.MimeType == MimeRaw {
+			if opts.Passthrough {
+				putRaw(it.FmtName, payload)
+			}
+			continue
+		}
+		if it.MimeType == "image/jpeg" { // registered IDs differ per machine
+			if err := putJPEG(payload); err != nil {
+				return err
+			}
+			continue
+		}
+		if it.MimeType == "image/webp" {
+			if err := putWebP(payload); err != nil {
+				return err
+			}
+			continue
+		}
+		if it.MimeType == core.MimeURIList {
+			if uris, ok := core.URIs(payload); ok {
+				putURL(uris[0])
+			}
+			continue
+		}
+
 		switch it.Fmt {
 		case CF_UNICODETEXT:
+			if opts.TextFileBytes > 0 && len(payload) > opts.TextFileBytes && persist.Enabled() {
+				if err := putTextAsFile(string(payload)); err != nil {
+					return err
+				}
+				continue
+			}
 			if err := putText(string(payload)); err != nil {
 				return err
 			}
@@ -160,6 +243,94 @@ func writeSnapshot(items []core.Item) error {
 	return nil
 }
 
+/*────── write, then read it back ─────────────────────────────*/
+
+// writeVerified is writeSnapshot plus a read-back of what it wrote: a
+// clipboard manager or another sync tool may replace the clipboard in
+// the moment between.  It writes once more if so, then gives up with
+// ErrOverwritten.
+func writeVerified(items []core.Item) error {
+	for try := 0; ; try++ {
+		if err := writeSnapshot(items); err != nil {
+			return err
+		}
+		want, got, err := readBack(items)
+		if err != nil {
+			return err
+		}
+		if core.QuickKey(want) == core.QuickKey(got) {
+			return nil
+		}
+		if try == 1 {
+			return ErrOverwritten
+		}
+	}
+}
+
+// readBack reads every item from the format writeSnapshot put it in:
+// want is the items as they should come back, got as they did.  Items
+// whose read-back can't be predicted (text pasted as a file, text with
+// a NUL, raw formats without Passthrough) are in neither.
+func readBack(items []core.Item) (want, got []core.Item, err error) {
+	if err := openCB(); err != nil {
+		return nil, nil, err
+	}
+	defer closeCB()
+	startRender()
+
+	for _, it := range items {
+		if it.Payload == "" {
+			continue
+		}
+		payload, _ := base64.StdEncoding.DecodeString(it.Payload)
+		var back *core.Item
+		switch {
+		case it.MimeType == MimeRaw:
+			if !opts.Passthrough {
+				continue
+			}
+			back = readRaw(regFormat(it.FmtName), it.FmtName)
+		case it.MimeType == "image/jpeg":
+			back = tryFormat(fmtIDJfif, "JFIF", "image/jpeg")
+		case it.MimeType == "image/webp":
+			back = tryFormat(fmtIDWebP, "image/webp", "image/webp")
+		case it.Fmt == CF_UNICODETEXT:
+			if opts.TextFileBytes > 0 && len(payload) > opts.TextFileBytes && persist.Enabled() ||
+				bytes.IndexByte(payload, 0) >= 0 {
+				continue
+			}
+			payload = []byte(string([]rune(string(payload)))) // bad UTF-8 comes back as U+FFFD
+			back = readText()
+		case it.Fmt == fmtIDPng || it.Fmt == fmtIDImagePng:
+			back = tryFormat(fmtIDPng, "PNG", "image/png")
+		default:
+			continue // writeSnapshot skipped it
+		}
+		var data []byte
+		if back != nil {
+			data, _ = base64.StdEncoding.DecodeString(back.Payload)
+			if len(data) > len(payload) {
+				data = data[:len(payload)] // GlobalSize may round up
+			}
+		}
+		id := core.Item{Fmt: it.Fmt, FmtName: it.FmtName}
+		id.Payload = base64.StdEncoding.EncodeToString(payload)
+		want = append(want, id)
+		id.Payload = base64.StdEncoding.EncodeToString(data)
+		got = append(got, id)
+	}
+	return want, got, nil
+}
+
+// Accepts lists the formats writeSnapshot can apply, as FormatKeys.
+func Accepts() []string {
+	caps := []string{"text/plain", "image/png", "image/jpeg", "image/webp", core.MimeURIList}
+	if opts.Passthrough {
+		caps = append(caps, "raw:*")
+	}
+	return caps
+}
+
 // putPNG places a PNG on the clipboard (both CF_DIB and custom formats).
 func putPNG(data []byte) error {
 	img, err := png.Decode(bytes.NewReader(data))
@@ -187,6 +358,39 @@ func putPNG(data []byte) error {
 	return nil
 }
 
+// putJPEG places a JPEG as CF_DIB plus the raw "JFIF" format.
+func putJPEG(data []byte) error {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procSetClipboardData.Call(CF_DIB, hFromBytes(ImageToDIB(img)))
+	if ret == 0 {
+		return windows.GetLastError()
+	}
+	if fmtIDJfif != 0 {
+		procSetClipboardData.Call(uintptr(fmtIDJfif), hFromBytes(data))
+	}
+	return nil
+}
+
+// putWebP places a WebP as CF_DIB plus the raw "image/webp" format
+// browsers read.
+func putWebP(data []byte) error {
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procSetClipboardData.Call(CF_DIB, hFromBytes(ImageToDIB(img)))
+	if ret == 0 {
+		return windows.GetLastError()
+	}
+	if fmtIDWebP != 0 {
+		procSetClipboardData.Call(uintptr(fmtIDWebP), hFromBytes(data))
+	}
+	return nil
+}
+
 // putText places UTF-16 text on the clipboard.
 func putText(s string) error {
 	utf16, _ := windows.UTF16FromString(s)
@@ -203,16 +407,39 @@ func putText(s string) error {
 	return nil
 }
 
+// putURL places uri the way browsers put a link: as
+// UniformResourceLocatorW and, if it is plain ASCII, as the ANSI
+// UniformResourceLocator too.  Best effort: the text goes with it.
+func putURL(uri string) {
+	utf16, _ := windows.UTF16FromString(uri)
+	wide := make([]byte, 2*len(utf16))
+	for i, u := range utf16 {
+		binary.LittleEndian.PutUint16(wide[2*i:], u)
+	}
+	if fmtIDURLW != 0 {
+		procSetClipboardData.Call(uintptr(fmtIDURLW), hFromBytes(wide))
+	}
+	for _, r := range uri {
+		if r >= 0x80 {
+			return
+		}
+	}
+	if fmtIDURL != 0 {
+		procSetClipboardData.Call(uintptr(fmtIDURL), hFromBytes(append([]byte(uri), 0)))
+	}
+}
+
 /*────── read snapshot ────────────────────────────────────────*/
 func readSnapshot() ([]core.Item, error) {
 	if err := openCB(); err != nil {
 		return nil, err
 	}
 	defer closeCB()
+	startRender()
 
 	var items []core.Item
 
-	// prioritize PNG formats
+	// prioritize PNG formats; each one that won't render falls through
 	if it := tryFormat(fmtIDPng, "PNG", "image/png"); it != nil {
 		items = append(items, *it)
 	} else if it := tryFormat(fmtIDImagePng, "image/png", "image/png"); it != nil {
@@ -230,15 +457,170 @@ func readSnapshot() ([]core.Item, error) {
 		}
 	}
 
+	// app-specific formats (Excel, Photoshop, …) by name
+	if opts.Passthrough {
+		items = append(items, readRawFormats()...)
+	}
+
+	if len(items) == 0 && rd.missed > 0 {
+		return nil, ErrNotRendered
+	}
 	if len(items) == 0 {
 		return nil, ErrUnsupportedFormat
 	}
-	return items, nil
+	return fitItems(items)
+}
+
+/*────── delayed rendering ───────────────────────────────────*/
+// An owner may put a format on the clipboard with no data and render it
+// only when asked: GetClipboardData then sends it WM_RENDERFORMAT and
+// waits.  Excel and Photoshop do this for everything.  A busy owner
+// makes the call fail, a hung one makes it block, so getData retries
+// failures until the read's render budget is spent, and the read skips
+// the owner altogether when it doesn't answer a WM_NULL in time.
+const (
+	renderBudget = 500 * time.Millisecond // per read, across all formats
+	hungAfter    = 200 * time.Millisecond // owner ping before reading
+
+	WM_NULL          = 0x0000
+	SMTO_ABORTIFHUNG = 0x0002
+)
+
+// rd is the current read's render state; only the clip thread uses it.
+var rd struct {
+	until  time.Time
+	hung   bool // owner didn't answer the ping: don't ask it to render
+	missed int  // formats advertised that never rendered
+}
+
+func startRender() {
+	rd.until, rd.missed = time.Now().Add(renderBudget), 0
+	rd.hung = ownerHung()
+}
+
+// ownerHung pings the clipboard owner's window.  No owner (an emptied
+// clipboard, or our own write) is never hung.
+func ownerHung() bool {
+	owner, _, _ := procGetClipboardOwner.Call()
+	if owner == 0 {
+		return false
+	}
+	var res uintptr
+	ret, _, _ := procSendMessageTimeoutW.Call(owner, WM_NULL, 0, 0,
+		SMTO_ABORTIFHUNG, uintptr(hungAfter/time.Millisecond), uintptr(unsafe.Pointer(&res)))
+	return ret == 0
+}
+
+// getData is GetClipboardData with retries for delayed rendering; 0 if
+// the format isn't there or didn't render within the budget.
+func getData(f uint32) uintptr {
+	if f == 0 || !isAvail(f) {
+		return 0
+	}
+	if rd.hung {
+		rd.missed++
+		return 0
+	}
+	for {
+		if h, _, _ := procGetClipboardData.Call(uintptr(f)); h != 0 {
+			return h
+		}
+		if time.Now().After(rd.until) {
+			rd.missed++
+			return 0
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// fitItems shrinks oversized PNGs and drops anything still above the cap.
+func fitItems(items []core.Item) ([]core.Item, error) {
+	kept := items[:0]
+	for _, it := range items {
+		if isPNGItem(it) && opts.MaxPixels > 0 {
+			raw, _ := base64.StdEncoding.DecodeString(it.Payload)
+			if small := ShrinkPNG(raw, opts.MaxPixels); len(small) != len(raw) {
+				it.Payload = base64.StdEncoding.EncodeToString(small)
+				it.ByteLen = len(small)
+			}
+		}
+		if isPNGItem(it) && opts.WebPQuality > 0 && it.ByteLen > opts.LossyMinBytes {
+			raw, _ := base64.StdEncoding.DecodeString(it.Payload)
+			if wp := PNGToWebP(raw, opts.WebPQuality); wp != nil {
+				it = core.Item{
+					Fmt:      fmtIDWebP,
+					FmtName:  "image/webp",
+					MimeType: "image/webp",
+					Payload:  base64.StdEncoding.EncodeToString(wp),
+					ByteLen:  len(wp),
+				}
+			}
+		}
+		if isPNGItem(it) && opts.JPEGQuality > 0 && it.ByteLen > opts.LossyMinBytes {
+			raw, _ := base64.StdEncoding.DecodeString(it.Payload)
+			if jpg := PNGToJPEG(raw, opts.JPEGQuality); jpg != nil {
+				it = core.Item{
+					Fmt:      fmtIDJfif,
+					FmtName:  "JFIF",
+					MimeType: "image/jpeg",
+					Payload:  base64.StdEncoding.EncodeToString(jpg),
+					ByteLen:  len(jpg),
+				}
+			}
+		}
+		if opts.MaxItemBytes > 0 && it.ByteLen > opts.MaxItemBytes {
+			continue
+		}
+		kept = append(kept, it)
+	}
+	if len(kept) == 0 {
+		return nil, ErrTooLarge
+	}
+	return kept, nil
+}
+
+func isPNGItem(it core.Item) bool {
+	return it.MimeType == "image/png"
+}
+
+// FitImage shrinks a PNG or JPEG item to at most limit bytes, for
+// "convert" size budgets: fewer pixels each round, as JPEG when the
+// image is photographic.  false if it can't be decoded or won't fit.
+func FitImage(it core.Item, limit int) (core.Item, bool) {
+	raw, err := base64.StdEncoding.DecodeString(it.Payload)
+	if err != nil {
+		return it, false
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return it, false
+	}
+	px, size := img.Bounds().Dx()*img.Bounds().Dy(), len(raw)
+	for round := 0; round < 8 && px > 1; round++ {
+		px = int(float64(px) * min(0.9, 0.9*float64(limit)/float64(size)))
+		out := encodePNG(Downscale(img, px))
+		if out == nil {
+			return it, false
+		}
+		fit := core.Item{Fmt: fmtIDPng, FmtName: "PNG", MimeType: "image/png"}
+		if isPNGItem(it) {
+			fit.Fmt, fit.FmtName = it.Fmt, it.FmtName
+		}
+		if jpg := PNGToJPEG(out, 85); jpg != nil {
+			out = jpg
+			fit = core.Item{Fmt: fmtIDJfif, FmtName: "JFIF", MimeType: "image/jpeg"}
+		}
+		if size = len(out); size <= limit {
+			fit.Payload, fit.ByteLen = base64.StdEncoding.EncodeToString(out), size
+			return fit, true
+		}
+	}
+	return it, false
 }
 
 // readDIBAsPNG converts CF_DIB -> PNG.
 func readDIBAsPNG() *core.Item {
-	h, _, _ := procGetClipboardData.Call(CF_DIB)
+	h := getData(CF_DIB)
 	if h == 0 {
 		return nil
 	}
@@ -249,7 +631,11 @@ func readDIBAsPNG() *core.Item {
 	dib := make([]byte, size)
 	copy(dib, (*[1 << 30]byte)(p)[:size])
 
-	png := DIBToPNG(dib)
+	img := dibToRGBA(dib)
+	if img == nil {
+		return nil
+	}
+	png := encodePNG(Downscale(img, opts.MaxPixels))
 	if png == nil {
 		return nil
 	}
@@ -264,7 +650,7 @@ func readDIBAsPNG() *core.Item {
 }
 
 func readText() *core.Item {
-	h, _, _ := procGetClipboardData.Call(CF_UNICODETEXT)
+	h := getData(CF_UNICODETEXT)
 	if h == 0 {
 		return nil
 	}
@@ -291,10 +677,7 @@ func readText() *core.Item {
 
 // tryFormat attempts to read a custom clipboard format.
 func tryFormat(fmt uint32, fmtName, mimeType string) *core.Item {
-	if fmt == 0 || !isAvail(fmt) {
-		return nil
-	}
-	h, _, _ := procGetClipboardData.Call(uintptr(fmt))
+	h := getData(fmt)
 	if h == 0 {
 		return nil
 	}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package clip
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+/*────── locked session / secure desktop detection ─────────────*/
+// While the workstation is locked or a UAC prompt owns the screen the
+// input desktop is Winlogon (or can't be opened at all) and every
+// OpenClipboard fails.  We check first and fail fast instead of
+// spinning in openCB.
+
+var (
+	procOpenInputDesktop          = user32.NewProc("OpenInputDesktop")
+	procCloseDesktop              = user32.NewProc("CloseDesktop")
+	procGetUserObjectInformationW = user32.NewProc("GetUserObjectInformationW")
+)
+
+const (
+	DESKTOP_READOBJECTS = 0x0001
+	UOI_NAME            = 2
+)
+
+// Accessible reports whether the interactive desktop is the normal
+// user desktop, i.e. the clipboard can be used right now.
+func Accessible() bool {
+	h, _, _ := procOpenInputDesktop.Call(0, 0, DESKTOP_READOBJECTS)
+	if h == 0 {
+		return false // locked, or another session owns the console
+	}
+	defer procCloseDesktop.Call(h)
+
+	var name [64]uint16
+	var need uint32
+	ret, _, _ := procGetUserObjectInformationW.Call(h, UOI_NAME,
+		uintptr(unsafe.Pointer(&name[0])), uintptr(len(name)*2),
+		uintptr(unsafe.Pointer(&need)))
+	if ret == 0 {
+		return true // can't tell; let OpenClipboard decide
+	}
+	return windows.UTF16ToString(name[:]) == "Default"
+}
@@ -0,0 +1,15 @@
+package clip
+
+import "errors"
+
+/*────── errors ───────────────────────────────────────────────*/
+// No build tag: callers on every OS can match these with errors.Is.
+var (
+	ErrClipboardBusy     = errors.New("clipboard busy")
+	ErrUnsupportedFormat = errors.New("unsupported clipboard format")
+	ErrBadDIB            = errors.New("malformed DIB")
+	ErrTooLarge          = errors.New("clipboard item over size limit")
+	ErrNoDesktop         = errors.New("clipboard unavailable: session locked or secure desktop")
+	ErrOverwritten       = errors.New("clipboard replaced by another program right after the write")
+	ErrNotRendered       = errors.New("clipboard owner didn't render its data in time")
+)
@@ -0,0 +1,65 @@
+//go:build windows
+
+package clip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"clipsync/internal/persist"
+
+	"golang.org/x/sys/windows"
+)
+
+const CF_HDROP = 15
+
+// spoolDir holds the .txt files handed out via CF_HDROP.
+var spoolDir = filepath.Join(os.TempDir(), "clipsync")
+
+// putTextAsFile writes s to a temp .txt and offers it as a file drop.
+func putTextAsFile(s string) error {
+	if err := persist.MkdirAll(spoolDir, 0o700); err != nil {
+		return err
+	}
+	pruneSpool(24 * time.Hour)
+
+	name := filepath.Join(spoolDir,
+		fmt.Sprintf("clip-%s.txt", time.Now().Format("20060102-150405.000")))
+	if err := persist.WriteFile(name, []byte(s), 0o600); err != nil {
+		return err
+	}
+
+	h := hFromBytes(dropFiles(name))
+	ret, _, _ := procSetClipboardData.Call(CF_HDROP, h)
+	if ret == 0 {
+		return windows.GetLastError()
+	}
+	return nil
+}
+
+// dropFiles builds a DROPFILES block listing one wide-char path.
+func dropFiles(path string) []byte {
+	const hdr = 20 // pFiles, pt.x, pt.y, fNC, fWide
+	utf16, _ := windows.UTF16FromString(path)
+
+	buf := make([]byte, hdr+2*len(utf16)+2) // list ends with an extra NUL
+	binary.LittleEndian.PutUint32(buf[0:4], hdr)
+	binary.LittleEndian.PutUint32(buf[16:20], 1) // fWide
+	for i, c := range utf16 {
+		binary.LittleEndian.PutUint16(buf[hdr+2*i:], c)
+	}
+	return buf
+}
+
+// pruneSpool deletes spooled files older than maxAge.
+func pruneSpool(maxAge time.Duration) {
+	ents, _ := os.ReadDir(spoolDir)
+	for _, e := range ents {
+		if fi, err := e.Info(); err == nil && time.Since(fi.ModTime()) > maxAge {
+			os.Remove(filepath.Join(spoolDir, e.Name()))
+		}
+	}
+}
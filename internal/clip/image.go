@@ -7,7 +7,12 @@ import (
     "encoding/binary"
     "image"
     "image/draw"
+    "image/jpeg"
     "image/png"
+    "io"
+    "math"
+
+    "clipsync/internal/webp"
 )
 
 /*───── ImageToDIB: converts image.Image → 40-byte DIB ───────────*/
@@ -57,6 +62,15 @@ func ImageToDIB(img image.Image) []byte {
 
 /*───── DIBToPNG: converts DIB bytes → PNG bytes ───────────────*/
 func DIBToPNG(dib []byte) []byte {
+    img := dibToRGBA(dib)
+    if img == nil {
+        return nil
+    }
+    return encodePNG(img)
+}
+
+// dibToRGBA decodes a 32-bpp DIB into an RGBA image (nil if malformed).
+func dibToRGBA(dib []byte) *image.RGBA {
     if len(dib) < 40 {
         return nil
     }
@@ -108,10 +122,128 @@ func DIBToPNG(dib []byte) []byte {
             dstRow[x*4+3] = srcRow[x*4+3] // A
         }
     }
+    return rgba
+}
 
+func encodePNG(img image.Image) []byte {
     var buf bytes.Buffer
-    if err := png.Encode(&buf, rgba); err != nil {
+    if err := png.Encode(&buf, img); err != nil {
         return nil
     }
     return buf.Bytes()
 }
+
+/*───── Downscale: box-filter resize to ≤ maxPixels ─────────────*/
+// Downscale keeps the aspect ratio; maxPixels ≤ 0 or a small image
+// returns img unchanged.
+func Downscale(img image.Image, maxPixels int) image.Image {
+    b := img.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if maxPixels <= 0 || w*h <= maxPixels {
+        return img
+    }
+    f := math.Sqrt(float64(maxPixels) / float64(w*h))
+    nw := max(1, int(float64(w)*f))
+    nh := max(1, int(float64(h)*f))
+
+    src := image.NewRGBA(image.Rect(0, 0, w, h))
+    draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+    dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+
+    for y := 0; y < nh; y++ {
+        y0, y1 := y*h/nh, max((y+1)*h/nh, y*h/nh+1)
+        for x := 0; x < nw; x++ {
+            x0, x1 := x*w/nw, max((x+1)*w/nw, x*w/nw+1)
+            var sum [4]int
+            for sy := y0; sy < y1; sy++ {
+                row := src.Pix[sy*src.Stride:]
+                for sx := x0; sx < x1; sx++ {
+                    for c := 0; c < 4; c++ {
+                        sum[c] += int(row[sx*4+c])
+                    }
+                }
+            }
+            n := (y1 - y0) * (x1 - x0)
+            d := dst.Pix[y*dst.Stride+x*4:]
+            for c := 0; c < 4; c++ {
+                d[c] = uint8(sum[c] / n)
+            }
+        }
+    }
+    return dst
+}
+
+// ShrinkPNG re-encodes a PNG above maxPixels; otherwise returns data as-is.
+func ShrinkPNG(data []byte, maxPixels int) []byte {
+    if maxPixels <= 0 {
+        return data
+    }
+    cfg, err := png.DecodeConfig(bytes.NewReader(data))
+    if err != nil || cfg.Width*cfg.Height <= maxPixels {
+        return data
+    }
+    img, err := png.Decode(bytes.NewReader(data))
+    if err != nil {
+        return data
+    }
+    if out := encodePNG(Downscale(img, maxPixels)); out != nil {
+        return out
+    }
+    return data
+}
+
+/*───── lossy path for photographic images ─────────────────────*/
+
+// PNGToJPEG re-encodes a photographic, fully opaque PNG as JPEG.
+// Returns nil for screenshots/text (few colours) or images with alpha,
+// which must stay loss-less.
+func PNGToJPEG(data []byte, quality int) []byte {
+    return toLossy(data, func(w io.Writer, img image.Image) error {
+        return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+    })
+}
+
+// PNGToWebP is PNGToJPEG for lossy WebP, smaller at the same quality.
+func PNGToWebP(data []byte, quality int) []byte {
+    return toLossy(data, func(w io.Writer, img image.Image) error {
+        return webp.Encode(w, img, quality)
+    })
+}
+
+func toLossy(data []byte, encode func(io.Writer, image.Image) error) []byte {
+    img, err := png.Decode(bytes.NewReader(data))
+    if err != nil || !isPhotographic(img) {
+        return nil
+    }
+    var buf bytes.Buffer
+    if err := encode(&buf, img); err != nil {
+        return nil
+    }
+    if buf.Len() >= len(data) {
+        return nil // no gain
+    }
+    return buf.Bytes()
+}
+
+// isPhotographic samples up to 64×64 pixels: any transparency → false;
+// otherwise photos show many distinct colours, UI screenshots few.
+func isPhotographic(img image.Image) bool {
+    b := img.Bounds()
+    stepX := max(1, b.Dx()/64)
+    stepY := max(1, b.Dy()/64)
+
+    seen := make(map[uint32]struct{})
+    n := 0
+    for y := b.Min.Y; y < b.Max.Y; y += stepY {
+        for x := b.Min.X; x < b.Max.X; x += stepX {
+            r, g, bl, a := img.At(x, y).RGBA()
+            if a != 0xffff {
+                return false
+            }
+            // quantise to 5 bits per channel so JPEG-ish noise still counts
+            seen[(r>>11)<<10|(g>>11)<<5|bl>>11] = struct{}{}
+            n++
+        }
+    }
+    return n > 0 && len(seen)*8 > n
+}
@@ -7,6 +7,7 @@ import (
 	"image"
 	"image/color"
 	"image/png"
+	"math/rand"
 	"testing"
 )
 
@@ -86,3 +87,80 @@ func TestDIBWithAlpha(t *testing.T) {
 		t.Fatalf("alpha values not preserved")
 	}
 }
+
+func TestDownscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	small := Downscale(img, 20000) // 80 000 → ≤ 20 000 pixels
+	b := small.Bounds()
+	if b.Dx()*b.Dy() > 20000 {
+		t.Fatalf("too many pixels: %v", b)
+	}
+	if b.Dx() != 2*b.Dy() {
+		t.Fatalf("aspect ratio lost: %v", b)
+	}
+	if r, _, _, a := small.At(10, 10).RGBA(); r != 0xffff || a != 0xffff {
+		t.Fatalf("pixel value not preserved")
+	}
+
+	if Downscale(img, 0) != image.Image(img) || Downscale(img, 1<<20) != image.Image(img) {
+		t.Fatalf("image below limit should be returned unchanged")
+	}
+}
+
+func TestShrinkPNG(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 300)))
+
+	out := ShrinkPNG(buf.Bytes(), 100*100)
+	cfg, err := png.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if cfg.Width != 100 || cfg.Height != 100 {
+		t.Fatalf("got %dx%d, want 100x100", cfg.Width, cfg.Height)
+	}
+	if !bytes.Equal(ShrinkPNG(buf.Bytes(), 0), buf.Bytes()) {
+		t.Fatalf("maxPixels 0 must be a no-op")
+	}
+}
+
+func TestPNGToJPEG(t *testing.T) {
+	// smooth gradients plus grain, fully opaque → photographic
+	photo := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			n := uint8(rnd.Intn(16))
+			photo.Set(x, y, color.RGBA{uint8(2*x) + n, uint8(2*y) + n, uint8(x+y) + n, 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, photo)
+	if PNGToJPEG(buf.Bytes(), 80) == nil {
+		t.Fatalf("photo should convert to JPEG")
+	}
+	if PNGToWebP(buf.Bytes(), 80) == nil {
+		t.Fatalf("photo should convert to WebP")
+	}
+
+	// flat two-colour screenshot → stays PNG
+	shot := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			c := color.RGBA{255, 255, 255, 255}
+			if x%8 == 0 {
+				c = color.RGBA{0, 0, 0, 255}
+			}
+			shot.Set(x, y, c)
+		}
+	}
+	buf.Reset()
+	png.Encode(&buf, shot)
+	if PNGToJPEG(buf.Bytes(), 80) != nil || PNGToWebP(buf.Bytes(), 80) != nil {
+		t.Fatalf("screenshot must stay PNG")
+	}
+}
@@ -0,0 +1,186 @@
+//go:build windows
+
+package clip
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+/*────── change notifications ────────────────────────────────*/
+// A hidden message-only window learns about clipboard changes as they
+// happen instead of waiting for the next GetSeq poll.  Vista+ has
+// AddClipboardFormatListener; where it's missing (or refused) we join
+// the old viewer chain with SetClipboardViewer and must then pass
+// WM_DRAWCLIPBOARD / WM_CHANGECBCHAIN on to the next viewer.
+
+var (
+	procRegisterClassExW              = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW               = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW                = user32.NewProc("DefWindowProcW")
+	procGetMessageW                   = user32.NewProc("GetMessageW")
+	procDispatchMessageW              = user32.NewProc("DispatchMessageW")
+	procPostMessageW                  = user32.NewProc("PostMessageW")
+	procSendMessageW                  = user32.NewProc("SendMessageW")
+	procPostQuitMessage               = user32.NewProc("PostQuitMessage")
+	procAddClipboardFormatListener    = user32.NewProc("AddClipboardFormatListener")
+	procRemoveClipboardFormatListener = user32.NewProc("RemoveClipboardFormatListener")
+	procSetClipboardViewer            = user32.NewProc("SetClipboardViewer")
+	procChangeClipboardChain          = user32.NewProc("ChangeClipboardChain")
+	procGetModuleHandleW              = kernel32.NewProc("GetModuleHandleW")
+)
+
+const (
+	WM_DESTROY         = 0x0002
+	WM_CLOSE           = 0x0010
+	WM_DRAWCLIPBOARD   = 0x0308
+	WM_CHANGECBCHAIN   = 0x030D
+	WM_CLIPBOARDUPDATE = 0x031D
+
+	hwndMessage = ^uintptr(2) // HWND_MESSAGE, (HWND)-3
+)
+
+type wndClassEx struct {
+	Size       uint32
+	Style      uint32
+	WndProc    uintptr
+	ClsExtra   int32
+	WndExtra   int32
+	Instance   uintptr
+	Icon       uintptr
+	Cursor     uintptr
+	Background uintptr
+	MenuName   *uint16
+	ClassName  *uint16
+	IconSm     uintptr
+}
+
+type winMsg struct {
+	Hwnd    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      struct{ X, Y int32 }
+	Private uint32
+}
+
+// state of the notify thread; only touched on that thread
+var (
+	notifyHwnd uintptr
+	notifyMode string
+	nextViewer uintptr // next window in the viewer chain
+	changed    chan struct{}
+)
+
+// Notify starts the notification thread.  It returns a channel that
+// ticks after clipboard changes and the mode in use: "listener",
+// "viewer", or "" when neither works and the caller has to poll.
+func Notify() (<-chan struct{}, string) {
+	ch := make(chan struct{}, 1)
+	mode := make(chan string)
+	go notifyThread(ch, mode)
+	m := <-mode
+	if m == "" {
+		return nil, ""
+	}
+	return ch, m
+}
+
+// StopNotify leaves the viewer chain (or drops the listener).  Call it
+// on shutdown: a viewer that just disappears breaks the chain for
+// every other viewer on the machine.
+func StopNotify() {
+	if notifyHwnd != 0 {
+		procPostMessageW.Call(notifyHwnd, WM_CLOSE, 0, 0)
+	}
+}
+
+func ping() {
+	select {
+	case changed <- struct{}{}:
+	default: // one pending tick is enough
+	}
+}
+
+func notifyProc(hwnd, msg, wp, lp uintptr) uintptr {
+	switch uint32(msg) {
+	case WM_CLIPBOARDUPDATE:
+		ping()
+		return 0
+	case WM_DRAWCLIPBOARD:
+		ping()
+		if nextViewer != 0 {
+			procSendMessageW.Call(nextViewer, msg, wp, lp)
+		}
+		return 0
+	case WM_CHANGECBCHAIN:
+		if wp == nextViewer {
+			nextViewer = lp // the window after us left; link past it
+		} else if nextViewer != 0 {
+			procSendMessageW.Call(nextViewer, msg, wp, lp)
+		}
+		return 0
+	case WM_DESTROY:
+		if notifyMode == "viewer" {
+			procChangeClipboardChain.Call(hwnd, nextViewer)
+		} else {
+			procRemoveClipboardFormatListener.Call(hwnd)
+		}
+		procPostQuitMessage.Call(0)
+		return 0
+	}
+	r, _, _ := procDefWindowProcW.Call(hwnd, msg, wp, lp)
+	return r
+}
+
+func notifyThread(ch chan struct{}, mode chan<- string) {
+	runtime.LockOSThread() // window messages go to the creating thread
+	changed = ch
+
+	inst, _, _ := procGetModuleHandleW.Call(0)
+	cls, _ := windows.UTF16PtrFromString("clipsyncNotify")
+	wc := wndClassEx{
+		WndProc:   windows.NewCallback(notifyProc),
+		Instance:  inst,
+		ClassName: cls,
+	}
+	wc.Size = uint32(unsafe.Sizeof(wc))
+	procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc)))
+	hwnd, _, _ := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(cls)), 0, 0,
+		0, 0, 0, 0, hwndMessage, 0, inst, 0)
+	if hwnd == 0 {
+		mode <- ""
+		return
+	}
+	notifyHwnd = hwnd
+
+	if procAddClipboardFormatListener.Find() == nil {
+		if ok, _, _ := procAddClipboardFormatListener.Call(hwnd); ok != 0 {
+			notifyMode = "listener"
+		}
+	}
+	if notifyMode == "" {
+		// 0 is a valid "you're first in the chain"; only an error code fails
+		next, _, err := procSetClipboardViewer.Call(hwnd)
+		if e, ok := err.(syscall.Errno); next == 0 && ok && e != 0 {
+			mode <- ""
+			return
+		}
+		nextViewer = next
+		notifyMode = "viewer"
+	}
+	mode <- notifyMode
+
+	var m winMsg
+	for {
+		r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+		if int32(r) <= 0 {
+			return
+		}
+		procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+	}
+}
@@ -0,0 +1,91 @@
+//go:build windows
+
+package clip
+
+import (
+	"encoding/base64"
+	"unsafe"
+
+	core "clipsync/internal"
+
+	"golang.org/x/sys/windows"
+)
+
+// MimeRaw tags an item carried verbatim; FmtName is the registered name.
+const MimeRaw = "application/x-clipboard-format"
+
+var procGetClipboardFormatNameW = user32.NewProc("GetClipboardFormatNameW")
+
+// skipRaw lists registered formats that are handled elsewhere or only
+// make sense inside one process (OLE plumbing, not HGLOBAL data).
+var skipRaw = map[string]bool{
+	"PNG": true, "image/png": true, "JFIF": true,
+	"DataObject": true, "Ole Private Data": true, "Object Descriptor": true,
+	"Link Source Descriptor": true, "Embed Source": true, "Link Source": true,
+	"OwnerLink": true, "ObjectLink": true, "Native": true,
+}
+
+// readRawFormats returns every registered (≥ 0xC000) format on the
+// clipboard as an opaque item.  Clipboard must already be open.
+func readRawFormats() []core.Item {
+	var items []core.Item
+	var f uintptr
+	for {
+		f, _, _ = procEnumClipboardFormats.Call(f)
+		if f == 0 {
+			break
+		}
+		if f < 0xC000 {
+			continue // predefined CF_* formats: numeric, not portable by name
+		}
+		name := formatName(uint32(f))
+		if name == "" || skipRaw[name] {
+			continue
+		}
+		if it := readRaw(uint32(f), name); it != nil {
+			items = append(items, *it)
+		}
+	}
+	return items
+}
+
+func readRaw(f uint32, name string) *core.Item {
+	h := getData(f)
+	if h == 0 {
+		return nil
+	}
+	p := lock(h)
+	if p == nil {
+		return nil // not global memory (GDI/OLE handle)
+	}
+	defer procGlobalUnlock.Call(h)
+
+	size := globalSize(h)
+	data := make([]byte, size)
+	copy(data, (*[1 << 30]byte)(p)[:size])
+
+	return &core.Item{
+		Fmt:      f,
+		FmtName:  name,
+		MimeType: MimeRaw,
+		Payload:  base64.StdEncoding.EncodeToString(data),
+		ByteLen:  size,
+	}
+}
+
+// putRaw registers the format by name locally and sets the bytes.
+func putRaw(name string, data []byte) {
+	if f := regFormat(name); f != 0 {
+		procSetClipboardData.Call(uintptr(f), hFromBytes(data))
+	}
+}
+
+func formatName(f uint32) string {
+	buf := make([]uint16, 256)
+	n, _, _ := procGetClipboardFormatNameW.Call(uintptr(f),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if n == 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf[:n])
+}
@@ -0,0 +1,609 @@
+// Package conformance checks a relay server against the protocol in
+// internal/net/server_design.md, for people writing their own.  A
+// required check that fails means this client won't work with the
+// server; an optional one reports whether the server has a feature the
+// client uses when it's there.  Checks run in a fresh random room, so
+// a server with rooms keeps its real clips; one without loses its
+// active clip, so point them at a test key.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	netw "clipsync/internal/net"
+
+	"nhooyr.io/websocket"
+)
+
+// Config says where the server is and how to talk to it.
+type Config struct {
+	URL    string       // the HTTP endpoint clients poll, e.g. http://host:5002/clip
+	WS     string       // ws:// or wss:// endpoint; "" skips the WebSocket checks
+	Key    string       // 16 hex chars, like -key
+	Room   string       // "" = a fresh random one
+	Client *http.Client // nil = one with a 10s timeout
+}
+
+// Result is one check's outcome.
+type Result struct {
+	Name     string
+	Optional bool
+	OK       bool   // passed, or for an optional check: supported
+	Detail   string // why not, or what was seen
+}
+
+func (r Result) String() string {
+	mark := map[[2]bool]string{
+		{false, true}: "ok  ", {false, false}: "FAIL",
+		{true, true}: "yes ", {true, false}: "no  ",
+	}[[2]bool{r.Optional, r.OK}]
+	if r.Detail == "" {
+		return mark + " " + r.Name
+	}
+	return fmt.Sprintf("%s %s: %s", mark, r.Name, r.Detail)
+}
+
+// Passed reports whether every required check passed.
+func Passed(rs []Result) bool {
+	for _, r := range rs {
+		if !r.Optional && !r.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// check is one entry of the battery; it returns "" on success.
+type check struct {
+	name     string
+	optional bool
+	run      func(t *tester) string
+}
+
+var battery = []check{
+	{"health ping (GET /)", false, (*tester).health},
+	{"auth: bad, stale and missing tokens get 401", false, (*tester).auth},
+	{"discover schema", false, (*tester).discoverSchema},
+	{"chunked upload and fetch", false, (*tester).chunked},
+	{"missing chunk is 404", false, (*tester).missing},
+	{"new snapshot flushes the old one (410)", false, (*tester).flushed},
+	{"300 KiB chunk cap (413)", false, (*tester).chunkCap},
+	{"changed X-Chunk-Total is rejected", false, (*tester).totalChanged},
+	{"inline snapshots (X-Inline)", true, (*tester).inline},
+	{"ranged fetch (X-Chunk-Range)", true, (*tester).ranged},
+	{"delivery acks (X-Ack)", true, (*tester).acks},
+	{"server time (X-Server-Time)", true, (*tester).serverTime},
+	{"advertised limits (max_body, max_chunk)", true, (*tester).limits},
+	{"adaptive hints (X-Hints)", true, (*tester).hints},
+	{"out-of-band blobs (/blob/<hash>)", true, (*tester).blobs},
+}
+
+var wsBattery = []check{
+	{"WebSocket fan-out", false, (*tester).wsFanOut},
+}
+
+// Run runs the whole battery and returns a result per check, in order.
+func Run(ctx context.Context, c Config) []Result {
+	t := &tester{ctx: ctx, cfg: c, cli: c.Client, room: c.Room, nonce: randHex(8)}
+	if t.cli == nil {
+		t.cli = &http.Client{Timeout: 10 * time.Second}
+	}
+	if t.room == "" {
+		t.room = "conformance-" + randHex(4)
+	}
+	checks := battery
+	if c.WS != "" {
+		checks = append(slices.Clip(battery), wsBattery...)
+	}
+	var out []Result
+	for _, ch := range checks {
+		r := Result{Name: ch.name, Optional: ch.optional}
+		if ctx.Err() != nil {
+			r.Detail = ctx.Err().Error()
+		} else {
+			r.Detail = ch.run(t)
+			r.OK = r.Detail == ""
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+/*──────── plumbing ────────────────────────────────────────────*/
+
+type tester struct {
+	ctx  context.Context
+	cfg  Config
+	cli  *http.Client
+	room string
+
+	// auth tokens carry nonce and a fresh counter n, as clients' do
+	nonce string
+	n     atomic.Uint64
+}
+
+// reply is a response with its body read.
+type reply struct {
+	code int
+	hdr  http.Header
+	body []byte
+}
+
+// do sends one request to the endpoint (or to path on its host, if
+// path is not ""), authenticated unless hdr sets X-Auth-Token itself.
+func (t *tester) do(method, path string, hdr map[string]string, body []byte) (reply, error) {
+	u := t.cfg.URL
+	if path != "" {
+		p, err := url.Parse(u)
+		if err != nil {
+			return reply{}, err
+		}
+		p.Path, p.RawQuery = path, ""
+		u = p.String()
+	}
+	req, err := http.NewRequestWithContext(t.ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return reply{}, err
+	}
+	t.authorize(req.Header, time.Now())
+	for k, v := range hdr {
+		if v == "" {
+			req.Header.Del(k)
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := t.cli.Do(req)
+	if err != nil {
+		return reply{}, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	return reply{resp.StatusCode, resp.Header, b}, err
+}
+
+func (t *tester) authorize(h http.Header, at time.Time) {
+	tok, _ := netw.AuthTokenNonce(t.cfg.Key, at.Unix(), t.nonce, t.n.Add(1))
+	h.Set("X-Auth-Token", tok)
+	h.Set("X-Device-Id", "conformance")
+	h.Set("X-Room", t.room)
+}
+
+// discover is the decoded reply to a plain GET.
+type discover struct {
+	Cid      string            `json:"cid"`
+	Total    int               `json:"total"`
+	Have     []int             `json:"have"`
+	Snap     json.RawMessage   `json:"snap"`
+	Acks     []json.RawMessage `json:"acks"`
+	MaxBody  int64             `json:"max_body"`
+	MaxChunk int64             `json:"max_chunk"`
+
+	hdr http.Header
+}
+
+func (t *tester) discover(hdr map[string]string) (discover, string) {
+	var d discover
+	r, err := t.do(http.MethodGet, "", hdr, nil)
+	if err != nil {
+		return d, err.Error()
+	}
+	if r.code != http.StatusOK {
+		return d, fmt.Sprintf("discover answered %d", r.code)
+	}
+	if err := json.Unmarshal(r.body, &d); err != nil {
+		return d, fmt.Sprintf("discover reply isn't the JSON schema: %v", err)
+	}
+	d.hdr = r.hdr
+	return d, ""
+}
+
+// upload posts chunks (idx order as given) of a snapshot cid with total
+// parts; "" if every one got a 2xx.
+func (t *tester) upload(cid string, total int, idx []int, parts [][]byte) string {
+	for _, i := range idx {
+		r, err := t.do(http.MethodPost, "", map[string]string{
+			"X-Chunk-Id": cid, "X-Chunk-Idx": strconv.Itoa(i), "X-Chunk-Total": strconv.Itoa(total),
+		}, parts[i])
+		if err != nil {
+			return err.Error()
+		}
+		if r.code/100 != 2 {
+			return fmt.Sprintf("chunk %d upload answered %d: %s", i, r.code, bytes.TrimSpace(r.body))
+		}
+	}
+	return ""
+}
+
+func (t *tester) fetch(cid string, idx int) (reply, error) {
+	return t.do(http.MethodGet, "", map[string]string{"X-Chunk-Id": cid, "X-Chunk-Idx": strconv.Itoa(idx)}, nil)
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func randParts(n, size int) [][]byte {
+	parts := make([][]byte, n)
+	for i := range parts {
+		parts[i] = make([]byte, size)
+		rand.Read(parts[i])
+	}
+	return parts
+}
+
+/*──────── required ────────────────────────────────────────────*/
+
+func (t *tester) health() string {
+	r, err := t.do(http.MethodGet, "/", nil, nil)
+	if err != nil {
+		return err.Error()
+	}
+	if r.code != http.StatusOK {
+		return fmt.Sprintf("answered %d", r.code)
+	}
+	return ""
+}
+
+func (t *tester) auth() string {
+	stale, _ := netw.AuthToken(t.cfg.Key, time.Now().Add(-time.Hour).Unix())
+	wrong, _ := netw.AuthToken("0123456789abcdef", time.Now().Unix())
+	if strings.EqualFold(t.cfg.Key, "0123456789abcdef") {
+		wrong, _ = netw.AuthToken("fedcba9876543210", time.Now().Unix())
+	}
+	for what, tok := range map[string]string{"missing": "", "garbage": "not-a-token", "stale (1h)": stale, "wrong key": wrong} {
+		r, err := t.do(http.MethodGet, "", map[string]string{"X-Auth-Token": tok}, nil)
+		if err != nil {
+			return err.Error()
+		}
+		if r.code != http.StatusUnauthorized {
+			return fmt.Sprintf("%s token answered %d", what, r.code)
+		}
+	}
+	_, bad := t.discover(nil)
+	return bad
+}
+
+func (t *tester) discoverSchema() string {
+	r, err := t.do(http.MethodGet, "", nil, nil)
+	if err != nil {
+		return err.Error()
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(r.body, &raw); err != nil {
+		return fmt.Sprintf("not a JSON object: %v", err)
+	}
+	var total int
+	if err := json.Unmarshal(raw["total"], &total); err != nil {
+		return `"total" missing or not a number`
+	}
+	var have []int
+	if err := json.Unmarshal(raw["have"], &have); err != nil || raw["have"] == nil {
+		return `"have" missing or not a list of numbers`
+	}
+	if c, ok := raw["cid"]; ok {
+		var cid string
+		if json.Unmarshal(c, &cid) != nil {
+			return `"cid" is not a string`
+		}
+	}
+	return ""
+}
+
+func (t *tester) chunked() string {
+	cid, parts := randHex(8), randParts(3, 1000)
+	if bad := t.upload(cid, 3, []int{0, 2, 1}, parts); bad != "" {
+		return bad
+	}
+	d, bad := t.discover(nil)
+	slices.Sort(d.Have)
+	switch {
+	case bad != "":
+		return bad
+	case d.Cid != cid:
+		return fmt.Sprintf("discover shows cid %q, want the one just uploaded", d.Cid)
+	case d.Total != 3:
+		return fmt.Sprintf("discover total %d, want 3", d.Total)
+	case !slices.Equal(d.Have, []int{0, 1, 2}):
+		return fmt.Sprintf("discover have %v, want [0 1 2]", d.Have)
+	}
+	for i, p := range parts {
+		r, err := t.fetch(cid, i)
+		if err != nil {
+			return err.Error()
+		}
+		if r.code != http.StatusOK || !bytes.Equal(r.body, p) {
+			return fmt.Sprintf("chunk %d came back %d with %d bytes, want 200 with the %d uploaded", i, r.code, len(r.body), len(p))
+		}
+	}
+	return ""
+}
+
+func (t *tester) missing() string {
+	cid := randHex(8)
+	if bad := t.upload(cid, 2, []int{0}, randParts(2, 100)); bad != "" {
+		return bad
+	}
+	r, err := t.fetch(cid, 1)
+	if err != nil {
+		return err.Error()
+	}
+	if r.code != http.StatusNotFound {
+		return fmt.Sprintf("answered %d", r.code)
+	}
+	return ""
+}
+
+func (t *tester) flushed() string {
+	old := randHex(8)
+	if bad := t.upload(old, 1, []int{0}, randParts(1, 100)); bad != "" {
+		return bad
+	}
+	if bad := t.upload(randHex(8), 1, []int{0}, randParts(1, 100)); bad != "" {
+		return bad
+	}
+	r, err := t.fetch(old, 0)
+	if err != nil {
+		return err.Error()
+	}
+	if r.code != http.StatusGone {
+		return fmt.Sprintf("fetch of the replaced snapshot answered %d", r.code)
+	}
+	return ""
+}
+
+func (t *tester) chunkCap() string {
+	const chunkMax = 300 * 1024
+	if bad := t.upload(randHex(8), 1, []int{0}, randParts(1, chunkMax)); bad != "" {
+		return "a chunk of exactly 300 KiB: " + bad
+	}
+	r, err := t.do(http.MethodPost, "", map[string]string{
+		"X-Chunk-Id": randHex(8), "X-Chunk-Idx": "0", "X-Chunk-Total": "1",
+	}, randParts(1, chunkMax+1)[0])
+	if err != nil {
+		return err.Error()
+	}
+	if r.code != http.StatusRequestEntityTooLarge {
+		return fmt.Sprintf("300 KiB + 1 answered %d", r.code)
+	}
+	return ""
+}
+
+func (t *tester) totalChanged() string {
+	cid, parts := randHex(8), randParts(2, 100)
+	if bad := t.upload(cid, 2, []int{0}, parts); bad != "" {
+		return bad
+	}
+	r, err := t.do(http.MethodPost, "", map[string]string{
+		"X-Chunk-Id": cid, "X-Chunk-Idx": "1", "X-Chunk-Total": "3",
+	}, parts[1])
+	if err != nil {
+		return err.Error()
+	}
+	if r.code/100 != 4 {
+		return fmt.Sprintf("answered %d", r.code)
+	}
+	return ""
+}
+
+/*──────── optional ────────────────────────────────────────────*/
+
+func (t *tester) inline() string {
+	cid := randHex(8)
+	snap := fmt.Sprintf(`{"origin":"conformance","ts":%d,"items":[]}`, time.Now().Unix())
+	r, err := t.do(http.MethodPost, "", map[string]string{"X-Inline": "1", "X-Chunk-Id": cid}, []byte(snap))
+	if err != nil {
+		return err.Error()
+	}
+	if r.code/100 != 2 {
+		return fmt.Sprintf("answered %d", r.code)
+	}
+	d, bad := t.discover(nil)
+	switch {
+	case bad != "":
+		return bad
+	case d.Cid != cid:
+		return "accepted, but discover doesn't show it"
+	case !bytes.Contains(d.Snap, []byte(`"conformance"`)):
+		return `discover has no "snap"`
+	}
+	return ""
+}
+
+func (t *tester) ranged() string {
+	cid, parts := randHex(8), randParts(3, 500)
+	if bad := t.upload(cid, 3, []int{0, 1, 2}, parts); bad != "" {
+		return bad
+	}
+	r, err := t.do(http.MethodGet, "", map[string]string{"X-Chunk-Id": cid, "X-Chunk-Range": "0-2"}, nil)
+	if err != nil {
+		return err.Error()
+	}
+	if r.code != http.StatusOK || r.hdr.Get("X-Chunk-Range") == "" {
+		return "no X-Chunk-Range in the reply"
+	}
+	got := map[int][]byte{}
+	for b := r.body; len(b) > 0; {
+		if len(b) < 8 {
+			return "truncated frame header"
+		}
+		idx, n := binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+		if uint32(len(b)-8) < n {
+			return "truncated frame"
+		}
+		got[int(idx)], b = b[8:8+n], b[8+n:]
+	}
+	for i, p := range parts {
+		if !bytes.Equal(got[i], p) {
+			return fmt.Sprintf("frame %d missing or wrong", i)
+		}
+	}
+	return ""
+}
+
+func (t *tester) acks() string {
+	cid := randHex(8)
+	if bad := t.upload(cid, 1, []int{0}, randParts(1, 100)); bad != "" {
+		return bad
+	}
+	key := randHex(8) + "-1"
+	body := fmt.Sprintf(`{"origin":"conformance","ts":%d,"kind":"ack","ack":%q}`, time.Now().Unix(), key)
+	r, err := t.do(http.MethodPost, "", map[string]string{"X-Ack": "1"}, []byte(body))
+	if err != nil {
+		return err.Error()
+	}
+	if r.code/100 != 2 {
+		return fmt.Sprintf("answered %d", r.code)
+	}
+	d, bad := t.discover(nil)
+	if bad != "" {
+		return bad
+	}
+	if d.Cid != cid {
+		return "the receipt flushed the active snapshot"
+	}
+	for _, a := range d.Acks {
+		if bytes.Contains(a, []byte(key)) {
+			return ""
+		}
+	}
+	return `accepted, but discover's "acks" doesn't list it`
+}
+
+func (t *tester) serverTime() string {
+	d, bad := t.discover(nil)
+	if bad != "" {
+		return bad
+	}
+	ms, err := strconv.ParseInt(d.hdr.Get("X-Server-Time"), 10, 64)
+	if err != nil {
+		return "no X-Server-Time on discover"
+	}
+	if skew := time.Since(time.UnixMilli(ms)); skew > 5*time.Minute || skew < -5*time.Minute {
+		return fmt.Sprintf("X-Server-Time is %v off this machine's clock", skew.Round(time.Second))
+	}
+	return ""
+}
+
+func (t *tester) limits() string {
+	d, bad := t.discover(nil)
+	if bad != "" {
+		return bad
+	}
+	if d.MaxBody <= 0 || d.MaxChunk <= 0 {
+		return "not advertised"
+	}
+	if d.MaxChunk > 300*1024 {
+		return fmt.Sprintf("max_chunk %d is over the 300 KiB protocol cap", d.MaxChunk)
+	}
+	return ""
+}
+
+func (t *tester) hints() string {
+	st := netw.NetStats{RTT: 800 * time.Millisecond, Loss: 0.1, Kbps: 100}
+	d, bad := t.discover(map[string]string{"X-Net-Stats": st.String()})
+	if bad != "" {
+		return bad
+	}
+	v := d.hdr.Get("X-Hints")
+	if v == "" {
+		return "no X-Hints for a slow, lossy client"
+	}
+	if netw.ParseHints(v) == (netw.Hints{}) {
+		return fmt.Sprintf("X-Hints %q has no field this client knows", v)
+	}
+	return ""
+}
+
+func (t *tester) blobs() string {
+	data := randParts(1, 100)[0]
+	sum := sha256.Sum256(data)
+	path := "/blob/" + hex.EncodeToString(sum[:])
+	r, err := t.do(http.MethodHead, path, nil, nil)
+	if err != nil {
+		return err.Error()
+	}
+	if r.code != http.StatusNotFound {
+		return fmt.Sprintf("HEAD of an unknown blob answered %d", r.code)
+	}
+	for _, rg := range [][2]int{{50, 99}, {0, 49}} { // any order
+		r, err = t.do(http.MethodPut, path, map[string]string{
+			"Content-Range": fmt.Sprintf("bytes %d-%d/%d", rg[0], rg[1], len(data)),
+		}, data[rg[0]:rg[1]+1])
+		if err != nil {
+			return err.Error()
+		}
+		if r.code/100 != 2 {
+			return fmt.Sprintf("PUT answered %d", r.code)
+		}
+	}
+	if r, err = t.do(http.MethodHead, path, nil, nil); err != nil || r.code != http.StatusOK {
+		return "HEAD of the stored blob isn't 200"
+	}
+	r, err = t.do(http.MethodGet, path, map[string]string{"Range": "bytes=10-19"}, nil)
+	switch {
+	case err != nil:
+		return err.Error()
+	case r.code == http.StatusPartialContent && bytes.Equal(r.body, data[10:20]):
+	case r.code == http.StatusOK && bytes.Equal(r.body, data):
+	default:
+		return fmt.Sprintf("ranged GET answered %d with %d bytes", r.code, len(r.body))
+	}
+	return ""
+}
+
+/*──────── WebSocket ───────────────────────────────────────────*/
+
+func (t *tester) wsDial(ctx context.Context) (*websocket.Conn, error) {
+	hdr := http.Header{}
+	t.authorize(hdr, time.Now())
+	conn, _, err := websocket.Dial(ctx, t.cfg.WS, &websocket.DialOptions{HTTPHeader: hdr})
+	return conn, err
+}
+
+func (t *tester) wsFanOut() string {
+	ctx, cancel := context.WithTimeout(t.ctx, 10*time.Second)
+	defer cancel()
+	a, err := t.wsDial(ctx)
+	if err != nil {
+		return "dial: " + err.Error()
+	}
+	defer a.Close(websocket.StatusNormalClosure, "bye")
+	b, err := t.wsDial(ctx)
+	if err != nil {
+		return "second dial: " + err.Error()
+	}
+	defer b.Close(websocket.StatusNormalClosure, "bye")
+
+	mark := randHex(8)
+	msg := fmt.Sprintf(`{"origin":"conformance-%s","ts":%d,"items":[]}`, mark, time.Now().Unix())
+	if err := a.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+		return "send: " + err.Error()
+	}
+	for {
+		_, got, err := b.Read(ctx)
+		if err != nil {
+			return "the other connection never got the message: " + err.Error()
+		}
+		if bytes.Contains(got, []byte(mark)) {
+			return ""
+		}
+	}
+}
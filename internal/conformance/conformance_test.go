@@ -0,0 +1,108 @@
+package conformance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"clipsync/internal/server"
+
+	"nhooyr.io/websocket"
+)
+
+const key = "0011223344556677"
+
+func TestEmbeddedServerConforms(t *testing.T) {
+	srv, err := server.New(key, nil, server.WithRequireNonce()) // as clipsyncd runs it
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rs := Run(context.Background(), Config{URL: ts.URL + "/clip", Key: key})
+	if !Passed(rs) {
+		t.Fatalf("required checks failed:\n%s", report(rs))
+	}
+	supported := map[string]bool{}
+	for _, r := range rs {
+		if r.Optional {
+			supported[strings.Fields(r.Name)[0]] = r.OK
+		}
+	}
+	for _, f := range []string{"inline", "ranged", "delivery", "server", "advertised", "adaptive"} {
+		if !supported[f] {
+			t.Fatalf("embedded server should support %s:\n%s", f, report(rs))
+		}
+	}
+	if supported["out-of-band"] {
+		t.Fatalf("embedded server has no blobs, yet the check passed")
+	}
+}
+
+func TestBrokenServerFails(t *testing.T) {
+	srv, _ := server.New(key, nil)
+	lax := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("X-Room")
+		if r.Header.Get("X-Auth-Token") == "not-a-token" {
+			w.WriteHeader(http.StatusOK) // lets a bad token through
+			return
+		}
+		srv.ServeHTTP(w, r)
+	})
+	ts := httptest.NewServer(lax)
+	defer ts.Close()
+
+	rs := Run(context.Background(), Config{URL: ts.URL + "/clip", Key: key})
+	if Passed(rs) {
+		t.Fatalf("a server accepting garbage tokens passed:\n%s", report(rs))
+	}
+	if rs[1].OK || !strings.Contains(rs[1].Detail, "garbage") {
+		t.Fatalf("auth check: %s", rs[1])
+	}
+}
+
+func TestWebSocketFanOut(t *testing.T) {
+	var mu sync.Mutex
+	conns := map[*websocket.Conn]bool{}
+	hub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		conns[c] = true
+		mu.Unlock()
+		for {
+			typ, msg, err := c.Read(r.Context())
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			for o := range conns {
+				if o != c {
+					o.Write(r.Context(), typ, msg)
+				}
+			}
+			mu.Unlock()
+		}
+	})
+	ts := httptest.NewServer(hub)
+	defer ts.Close()
+
+	tr := &tester{ctx: context.Background(), cfg: Config{WS: "ws" + strings.TrimPrefix(ts.URL, "http"), Key: key}}
+	if bad := tr.wsFanOut(); bad != "" {
+		t.Fatalf("fan-out: %s", bad)
+	}
+}
+
+func report(rs []Result) string {
+	var sb strings.Builder
+	for _, r := range rs {
+		sb.WriteString(r.String() + "\n")
+	}
+	return sb.String()
+}
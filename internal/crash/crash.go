@@ -0,0 +1,175 @@
+// Package crash writes a report when clipsync panics, for bug reports.
+// It is off until Enable, process-wide like persist, and a report holds
+// no clipboard content: panic messages are kept only for runtime errors
+// (index out of range and the like); any other panic value is named by
+// type alone, since its text may quote a clip.  Stacks keep function
+// names and lines but not argument words.
+package crash
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"clipsync/internal/persist"
+)
+
+// Keep is how many reports Enable's directory holds; older ones go.
+const Keep = 20
+
+var (
+	mu    sync.Mutex
+	dir   string // "" = off
+	start = time.Now()
+)
+
+// Enable turns reporting on, writing to dir.
+func Enable(reportDir string) {
+	mu.Lock()
+	dir = reportDir
+	mu.Unlock()
+}
+
+// Dir is where reports go, "" while off.
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return dir
+}
+
+// Recover is deferred at the top of a goroutine: a panic is written to
+// a report, then carries on taking the process down.
+func Recover() {
+	if r := recover(); r != nil {
+		Record("fatal", r, debug.Stack())
+		panic(r)
+	}
+}
+
+// Record writes a report for a panic with value r, recovered where
+// stack was taken; where says what happened to it ("fatal", or the name
+// of a subsystem that was restarted).  It returns the report's path, ""
+// if reporting is off.
+func Record(where string, r any, stack []byte) (string, error) {
+	d := Dir()
+	if d == "" {
+		return "", nil
+	}
+	all := make([]byte, 1<<20)
+	all = all[:runtime.Stack(all, true)]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "clipsync crash report\n")
+	fmt.Fprintf(&b, "time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "build: %s\n", Build())
+	fmt.Fprintf(&b, "uptime: %s\n", time.Since(start).Round(time.Second))
+	fmt.Fprintf(&b, "where: %s\n", where)
+	fmt.Fprintf(&b, "panic: %s\n", Describe(r))
+	fmt.Fprintf(&b, "goroutines: %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(&b, "\n--- panicking goroutine ---\n%s\n", Scrub(stack))
+	fmt.Fprintf(&b, "\n--- all goroutines ---\n%s", Scrub(all))
+
+	if err := persist.MkdirAll(d, 0o700); err != nil {
+		return "", err
+	}
+	name := filepath.Join(d, "crash-"+time.Now().Format("20060102-150405.000")+".txt")
+	if err := persist.WriteFile(name, []byte(b.String()), 0o600); err != nil {
+		return "", err
+	}
+	prune(d)
+	return name, nil
+}
+
+// Describe is what a report says about a panic value: a runtime error's
+// message, anything else by type only.
+func Describe(r any) string {
+	if e, ok := r.(runtime.Error); ok {
+		return e.Error()
+	}
+	return fmt.Sprintf("%T (message withheld: it may contain clipboard data)", r)
+}
+
+// argWords are the argument lists in a Go traceback,
+// "main.f(0xc000012345, {0x4b2a40, 0x5?}, ...)"; a receiver such as
+// "(*Syncer)" is not one.
+var argWords = regexp.MustCompile(`\((?:0x[0-9a-f]+\??|\.\.\.|[{}, ])+\)`)
+
+// Scrub strips argument words from a traceback.
+func Scrub(stack []byte) string {
+	return argWords.ReplaceAllString(string(stack), "(…)")
+}
+
+// Build is the binary's version, VCS revision and platform.
+func Build() string {
+	v, rev := "(unknown)", ""
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		v = bi.Main.Version
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				rev = " " + s.Value
+			}
+		}
+	}
+	return fmt.Sprintf("%s%s %s %s/%s", v, rev, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// Reports lists dir's reports, newest first.
+func Reports(dir string) []string {
+	names, _ := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	slices.Sort(names)
+	slices.Reverse(names)
+	return names
+}
+
+func prune(dir string) {
+	if rs := Reports(dir); len(rs) > Keep {
+		for _, old := range rs[Keep:] {
+			os.Remove(old)
+		}
+	}
+}
+
+// Bundle zips dir's reports and the extra text files (name → content)
+// into w, for attaching to a bug report.  It returns the names written.
+func Bundle(w io.Writer, dir string, extra map[string]string) ([]string, error) {
+	zw := zip.NewWriter(w)
+	var names []string
+	add := func(name string, data []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		_, err = f.Write(data)
+		return err
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if err := add(k, []byte(extra[k])); err != nil {
+			return names, err
+		}
+	}
+	for _, r := range Reports(dir) {
+		data, err := os.ReadFile(r)
+		if err != nil {
+			continue
+		}
+		if err := add("crashes/"+filepath.Base(r), data); err != nil {
+			return names, err
+		}
+	}
+	return names, zw.Close()
+}
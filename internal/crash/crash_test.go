@@ -0,0 +1,90 @@
+package crash
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordKeepsClipsOut(t *testing.T) {
+	dir := t.TempDir()
+	Enable(dir)
+	defer Enable("")
+
+	secret := "hunter2 from the clipboard"
+	var path string
+	func() {
+		defer func() {
+			r := recover()
+			path, _ = Record("transport", r, nil)
+		}()
+		panic(errors.New("bad item " + secret))
+	}()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	if strings.Contains(report, secret) {
+		t.Fatal("report quotes the panic message")
+	}
+	for _, want := range []string{"where: transport", "panic: *errors.errorString (message withheld", "--- all goroutines ---", "TestRecordKeepsClipsOut"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q", want)
+		}
+	}
+
+	func() {
+		defer func() { path, _ = Record("clip", recover(), nil) }()
+		var s []int
+		_ = s[3]
+	}()
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), "panic: runtime error: index out of range [3] with length 0") {
+		t.Fatalf("runtime error message missing:\n%s", data)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	in := "clipsync/pkg/clipsync.(*Syncer).poller(0xc0001a2000, {0x8c4f20, 0xc000126000}, 0x5?, ...)\n\tmain.main()"
+	want := "clipsync/pkg/clipsync.(*Syncer).poller(…)\n\tmain.main()"
+	if got := Scrub([]byte(in)); got != want {
+		t.Fatalf("Scrub = %q", got)
+	}
+}
+
+func TestPruneAndBundle(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < Keep+3; i++ {
+		name := filepath.Join(dir, "crash-"+time.Unix(int64(i), 0).UTC().Format("20060102-150405.000")+".txt")
+		os.WriteFile(name, []byte("report"), 0o600)
+	}
+	prune(dir)
+	if n := len(Reports(dir)); n != Keep {
+		t.Fatalf("%d reports kept, want %d", n, Keep)
+	}
+
+	var buf bytes.Buffer
+	names, err := Bundle(&buf, dir, map[string]string{"system.txt": Build()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != Keep+1 || len(names) != Keep+1 || zr.File[0].Name != "system.txt" || !strings.HasPrefix(zr.File[1].Name, "crashes/crash-") {
+		t.Fatalf("bundle holds %d files, first %q", len(zr.File), zr.File[0].Name)
+	}
+}
+
+func TestOffWritesNothing(t *testing.T) {
+	if p, err := Record("x", "boom", nil); p != "" || err != nil {
+		t.Fatalf("Record while off = %q, %v", p, err)
+	}
+}
@@ -0,0 +1,267 @@
+// Package ctl is the local control socket: one command per line in,
+// one JSON reply per line out.  It listens on loopback, where any local
+// process (or a web page, by POSTing to it) can reach it, so commands
+// that touch clip content are private: they need a first line of
+//
+//	auth <token>
+//
+// where the token is made fresh each run and kept in a file only the
+// user can read (TokenFile).  A line that looks like HTTP ends the
+// connection.
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"clipsync/internal/persist"
+)
+
+// DefaultAddr is where the daemon listens unless told otherwise.
+const DefaultAddr = "127.0.0.1:5004"
+
+// MaxLine caps one command line; clip text rides in it as base64.
+const MaxLine = 16 << 20
+
+// Handler runs one command; args exclude the command name itself.
+type Handler func(args []string) (string, error)
+
+// reply is the wire form of every answer.
+type reply struct {
+	OK  bool   `json:"ok"`
+	Out string `json:"out,omitempty"`
+	Err string `json:"err,omitempty"`
+}
+
+/*──────── server ──────────────────────────────────────────────*/
+
+// TokenFile is where the daemon listening on addr keeps its token, or
+// "" if there is no user cache directory.
+func TokenFile(addr string) string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	name := strings.NewReplacer(":", "_", "/", "_", "\\", "_", "[", "", "]", "").Replace(addr)
+	return filepath.Join(d, "clipsync", "control-"+name+".token")
+}
+
+// Server dispatches control commands to registered handlers.
+type Server struct {
+	mu      sync.RWMutex
+	cmds    map[string]Handler
+	private map[string]bool
+	token   string // "" until Serve wrote it: private commands are refused
+}
+
+func NewServer() *Server {
+	s := &Server{cmds: make(map[string]Handler), private: make(map[string]bool)}
+	s.Handle("help", func([]string) (string, error) {
+		return strings.Join(s.names(), " "), nil
+	})
+	return s
+}
+
+// Handle registers (or replaces) the handler for name.
+func (s *Server) Handle(name string, h Handler) {
+	s.mu.Lock()
+	s.cmds[name] = h
+	s.mu.Unlock()
+}
+
+// Private marks commands as needing the token.
+func (s *Server) Private(names ...string) {
+	s.mu.Lock()
+	for _, n := range names {
+		s.private[n] = true
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.cmds))
+	for n := range s.cmds {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Serve listens on addr until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	file, err := s.writeToken(addr)
+	if err != nil {
+		// with -ephemeral, say: public commands still work
+		file = ""
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		if file != "" {
+			os.Remove(file)
+		}
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// writeToken makes this run's token and saves it for clients.
+func (s *Server) writeToken(addr string) (string, error) {
+	file := TokenFile(addr)
+	if file == "" {
+		return "", errors.New("ctl: no cache directory for the token")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	tok := hex.EncodeToString(b)
+	if err := persist.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", err
+	}
+	if err := persist.WriteFile(file, []byte(tok+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.token = tok
+	s.mu.Unlock()
+	return file, nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(nil, MaxLine)
+	enc := json.NewEncoder(conn)
+	authed := false
+	for sc.Scan() {
+		line := sc.Text()
+		if isHTTP(line) {
+			return // a browser, made to talk to us by some page
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if f[0] == "auth" {
+			authed = len(f) == 2 && s.checkToken(f[1])
+			if !authed {
+				_ = enc.Encode(reply{Err: "bad token"})
+				return
+			}
+			_ = enc.Encode(reply{OK: true})
+			continue
+		}
+		_ = enc.Encode(s.dispatch(f[0], f[1:], authed))
+	}
+}
+
+func (s *Server) checkToken(tok string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(s.token)) == 1
+}
+
+// isHTTP spots an HTTP request or header line.
+func isHTTP(line string) bool {
+	if strings.Contains(line, " HTTP/1.") || strings.HasPrefix(line, "PRI * HTTP/2") {
+		return true
+	}
+	name, _, ok := strings.Cut(line, ":")
+	return ok && strings.EqualFold(name, "Host")
+}
+
+func (s *Server) dispatch(name string, args []string, authed bool) reply {
+	s.mu.RLock()
+	h, ok := s.cmds[name]
+	private := s.private[name]
+	s.mu.RUnlock()
+	if !ok {
+		return reply{Err: fmt.Sprintf("unknown command %q (try help)", name)}
+	}
+	if private && !authed {
+		return reply{Err: fmt.Sprintf("%s needs the daemon's token, which only its user can read", name)}
+	}
+	out, err := h(args)
+	if err != nil {
+		return reply{Err: err.Error()}
+	}
+	return reply{OK: true, Out: out}
+}
+
+/*──────── client ──────────────────────────────────────────────*/
+
+// Call sends one command to the daemon at addr and returns its output,
+// authenticated if the daemon's token file is readable.
+func Call(addr string, cmd ...string) (string, error) {
+	if len(cmd) == 0 {
+		return "", errors.New("ctl: empty command")
+	}
+	tok, _ := os.ReadFile(TokenFile(addr))
+	out, err := call(addr, strings.TrimSpace(string(tok)), cmd)
+	if errors.Is(err, errBadToken) {
+		// left by an earlier run: public commands still work
+		return call(addr, "", cmd)
+	}
+	return out, err
+}
+
+var errBadToken = errors.New("ctl: bad token")
+
+func call(addr, tok string, cmd []string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("ctl: daemon not reachable at %s: %w", addr, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	dec := json.NewDecoder(conn)
+	var r reply
+	if tok != "" {
+		if _, err := fmt.Fprintln(conn, "auth", tok); err != nil {
+			return "", err
+		}
+		if err := dec.Decode(&r); err != nil || !r.OK {
+			return "", errBadToken
+		}
+	}
+	if _, err := fmt.Fprintln(conn, strings.Join(cmd, " ")); err != nil {
+		return "", err
+	}
+	r = reply{}
+	if err := dec.Decode(&r); err != nil {
+		return "", fmt.Errorf("ctl: bad reply: %w", err)
+	}
+	if !r.OK {
+		return "", errors.New(r.Err)
+	}
+	return r.Out, nil
+}
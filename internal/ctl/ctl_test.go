@@ -0,0 +1,124 @@
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freeAddr grabs an unused loopback port.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// tempCache points the user cache directory, and so TokenFile, at a
+// fresh directory.
+func tempCache(t *testing.T) {
+	d := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", d)
+	t.Setenv("HOME", d)
+	t.Setenv("LocalAppData", d)
+}
+
+func TestCallRoundTrip(t *testing.T) {
+	tempCache(t)
+	addr := freeAddr(t)
+	s := NewServer()
+	s.Handle("echo", func(args []string) (string, error) {
+		return strings.Join(args, ","), nil
+	})
+	s.Handle("fail", func([]string) (string, error) {
+		return "", errors.New("boom")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, addr)
+	time.Sleep(50 * time.Millisecond)
+
+	out, err := Call(addr, "echo", "a", "b")
+	if err != nil || out != "a,b" {
+		t.Fatalf("echo: got %q, %v", out, err)
+	}
+	if _, err := Call(addr, "fail"); err == nil || err.Error() != "boom" {
+		t.Fatalf("fail: expected boom, got %v", err)
+	}
+	if _, err := Call(addr, "nope"); err == nil {
+		t.Fatalf("unknown command accepted")
+	}
+	if out, _ := Call(addr, "help"); !strings.Contains(out, "echo") {
+		t.Fatalf("help missing echo: %q", out)
+	}
+	long := strings.Repeat("x", 1<<20) // well past bufio's default
+	if out, err := Call(addr, "echo", long); err != nil || out != long {
+		t.Fatalf("long line: %d bytes back, %v", len(out), err)
+	}
+}
+
+func TestPrivateNeedsToken(t *testing.T) {
+	tempCache(t)
+	addr := freeAddr(t)
+	s := NewServer()
+	s.Handle("paste", func([]string) (string, error) { return "secret", nil })
+	s.Private("paste")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, addr)
+	time.Sleep(50 * time.Millisecond)
+
+	if out, err := Call(addr, "paste"); err != nil || out != "secret" {
+		t.Fatalf("with the token file: got %q, %v", out, err)
+	}
+	if fi, err := os.Stat(TokenFile(addr)); err != nil || fi.Mode().Perm()&0o077 != 0 {
+		t.Fatalf("token file: %v, %v", fi, err)
+	}
+	if out, err := call(addr, "", []string{"paste"}); err == nil {
+		t.Fatalf("no token: got %q", out)
+	}
+	if _, err := call(addr, "0123", []string{"paste"}); !errors.Is(err, errBadToken) {
+		t.Fatalf("wrong token: %v", err)
+	}
+}
+
+// A page can make a browser POST to the socket; its request line must
+// end the connection before the body is read as commands.
+func TestHTTPIsDropped(t *testing.T) {
+	tempCache(t)
+	addr := freeAddr(t)
+	s := NewServer()
+	ran := make(chan bool, 1)
+	s.Handle("pause", func([]string) (string, error) { ran <- true; return "", nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, addr)
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: 127.0.0.1:5004\r\nContent-Type: text/plain\r\n\r\npause\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+		t.Fatalf("got a reply: %q", line)
+	}
+	select {
+	case <-ran:
+		t.Fatal("command in an HTTP body ran")
+	default:
+	}
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+/*──────── dedupe horizon ──────────────────────────────────────*/
+// Dedupe remembers the last n accepted QuickKeys.  A key is a duplicate
+// only while it is still among them and, if window > 0, was accepted
+// less than window ago.  n = 1, window = 0 is the classic "same as the
+// previous copy" rule; n = 0 turns deduplication off.
+type Dedupe struct {
+	mu     sync.Mutex
+	n      int
+	window time.Duration
+	keys   []string
+	at     []time.Time
+}
+
+func NewDedupe(n int, window time.Duration) *Dedupe {
+	return &Dedupe{n: n, window: window}
+}
+
+// Seen reports whether key is a duplicate; if not, it is recorded.
+func (d *Dedupe) Seen(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dup(key, now) {
+		return true
+	}
+	d.add(key, now)
+	return false
+}
+
+// Dup reports whether key is a duplicate without recording it: for
+// clips that only count once they have landed (see Add).
+func (d *Dedupe) Dup(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dup(key, now)
+}
+
+// Add records key as accepted at now.
+func (d *Dedupe) Add(key string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.dup(key, now) {
+		d.add(key, now)
+	}
+}
+
+func (d *Dedupe) dup(key string, now time.Time) bool {
+	if d.n <= 0 {
+		return false
+	}
+	for i, k := range d.keys {
+		if k != key {
+			continue
+		}
+		if d.window <= 0 || now.Sub(d.at[i]) < d.window {
+			return true
+		}
+		// expired: drop the old entry, add re-adds it as fresh
+		d.keys = append(d.keys[:i], d.keys[i+1:]...)
+		d.at = append(d.at[:i], d.at[i+1:]...)
+		return false
+	}
+	return false
+}
+
+func (d *Dedupe) add(key string, now time.Time) {
+	if d.n <= 0 {
+		return
+	}
+	d.keys = append(d.keys, key)
+	d.at = append(d.at, now)
+	if len(d.keys) > d.n {
+		d.keys = d.keys[1:]
+		d.at = d.at[1:]
+	}
+}
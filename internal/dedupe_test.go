@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupeClassic(t *testing.T) {
+	d := NewDedupe(1, 0)
+	now := time.Now()
+	if d.Seen("a", now) {
+		t.Fatalf("first a is not a dupe")
+	}
+	if !d.Seen("a", now) {
+		t.Fatalf("second a should be a dupe")
+	}
+	d.Seen("b", now)
+	if d.Seen("a", now) {
+		t.Fatalf("a after b should pass with n=1")
+	}
+}
+
+func TestDedupeCountAndWindow(t *testing.T) {
+	d := NewDedupe(3, 10*time.Second)
+	t0 := time.Now()
+	d.Seen("a", t0)
+	d.Seen("b", t0)
+	if !d.Seen("a", t0.Add(time.Second)) {
+		t.Fatalf("a within count+window should be a dupe")
+	}
+	if d.Seen("a", t0.Add(11*time.Second)) {
+		t.Fatalf("a after the window should pass")
+	}
+	if !d.Seen("a", t0.Add(12*time.Second)) {
+		t.Fatalf("re-accepted a should restart its window")
+	}
+}
+
+func TestDedupeOff(t *testing.T) {
+	d := NewDedupe(0, 0)
+	if d.Seen("a", time.Now()) || d.Seen("a", time.Now()) {
+		t.Fatalf("n=0 must never report dupes")
+	}
+}
+
+func TestDedupeDupDoesNotRecord(t *testing.T) {
+	d := NewDedupe(1, 0)
+	now := time.Now()
+	if d.Dup("a", now) || d.Dup("a", now) {
+		t.Fatalf("a never added, yet a dupe")
+	}
+	d.Add("a", now)
+	if !d.Dup("a", now) {
+		t.Fatalf("added a should be a dupe")
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+/*──────── origin-echo suppression ─────────────────────────────*/
+// Echo tells the watcher which clipboard changes are our own writes of
+// a remote snapshot, so they aren't sent straight back.  Begin is called
+// just before a write with the sequence number then current, Wrote just
+// after with the new one: every sequence in between is ours, and so is
+// anything seen while a write is under way.
+//
+// Some changes land outside that range — a clipboard manager re-owning
+// the clip, an app re-rendering a delayed format — so for grace after a
+// write a copy whose payload matches one we wrote still counts as ours.
+// grace = 0 leaves only the sequence check.
+type Echo struct {
+	mu      sync.Mutex
+	grace   time.Duration
+	writing int
+	lo, hi  uint32 // ours: lo < seq <= hi
+	until   time.Time
+	sums    map[[32]byte]bool // payloads of the last write
+}
+
+func NewEcho(grace time.Duration) *Echo {
+	return &Echo{grace: grace}
+}
+
+// Begin marks a write as under way; seq is the sequence before it.
+func (e *Echo) Begin(seq uint32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.writing == 0 {
+		e.lo = seq
+	}
+	e.writing++
+}
+
+// Wrote ends the write Begin started.  seq is the sequence after it and
+// items what was written (nil for a failed write, which arms no grace).
+func (e *Echo) Wrote(seq uint32, items []Item, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.writing > 0 {
+		e.writing--
+	}
+	e.hi = seq
+	if len(items) == 0 || e.grace <= 0 {
+		return
+	}
+	e.until = now.Add(e.grace)
+	e.sums = make(map[[32]byte]bool, len(items))
+	for _, it := range items {
+		if it.Payload != "" { // an empty item matches too much
+			e.sums[sha256.Sum256([]byte(it.Payload))] = true
+		}
+	}
+}
+
+// Ours reports whether the clipboard at seq is our own write.
+func (e *Echo) Ours(seq uint32) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.writing > 0 || seq-e.lo-1 < e.hi-e.lo // lo < seq <= hi, wrap-safe
+}
+
+// Echoes reports whether items, first seen changing at, are a late echo
+// of our last write: within grace of it and sharing a payload with it.
+func (e *Echo) Echoes(items []Item, at time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !at.Before(e.until) {
+		return false
+	}
+	for _, it := range items {
+		if e.sums[sha256.Sum256([]byte(it.Payload))] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEchoSequenceRange(t *testing.T) {
+	e := NewEcho(0)
+	if e.Ours(0) || e.Ours(1) {
+		t.Fatalf("nothing is ours before a write")
+	}
+	e.Begin(10)
+	if !e.Ours(11) || !e.Ours(99) {
+		t.Fatalf("anything seen mid-write is ours")
+	}
+	e.Wrote(13, []Item{{Fmt: 13, Payload: "aGk="}}, time.Now())
+	for seq, want := range map[uint32]bool{10: false, 11: true, 12: true, 13: true, 14: false} {
+		if e.Ours(seq) != want {
+			t.Fatalf("Ours(%d) = %v", seq, !want)
+		}
+	}
+}
+
+func TestEchoSequenceWraps(t *testing.T) {
+	e := NewEcho(0)
+	e.Begin(^uint32(0) - 1)
+	e.Wrote(1, nil, time.Now())
+	if !e.Ours(^uint32(0)) || !e.Ours(0) || !e.Ours(1) || e.Ours(2) {
+		t.Fatalf("range across the wrap is wrong")
+	}
+}
+
+func TestEchoGrace(t *testing.T) {
+	e := NewEcho(time.Second)
+	t0 := time.Now()
+	e.Begin(1)
+	e.Wrote(2, []Item{{Fmt: 13, Payload: "aGk="}, {Fmt: 1, Payload: "aGk="}}, t0)
+
+	same := []Item{{Fmt: 13, Payload: "aGk="}}
+	if !e.Echoes(same, t0.Add(500*time.Millisecond)) {
+		t.Fatalf("same payload within grace is an echo")
+	}
+	if e.Echoes(same, t0.Add(time.Second)) {
+		t.Fatalf("grace is over")
+	}
+	if e.Echoes([]Item{{Fmt: 13, Payload: "Ynll"}}, t0) {
+		t.Fatalf("a different copy is never an echo")
+	}
+	if e.Echoes([]Item{{Fmt: 13}}, t0) {
+		t.Fatalf("an empty payload is not an echo")
+	}
+}
+
+func TestEchoGraceOff(t *testing.T) {
+	e := NewEcho(0)
+	t0 := time.Now()
+	e.Begin(1)
+	e.Wrote(2, []Item{{Fmt: 13, Payload: "aGk="}}, t0)
+	if e.Echoes([]Item{{Fmt: 13, Payload: "aGk="}}, t0) {
+		t.Fatalf("grace 0 leaves only the sequence check")
+	}
+}
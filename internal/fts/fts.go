@@ -0,0 +1,157 @@
+// Package fts is the full-text index behind `clipsync history search`:
+// an inverted index from words to the clips holding them.  A word is a
+// run of letters and digits, compared case-insensitively, and a query
+// word matches any word it starts, so "sk-ab" finds "sk-abc123" and
+// "tues" finds "Tuesday".  Histories are at most thousands of clips, so
+// matching a prefix walks the vocabulary instead of keeping a trie.
+package fts
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxText is how much of a clip's text is indexed; the rest of a huge
+// paste is not searchable.
+const MaxText = 1 << 20
+
+// Index maps words to ids.  It is not safe for concurrent use.
+type Index struct {
+	post  map[string]map[int]struct{} // word → ids holding it
+	words map[int][]string            // id → its distinct words, for Remove
+}
+
+func New() *Index {
+	return &Index{post: make(map[string]map[int]struct{}), words: make(map[int][]string)}
+}
+
+// Words splits text into its distinct lowercase words, in order of
+// first appearance.
+func Words(text string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(text, notWord) {
+		w = strings.ToLower(w)
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func notWord(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+
+// Add indexes text under id, replacing what id held before.
+func (x *Index) Add(id int, text string) {
+	x.Remove(id)
+	if len(text) > MaxText {
+		text = text[:MaxText]
+	}
+	ws := Words(text)
+	for _, w := range ws {
+		if x.post[w] == nil {
+			x.post[w] = make(map[int]struct{})
+		}
+		x.post[w][id] = struct{}{}
+	}
+	x.words[id] = ws
+}
+
+// Remove drops id from the index.
+func (x *Index) Remove(id int) {
+	for _, w := range x.words[id] {
+		delete(x.post[w], id)
+		if len(x.post[w]) == 0 {
+			delete(x.post, w)
+		}
+	}
+	delete(x.words, id)
+}
+
+// Search is the ids holding a word starting with each word of query,
+// highest (newest) first.  An empty query matches nothing.
+func (x *Index) Search(query string) []int {
+	var hits map[int]bool
+	for _, q := range Words(query) {
+		ids := make(map[int]bool)
+		for w, post := range x.post {
+			if strings.HasPrefix(w, q) {
+				for id := range post {
+					if hits == nil || hits[id] {
+						ids[id] = true
+					}
+				}
+			}
+		}
+		if hits = ids; len(hits) == 0 {
+			return nil
+		}
+	}
+	out := make([]int, 0, len(hits))
+	for id := range hits {
+		out = append(out, id)
+	}
+	slices.Sort(out)
+	slices.Reverse(out)
+	return out
+}
+
+// Snippet is the line of text holding the first match of query's first
+// word, cut to about width runes around it and flattened to one line.
+func Snippet(text, query string, width int) string {
+	qs := Words(query)
+	at := 0
+	if len(qs) > 0 {
+		if i := indexWord(text, qs[0]); i >= 0 {
+			at = i
+		}
+	}
+	start := strings.LastIndexByte(text[:at], '\n') + 1
+	end := len(text)
+	if i := strings.IndexByte(text[at:], '\n'); i >= 0 {
+		end = at + i
+	}
+	line := []rune(strings.TrimRight(text[start:end], "\r"))
+	pos := len([]rune(text[start:at]))
+	from := max(0, pos-width/3)
+	to := min(len(line), from+width)
+	s := strings.TrimSpace(string(line[from:to]))
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(line) {
+		s += "…"
+	}
+	return s
+}
+
+// indexWord is the byte offset in text of the first word starting with
+// prefix q (lowercase), or -1.
+func indexWord(text, q string) int {
+	inWord := false
+	for i, r := range text {
+		if notWord(r) {
+			inWord = false
+			continue
+		}
+		if !inWord && hasFoldPrefix(text[i:], q) {
+			return i
+		}
+		inWord = true
+	}
+	return -1
+}
+
+func hasFoldPrefix(s, prefix string) bool {
+	for _, p := range prefix {
+		r, n := utf8.DecodeRuneInString(s)
+		if n == 0 || unicode.ToLower(r) != p {
+			return false
+		}
+		s = s[n:]
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package fts
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	x := New()
+	x.Add(1, "meeting notes for Tuesday")
+	x.Add(2, "export OPENAI_KEY=sk-abc123def")
+	x.Add(3, "Tuesday: rotate the API key")
+	x.Add(4, "Größe und Maße")
+
+	for _, c := range []struct {
+		q    string
+		want []int
+	}{
+		{"tuesday", []int{3, 1}},
+		{"TUES", []int{3, 1}},
+		{"api key", []int{3}},
+		{"sk-abc", []int{2}},
+		{"key", []int{3, 2}}, // KEY is a word of its own in OPENAI_KEY
+		{"größe", []int{4}},
+		{"tuesday notes", []int{1}},
+		{"wednesday", nil},
+		{"", nil},
+		{"  ...", nil},
+	} {
+		if got := x.Search(c.q); !slices.Equal(got, c.want) {
+			t.Errorf("Search(%q) = %v, want %v", c.q, got, c.want)
+		}
+	}
+
+	x.Remove(3)
+	if got := x.Search("tuesday"); !slices.Equal(got, []int{1}) {
+		t.Fatalf("after Remove: %v", got)
+	}
+	x.Add(1, "something else")
+	if got := x.Search("tuesday"); got != nil {
+		t.Fatalf("after re-Add: %v", got)
+	}
+	if len(x.post["tuesday"]) != 0 || len(x.post) != len(Words("export OPENAI_KEY=sk-abc123def Größe und Maße something else")) {
+		t.Fatalf("stale words: %v", x.post)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := "first line\nsome padding before the secret key sk-abc123 and a long tail after it\r\nlast"
+	for _, c := range []struct {
+		q     string
+		width int
+		want  string
+	}{
+		{"sk-abc", 30, "…ecret key sk-abc123 and a long…"},
+		{"first", 80, "first line"},
+		{"last", 80, "last"},
+		{"nowhere", 10, "first line"},
+		{"tail", 200, "some padding before the secret key sk-abc123 and a long tail after it"},
+	} {
+		if got := Snippet(text, c.q, c.width); got != c.want {
+			t.Errorf("Snippet(%q, %d) = %q, want %q", c.q, c.width, got, c.want)
+		}
+	}
+}
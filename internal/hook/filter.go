@@ -0,0 +1,88 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	core "clipsync/internal"
+)
+
+/*──────── script filters ──────────────────────────────────────*/
+// Script is a user filter run as its own process, in whatever language
+// the command names (lua, python, …); see Starlark for one run in
+// process.  It gets
+//
+//	{"event": "send", "items": [ {…item…, "text": "…"} ]}
+//
+// on stdin and answers on stdout with the same shape.  "text" is the
+// decoded payload of text/plain items; edit it instead of payload.
+// Empty output leaves the items alone; "items": [] blocks the clip.
+type Script struct {
+	Cmd string // run through the shell, like Hook
+}
+
+type scriptItem struct {
+	core.Item
+	Text *string `json:"text,omitempty"`
+}
+
+type scriptIO struct {
+	Event string       `json:"event"`
+	Items []scriptItem `json:"items"`
+}
+
+// Filter runs the script on items until ctx ends.
+func (s Script) Filter(ctx context.Context, event string, items []core.Item) ([]core.Item, error) {
+	body, _ := json.Marshal(scriptIO{Event: event, Items: toScript(items)})
+
+	cmd := shell(ctx, s.Cmd)
+	cmd.Env = append(os.Environ(), "CLIPSYNC_EVENT="+event)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w: %s", event, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return items, nil
+	}
+
+	var res scriptIO
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("filter %s: bad output: %w", event, err)
+	}
+	return fromScript(res.Items), nil
+}
+
+// toScript adds "text" to text/plain items.
+func toScript(items []core.Item) []scriptItem {
+	out := make([]scriptItem, len(items))
+	for i, it := range items {
+		out[i].Item = it
+		if it.MimeType == "text/plain" {
+			if b, err := base64.StdEncoding.DecodeString(it.Payload); err == nil {
+				t := string(b)
+				out[i].Text = &t
+			}
+		}
+	}
+	return out
+}
+
+// fromScript folds an edited "text" back into the payload.
+func fromScript(items []scriptItem) []core.Item {
+	kept := make([]core.Item, len(items))
+	for i, si := range items {
+		kept[i] = si.Item
+		if si.Text != nil {
+			kept[i].Payload = base64.StdEncoding.EncodeToString([]byte(*si.Text))
+			kept[i].ByteLen = len(*si.Text)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package hook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+)
+
+func TestScriptRewritesText(t *testing.T) {
+	sc := Script{Cmd: `sed 's/?utm_source=[a-z]*//'`}
+	got, err := sc.Filter(context.Background(), "send", []core.Item{text("https://x.org/a?utm_source=mail")})
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	want := text("https://x.org/a")
+	if len(got) != 1 || got[0].Payload != want.Payload || got[0].ByteLen != 15 {
+		t.Fatalf("got %+v, want payload %s", got, want.Payload)
+	}
+}
+
+func TestScriptBlocksAndPassesThrough(t *testing.T) {
+	in := []core.Item{text("hi")}
+	if got, err := (Script{Cmd: `echo '{"items":[]}'`}).Filter(context.Background(), "receive", in); err != nil || len(got) != 0 {
+		t.Fatalf("block: got %v, %v", got, err)
+	}
+	if got, err := (Script{Cmd: `cat >/dev/null`}).Filter(context.Background(), "receive", in); err != nil || len(got) != 1 || got[0] != in[0] {
+		t.Fatalf("empty output must pass through: got %v, %v", got, err)
+	}
+}
+
+func TestScriptTimeLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := (Script{Cmd: "sleep 5"}).Filter(ctx, "send", nil); err == nil {
+		t.Fatalf("slow filter not stopped")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("time limit not enforced")
+	}
+}
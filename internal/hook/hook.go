@@ -0,0 +1,91 @@
+// Package hook tells the outside world when a clip is sent or received:
+// by running a user's program (metadata in CLIPSYNC_* environment
+// variables, the clip itself optionally on stdin), by POSTing to a
+// webhook (webhook.go), or with a desktop notification (notify.go).
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// DefaultTimeout bounds a hook that forgot to exit.
+const DefaultTimeout = 30 * time.Second
+
+type Hook struct {
+	Cmd     string        // run through the shell: cmd /C or sh -c
+	Stdin   bool          // pipe the first item's decoded bytes in
+	Timeout time.Duration // 0 = DefaultTimeout
+}
+
+// Fire runs h for event ("send" / "receive") and waits for it.  A
+// failing hook only returns its error; sync never depends on it.
+func (h Hook) Fire(event string, snap core.Snapshot) error {
+	if h.Cmd == "" {
+		return nil
+	}
+	to := h.Timeout
+	if to == 0 {
+		to = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), to)
+	defer cancel()
+
+	cmd := shell(ctx, h.Cmd)
+	cmd.Env = append(os.Environ(), Env(event, snap)...)
+	if h.Stdin && len(snap.Items) > 0 {
+		data, err := base64.StdEncoding.DecodeString(snap.Items[0].Payload)
+		if err != nil {
+			return fmt.Errorf("hook %s: payload: %w", event, err)
+		}
+		cmd.Stdin = bytes.NewReader(data)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("hook %s: %w: %s", event, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// shell runs line through the platform shell, killed when ctx ends.
+func shell(ctx context.Context, line string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", line)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", line)
+	}
+	cmd.WaitDelay = time.Second // grandchildren may hold the output pipe open
+	return cmd
+}
+
+// Env is the metadata a hook sees, as KEY=value pairs.
+func Env(event string, snap core.Snapshot) []string {
+	env := []string{
+		"CLIPSYNC_EVENT=" + event,
+		"CLIPSYNC_ORIGIN=" + snap.Origin,
+		"CLIPSYNC_TS=" + strconv.FormatInt(snap.TS, 10),
+		"CLIPSYNC_ITEMS=" + strconv.Itoa(len(snap.Items)),
+	}
+	if len(snap.Items) > 0 {
+		it := snap.Items[0]
+		n := it.ByteLen
+		if n == 0 {
+			b, _ := base64.StdEncoding.DecodeString(it.Payload)
+			n = len(b)
+		}
+		env = append(env,
+			"CLIPSYNC_FORMAT="+core.FormatKey(it),
+			"CLIPSYNC_BYTES="+strconv.Itoa(n),
+		)
+	}
+	return env
+}
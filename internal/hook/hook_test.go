@@ -0,0 +1,118 @@
+//go:build !windows
+
+package hook
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/a11y"
+)
+
+func TestFirePassesEnvAndStdin(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	h := Hook{
+		Cmd:   `{ echo "$CLIPSYNC_EVENT $CLIPSYNC_ORIGIN $CLIPSYNC_FORMAT $CLIPSYNC_BYTES"; cat; } > ` + out,
+		Stdin: true,
+	}
+	snap := core.Snapshot{Origin: "peer1", Items: []core.Item{{
+		MimeType: "text/plain",
+		Payload:  base64.StdEncoding.EncodeToString([]byte("https://example.com")),
+	}}}
+	if err := h.Fire("receive", snap); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	want := "receive peer1 text/plain 19\nhttps://example.com"
+	if string(got) != want {
+		t.Fatalf("hook saw %q, want %q", got, want)
+	}
+}
+
+func TestFireReportsFailureAndTimeout(t *testing.T) {
+	if err := (Hook{Cmd: "echo oops; exit 3"}).Fire("send", core.Snapshot{}); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("want failure with output, got %v", err)
+	}
+	start := time.Now()
+	if err := (Hook{Cmd: "sleep 5", Timeout: 100 * time.Millisecond}).Fire("send", core.Snapshot{}); err == nil {
+		t.Fatalf("hung hook not killed")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("timeout not enforced")
+	}
+}
+
+func TestNotifyConfirmAndDescribe(t *testing.T) {
+	snap := core.Snapshot{Origin: "laptop-a", Items: []core.Item{{MimeType: "image/png", ByteLen: 1258291}}}
+	if got := Describe(snap); got != "Received image (1.2 MB) from laptop-a" {
+		t.Fatalf("Describe: %q", got)
+	}
+	if got := (Notify{Verbosity: a11y.Brief}).Text(snap); got != "Clip received from laptop-a" {
+		t.Fatalf("brief: %q", got)
+	}
+	if got := (Notify{Verbosity: a11y.Full, Spoken: true}).Text(snap); got != "Received image (1.2 megabytes) from laptop-a. Formats: image/png" {
+		t.Fatalf("full, spoken: %q", got)
+	}
+
+	defer func(old func(context.Context, string, string, time.Duration) *exec.Cmd) { notifyCmd = old }(notifyCmd)
+	var body string
+	click := "echo skip"
+	notifyCmd = func(ctx context.Context, _, b string, _ time.Duration) *exec.Cmd {
+		body = b
+		return shell(ctx, click)
+	}
+	n := Notify{Hold: time.Second}
+	if n.Confirm(context.Background(), snap) || !strings.HasPrefix(body, "Received image") {
+		t.Fatalf("clicked notification let the clip through (body %q)", body)
+	}
+	click = "true"
+	if !n.Confirm(context.Background(), snap) {
+		t.Fatalf("ignored notification dropped the clip")
+	}
+	click = "exit 1" // no notifier installed
+	if !n.Confirm(context.Background(), snap) {
+		t.Fatalf("broken notifier dropped the clip")
+	}
+}
+
+func TestNotifyAskOversize(t *testing.T) {
+	defer func(old func(context.Context, string, string, time.Duration) *exec.Cmd) { notifyCmd = old }(notifyCmd)
+	var body, click string
+	notifyCmd = func(ctx context.Context, _, b string, _ time.Duration) *exec.Cmd {
+		body = b
+		return shell(ctx, click)
+	}
+	it := core.Item{MimeType: "image/png", ByteLen: 12 << 20}
+	b := core.Budget{Key: "image", Max: 10 << 20, Policy: core.BudgetAsk}
+	for cmd, want := range map[string]bool{"echo skip": true, "true": false, "exit 1": false} {
+		click = cmd
+		if got := (Notify{}).AskOversize(context.Background(), it, b); got != want {
+			t.Errorf("%q: send = %v", cmd, got)
+		}
+	}
+	if body != "Copied image/png (12.0 MB) is over its 10.0 MB limit; click to send it anyway" {
+		t.Fatalf("body %q", body)
+	}
+}
+
+func TestNotifyAskSecret(t *testing.T) {
+	defer func(old func(context.Context, string, string, time.Duration) *exec.Cmd) { notifyCmd = old }(notifyCmd)
+	var body string
+	notifyCmd = func(ctx context.Context, _, b string, _ time.Duration) *exec.Cmd {
+		body = b
+		return shell(ctx, "echo skip")
+	}
+	if !(Notify{}).AskSecret(context.Background(), "JWT", "eyJh… (212 chars)") {
+		t.Fatalf("click not taken for a yes")
+	}
+	if body != "Copied text looks like a JWT (eyJh… (212 chars)); click to send it anyway" {
+		t.Fatalf("body %q", body)
+	}
+}
@@ -0,0 +1,226 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/a11y"
+)
+
+/*──────── desktop notifications ──────────────────────────────*/
+// Notify shows a desktop notification for every received clip, with
+// what each OS ships: a tray balloon through PowerShell on Windows,
+// osascript on macOS, notify-send elsewhere.  Missing tools only make
+// Fire fail; sync goes on.
+type Notify struct {
+	// Hold > 0 asks before applying instead (Confirm): the clip waits
+	// this long, and clicking the notification drops it.
+	Hold time.Duration
+
+	// Verbosity is how much the text says (a11y.Normal: Describe).
+	Verbosity a11y.Verbosity
+	// Spoken spells out units ("1.2 megabytes") for screen readers.
+	Spoken bool
+}
+
+// notifyCmd builds the notification command; a test swaps it out.  It
+// prints "skip" if the user clicked within wait (0 = don't ask).
+var notifyCmd = osNotify
+
+// Fire shows the notification for a received clip, unless Confirm
+// already did.
+func (n Notify) Fire(event string, snap core.Snapshot) error {
+	if event != "receive" || n.Hold > 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	if out, err := notifyCmd(ctx, "clipsync", n.Text(snap), 0).CombinedOutput(); err != nil {
+		return fmt.Errorf("notify: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Confirm shows the notification for Hold and reports whether snap
+// may be applied: false only if the user clicked it.  A notification
+// that can't be shown lets the clip through.
+func (n Notify) Confirm(ctx context.Context, snap core.Snapshot) bool {
+	ctx, cancel := context.WithTimeout(ctx, n.Hold+5*time.Second)
+	defer cancel()
+	body := n.Text(snap) + "; skip it to keep your clipboard"
+	out, _ := notifyCmd(ctx, "clipsync", body, n.Hold).Output()
+	return !bytes.Contains(out, []byte("skip"))
+}
+
+// askWait is how long AskOversize and AskSecret wait for a click
+// without a Hold.
+const askWait = 15 * time.Second
+
+// AskOversize shows a notification for a copied item over its size
+// budget and reports whether to send it anyway: true only if the user
+// clicked it within Hold (15s if unset).  A notification that can't be
+// shown keeps the item back.
+func (n Notify) AskOversize(ctx context.Context, it core.Item, b core.Budget) bool {
+	size, limit := Size(it.ByteLen), Size(b.Max)
+	if n.Spoken {
+		size, limit = spokenSize(it.ByteLen), spokenSize(b.Max)
+	}
+	return n.ask(ctx, fmt.Sprintf("Copied %s (%s) is over its %s limit; click to send it anyway", core.FormatKey(it), size, limit))
+}
+
+// AskSecret is AskOversize for a copy that looks like a secret of this
+// kind; preview is redacted (see internal/secret).
+func (n Notify) AskSecret(ctx context.Context, kind, preview string) bool {
+	return n.ask(ctx, fmt.Sprintf("Copied text looks like a %s (%s); click to send it anyway", kind, preview))
+}
+
+// ask shows body and reports whether the user clicked it in time.
+func (n Notify) ask(ctx context.Context, body string) bool {
+	wait := n.Hold
+	if wait <= 0 {
+		wait = askWait
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait+5*time.Second)
+	defer cancel()
+	out, err := notifyCmd(ctx, "clipsync", body, wait).Output()
+	return err == nil && bytes.Contains(out, []byte("skip"))
+}
+
+// Describe is the notification text, e.g. "Received image (1.2 MB)
+// from laptop": the sender's device name, else its id.
+func Describe(snap core.Snapshot) string { return Notify{}.Text(snap) }
+
+// Text is the notification text at n's verbosity: "Clip received from
+// laptop" (Brief), Describe's (Normal), or that plus every format and
+// the time it was copied (Full).
+func (n Notify) Text(snap core.Snapshot) string {
+	from := snap.Origin
+	if snap.Name != "" {
+		from = snap.Name
+	}
+	if n.Verbosity == a11y.Brief {
+		return "Clip received from " + from
+	}
+	kind, size := "clip", 0
+	for i, it := range snap.Items {
+		if i == 0 {
+			if c := core.FormatClass(it); c != "" {
+				kind = c
+			}
+		}
+		if it.ByteLen > 0 {
+			size += it.ByteLen
+		} else {
+			size += base64.StdEncoding.DecodedLen(len(it.Payload))
+		}
+	}
+	sz := Size(size)
+	if n.Spoken {
+		sz = spokenSize(size)
+	}
+	text := fmt.Sprintf("Received %s (%s) from %s", kind, sz, from)
+	if n.Verbosity < a11y.Full {
+		return text
+	}
+	var formats []string
+	for _, it := range snap.Items {
+		formats = append(formats, core.FormatKey(it))
+	}
+	text += ". Formats: " + strings.Join(formats, ", ")
+	if snap.TS > 0 {
+		text += ". Copied at " + time.Unix(snap.TS, 0).Format("15:04:05")
+	}
+	return text
+}
+
+// Size is n bytes for people: "512 bytes", "1.2 MB".
+func Size(n int) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KB"
+	}
+	return strconv.Itoa(n) + " bytes"
+}
+
+// spokenSize is Size with the units written out, as a screen reader
+// should say them.
+func spokenSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " megabytes"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " kilobytes"
+	case n == 1:
+		return "1 byte"
+	}
+	return strconv.Itoa(n) + " bytes"
+}
+
+// osNotify passes title and body in the environment, so nothing in a
+// clip's description is ever parsed as script.
+func osNotify(ctx context.Context, title, body string, wait time.Duration) *exec.Cmd {
+	ms := strconv.FormatInt(max(wait, 5*time.Second).Milliseconds(), 10)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", winBalloon)
+	case "darwin":
+		if wait > 0 {
+			cmd = exec.CommandContext(ctx, "osascript", "-e", macDialog)
+		} else {
+			cmd = exec.CommandContext(ctx, "osascript", "-e",
+				`display notification (system attribute "CLIPSYNC_BODY") with title (system attribute "CLIPSYNC_TITLE")`)
+		}
+	default:
+		args := []string{"-a", "clipsync", "-t", ms}
+		if wait > 0 {
+			args = append(args, "--wait", "--action=skip=Skip")
+		}
+		cmd = exec.CommandContext(ctx, "notify-send", append(args, title, body)...)
+	}
+	cmd.Env = append(os.Environ(),
+		"CLIPSYNC_TITLE="+title,
+		"CLIPSYNC_BODY="+body,
+		"CLIPSYNC_WAIT_MS="+ms,
+		"CLIPSYNC_ASK="+strconv.FormatBool(wait > 0))
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// winBalloon shows a tray balloon until it times out or is clicked;
+// when asking, a click prints "skip".
+const winBalloon = `
+Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$script:clicked = $false
+$n.add_BalloonTipClicked({ $script:clicked = $true })
+$ms = [int]$env:CLIPSYNC_WAIT_MS
+$n.ShowBalloonTip($ms, $env:CLIPSYNC_TITLE, $env:CLIPSYNC_BODY, 'Info')
+$end = (Get-Date).AddMilliseconds($ms)
+while ((Get-Date) -lt $end -and -not $script:clicked) {
+  [System.Windows.Forms.Application]::DoEvents(); Start-Sleep -Milliseconds 100
+}
+if ($script:clicked -and $env:CLIPSYNC_ASK -eq 'true') { 'skip' }
+$n.Dispose()
+`
+
+// macDialog asks with a dialog that gives up on its own: macOS
+// notifications sent through osascript can't carry buttons.
+const macDialog = `
+set r to display dialog (system attribute "CLIPSYNC_BODY") with title (system attribute "CLIPSYNC_TITLE") ¬
+	buttons {"Skip", "Paste"} default button "Paste" giving up after ((system attribute "CLIPSYNC_WAIT_MS") / 1000)
+if button returned of r is "Skip" then return "skip"
+`
@@ -0,0 +1,82 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	core "clipsync/internal"
+
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+/*──────── Starlark filters ────────────────────────────────────*/
+// Starlark is a filter written in Starlark, the Python dialect, and run
+// inside clipsync: nothing to install and no process per clip.  The
+// file defines
+//
+//	def filter(event, items):
+//	    return items
+//
+// items are dicts shaped like Script's JSON items, "text" included, and
+// may be edited in place.  Returning None leaves the clip alone, []
+// blocks it.  The json module is predeclared; print goes to stderr.
+type Starlark struct {
+	fn starlark.Callable
+}
+
+var starPredeclared = starlark.StringDict{"json": starjson.Module}
+
+// LoadStarlark runs the file's top level once and finds its filter.
+func LoadStarlark(path string) (*Starlark, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := starlark.ExecFile(starThread(path), path, src, starPredeclared)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := globals["filter"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: no filter(event, items) function", path)
+	}
+	return &Starlark{fn: fn}, nil
+}
+
+// Filter calls the script's filter, stopping it once ctx ends.
+func (s *Starlark) Filter(ctx context.Context, event string, items []core.Item) ([]core.Item, error) {
+	th := starThread("filter " + event)
+	stop := context.AfterFunc(ctx, func() { th.Cancel(ctx.Err().Error()) })
+	defer stop()
+
+	body, _ := json.Marshal(toScript(items))
+	in, err := starlark.Call(th, starjson.Module.Members["decode"], starlark.Tuple{starlark.String(body)}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w", event, err)
+	}
+	res, err := starlark.Call(th, s.fn, starlark.Tuple{starlark.String(event), in}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w", event, err)
+	}
+	if res == starlark.None {
+		return items, nil
+	}
+	out, err := starlark.Call(th, starjson.Module.Members["encode"], starlark.Tuple{res}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: bad result: %w", event, err)
+	}
+	var kept []scriptItem
+	if err := json.Unmarshal([]byte(out.(starlark.String)), &kept); err != nil {
+		return nil, fmt.Errorf("filter %s: bad result: %w", event, err)
+	}
+	return fromScript(kept), nil
+}
+
+func starThread(name string) *starlark.Thread {
+	return &starlark.Thread{Name: name, Print: func(_ *starlark.Thread, msg string) {
+		fmt.Fprintln(os.Stderr, msg)
+	}}
+}
@@ -0,0 +1,96 @@
+package hook
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// text is a plain text item, as the filters' tests pass around.
+func text(s string) core.Item {
+	return core.Item{MimeType: "text/plain", Payload: base64.StdEncoding.EncodeToString([]byte(s))}
+}
+
+func loadStar(t *testing.T, src string) *Starlark {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "f.star")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadStarlark(path)
+	if err != nil {
+		t.Fatalf("LoadStarlark: %v", err)
+	}
+	return s
+}
+
+func TestStarlarkRewritesText(t *testing.T) {
+	s := loadStar(t, `
+def strip(url):
+    base, _, query = url.partition("?")
+    kept = [p for p in query.split("&") if p and not p.startswith("utm_")]
+    return base + ("?" + "&".join(kept) if kept else "")
+
+def filter(event, items):
+    for it in items:
+        if "text" in it:
+            it["text"] = strip(it["text"])
+    return items
+`)
+	got, err := s.Filter(context.Background(), "send", []core.Item{text("https://x.org/a?utm_source=mail&id=7")})
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	want := text("https://x.org/a?id=7")
+	if len(got) != 1 || got[0].Payload != want.Payload || got[0].ByteLen != 20 {
+		t.Fatalf("got %+v, want payload %s", got, want.Payload)
+	}
+}
+
+func TestStarlarkBlocksAndPassesThrough(t *testing.T) {
+	in := []core.Item{text("hi"), {MimeType: "image/png", Payload: "AAAA"}}
+	s := loadStar(t, `
+def filter(event, items):
+    if event == "receive":
+        return [it for it in items if it["mime_type"] != "image/png"]
+`)
+	if got, err := s.Filter(context.Background(), "receive", in); err != nil || len(got) != 1 || got[0].Payload != in[0].Payload {
+		t.Fatalf("drop image: got %v, %v", got, err)
+	}
+	if got, err := s.Filter(context.Background(), "send", in); err != nil || len(got) != 2 || got[1] != in[1] {
+		t.Fatalf("None must pass through: got %v, %v", got, err)
+	}
+}
+
+func TestStarlarkTimeLimit(t *testing.T) {
+	s := loadStar(t, `
+def filter(event, items):
+    n = 0
+    for i in range(1000000000):
+        n += i
+    return items
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := s.Filter(ctx, "send", nil); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("slow filter not stopped: %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("time limit not enforced")
+	}
+}
+
+func TestLoadStarlarkNeedsFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.star")
+	os.WriteFile(path, []byte("x = 1\n"), 0o600)
+	if _, err := LoadStarlark(path); err == nil {
+		t.Fatal("script without filter() loaded")
+	}
+}
@@ -0,0 +1,71 @@
+package hook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	core "clipsync/internal"
+)
+
+/*──────── webhook ─────────────────────────────────────────────*/
+// Webhook POSTs a small JSON Event per clip to a user's URL (Home
+// Assistant, a Slack relay, …).  Only metadata leaves the machine: the
+// hash lets a receiver tell clips apart without seeing them.
+type Webhook struct {
+	URL    string
+	Device string // this device's id
+	Client *http.Client
+}
+
+// Event is the JSON body of every webhook POST.
+type Event struct {
+	Event  string `json:"event"`  // "send" / "receive"
+	Device string `json:"device"` // who is reporting
+	Origin string `json:"origin"` // who copied the clip
+	TS     int64  `json:"ts"`
+	Format string `json:"format"` // first item, see core.FormatKey
+	Size   int    `json:"size"`   // its bytes
+	Items  int    `json:"items"`
+	Hash   string `json:"hash"` // first 16 hex of its sha256
+}
+
+// NewEvent describes snap without its content.
+func NewEvent(event, device string, snap core.Snapshot) Event {
+	ev := Event{Event: event, Device: device, Origin: snap.Origin, TS: snap.TS, Items: len(snap.Items)}
+	if len(snap.Items) > 0 {
+		it := snap.Items[0]
+		data, _ := base64.StdEncoding.DecodeString(it.Payload)
+		sum := sha256.Sum256(data)
+		ev.Format = core.FormatKey(it)
+		ev.Size = len(data)
+		ev.Hash = hex.EncodeToString(sum[:8])
+	}
+	return ev
+}
+
+// Fire POSTs the event for snap and waits for the reply.
+func (w Webhook) Fire(event string, snap core.Snapshot) error {
+	if w.URL == "" {
+		return nil
+	}
+	cli := w.Client
+	if cli == nil {
+		cli = &http.Client{Timeout: 10 * time.Second}
+	}
+	body, _ := json.Marshal(NewEvent(event, w.Device, snap))
+	resp, err := cli.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", event, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: status %d", event, resp.StatusCode)
+	}
+	return nil
+}
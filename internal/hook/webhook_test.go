@@ -0,0 +1,50 @@
+package hook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	core "clipsync/internal"
+)
+
+func TestWebhookPostsMetadataOnly(t *testing.T) {
+	var ev Event
+	var raw string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		raw = string(b)
+		_ = json.Unmarshal([]byte(raw), &ev)
+	}))
+	defer ts.Close()
+
+	snap := core.Snapshot{Origin: "peer1", TS: 42, Items: []core.Item{{
+		MimeType: "text/plain",
+		Payload:  base64.StdEncoding.EncodeToString([]byte("top secret")),
+	}}}
+	if err := (Webhook{URL: ts.URL, Device: "me"}).Fire("receive", snap); err != nil {
+		t.Fatalf("Fire: %v", err)
+	}
+	want := Event{Event: "receive", Device: "me", Origin: "peer1", TS: 42,
+		Format: "text/plain", Size: 10, Items: 1, Hash: ev.Hash}
+	if ev != want || len(ev.Hash) != 16 {
+		t.Fatalf("got %+v", ev)
+	}
+	if strings.Contains(raw, "secret") || strings.Contains(raw, snap.Items[0].Payload) {
+		t.Fatalf("clip content leaked into webhook: %s", raw)
+	}
+}
+
+func TestWebhookReportsHTTPErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer ts.Close()
+	if (Webhook{URL: ts.URL}).Fire("send", core.Snapshot{}) == nil {
+		t.Fatalf("500 not reported")
+	}
+}
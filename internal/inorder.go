@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*──────── strict per-origin order ─────────────────────────────*/
+// InOrder releases each origin's snapshots in Snapshot.N order.  One
+// that arrives early is held until the ones before it show up, or
+// until it has waited wait: then the gap is given up on and everything
+// held is released in order.  Snapshots older than what was already
+// released are dropped.  N 0 (peers that don't number) passes as is;
+// N 1 from a known origin means it restarted.  The first snapshot from
+// a new origin is held too, unless it is N 1.
+type InOrder struct {
+	mu   sync.Mutex
+	wait time.Duration
+	next map[string]uint64 // origin → N expected next
+	held map[string][]heldSnap
+}
+
+type heldSnap struct {
+	snap Snapshot
+	at   time.Time
+}
+
+func NewInOrder(wait time.Duration) *InOrder {
+	return &InOrder{wait: wait, next: make(map[string]uint64), held: make(map[string][]heldSnap)}
+}
+
+// Push takes a snapshot and returns those now ready, oldest first;
+// ok is false if s came too late and was dropped.
+func (o *InOrder) Push(s Snapshot, now time.Time) (ready []Snapshot, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	next, known := o.next[s.Origin]
+	switch {
+	case s.N == 0:
+		return []Snapshot{s}, true
+	case !known:
+		next = 1 // joined mid-stream: earlier ones may still be coming
+	case s.N == 1 && next > 1:
+		delete(o.held, s.Origin) // the origin restarted
+		next = 1
+	case s.N < next:
+		return nil, false
+	}
+	h := o.held[s.Origin]
+	i := sort.Search(len(h), func(i int) bool { return h[i].snap.N >= s.N })
+	if i < len(h) && h[i].snap.N == s.N {
+		return nil, false // a duplicate of one already held
+	}
+	h = append(h[:i], append([]heldSnap{{s, now}}, h[i:]...)...)
+	o.held[s.Origin], o.next[s.Origin] = h, next
+	return o.release(s.Origin, false), true
+}
+
+// Due gives up on gaps that have been waited on long enough and returns
+// what that releases.
+func (o *InOrder) Due(now time.Time) []Snapshot {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var ready []Snapshot
+	for origin, h := range o.held {
+		if len(h) > 0 && now.Sub(h[0].at) >= o.wait {
+			ready = append(ready, o.release(origin, true)...)
+		}
+	}
+	return ready
+}
+
+// release pops origin's held run that starts at next; skip lets it
+// jump the gap first.
+func (o *InOrder) release(origin string, skip bool) []Snapshot {
+	h, next := o.held[origin], o.next[origin]
+	var ready []Snapshot
+	for len(h) > 0 && (h[0].snap.N == next || skip) {
+		ready = append(ready, h[0].snap)
+		next = h[0].snap.N + 1
+		h, skip = h[1:], false
+	}
+	if len(h) == 0 {
+		delete(o.held, origin)
+	} else {
+		o.held[origin] = h
+	}
+	o.next[origin] = next
+	return ready
+}
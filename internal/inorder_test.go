@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func ns(snaps []Snapshot) []uint64 {
+	var out []uint64
+	for _, s := range snaps {
+		out = append(out, s.N)
+	}
+	return out
+}
+
+func TestInOrderHoldsUntilGapFills(t *testing.T) {
+	o := NewInOrder(time.Second)
+	t0 := time.Now()
+	push := func(n uint64, at time.Duration) []uint64 {
+		ready, _ := o.Push(Snapshot{Origin: "a", N: n}, t0.Add(at))
+		return ns(ready)
+	}
+	if got := push(1, 0); len(got) != 1 {
+		t.Fatalf("first in line held: %v", got)
+	}
+	if got := push(3, 0); len(got) != 0 {
+		t.Fatalf("3 released before 2: %v", got)
+	}
+	if got := push(2, 100*time.Millisecond); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("gap filled, want [2 3], got %v", got)
+	}
+	if _, ok := o.Push(Snapshot{Origin: "a", N: 2}, t0); ok {
+		t.Fatalf("late duplicate accepted")
+	}
+
+	// 5 never comes: 6 and 7 go after the wait
+	push(6, time.Second)
+	push(7, time.Second)
+	if got := ns(o.Due(t0.Add(1500 * time.Millisecond))); len(got) != 0 {
+		t.Fatalf("released before the wait: %v", got)
+	}
+	if got := ns(o.Due(t0.Add(2 * time.Second))); len(got) != 2 || got[0] != 6 {
+		t.Fatalf("want [6 7] after the wait, got %v", got)
+	}
+	if got := push(4, 2*time.Second); len(got) != 0 {
+		t.Fatalf("skipped-over snapshot applied: %v", got)
+	}
+
+	if got := push(1, 3*time.Second); len(got) != 1 {
+		t.Fatalf("restarted origin held: %v", got)
+	}
+	if ready, ok := o.Push(Snapshot{Origin: "old"}, t0); !ok || len(ready) != 1 {
+		t.Fatalf("unnumbered snapshot held")
+	}
+}
+
+func TestInOrderNewOriginMidStream(t *testing.T) {
+	o := NewInOrder(time.Second)
+	t0 := time.Now()
+	if ready, _ := o.Push(Snapshot{Origin: "b", N: 41}, t0); len(ready) != 0 {
+		t.Fatalf("first contact released at once")
+	}
+	if ready, _ := o.Push(Snapshot{Origin: "b", N: 40}, t0); len(ready) != 0 {
+		t.Fatalf("want both held for the wait")
+	}
+	if got := ns(o.Due(t0.Add(time.Second))); len(got) != 2 || got[0] != 40 {
+		t.Fatalf("want [40 41], got %v", got)
+	}
+}
@@ -0,0 +1,264 @@
+// Package interop produces and checks reference vectors for everything
+// a non-Go peer must reproduce byte for byte: the auth token, qkey, ack
+// key, chunk slicing and the bytes a -sign signature covers.  Sealed
+// clips (-ring) and gzip bodies (-compress) are random or up to the
+// compressor, so their vectors go the other way: a fixed input and the
+// clip or body it opens to.  A peer checks it opens ours, and puts its
+// own sealed or gzipped bytes in Input for Check to open.
+package interop
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	core "clipsync/internal"
+	netw "clipsync/internal/net"
+	"clipsync/internal/seal"
+	"clipsync/internal/sign"
+)
+
+// Vector is one input → expected output pair.
+type Vector struct {
+	Name   string          `json:"name"`
+	Kind   string          `json:"kind"`
+	Input  json.RawMessage `json:"input"`
+	Output json.RawMessage `json:"output"`
+}
+
+/*──────── kinds ───────────────────────────────────────────────*/
+
+// authIn is a token without a nonce, as older clients send, unless
+// Nonce is set: then it carries the counter N and a MAC over both.
+type authIn struct {
+	KeyHex string `json:"key_hex"`
+	TS     int64  `json:"ts"`
+	Nonce  string `json:"nonce,omitempty"`
+	N      uint64 `json:"n,omitempty"`
+}
+
+type itemsIn struct {
+	Items []core.Item `json:"items"`
+}
+
+// chunkIn describes the body instead of embedding it: pattern repeated
+// up to length bytes.
+type chunkIn struct {
+	Pattern string `json:"pattern"`
+	Length  int    `json:"length"`
+}
+
+// sigIn signs Snap with the key for a 32-byte seed; Ed25519 is
+// deterministic, so the signature is fixed too.
+type sigIn struct {
+	SeedHex string        `json:"seed_hex"`
+	Snap    core.Snapshot `json:"snapshot"`
+}
+
+// sealIn opens Items, sealed for Ring's room, as the device with the
+// X25519 private key DeviceKeyHex.
+type sealIn struct {
+	DeviceKeyHex string      `json:"device_key_hex"`
+	Ring         seal.Ring   `json:"ring"`
+	Items        []core.Item `json:"items"`
+}
+
+// bodyIn is an HTTP or WS body as sent, gzipped or not.
+type bodyIn struct {
+	BodyB64 string `json:"body_b64"`
+}
+
+type chunkOut struct {
+	Inline bool        `json:"inline"`
+	Chunks []chunkMeta `json:"chunks"`
+}
+
+type chunkMeta struct {
+	Len    int    `json:"len"`
+	SHA256 string `json:"sha256"`
+}
+
+// compute runs this package's implementation for one vector.
+func compute(kind string, in json.RawMessage) (any, error) {
+	switch kind {
+	case "auth_token":
+		var a authIn
+		if err := json.Unmarshal(in, &a); err != nil {
+			return nil, err
+		}
+		tok, err := netw.AuthTokenNonce(a.KeyHex, a.TS, a.Nonce, a.N)
+		return map[string]string{"token": tok}, err
+	case "qkey":
+		var it itemsIn
+		if err := json.Unmarshal(in, &it); err != nil {
+			return nil, err
+		}
+		return map[string]string{"qkey_hex": hex.EncodeToString([]byte(core.QuickKey(it.Items)))}, nil
+	case "content_hash":
+		var it itemsIn
+		if err := json.Unmarshal(in, &it); err != nil {
+			return nil, err
+		}
+		return map[string]string{"hash": core.ContentHash(it.Items)}, nil
+	case "ack_key":
+		var s core.Snapshot
+		if err := json.Unmarshal(in, &s); err != nil {
+			return nil, err
+		}
+		return map[string]string{"ack": core.AckKey(s)}, nil
+	case "chunks":
+		var c chunkIn
+		if err := json.Unmarshal(in, &c); err != nil {
+			return nil, err
+		}
+		if c.Pattern == "" || c.Length < 0 {
+			return nil, fmt.Errorf("bad chunk input")
+		}
+		body := []byte(strings.Repeat(c.Pattern, c.Length/len(c.Pattern)+1)[:c.Length])
+		out := chunkOut{Inline: netw.Inline(len(body))}
+		for _, p := range netw.Chunks(body) {
+			sum := sha256.Sum256(p)
+			out.Chunks = append(out.Chunks, chunkMeta{Len: len(p), SHA256: hex.EncodeToString(sum[:])})
+		}
+		return out, nil
+	case "signature":
+		var si sigIn
+		if err := json.Unmarshal(in, &si); err != nil {
+			return nil, err
+		}
+		seed, err := hex.DecodeString(si.SeedHex)
+		if err != nil || len(seed) != 32 {
+			return nil, fmt.Errorf("bad seed")
+		}
+		snap := si.Snap
+		sign.KeyFromSeed(seed).Sign(&snap)
+		return map[string]string{"message": string(sign.Message(snap)), "sig_key": snap.SigKey, "sig": snap.Sig}, nil
+	case "seal_open":
+		var si sealIn
+		if err := json.Unmarshal(in, &si); err != nil {
+			return nil, err
+		}
+		priv, err := hex.DecodeString(si.DeviceKeyHex)
+		if err != nil {
+			return nil, fmt.Errorf("bad device key")
+		}
+		d, err := seal.DeviceFromKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		s, err := seal.NewSealer(d, &si.Ring)
+		if err != nil {
+			return nil, err
+		}
+		items, err := s.Open(si.Items)
+		return map[string][]core.Item{"items": items}, err
+	case "body":
+		var bi bodyIn
+		if err := json.Unmarshal(in, &bi); err != nil {
+			return nil, err
+		}
+		raw, err := base64.StdEncoding.DecodeString(bi.BodyB64)
+		if err != nil {
+			return nil, err
+		}
+		body, err := netw.DecodeBody(raw, 64<<20)
+		return map[string]string{"body": string(body)}, err
+	}
+	return nil, fmt.Errorf("unknown kind %q", kind)
+}
+
+/*──────── gen / check ─────────────────────────────────────────*/
+
+// canonical inputs; append, never reorder or change
+var inputs = []struct {
+	name, kind string
+	in         any
+}{
+	{"auth-basic", "auth_token", authIn{KeyHex: "deadbeefdeadbeef", TS: 1700000000}},
+	{"auth-negative-xor", "auth_token", authIn{KeyHex: "ffffffffffffffff", TS: 1}},
+	{"qkey-empty", "qkey", itemsIn{}},
+	{"qkey-text", "qkey", itemsIn{[]core.Item{{Fmt: 13, Payload: "aGVsbG8=", ByteLen: 5}}}},
+	{"qkey-two-items", "qkey", itemsIn{[]core.Item{{Payload: "YQ=="}, {Payload: "Yg=="}}}},
+	{"ack-text", "ack_key", core.Snapshot{TS: 1700000000, Items: []core.Item{{Payload: "aGVsbG8="}}}},
+	{"chunks-inline", "chunks", chunkIn{"0123456789abcdef", 1000}},
+	{"chunks-exact", "chunks", chunkIn{"0123456789abcdef", 300 * 1024}},
+	{"chunks-three", "chunks", chunkIn{"0123456789abcdef", 700000}},
+	{"signature-clip", "signature", sigIn{strings.Repeat("01", 32), core.Snapshot{
+		Origin: "ab12cd34", TS: 1700000000, Seq: 7, N: 3, Name: "laptop <home>",
+		Items: []core.Item{{Fmt: 13, Payload: "aGVsbG8=", ByteLen: 5, FmtName: "CF_UNICODETEXT", MimeType: "text/plain"}},
+	}}},
+	{"signature-ack", "signature", sigIn{strings.Repeat("01", 32), core.Snapshot{
+		Origin: "ab12cd34", TS: 1700000001, Kind: core.KindAck, Ack: "abcd-1700000000", Quick: "ignored", Room: "team",
+	}}},
+	{"qkey-same-bytes-two-formats", "qkey", itemsIn{[]core.Item{
+		{Fmt: 13, FmtName: "CF_UNICODETEXT", Payload: "aGVsbG8="},
+		{Fmt: 0xC0AA, FmtName: "HTML Format", Payload: "aGVsbG8="},
+	}}},
+	{"content-hash-empty", "content_hash", itemsIn{}},
+	{"content-hash-text", "content_hash", itemsIn{[]core.Item{{Fmt: 13, Payload: "aGVsbG8=", ByteLen: 5}}}},
+	{"auth-nonce", "auth_token", authIn{KeyHex: "deadbeefdeadbeef", TS: 1700000000, Nonce: "0123456789abcdef", N: 42}},
+	{"seal-open", "seal_open", sealIn{
+		DeviceKeyHex: strings.Repeat("02", 32),
+		Ring: seal.Ring{Room: "team", Epoch: 3, Members: map[string]string{
+			"zo060cy2M+x7cMF4FKXHbs0CloUFDTRHRboFhw5YfVk=": "brTTKFSk1xAUDZSkgbhOmYf1Ek68u3Spbm7skNSMGA/bfsFDjRoNLiWK0vC+UU/OxMwpnBfv5K726Mg23/0FFMJbXALAUx620j/8nhlJB0DSvVO1zA1EzFzJ4iw=",
+		}},
+		Items: []core.Item{{MimeType: seal.Mime, FmtName: "epoch 3", ByteLen: 113,
+			Payload: "7xSzqaWQDCbzbHyG4Z3wRXbmy+tVCYbwT84s6MwRySkjfeC0UlEMM1l5GMyfT/inHloJmzF85pE8lvF2nXCW94MsgFbTfUIbdiUGtBnWDhTViAH/+WMBTT6Q4RAXGfrYS1LlMPsQ9j7uAWlWmgqJmm0="}},
+	}},
+	{"body-gzip", "body", bodyIn{gzipped(`{"origin":"ab12cd34","ts":1700000000,"items":[{"fmt":13,"payload":"aGVsbG8=","byte_len":5}]}`)}},
+	{"body-plain", "body", bodyIn{base64.StdEncoding.EncodeToString([]byte(`{"origin":"ab12cd34","ts":1700000000}`))}},
+}
+
+// gzipped is body as a sender with -compress puts it on the wire.
+func gzipped(body string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(body))
+	zw.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// Generate returns the reference vectors.
+func Generate() ([]Vector, error) {
+	var vs []Vector
+	for _, c := range inputs {
+		in, _ := json.Marshal(c.in)
+		out, err := compute(c.kind, in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		ob, _ := json.Marshal(out)
+		vs = append(vs, Vector{Name: c.name, Kind: c.kind, Input: in, Output: ob})
+	}
+	return vs, nil
+}
+
+// Check recomputes every vector and returns one error per mismatch;
+// vectors from another implementation pass iff it agrees with ours.
+func Check(vs []Vector) []error {
+	var errs []error
+	for _, v := range vs {
+		out, err := compute(v.Kind, v.Input)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.Name, err))
+			continue
+		}
+		ob, _ := json.Marshal(out)
+		var want, got any
+		if err := json.Unmarshal(v.Output, &want); err != nil {
+			errs = append(errs, fmt.Errorf("%s: output: %w", v.Name, err))
+			continue
+		}
+		_ = json.Unmarshal(ob, &got)
+		if !reflect.DeepEqual(want, got) {
+			errs = append(errs, fmt.Errorf("%s: expected %s, this implementation gives %s", v.Name, v.Output, ob))
+		}
+	}
+	return errs
+}
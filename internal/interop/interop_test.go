@@ -0,0 +1,96 @@
+package interop
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGenerateThenCheck(t *testing.T) {
+	vs, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Check(vs); len(errs) != 0 {
+		t.Fatalf("fresh vectors fail: %v", errs)
+	}
+}
+
+func TestCheckCatchesMismatch(t *testing.T) {
+	vs, _ := Generate()
+	vs[0].Output = json.RawMessage(`{"token":"bogus"}`)
+	if errs := Check(vs); len(errs) != 1 {
+		t.Fatalf("want exactly one mismatch, got %v", errs)
+	}
+}
+
+func TestChunkBoundaries(t *testing.T) {
+	vs, _ := Generate()
+	for _, v := range vs {
+		if v.Kind != "chunks" {
+			continue
+		}
+		var out chunkOut
+		_ = json.Unmarshal(v.Output, &out)
+		switch v.Name {
+		case "chunks-exact":
+			if !out.Inline || len(out.Chunks) != 1 {
+				t.Errorf("%s: %+v", v.Name, out)
+			}
+		case "chunks-three":
+			if out.Inline || len(out.Chunks) != 3 || out.Chunks[2].Len != 700000-2*300*1024 {
+				t.Errorf("%s: %+v", v.Name, out)
+			}
+		}
+	}
+}
+
+// The token with a nonce is the one servers require; its bytes are
+// pinned, worked out by hand as HMAC-SHA256(key, "ts.nonce.n")[:16].
+func TestAuthNonceVector(t *testing.T) {
+	const want = `{"ts":1700000000,"ts_enc":-2401053089458139153,"nonce":"0123456789abcdef","n":42,"mac":"417b1ccc09b8e94afd8cb3580cd51b33"}`
+	vs, _ := Generate()
+	for _, v := range vs {
+		if v.Name != "auth-nonce" {
+			continue
+		}
+		var out struct{ Token string }
+		_ = json.Unmarshal(v.Output, &out)
+		if raw, _ := base64.StdEncoding.DecodeString(out.Token); string(raw) != want {
+			t.Fatalf("token %s, want %s", raw, want)
+		}
+		return
+	}
+	t.Fatal("no auth-nonce vector")
+}
+
+// The sealed and gzipped vectors open to what went in, and a sealed
+// clip that was tampered with doesn't.
+func TestOpeningVectors(t *testing.T) {
+	vs, _ := Generate()
+	want := map[string]string{
+		"seal-open":  `{"items":[{"fmt":13,"payload":"aGVsbG8=","byte_len":5,"fmt_name":"","mime_type":"text/plain"}]}`,
+		"body-gzip":  `{"body":"{\"origin\":\"ab12cd34\",\"ts\":1700000000,\"items\":[{\"fmt\":13,\"payload\":\"aGVsbG8=\",\"byte_len\":5}]}"}`,
+		"body-plain": `{"body":"{\"origin\":\"ab12cd34\",\"ts\":1700000000}"}`,
+	}
+	for _, v := range vs {
+		w, ok := want[v.Name]
+		if !ok {
+			continue
+		}
+		delete(want, v.Name)
+		if string(v.Output) != w {
+			t.Errorf("%s: %s, want %s", v.Name, v.Output, w)
+		}
+		if v.Kind == "seal_open" {
+			v.Input = json.RawMessage(strings.Replace(string(v.Input), `"payload":"7x`, `"payload":"8x`, 1))
+			if errs := Check([]Vector{v}); len(errs) != 1 {
+				t.Errorf("tampered clip opened: %v", errs)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("vectors missing: %v", want)
+	}
+}
@@ -0,0 +1,97 @@
+// Package kdf turns a human passphrase into the transport key -key
+// expects, through Argon2id (RFC 9106).  The cost parameters and salt
+// can ride in the -key value itself, so every device derives the same
+// key without a config file; `clipsync derive-key` prints the result
+// for the server and for peers that want the hex form.
+package kdf
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Params are Argon2id's costs.  Every device must use the same ones.
+type Params struct {
+	Memory  uint32 // KiB
+	Time    uint32 // passes
+	Threads uint8
+	Salt    string
+}
+
+// Default is what a bare passphrase is derived with: the RFC 9106
+// second recommended option, a fraction of a second on a laptop.
+var Default = Params{Memory: 64 * 1024, Time: 3, Threads: 4, Salt: "clipsync transport key"}
+
+// Prefix marks a -key that carries its own parameters:
+// "argon2id:m=65536,t=3,p=4,salt=team:passphrase".
+const Prefix = "argon2id:"
+
+// TransportKey resolves a -key value to 16 hex characters: hex as is,
+// anything else a passphrase, optionally with parameters after Prefix.
+func TransportKey(key string) (hexKey string, derived bool, err error) {
+	if b, err := hex.DecodeString(key); err == nil && len(b) == 8 {
+		return key, false, nil
+	}
+	if key == "" {
+		return "", false, errors.New("kdf: empty key")
+	}
+	p, pass := Default, key
+	if rest, ok := strings.CutPrefix(key, Prefix); ok {
+		spec, phrase, ok := strings.Cut(rest, ":")
+		if !ok || phrase == "" {
+			return "", false, fmt.Errorf("kdf: want %sparams:passphrase", Prefix)
+		}
+		if p, err = ParseParams(spec); err != nil {
+			return "", false, err
+		}
+		pass = phrase
+	}
+	return hex.EncodeToString(IDKey([]byte(pass), []byte(p.Salt), p, 8)), true, nil
+}
+
+// ParseParams reads "m=65536,t=3,p=4,salt=..."; fields left out keep
+// their Default value.
+func ParseParams(spec string) (Params, error) {
+	p := Default
+	for _, f := range strings.Split(spec, ",") {
+		if f == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(f, "=")
+		if k == "salt" {
+			p.Salt = v
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		switch {
+		case err != nil || n == 0:
+			return p, fmt.Errorf("kdf: bad %q", f)
+		case k == "m":
+			p.Memory = uint32(n)
+		case k == "t":
+			p.Time = uint32(n)
+		case k == "p" && n < 256:
+			p.Threads = uint8(n)
+		default:
+			return p, fmt.Errorf("kdf: unknown parameter %q", f)
+		}
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return p, fmt.Errorf("kdf: m must be at least 8 KiB per thread")
+	}
+	if len(p.Salt) < 8 {
+		return p, fmt.Errorf("kdf: salt must be at least 8 bytes")
+	}
+	return p, nil
+}
+
+// IDKey is Argon2id of password and salt with p's costs (p.Salt is not
+// used), keyLen bytes long.
+func IDKey(password, salt []byte, p Params, keyLen uint32) []byte {
+	return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, keyLen)
+}
@@ -0,0 +1,41 @@
+package kdf
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Keys derived before and after any change to the derivation must
+// match, or devices on different releases stop hearing each other.
+func TestDerivedKeysPinned(t *testing.T) {
+	got := IDKey([]byte("correct horse"), []byte("clipsync test salt"), Params{Memory: 64, Time: 2, Threads: 2}, 8)
+	if hex.EncodeToString(got) != "1a9ea9657a15d36a" {
+		t.Errorf("IDKey = %x", got)
+	}
+	if k, _, err := TransportKey("correct horse battery staple"); err != nil || k != "1cd0900eaed92f70" {
+		t.Errorf("default parameters: %s, %v", k, err)
+	}
+}
+
+func TestTransportKey(t *testing.T) {
+	if k, derived, err := TransportKey("0123456789abcdef"); err != nil || derived || k != "0123456789abcdef" {
+		t.Fatalf("hex key: %q %v %v", k, derived, err)
+	}
+	cheap := Prefix + "m=64,t=1,p=1,salt=unit-test:correct horse"
+	a, derived, err := TransportKey(cheap)
+	if err != nil || !derived || len(a) != 16 {
+		t.Fatalf("passphrase: %q %v %v", a, derived, err)
+	}
+	if b, _, _ := TransportKey(cheap); b != a {
+		t.Fatalf("derivation not deterministic: %s vs %s", a, b)
+	}
+	if b, _, _ := TransportKey(strings.Replace(cheap, "t=1", "t=2", 1)); b == a {
+		t.Fatalf("parameters don't change the key")
+	}
+	for _, bad := range []string{"", Prefix + "m=64", Prefix + "m=4,p=1:x", Prefix + "q=1:x", Prefix + "salt=short:x"} {
+		if _, _, err := TransportKey(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
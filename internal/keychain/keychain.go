@@ -0,0 +1,61 @@
+// Package keychain keeps clipsync's secrets in the OS's own store: the
+// login keychain on macOS, Credential Manager on Windows and the Secret
+// Service (GNOME Keyring, KWallet) over D-Bus on Linux.  They
+// are unlocked with the user's login, so what they hold is not on disk
+// in a form a stolen drive gives away.
+package keychain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Service is the name clipsync's entries are filed under.
+const Service = "clipsync"
+
+// ErrUnavailable means this platform or session has no keychain
+// clipsync can use (no D-Bus session, no Secret Service, …).
+var ErrUnavailable = errors.New("keychain: no OS keychain available")
+
+// errNotFound is a backend's get for an account that is certainly not
+// there; any doubt is another error, or Key would replace a key it
+// merely failed to read.
+var errNotFound = errors.New("keychain: not found")
+
+// backend reads and writes one secret per account, as text.
+type backend interface {
+	get(account string) (string, error) // errNotFound if missing
+	set(account, secret string) error
+}
+
+// native is this platform's keychain; tests swap it.
+var native backend = platform()
+
+// Key is the 32-byte key stored for account, made and stored on first
+// use.  A new key is read back before it is handed out, so nothing is
+// sealed under one the keychain didn't keep.
+func Key(account string) ([]byte, error) {
+	s, err := native.get(account)
+	if errors.Is(err, errNotFound) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := native.set(account, hex.EncodeToString(key)); err != nil {
+			return nil, fmt.Errorf("keychain: store %s key: %w", account, err)
+		}
+		if s, err := native.get(account); err != nil || s != hex.EncodeToString(key) {
+			return nil, fmt.Errorf("keychain: %s key didn't stick", account)
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("keychain: %s/%s is not a clipsync key", Service, account)
+	}
+	return key, nil
+}
@@ -0,0 +1,34 @@
+package keychain
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// security is the login keychain through /usr/bin/security.
+type security struct{}
+
+func platform() backend { return security{} }
+
+func (security) get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w").Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 44 { // errSecItemNotFound
+		return "", errNotFound
+	} else if errors.Is(err, exec.ErrNotFound) {
+		return "", ErrUnavailable
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// set hands security its command on stdin (-i), so the secret never
+// sits in an argument list where ps shows it.
+func (security) set(account, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", Service, account, secret))
+	return cmd.Run()
+}
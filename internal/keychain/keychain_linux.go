@@ -0,0 +1,148 @@
+package keychain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// secretService is the freedesktop Secret Service (GNOME Keyring,
+// KWallet) on the session bus.  Entries carry the attributes secret-tool
+// files them under, so keys either one stored are found by both.
+type secretService struct{}
+
+func platform() backend { return secretService{} }
+
+const (
+	ssName    = "org.freedesktop.secrets"
+	ssPath    = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssDefault = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	ssService = "org.freedesktop.Secret.Service"
+	ssPrompt  = "org.freedesktop.Secret.Prompt"
+	noPrompt  = dbus.ObjectPath("/")
+)
+
+// promptWait is how long a keyring's unlock dialog may stay open.
+const promptWait = 2 * time.Minute
+
+var errDismissed = errors.New("keychain: unlock dismissed")
+
+// ssSecret is the Secret Service's Secret struct, (oayays).
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func attributes(account string) map[string]string {
+	return map[string]string{"xdg:schema": "org.freedesktop.Secret.Generic", "service": Service, "account": account}
+}
+
+// open connects and starts a plain session: the secret only crosses the
+// user's own bus.  Without a bus or a Secret Service on it there is no
+// keychain.
+func open() (*dbus.Conn, dbus.ObjectPath, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, "", ErrUnavailable
+	}
+	var out dbus.Variant
+	var session dbus.ObjectPath
+	if err := conn.Object(ssName, ssPath).Call(ssService+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&out, &session); err != nil {
+		conn.Close()
+		return nil, "", ErrUnavailable
+	}
+	return conn, session, nil
+}
+
+// get reports errNotFound only when the search comes back empty; a
+// locked keyring the user won't open is an error, so Key doesn't
+// replace a key it couldn't read.
+func (secretService) get(account string) (string, error) {
+	conn, session, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	svc := conn.Object(ssName, ssPath)
+	var unlocked, locked []dbus.ObjectPath
+	if err := svc.Call(ssService+".SearchItems", 0, attributes(account)).Store(&unlocked, &locked); err != nil {
+		return "", fmt.Errorf("keychain: search: %w", err)
+	}
+	if len(unlocked) == 0 && len(locked) == 0 {
+		return "", errNotFound
+	}
+	if len(unlocked) == 0 {
+		var p dbus.ObjectPath
+		if err := svc.Call(ssService+".Unlock", 0, locked).Store(&unlocked, &p); err != nil {
+			return "", fmt.Errorf("keychain: unlock: %w", err)
+		}
+		if p != noPrompt {
+			v, err := prompt(conn, p)
+			if err != nil {
+				return "", err
+			}
+			unlocked, _ = v.Value().([]dbus.ObjectPath)
+		}
+		if len(unlocked) == 0 {
+			return "", errDismissed
+		}
+	}
+	var s ssSecret
+	if err := conn.Object(ssName, unlocked[0]).Call("org.freedesktop.Secret.Item.GetSecret", 0, session).Store(&s); err != nil {
+		return "", fmt.Errorf("keychain: read: %w", err)
+	}
+	return string(s.Value), nil
+}
+
+func (secretService) set(account, secret string) error {
+	conn, session, err := open()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	props := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(Service + " " + account),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(attributes(account)),
+	}
+	s := ssSecret{Session: session, Parameters: []byte{}, Value: []byte(secret), ContentType: "text/plain"}
+	var item, p dbus.ObjectPath
+	err = conn.Object(ssName, ssDefault).Call("org.freedesktop.Secret.Collection.CreateItem", 0, props, s, true).Store(&item, &p)
+	if err == nil && p != noPrompt {
+		_, err = prompt(conn, p)
+	}
+	return err
+}
+
+// prompt shows the keyring's own dialog (to unlock it, say) and waits
+// for it to close; the result is what the call it stood in for returns.
+func prompt(conn *dbus.Conn, p dbus.ObjectPath) (dbus.Variant, error) {
+	if err := conn.AddMatchSignal(dbus.WithMatchObjectPath(p), dbus.WithMatchInterface(ssPrompt), dbus.WithMatchMember("Completed")); err != nil {
+		return dbus.Variant{}, err
+	}
+	sigs := make(chan *dbus.Signal, 4)
+	conn.Signal(sigs)
+	defer conn.RemoveSignal(sigs)
+	if err := conn.Object(ssName, p).Call(ssPrompt+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, fmt.Errorf("keychain: prompt: %w", err)
+	}
+	timeout := time.After(promptWait)
+	for {
+		select {
+		case sig := <-sigs:
+			if sig.Path != p || sig.Name != ssPrompt+".Completed" || len(sig.Body) != 2 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return dbus.Variant{}, errDismissed
+			}
+			v, _ := sig.Body[1].(dbus.Variant)
+			return v, nil
+		case <-timeout:
+			return dbus.Variant{}, errDismissed
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !linux && !windows
+
+package keychain
+
+type none struct{}
+
+func platform() backend { return none{} }
+
+func (none) get(string) (string, error) { return "", ErrUnavailable }
+func (none) set(string, string) error   { return ErrUnavailable }
@@ -0,0 +1,82 @@
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type fake map[string]string
+
+func (f fake) get(account string) (string, error) {
+	s, ok := f[account]
+	if !ok {
+		return "", errNotFound
+	}
+	return s, nil
+}
+
+func (f fake) set(account, secret string) error { f[account] = secret; return nil }
+
+func TestKeyIsMadeOnce(t *testing.T) {
+	defer func(old backend) { native = old }(native)
+	f := fake{}
+	native = f
+
+	k1, err := Key("history")
+	if err != nil || len(k1) != 32 {
+		t.Fatalf("Key = %x, %v", k1, err)
+	}
+	if len(f["history"]) != 64 {
+		t.Fatalf("stored %q", f["history"])
+	}
+	if k2, _ := Key("history"); !bytes.Equal(k1, k2) {
+		t.Fatalf("second Key differs")
+	}
+	if k3, _ := Key("other"); bytes.Equal(k1, k3) {
+		t.Fatalf("accounts share a key")
+	}
+
+	f["bad"] = "hunter2"
+	if _, err := Key("bad"); err == nil {
+		t.Fatal("a foreign secret passed for a key")
+	}
+}
+
+type locked struct{}
+
+func (locked) get(string) (string, error) { return "", ErrUnavailable }
+func (locked) set(string, string) error   { return ErrUnavailable }
+
+func TestKeyWithoutKeychain(t *testing.T) {
+	defer func(old backend) { native = old }(native)
+	native = locked{}
+	if _, err := Key("history"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Key = %v", err)
+	}
+}
+
+// flaky can't tell whether the account is there, and forgets what it
+// is told.
+type flaky struct{ sets *int }
+
+func (flaky) get(string) (string, error) { return "", errors.New("lookup failed") }
+func (f flaky) set(string, string) error { *f.sets++; return nil }
+
+type forgetful struct{}
+
+func (forgetful) get(string) (string, error) { return "", errNotFound }
+func (forgetful) set(string, string) error   { return nil }
+
+func TestKeyOnlyMadeOnADefiniteMiss(t *testing.T) {
+	defer func(old backend) { native = old }(native)
+	sets := 0
+	native = flaky{&sets}
+	if _, err := Key("history"); err == nil || sets != 0 {
+		t.Fatalf("failed lookup: Key = %v after %d sets", err, sets)
+	}
+	native = forgetful{}
+	if _, err := Key("history"); err == nil {
+		t.Fatal("a key the keychain didn't keep was handed out")
+	}
+}
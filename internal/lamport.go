@@ -0,0 +1,43 @@
+package internal
+
+import "sync"
+
+/*──────── clipboard ordering ──────────────────────────────────*/
+// Lamport orders clipboard contents across devices.  Every local copy
+// gets a stamp above everything seen so far (and at least the given
+// wall-clock ms, so a freshly started device isn't behind); a remote
+// snapshot is applied only if its (seq, origin) is newer than what the
+// clipboard currently holds.  Ties break on origin, so all devices pick
+// the same winner for concurrent copies.
+type Lamport struct {
+	mu     sync.Mutex
+	seq    uint64 // stamp of the current clipboard content
+	origin string
+}
+
+func NewLamport() *Lamport { return &Lamport{} }
+
+// Tick stamps a local copy made by origin.
+func (l *Lamport) Tick(origin string, wallMs uint64) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq = max(l.seq+1, wallMs)
+	l.origin = origin
+	return l.seq
+}
+
+// Accept reports whether a remote (origin, seq) is newer than the
+// current content and, if so, makes it current.  seq 0 comes from
+// peers without ordering and is always accepted.
+func (l *Lamport) Accept(origin string, seq uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq == 0 {
+		return true
+	}
+	if seq < l.seq || (seq == l.seq && origin <= l.origin) {
+		return false
+	}
+	l.seq, l.origin = seq, origin
+	return true
+}
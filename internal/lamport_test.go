@@ -0,0 +1,35 @@
+package internal
+
+import "testing"
+
+func TestLamportRejectsDelayed(t *testing.T) {
+	l := NewLamport()
+	if !l.Accept("bbbb", 10) {
+		t.Fatalf("first remote should apply")
+	}
+	local := l.Tick("aaaa", 0)
+	if local != 11 {
+		t.Fatalf("tick after 10 = %d, want 11", local)
+	}
+	if l.Accept("bbbb", 9) {
+		t.Fatalf("delayed snapshot clobbered newer local copy")
+	}
+	if !l.Accept("bbbb", 12) {
+		t.Fatalf("newer remote rejected")
+	}
+	if !l.Accept("old-peer", 0) {
+		t.Fatalf("unstamped snapshot must be accepted")
+	}
+}
+
+func TestLamportTieAndWall(t *testing.T) {
+	a, b := NewLamport(), NewLamport()
+	sa, sb := a.Tick("aaaa", 500), b.Tick("bbbb", 500)
+	// concurrent copies with equal stamps: both sides agree bbbb wins
+	if a.Accept("bbbb", sb) != true || b.Accept("aaaa", sa) != false {
+		t.Fatalf("tie not broken consistently")
+	}
+	if s := a.Tick("aaaa", 100); s != 501 {
+		t.Fatalf("stamp must stay monotonic, got %d", s)
+	}
+}
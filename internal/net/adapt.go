@@ -0,0 +1,211 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*──────── adaptive tuning ────────────────────────────────────*/
+// A client tells the server what its path looks like (X-Net-Stats on
+// every discover and the WS dial) and the server answers with hints
+// (X-Hints) for the chunk size, the pause between discovers and
+// whether to gzip.  With WithAdaptive the hints override the
+// configured chunk size and compression, always within the server's
+// advertised limits; see server_design.md "Adaptive tuning".
+
+// NetStats is what a client has lately seen of its path to the server.
+type NetStats struct {
+	RTT  time.Duration // smoothed round trip
+	Loss float64       // share of recent requests that failed, 0–1
+	Kbps int           // smoothed upload throughput, 0 = not measured yet
+}
+
+// String is the X-Net-Stats form: "rtt=45,loss=0.020,kbps=1200" (ms).
+func (n NetStats) String() string {
+	return fmt.Sprintf("rtt=%d,loss=%.3f,kbps=%d", n.RTT.Milliseconds(), n.Loss, n.Kbps)
+}
+
+// ParseNetStats reads String's form; unknown fields are ignored.
+func ParseNetStats(v string) (NetStats, bool) {
+	var n NetStats
+	ok := false
+	for _, f := range strings.Split(v, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(f), "=")
+		switch k {
+		case "rtt":
+			ms, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || ms < 0 {
+				return NetStats{}, false
+			}
+			n.RTT, ok = time.Duration(ms)*time.Millisecond, true
+		case "loss":
+			l, err := strconv.ParseFloat(val, 64)
+			if err != nil || l < 0 || l > 1 {
+				return NetStats{}, false
+			}
+			n.Loss = l
+		case "kbps":
+			kb, err := strconv.Atoi(val)
+			if err != nil || kb < 0 {
+				return NetStats{}, false
+			}
+			n.Kbps = kb
+		}
+	}
+	return n, ok
+}
+
+// Hints are a server's suggestions for one client's settings.
+type Hints struct {
+	Chunk int           // upload chunk size, bytes; 0 = no opinion
+	Poll  time.Duration // pause between discovers; 0 = no opinion
+	Gzip  int           // 1 compress, -1 don't, 0 no opinion
+}
+
+// String is the X-Hints form: "chunk=131072,poll=500,gzip=1" (ms).
+func (h Hints) String() string {
+	var f []string
+	if h.Chunk > 0 {
+		f = append(f, "chunk="+strconv.Itoa(h.Chunk))
+	}
+	if h.Poll > 0 {
+		f = append(f, "poll="+strconv.FormatInt(h.Poll.Milliseconds(), 10))
+	}
+	if h.Gzip != 0 {
+		f = append(f, "gzip="+strconv.Itoa(max(h.Gzip, 0)))
+	}
+	return strings.Join(f, ",")
+}
+
+// ParseHints reads String's form; bad or unknown fields are skipped.
+func ParseHints(v string) Hints {
+	var h Hints
+	for _, f := range strings.Split(v, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(f), "=")
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch k {
+		case "chunk":
+			h.Chunk = n
+		case "poll":
+			h.Poll = time.Duration(n) * time.Millisecond
+		case "gzip":
+			h.Gzip = 1
+			if n == 0 {
+				h.Gzip = -1
+			}
+		}
+	}
+	return h
+}
+
+// Hint bounds: a server asking for less or more is not followed.
+const (
+	minHintChunk = 16 * 1024
+	minHintPoll  = 50 * time.Millisecond
+	maxHintPoll  = 10 * time.Second
+)
+
+// adaptive keeps a client's NetStats and the server's latest Hints.
+type adaptive struct {
+	on atomic.Bool // WithAdaptive
+
+	mu      sync.Mutex
+	st      NetStats
+	samples int
+	hint    Hints
+}
+
+// observe folds one request into the stats: its round trip (0 if it
+// failed) and whether it got an answer.
+func (a *adaptive) observe(rtt time.Duration, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	lost := 1.0
+	if ok {
+		lost = 0
+		if a.st.RTT == 0 {
+			a.st.RTT = rtt
+		} else {
+			a.st.RTT += (rtt - a.st.RTT) / 8
+		}
+	}
+	if a.samples == 0 {
+		a.st.Loss = lost
+	} else {
+		a.st.Loss += (lost - a.st.Loss) / 16
+	}
+	a.samples++
+}
+
+// observeUpload folds n bytes sent in d into the throughput.
+func (a *adaptive) observeUpload(n int, d time.Duration) {
+	if n < 4096 || d <= 0 {
+		return // too small to say anything about bandwidth
+	}
+	kbps := int(float64(n) * 8 / 1000 / d.Seconds())
+	a.mu.Lock()
+	if a.st.Kbps == 0 {
+		a.st.Kbps = kbps
+	} else {
+		a.st.Kbps += (kbps - a.st.Kbps) / 4
+	}
+	a.mu.Unlock()
+}
+
+// NetStats returns the stats so far.
+func (a *adaptive) NetStats() NetStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.st
+}
+
+// Hints returns what the server last suggested, zero when adaptive
+// tuning is off or it hasn't said.
+func (a *adaptive) Hints() Hints {
+	if !a.on.Load() {
+		return Hints{}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.hint
+}
+
+// statsHeader adds X-Net-Stats once there is something to report.
+func (a *adaptive) statsHeader(h http.Header) {
+	if !a.on.Load() {
+		return
+	}
+	a.mu.Lock()
+	st, n := a.st, a.samples
+	a.mu.Unlock()
+	if n > 0 {
+		h.Set("X-Net-Stats", st.String())
+	}
+}
+
+// observeHints takes the server's X-Hints, clamped to sane bounds.  A
+// reply without the header leaves the last hints in place.
+func (a *adaptive) observeHints(h http.Header) {
+	v := h.Get("X-Hints")
+	if v == "" || !a.on.Load() {
+		return
+	}
+	hint := ParseHints(v)
+	if hint.Chunk > 0 {
+		hint.Chunk = max(hint.Chunk, minHintChunk)
+	}
+	if hint.Poll > 0 {
+		hint.Poll = min(max(hint.Poll, minHintPoll), maxHintPoll)
+	}
+	a.mu.Lock()
+	a.hint = hint
+	a.mu.Unlock()
+}
@@ -0,0 +1,92 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetStatsAndHintsRoundTrip(t *testing.T) {
+	st := NetStats{RTT: 45 * time.Millisecond, Loss: 0.02, Kbps: 1200}
+	if got, ok := ParseNetStats(st.String()); !ok || got != st {
+		t.Fatalf("ParseNetStats(%q) = %+v, %v", st, got, ok)
+	}
+	for _, bad := range []string{"", "loss=0.1", "rtt=-1", "rtt=5,loss=2"} {
+		if _, ok := ParseNetStats(bad); ok {
+			t.Errorf("ParseNetStats(%q) accepted", bad)
+		}
+	}
+	h := Hints{Chunk: 131072, Poll: 500 * time.Millisecond, Gzip: -1}
+	if got := ParseHints(h.String()); got != h {
+		t.Fatalf("ParseHints(%q) = %+v", h, got)
+	}
+	if got := ParseHints("chunk=x,poll=700,future=1"); got != (Hints{Poll: 700 * time.Millisecond}) {
+		t.Fatalf("partial hints = %+v", got)
+	}
+}
+
+// TestAdaptiveFollowsHints: stats go up once there are some, hints come
+// back and retune chunking, polling and compression, clamped.
+func TestAdaptiveFollowsHints(t *testing.T) {
+	var stats []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats = append(stats, r.Header.Get("X-Net-Stats"))
+		w.Header().Set("X-Hints", "chunk=1024,poll=60000,gzip=1")
+		w.Write([]byte(`{"max_chunk":200000}`))
+	}))
+	defer srv.Close()
+
+	for _, on := range []bool{false, true} {
+		stats = nil
+		c, err := NewHTTP(srv.URL, "me", "0123456789abcdef", WithAdaptive(on),
+			WithLimits(Limits{ChunkSize: 100000}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := c.discover(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		body := []byte(strings.Repeat("compress me ", 100))
+		if !on {
+			if stats[1] != "" || c.chunkSize() != 100000 || c.pause(200*time.Millisecond) != 200*time.Millisecond || len(c.squeeze(body)) != len(body) {
+				t.Fatalf("adaptive off still tuned: stats %q, chunk %d", stats, c.chunkSize())
+			}
+			continue
+		}
+		if stats[0] != "" || !strings.HasPrefix(stats[1], "rtt=") {
+			t.Fatalf("X-Net-Stats = %q", stats)
+		}
+		if c.chunkSize() != minHintChunk {
+			t.Errorf("chunk = %d, want the %d floor", c.chunkSize(), minHintChunk)
+		}
+		if p := c.pause(200 * time.Millisecond); p != maxHintPoll {
+			t.Errorf("pause = %v, want the %v ceiling", p, maxHintPoll)
+		}
+		if len(c.squeeze(body)) >= len(body) {
+			t.Error("gzip hint not followed")
+		}
+		if st := c.NetStats(); st.RTT <= 0 || st.Loss != 0 {
+			t.Errorf("NetStats = %+v", st)
+		}
+	}
+}
+
+func TestAdaptiveLoss(t *testing.T) {
+	var a adaptive
+	a.observe(10*time.Millisecond, true)
+	for i := 0; i < 8; i++ {
+		a.observe(0, false)
+	}
+	if st := a.NetStats(); st.Loss < 0.3 || st.Loss > 0.5 || st.RTT != 10*time.Millisecond {
+		t.Fatalf("NetStats = %+v", st)
+	}
+	a.observeUpload(1<<20, time.Second)
+	if kb := a.NetStats().Kbps; kb != 8388 {
+		t.Fatalf("Kbps = %d", kb)
+	}
+}
@@ -0,0 +1,165 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	core "clipsync/internal"
+)
+
+/*──────── out-of-band blobs ──────────────────────────────────*/
+// A snapshot whose JSON would exceed the body cap has its large items moved
+// out of band: the item keeps only Blob (sha256 hex of the raw bytes)
+// and ByteLen, and the bytes travel as ranged PUT / GET on
+// <server>/blob/<hash>.  Receivers fetch and verify before delivery.
+
+const (
+	blobPiece = 4 << 20 // bytes per ranged request
+	blobMin   = 1 << 20 // smaller items always stay inline
+)
+
+// blobURL maps the transport endpoint to <scheme>://host/blob/<hash>.
+func blobURL(endpoint, hash string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	u.Path, u.RawQuery = "/blob/"+hash, ""
+	return u.String(), nil
+}
+
+// offload moves items of at least blobMin bytes to blobs.
+func (s *shared) offload(ctx context.Context, cli *http.Client, endpoint string, snap *core.Snapshot) error {
+	for i := range snap.Items {
+		it := &snap.Items[i]
+		if it.Blob != "" || it.ByteLen < blobMin {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(it.Payload)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(raw)
+		hash := hex.EncodeToString(sum[:])
+		if err := s.putBlob(ctx, cli, endpoint, hash, raw); err != nil {
+			return fmt.Errorf("blob upload: %w", err)
+		}
+		it.Blob, it.Payload, it.ByteLen = hash, "", len(raw)
+	}
+	return nil
+}
+
+// putBlob uploads raw in pieces, skipping it if the server already has it.
+func (s *shared) putBlob(ctx context.Context, cli *http.Client, endpoint, hash string, raw []byte) error {
+	u, err := blobURL(endpoint, hash)
+	if err != nil {
+		return err
+	}
+	head, _ := http.NewRequestWithContext(ctx, "HEAD", u, nil)
+	s.authHeaders(head.Header)
+	if resp, err := cli.Do(head); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && resp.ContentLength == int64(len(raw)) {
+			return nil // same content uploaded before
+		}
+	}
+	piece := s.paced(blobPiece) // a second's worth at most, if paced
+	for off := 0; off < len(raw); off += piece {
+		end := min(off+piece, len(raw))
+		if err := s.pace(ctx, end-off); err != nil {
+			return err
+		}
+		req, _ := http.NewRequestWithContext(ctx, "PUT", u, bytes.NewReader(raw[off:end]))
+		s.authHeaders(req.Header)
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", off, end-1, len(raw)))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp, err := cli.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("PUT %d-%d: status %d", off, end-1, resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+// inflate downloads every blob item in snap and puts the payload back.
+func (s *shared) inflate(ctx context.Context, cli *http.Client, endpoint string, snap *core.Snapshot) error {
+	for i := range snap.Items {
+		it := &snap.Items[i]
+		if it.Blob == "" {
+			continue
+		}
+		raw, err := s.getBlob(ctx, cli, endpoint, it.Blob, it.ByteLen)
+		if err != nil {
+			return fmt.Errorf("blob %.12s: %w", it.Blob, err)
+		}
+		it.Payload, it.Blob = base64.StdEncoding.EncodeToString(raw), ""
+	}
+	return nil
+}
+
+var errBlobHash = errors.New("content does not match hash")
+
+func (s *shared) getBlob(ctx context.Context, cli *http.Client, endpoint, hash string, size int) ([]byte, error) {
+	u, err := blobURL(endpoint, hash)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 0, size)
+	for len(raw) < size {
+		end := min(len(raw)+blobPiece, size)
+		req, _ := http.NewRequestWithContext(ctx, "GET", u, nil)
+		s.authHeaders(req.Header)
+		req.Header.Set("Range", "bytes="+strconv.Itoa(len(raw))+"-"+strconv.Itoa(end-1))
+		resp, err := cli.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			raw, err = readAppend(raw, resp.Body, int64(end-len(raw)))
+		case http.StatusOK: // server ignored Range: whole body
+			raw, err = readAppend(raw[:0], resp.Body, int64(size))
+		default:
+			err = fmt.Errorf("GET: status %d", resp.StatusCode)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sum := sha256.Sum256(raw); hex.EncodeToString(sum[:]) != hash {
+		return nil, errBlobHash
+	}
+	return raw, nil
+}
+
+// readAppend reads exactly n bytes from r onto buf.
+func readAppend(buf []byte, r io.Reader, n int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return append(buf, b...), nil
+}
@@ -0,0 +1,118 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	core "clipsync/internal"
+)
+
+// blobServer keeps blobs in memory and honours Content-Range / Range.
+type blobServer struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+	puts  int
+	snap  []byte // last /clip body
+}
+
+func (b *blobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !strings.HasPrefix(r.URL.Path, "/blob/") {
+		b.snap, _ = io.ReadAll(r.Body)
+		return
+	}
+	h := strings.TrimPrefix(r.URL.Path, "/blob/")
+	switch r.Method {
+	case "HEAD":
+		if _, ok := b.blobs[h]; !ok {
+			w.WriteHeader(404)
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(b.blobs[h])))
+	case "PUT":
+		var from, to, total int
+		fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &from, &to, &total)
+		if b.blobs[h] == nil {
+			b.blobs[h] = make([]byte, total)
+		}
+		data, _ := io.ReadAll(r.Body)
+		copy(b.blobs[h][from:], data)
+		b.puts++
+	case "GET":
+		var from, to int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &from, &to)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(b.blobs[h][from : to+1])
+	}
+}
+
+func TestBlobOffloadAndInflate(t *testing.T) {
+	raw := make([]byte, 9<<20) // three ranged pieces
+	rand.New(rand.NewSource(1)).Read(raw)
+
+	srv := &blobServer{blobs: map[string][]byte{}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL+"/clip", "deadbeef", hexKey, WithLimits(Limits{BodyCap: 2 << 20}))
+	snap := core.Snapshot{Origin: "deadbeef", Items: []core.Item{
+		{Fmt: 13, Payload: base64.StdEncoding.EncodeToString([]byte("small")), ByteLen: 5},
+		{Fmt: 99, Payload: base64.StdEncoding.EncodeToString(raw), ByteLen: len(raw)},
+	}}
+	if err := cli.Send(context.Background(), snap); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if srv.puts != 3 {
+		t.Fatalf("want 3 ranged PUTs, got %d", srv.puts)
+	}
+
+	var got core.Snapshot
+	if err := json.Unmarshal(srv.snap, &got); err != nil {
+		t.Fatalf("uploaded snapshot: %v", err)
+	}
+	if got.Items[0].Blob != "" || got.Items[1].Blob == "" || got.Items[1].Payload != "" {
+		t.Fatalf("wrong items offloaded: %+v", got.Items)
+	}
+
+	if err := cli.inflate(context.Background(), cli.poller, cli.url, &got); err != nil {
+		t.Fatalf("inflate: %v", err)
+	}
+	back, _ := base64.StdEncoding.DecodeString(got.Items[1].Payload)
+	if !bytes.Equal(back, raw) {
+		t.Fatalf("round trip changed the payload")
+	}
+
+	// same content again: HEAD says the server has it, no new PUTs
+	if err := cli.Send(context.Background(), snap); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+	if srv.puts != 3 {
+		t.Fatalf("blob re-uploaded: %d PUTs", srv.puts)
+	}
+
+	// corrupt blob is rejected
+	h := srv.snapBlob(t)
+	srv.blobs[h][0] ^= 1
+	got.Items[1].Payload, got.Items[1].Blob = "", h
+	if err := cli.inflate(context.Background(), cli.poller, cli.url, &got); err == nil {
+		t.Fatalf("corrupt blob accepted")
+	}
+}
+
+func (b *blobServer) snapBlob(t *testing.T) string {
+	var s core.Snapshot
+	if err := json.Unmarshal(b.snap, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s.Items[1].Blob
+}
@@ -1,18 +1,28 @@
 package net
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	core "clipsync/internal"
 )
 
 /*────── common interface ────────────────────────────────────*/
 type Client interface {
-	Send(snap core.Snapshot) error
+	Send(ctx context.Context, snap core.Snapshot) error
 	Poll(ctx context.Context, out chan<- core.Snapshot)
 }
 
@@ -20,6 +30,26 @@ type Client interface {
 type shared struct {
 	id    string
 	key64 uint64
+	nonce string        // this client's, in every auth token
+	n     atomic.Uint64 // auth token counter
+	room  string // sync group; "" is the default room
+	connMeter
+
+	headers  http.Header // extra, from WithHeaders
+	devTok   DeviceToken // WithDeviceToken; zero = none
+	compress bool
+
+	lim      Limits       // configured
+	srvBody  atomic.Int64 // server-advertised, 0 = unknown
+	srvChunk atomic.Int64
+
+	kickOnce sync.Once
+	kickCh   chan struct{} // Redial → Poll, see kick()
+
+	metered atomic.Bool // SetMetered
+	upRate  *bucket     // WithMaxUpload; nil = unlimited
+
+	adaptive // X-Net-Stats / X-Hints, see adapt.go
 }
 
 func newShared(id, keyHex string) (*shared, error) {
@@ -28,23 +58,201 @@ func newShared(id, keyHex string) (*shared, error) {
 		return nil, errors.New("key must be 16 hex chars (8 bytes)")
 	}
 	key64 := binary.BigEndian.Uint64(k)
-	return &shared{id: id, key64: key64}, nil
+	var nonce [8]byte
+	rand.Read(nonce[:])
+	return &shared{id: id, key64: key64, nonce: hex.EncodeToString(nonce[:])}, nil
+}
+
+// apply copies the settings both transports share out of cfg.
+func (s *shared) apply(cfg config) {
+	s.room = cfg.room
+	s.lim = cfg.lim
+	s.headers = cfg.headers
+	s.devTok = cfg.devTok
+	s.compress = cfg.compress
+	s.upRate = newBucket(cfg.maxUpKbps)
+	s.on.Store(cfg.adaptive)
+}
+
+/*────── re-dial on network change ───────────────────────────*/
+
+// Redial drops the current connection and dials again at once, skipping
+// any back-off: after a network change the old one is likely dead
+// without knowing it yet.
+func (s *shared) Redial() {
+	select {
+	case s.kick() <- struct{}{}:
+	default:
+	}
+}
+
+func (s *shared) kick() chan struct{} {
+	s.kickOnce.Do(func() { s.kickCh = make(chan struct{}, 1) })
+	return s.kickCh
+}
+
+// untilRedial is ctx, also cancelled by the next Redial.  Poll loops
+// run a connection's lifetime under it.
+func (s *shared) untilRedial(ctx context.Context) (context.Context, context.CancelFunc) {
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.kick():
+			cancel()
+		case <-cctx.Done():
+		}
+	}()
+	return cctx, cancel
+}
+
+/*────── metered networks ────────────────────────────────────*/
+
+// meteredPoll is the slowest polling transports go on a metered network.
+const meteredPoll = 5 * time.Second
+
+// SetMetered makes the transport save bytes (true) or stop saving them:
+// every body not sent inline is gzipped at the best level, whatever
+// WithCompression says, and polling transports wait meteredPoll between
+// rounds.
+func (s *shared) SetMetered(on bool) { s.metered.Store(on) }
+
+// squeeze compresses an outgoing body as configured, or as the server
+// hinted.
+func (s *shared) squeeze(b []byte) []byte {
+	compress := s.compress
+	if g := s.Hints().Gzip; g != 0 {
+		compress = g > 0
+	}
+	switch {
+	case s.metered.Load():
+		return gzipBody(b, gzip.BestCompression)
+	case compress:
+		return gzipBody(b, gzip.DefaultCompression)
+	}
+	return b
+}
+
+// pause is how long to wait between polls: d (or the server's hint),
+// longer when metered.
+func (s *shared) pause(d time.Duration) time.Duration {
+	if p := s.Hints().Poll; p > 0 {
+		d = p
+	}
+	if s.metered.Load() {
+		return max(d, meteredPoll)
+	}
+	return d
 }
 
 /*────── auth header builder ──────────────────────────────────*/
 func (s *shared) buildAuthHeader() string {
+	// server time, see clock.go; a fresh counter so no token is sent twice
+	return authToken(s.key64, Now().Unix(), s.nonce, s.n.Add(1))
+}
+
+// authToken builds an X-Auth-Token.  With a nonce it also carries the
+// counter n and a MAC binding both to the timestamp, which lets a
+// server refuse a token it has seen before; without one it is the bare
+// timestamp token older servers and interop vectors know.
+func authToken(key64 uint64, ts int64, nonce string, n uint64) string {
 	type token struct {
-		TS    int64 `json:"ts"`
-		TSEnc int64 `json:"ts_enc"`
+		TS    int64  `json:"ts"`
+		TSEnc int64  `json:"ts_enc"`
+		Nonce string `json:"nonce,omitempty"`
+		N     uint64 `json:"n,omitempty"`
+		MAC   string `json:"mac,omitempty"`
+	}
+	tok := token{TS: ts, TSEnc: ts ^ int64(key64)}
+	if nonce != "" {
+		var k [8]byte
+		binary.BigEndian.PutUint64(k[:], key64)
+		m := hmac.New(sha256.New, k[:])
+		fmt.Fprintf(m, "%d.%s.%d", ts, nonce, n)
+		tok.Nonce, tok.N, tok.MAC = nonce, n, hex.EncodeToString(m.Sum(nil)[:16])
 	}
-	ts := time.Now().Unix()
-	tok := token{TS: ts, TSEnc: ts ^ int64(s.key64)}
 	raw, _ := json.Marshal(&tok)
 	return base64.StdEncoding.EncodeToString(raw)
 }
 
-/*────── size cap ─────────────────────────────────────────────*/
-const bodyCap = 32 * 1024 * 1024 // 32 MiB
+// AuthToken is the X-Auth-Token value for keyHex at Unix time ts
+// (exported for interop vectors).
+func AuthToken(keyHex string, ts int64) (string, error) {
+	return AuthTokenNonce(keyHex, ts, "", 0)
+}
+
+// AuthTokenNonce is the X-Auth-Token value for keyHex at Unix time ts,
+// counter n of nonce ("" = no nonce, as AuthToken).  Servers rebuild it
+// to check a token.
+func AuthTokenNonce(keyHex string, ts int64, nonce string, n uint64) (string, error) {
+	s, err := newShared("", keyHex)
+	if err != nil {
+		return "", err
+	}
+	return authToken(s.key64, ts, nonce, n), nil
+}
+
+// authHeaders stamps the headers every request (and WS dial) carries.
+func (s *shared) authHeaders(h http.Header) {
+	for k, v := range s.headers {
+		h[k] = v
+	}
+	if s.devTok.Name == "" {
+		h.Set("X-Auth-Token", s.buildAuthHeader())
+	} else {
+		// both headers sign the same timestamp and counter
+		ts, n := Now().Unix(), s.n.Add(1)
+		h.Set("X-Auth-Token", authToken(s.key64, ts, s.nonce, n))
+		h.Set("X-Device-Auth", s.devTok.Auth(ts, s.nonce, n))
+	}
+	h.Set("X-Device-Id", s.id)
+	if s.room != "" {
+		h.Set("X-Room", s.room)
+	}
+}
+
+/*────── size caps ────────────────────────────────────────────*/
+const (
+	defaultBodyCap   = 32 * 1024 * 1024 // bigger items go out of band (blob.go)
+	defaultChunkSize = 300 * 1024
+)
+
+// Limits caps request sizes; zero fields mean the defaults (32 MiB body,
+// 300 KiB chunks).  A server may advertise lower limits, which win.
+type Limits struct {
+	BodyCap   int // largest snapshot JSON sent in one piece
+	ChunkSize int // HTTP chunk slice size
+}
+
+func pick(cfg, def int, srv int64) int {
+	if cfg <= 0 {
+		cfg = def
+	}
+	if srv > 0 && int(srv) < cfg {
+		return int(srv)
+	}
+	return cfg
+}
+
+func (s *shared) bodyCap() int   { return pick(s.lim.BodyCap, defaultBodyCap, s.srvBody.Load()) }
+func (s *shared) chunkSize() int {
+	if c := s.Hints().Chunk; c > 0 {
+		return s.paced(pick(c, defaultChunkSize, s.srvChunk.Load())) // hint replaces -chunk-size
+	}
+	return s.paced(pick(s.lim.ChunkSize, defaultChunkSize, s.srvChunk.Load()))
+}
+
+// observeLimits records server-advertised caps (0 = not advertised).
+func (s *shared) observeLimits(body, chunk int64) {
+	if body > 0 {
+		s.srvBody.Store(body)
+	}
+	if chunk > 0 {
+		s.srvChunk.Store(chunk)
+	}
+}
+
+// ErrTooLarge is permanent: retrying or queueing the snapshot won't help.
+var ErrTooLarge = errors.New("snapshot over the body cap even with blobs, dropped")
 
 // mustJSON panics on impossible marshal errors but caps size.
 func mustJSON(v any) []byte {
@@ -54,10 +262,3 @@ func mustJSON(v any) []byte {
 	}
 	return b
 }
-
-/*────── imports (at end to avoid scroll) ─────────────────────*/
-import (
-	"encoding/base64"
-	"encoding/json"
-	"time"
-)
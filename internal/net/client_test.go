@@ -13,7 +13,7 @@ type token struct {
 }
 
 func TestBuildAuthHeader(t *testing.T) {
-    s, err := newShared("deadbeef", "test-secret-key")
+    s, err := newShared("deadbeef", hexKey)
     if err != nil {
         t.Fatalf("newShared: %v", err)
     }
@@ -0,0 +1,51 @@
+package net
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*──────── server-assisted clock ──────────────────────────────*/
+// Servers stamp discover replies and the WS handshake with
+// X-Server-Time (Unix ms).  We keep a smoothed server − local offset
+// so auth tokens and snapshot timestamps are in server time even when
+// this machine's clock is off.
+
+var (
+	clockSkew   atomic.Int64 // ms, server − local
+	clockSynced atomic.Bool
+)
+
+// Now is the local clock corrected by the last known server offset.
+func Now() time.Time {
+	return time.Now().Add(ClockOffset())
+}
+
+// ClockOffset is server time minus local time (0 until first sync).
+func ClockOffset() time.Duration {
+	return time.Duration(clockSkew.Load()) * time.Millisecond
+}
+
+// observeServerTime folds one X-Server-Time sample into the offset.
+// sent/recv bracket the request; the server is assumed to have stamped
+// the reply half-way through.  Slow round trips are too noisy to use.
+func observeServerTime(h http.Header, sent, recv time.Time) {
+	ms, err := strconv.ParseInt(h.Get("X-Server-Time"), 10, 64)
+	if err != nil || ms <= 0 {
+		return
+	}
+	rtt := recv.Sub(sent)
+	if rtt > 500*time.Millisecond {
+		return
+	}
+	mid := sent.Add(rtt / 2).UnixMilli()
+	sample := ms - mid
+	if !clockSynced.Swap(true) {
+		clockSkew.Store(sample)
+		return
+	}
+	old := clockSkew.Load()
+	clockSkew.Store(old + (sample-old)/4)
+}
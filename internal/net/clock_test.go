@@ -0,0 +1,36 @@
+package net
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestObserveServerTime(t *testing.T) {
+	clockSynced.Store(false)
+	defer func() { clockSynced.Store(false); clockSkew.Store(0) }()
+
+	sent := time.Now()
+	recv := sent.Add(100 * time.Millisecond)
+	h := http.Header{}
+	h.Set("X-Server-Time", strconv.FormatInt(sent.Add(50*time.Millisecond+time.Hour).UnixMilli(), 10))
+	observeServerTime(h, sent, recv)
+	if off := ClockOffset(); off < time.Hour-time.Second || off > time.Hour+time.Second {
+		t.Fatalf("offset %v, want ~1h", off)
+	}
+	if d := Now().Sub(time.Now()); d < 59*time.Minute {
+		t.Fatalf("Now not corrected: %v", d)
+	}
+
+	// a slow round trip is ignored
+	observeServerTime(h, sent, sent.Add(2*time.Second))
+	if off := ClockOffset(); off < time.Hour-time.Second {
+		t.Fatalf("slow sample moved offset to %v", off)
+	}
+	// missing header is ignored
+	observeServerTime(http.Header{}, sent, recv)
+	if off := ClockOffset(); off < time.Hour-time.Second {
+		t.Fatalf("empty sample moved offset to %v", off)
+	}
+}
@@ -0,0 +1,362 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	core "clipsync/internal"
+)
+
+/*──────── several endpoints, one at a time ───────────────────*/
+// A failover client holds one client per server URL and syncs through
+// one of them, the active one.  It stays there (sticky) while health
+// checks pass and sends go through; failAfter misses in a row and it
+// moves to the next endpoint in the list that answers.  Away from the
+// first (the primary) it keeps checking the primary and goes back once
+// it has answered backAfter times in a row, so a fleet that scattered
+// during an outage meets on the same relay again.
+//
+// A health check is a GET of the server's root (the keep-warm path) for
+// http(s) and ws(s) URLs, anything below 500 counting as up, and a TCP
+// connect for the rest.
+
+// Endpoint is one server and the client built for it.
+type Endpoint struct {
+	URL    string
+	Client Client
+}
+
+const (
+	failAfter        = 3
+	backAfter        = 3
+	defaultHealthGap = 10 * time.Second
+)
+
+type failoverClient struct {
+	eps     []Endpoint
+	every   time.Duration
+	timeout time.Duration
+	hc      *http.Client
+	notify  func(from, to string)
+
+	mu        sync.Mutex
+	active    int
+	fails     int // consecutive misses of the active endpoint
+	primaryOK int // consecutive good checks of eps[0] while away
+	switches  int
+	moved     chan struct{} // active changed → Poll
+}
+
+// NewFailover syncs through eps, the first being the primary.  Of opts
+// it uses WithHealthCheck, WithTimeout (each check, default 5s) and
+// WithProxy / WithTLSConfig for the checks themselves.
+func NewFailover(eps []Endpoint, opts ...Option) (*failoverClient, error) {
+	if len(eps) == 0 {
+		return nil, errors.New("failover: no endpoints")
+	}
+	cfg := newConfig(opts)
+	f := &failoverClient{
+		eps:     eps,
+		every:   cfg.health,
+		timeout: cfg.timeout,
+		notify:  cfg.onFailover,
+		moved:   make(chan struct{}, 1),
+	}
+	if f.every <= 0 {
+		f.every = defaultHealthGap
+	}
+	if f.timeout <= 0 {
+		f.timeout = 5 * time.Second
+	}
+	f.hc = &http.Client{Transport: warmTransport(cfg), Timeout: f.timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	return f, nil
+}
+
+// SplitEndpoints reads a comma-separated -http list.
+func SplitEndpoints(s string) []string {
+	var out []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+func (f *failoverClient) current() (int, Client) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active, f.eps[f.active].Client
+}
+
+// Active is the URL sync goes through now.
+func (f *failoverClient) Active() string {
+	i, _ := f.current()
+	return f.eps[i].URL
+}
+
+// Endpoints describes the list for `clipsync conn`.
+func (f *failoverClient) Endpoints() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fmt.Sprintf("endpoint %d of %d: %s (failovers=%d)",
+		f.active+1, len(f.eps), f.eps[f.active].URL, f.switches)
+}
+
+// Send goes to the active endpoint.  A failure that tips it over
+// failAfter moves to the next one up, and the snapshot is tried there
+// once before the error is returned.
+func (f *failoverClient) Send(ctx context.Context, snap core.Snapshot) error {
+	i, c := f.current()
+	err := c.Send(ctx, snap)
+	if err == nil || errors.Is(err, ErrTooLarge) {
+		f.result(i, true) // too large is the snapshot's fault
+		return err
+	}
+	if ctx.Err() != nil || !f.result(i, false) {
+		return err // called off: not the endpoint's fault
+	}
+	if j, c := f.current(); j != i {
+		return c.Send(ctx, snap)
+	}
+	return err
+}
+
+// result records how the active endpoint i did; true if it was failed
+// over just now.
+func (f *failoverClient) result(i int, ok bool) bool {
+	f.mu.Lock()
+	if i != f.active {
+		f.mu.Unlock()
+		return false
+	}
+	if ok {
+		f.fails = 0
+		f.mu.Unlock()
+		return false
+	}
+	f.fails++
+	down := f.fails >= failAfter
+	f.mu.Unlock()
+	if !down {
+		return false
+	}
+	return f.failover(context.Background(), i)
+}
+
+// failover moves off endpoint i to the next one after it that answers a
+// health check.  With none up it stays, and the misses keep counting.
+func (f *failoverClient) failover(ctx context.Context, i int) bool {
+	for k := 1; k < len(f.eps); k++ {
+		j := (i + k) % len(f.eps)
+		if f.check(ctx, f.eps[j].URL) == nil {
+			return f.switchTo(i, j)
+		}
+	}
+	return false
+}
+
+// switchTo makes j active if i still is.
+func (f *failoverClient) switchTo(i, j int) bool {
+	f.mu.Lock()
+	if f.active != i {
+		f.mu.Unlock()
+		return false
+	}
+	f.active, f.fails, f.primaryOK = j, 0, 0
+	f.switches++
+	notify := f.notify
+	f.mu.Unlock()
+	select {
+	case f.moved <- struct{}{}:
+	default:
+	}
+	if notify != nil {
+		notify(f.eps[i].URL, f.eps[j].URL)
+	}
+	return true
+}
+
+// Poll runs the active client's Poll, restarting it on the new one
+// whenever the endpoint changes.  Health checks run alongside.
+func (f *failoverClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
+	go f.watch(ctx)
+	for ctx.Err() == nil {
+		_, c := f.current()
+		pctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.Poll(pctx, out)
+		}()
+		select {
+		case <-ctx.Done():
+		case <-f.moved:
+		}
+		cancel()
+		<-done
+	}
+}
+
+// watch is the health-check loop.
+func (f *failoverClient) watch(ctx context.Context) {
+	t := time.NewTicker(f.every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		f.tick(ctx)
+	}
+}
+
+// tick checks the active endpoint, and the primary when away from it.
+func (f *failoverClient) tick(ctx context.Context) {
+	i, _ := f.current()
+	f.result(i, f.check(ctx, f.eps[i].URL) == nil)
+	if i, _ = f.current(); i == 0 {
+		return
+	}
+	ok := f.check(ctx, f.eps[0].URL) == nil
+	f.mu.Lock()
+	if ok {
+		f.primaryOK++
+	} else {
+		f.primaryOK = 0
+	}
+	back := f.primaryOK >= backAfter
+	f.mu.Unlock()
+	if back {
+		f.switchTo(i, 0)
+	}
+}
+
+// check is one health check of endpoint u.
+func (f *failoverClient) check(ctx context.Context, u string) error {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	switch pu.Scheme {
+	case "ws", "wss", "http", "https":
+		pu.Scheme = strings.Replace(pu.Scheme, "ws", "http", 1)
+		pu.Path, pu.RawQuery = "/", ""
+		req, _ := http.NewRequestWithContext(ctx, "GET", pu.String(), nil)
+		resp, err := f.hc.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return errors.New(resp.Status)
+		}
+		return nil
+	}
+	host := pu.Host
+	if pu.Port() == "" {
+		host = net.JoinHostPort(pu.Hostname(), defaultPort(pu.Scheme))
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "redis":
+		return "6379"
+	case "rediss":
+		return "6380"
+	case "nats":
+		return "4222"
+	}
+	return "443"
+}
+
+/*──────── what the engine and `conn` ask of a transport ───────*/
+
+// Redial re-dials the active endpoint.
+func (f *failoverClient) Redial() {
+	if r, ok := f.activeClient().(interface{ Redial() }); ok {
+		r.Redial()
+	}
+}
+
+// SetMetered reaches every endpoint, so a failover keeps the setting.
+func (f *failoverClient) SetMetered(on bool) {
+	for _, ep := range f.eps {
+		if m, ok := ep.Client.(interface{ SetMetered(bool) }); ok {
+			m.SetMetered(on)
+		}
+	}
+}
+
+func (f *failoverClient) ConnStats() ConnStats {
+	if m, ok := f.activeClient().(interface{ ConnStats() ConnStats }); ok {
+		return m.ConnStats()
+	}
+	return ConnStats{}
+}
+
+func (f *failoverClient) NetStats() NetStats {
+	if a, ok := f.activeClient().(interface{ NetStats() NetStats }); ok {
+		return a.NetStats()
+	}
+	return NetStats{}
+}
+
+func (f *failoverClient) Hints() Hints {
+	if a, ok := f.activeClient().(interface{ Hints() Hints }); ok {
+		return a.Hints()
+	}
+	return Hints{}
+}
+
+func (f *failoverClient) Devices() []Device {
+	if d, ok := f.activeClient().(interface{ Devices() []Device }); ok {
+		return d.Devices()
+	}
+	return nil
+}
+
+func (f *failoverClient) Deflate() bool {
+	d, ok := f.activeClient().(interface{ Deflate() bool })
+	return ok && d.Deflate()
+}
+
+func (f *failoverClient) Abandoned() (n int64) {
+	for _, ep := range f.eps {
+		if a, ok := ep.Client.(interface{ Abandoned() int64 }); ok {
+			n += a.Abandoned()
+		}
+	}
+	return n
+}
+
+func (f *failoverClient) Transfers() (out []Transfer) {
+	for _, ep := range f.eps {
+		if t, ok := ep.Client.(interface{ Transfers() []Transfer }); ok {
+			out = append(out, t.Transfers()...)
+		}
+	}
+	return out
+}
+
+func (f *failoverClient) activeClient() Client {
+	_, c := f.current()
+	return c
+}
@@ -0,0 +1,150 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// fakeClient records what went through it and fails sends on demand.
+type fakeClient struct {
+	name  string
+	fail  atomic.Bool
+	sent  atomic.Int32
+	polls atomic.Int32
+}
+
+func (c *fakeClient) Send(context.Context, core.Snapshot) error {
+	if c.fail.Load() {
+		return errors.New(c.name + " down")
+	}
+	c.sent.Add(1)
+	return nil
+}
+
+func (c *fakeClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
+	c.polls.Add(1)
+	<-ctx.Done()
+}
+
+// flakyServer answers its root with 200 until down is set, then 503.
+func flakyServer(down *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for end := time.Now().Add(3 * time.Second); time.Now().Before(end); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestFailoverAndBack(t *testing.T) {
+	var downA, downB atomic.Bool
+	a, b := flakyServer(&downA), flakyServer(&downB)
+	defer a.Close()
+	defer b.Close()
+	ca, cb := &fakeClient{name: "a"}, &fakeClient{name: "b"}
+
+	var mu sync.Mutex
+	var moves []string
+	f, err := NewFailover([]Endpoint{{a.URL + "/clip", ca}, {"ws" + b.URL[4:] + "/ws", cb}},
+		WithHealthCheck(10*time.Millisecond),
+		WithOnFailover(func(from, to string) {
+			mu.Lock()
+			moves = append(moves, from+" -> "+to)
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Poll(ctx, make(chan core.Snapshot))
+
+	waitFor(t, "poll on the primary", func() bool { return ca.polls.Load() == 1 })
+	if f.Send(context.Background(), core.Snapshot{}) != nil || ca.sent.Load() != 1 {
+		t.Fatal("send did not go to the primary")
+	}
+
+	downA.Store(true)
+	waitFor(t, "failover", func() bool { return f.Active() == "ws"+b.URL[4:]+"/ws" })
+	waitFor(t, "poll on the backup", func() bool { return cb.polls.Load() == 1 })
+	f.Send(context.Background(), core.Snapshot{})
+	if cb.sent.Load() != 1 {
+		t.Fatal("send did not follow the failover")
+	}
+
+	// back once the primary has answered backAfter checks in a row
+	downA.Store(false)
+	waitFor(t, "return to the primary", func() bool { return f.Active() == a.URL+"/clip" })
+	waitFor(t, "poll back on the primary", func() bool { return ca.polls.Load() == 2 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(moves) != 2 {
+		t.Fatalf("moves = %q", moves)
+	}
+}
+
+func TestFailoverOnSendErrors(t *testing.T) {
+	var up atomic.Bool
+	a, b := flakyServer(&up), flakyServer(&up) // both healthy
+	defer a.Close()
+	defer b.Close()
+	ca, cb := &fakeClient{name: "a"}, &fakeClient{name: "b"}
+	f, _ := NewFailover([]Endpoint{{a.URL, ca}, {b.URL, cb}}, WithHealthCheck(time.Hour))
+
+	ca.fail.Store(true)
+	for i := 1; i < failAfter; i++ {
+		if f.Send(context.Background(), core.Snapshot{}) == nil {
+			t.Fatal("failed send reported ok")
+		}
+	}
+	if f.Active() != a.URL {
+		t.Fatal("moved before failAfter misses")
+	}
+	if err := f.Send(context.Background(), core.Snapshot{}); err != nil || cb.sent.Load() != 1 {
+		t.Fatalf("tipping send: %v, backup sent %d", err, cb.sent.Load())
+	}
+
+	// too large is the snapshot's fault, not the server's
+	cb.fail.Store(false)
+	g, _ := NewFailover([]Endpoint{{a.URL, tooLarge{}}, {b.URL, cb}}, WithHealthCheck(time.Hour))
+	for i := 0; i < 2*failAfter; i++ {
+		g.Send(context.Background(), core.Snapshot{})
+	}
+	if g.Active() != a.URL {
+		t.Fatal("ErrTooLarge counted against the endpoint")
+	}
+}
+
+type tooLarge struct{}
+
+func (tooLarge) Send(context.Context, core.Snapshot) error        { return ErrTooLarge }
+func (tooLarge) Poll(ctx context.Context, _ chan<- core.Snapshot) { <-ctx.Done() }
+
+func TestFailoverStaysWithNothingUp(t *testing.T) {
+	f, _ := NewFailover([]Endpoint{{"redis://127.0.0.1:1", &fakeClient{}}, {"nats://127.0.0.1:1", &fakeClient{}}},
+		WithTimeout(200*time.Millisecond))
+	for i := 0; i < 2*failAfter; i++ {
+		f.tick(context.Background())
+	}
+	if f.Active() != "redis://127.0.0.1:1" {
+		t.Fatalf("moved to %s, which is down too", f.Active())
+	}
+}
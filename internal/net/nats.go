@@ -0,0 +1,430 @@
+// nats.go — NATS transport implementing the Client interface.
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// natsClient publishes every snapshot on subject clipsync.<room>.  With
+// JetStream on the server, stream CLIPSYNC keeps the last message per
+// subject and a (re)connecting device fetches it, like Redis's last
+// key.  Plain core NATS works too, without the catch-up.
+type natsClient struct {
+	addr    string
+	tls     *tls.Config // tls:// URL or server demands it
+	connect natsConnect
+	subject string
+	stream  string
+	timeout time.Duration
+	*shared
+
+	mu      sync.Mutex // guards pub
+	pub     *natsConn
+	created bool // stream ensured
+}
+
+// natsConnect is the CONNECT payload.
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+}
+
+type natsInfo struct {
+	MaxPayload  int64 `json:"max_payload"`
+	TLSRequired bool  `json:"tls_required"`
+	JetStream   bool  `json:"jetstream"`
+}
+
+var _ Client = (*natsClient)(nil)
+
+// NewNATS builds a NATS client for nats://[user:pass@ | token@]host[:port]
+// (tls:// for TLS); ?stream= renames the JetStream stream.  The NATS
+// credentials are the access control, so there is no key.
+func NewNATS(rawURL, id string, opts ...Option) (*natsClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+		return nil, errors.New("nats: want nats://[user:pass@]host[:port]")
+	}
+	cfg := newConfig(opts)
+	sh := &shared{id: id}
+	sh.apply(cfg)
+	if cfg.timeout == 0 {
+		cfg.timeout = 10 * time.Second
+	}
+	c := &natsClient{
+		addr:    u.Host,
+		timeout: cfg.timeout,
+		shared:  sh,
+		connect: natsConnect{Name: "clipsync " + id, Lang: "go", Version: "1", Protocol: 1},
+		stream:  "CLIPSYNC",
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.Scheme == "tls" || cfg.tls != nil {
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+		if cfg.tls != nil {
+			c.tls = cfg.tls.Clone()
+		}
+	}
+	if u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			c.connect.User, c.connect.Pass = u.User.Username(), p
+		} else {
+			c.connect.Token = u.User.Username()
+		}
+	}
+	if s := u.Query().Get("stream"); s != "" {
+		c.stream = s
+	}
+	c.subject = "clipsync." + natsToken(cfg.room)
+	return c, nil
+}
+
+// natsToken makes room one subject token: no dots, wildcards or spaces.
+func natsToken(room string) string {
+	if room == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, room)
+}
+
+/*──────── Send (PUB, then PING so errors show up here) ────────*/
+func (c *natsClient) Send(ctx context.Context, snap core.Snapshot) error {
+	snap.Quick = core.QuickKey(snap.Items)
+	snap.Room = c.room
+	snap.Items = core.Pack(snap.Items) // repeated formats go once
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := time.Now()
+	fresh := c.pub == nil
+	if fresh {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return err
+		}
+		c.pub = conn
+	}
+	conn := c.pub.conn
+	defer context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })()
+	if c.pub.js && !c.created {
+		c.created = c.ensureStream(c.pub) == nil
+	}
+
+	body := mustJSON(&snap)
+	if len(body) > c.bodyCap() { // max_payload counts
+		return ErrTooLarge
+	}
+	body = c.squeeze(body)
+	if err := c.pace(ctx, len(body)); err != nil {
+		return err
+	}
+	_ = c.pub.conn.SetDeadline(time.Now().Add(c.timeout))
+	err := c.pub.write("PUB %s %d\r\n%s\r\n", c.subject, len(body), body)
+	if err == nil {
+		err = c.pub.flush()
+	}
+	if err != nil {
+		c.pub.conn.Close()
+		c.pub = nil
+		return err
+	}
+	c.record(0, time.Since(start), fresh)
+	return nil
+}
+
+// ensureStream creates the stream holding the last clip per room.  An
+// existing stream is fine; so is a server that refuses (no catch-up).
+func (c *natsClient) ensureStream(nc *natsConn) error {
+	cfg, _ := json.Marshal(map[string]any{
+		"name":                 c.stream,
+		"subjects":             []string{"clipsync.>"},
+		"max_msgs_per_subject": 1,
+		"max_age":              int64(24 * time.Hour), // ns
+		"storage":              "file",
+	})
+	_, err := nc.request("$JS.API.STREAM.CREATE."+c.stream, cfg)
+	return err
+}
+
+/*──────── Poll (SUB, then catch up) ───────────────────────────*/
+// Redial drops the publishing connection as well.
+func (c *natsClient) Redial() {
+	c.mu.Lock()
+	if c.pub != nil {
+		c.pub.conn.Close()
+		c.pub = nil
+	}
+	c.mu.Unlock()
+	c.shared.Redial()
+}
+
+func (c *natsClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
+	backoff := 500 * time.Millisecond
+	var lastKey string
+	deliver := func(data []byte) {
+		if snap, ok := c.pushed(data, &lastKey); ok {
+			out <- snap
+		}
+	}
+	for ctx.Err() == nil {
+		start := time.Now()
+		if sub, err := c.dial(ctx); err == nil {
+			lctx, cancel := c.untilRedial(ctx)
+			_ = c.listen(lctx, sub, deliver)
+			sub.conn.Close()
+			redial := ctx.Err() == nil && lctx.Err() != nil
+			cancel()
+			if redial {
+				continue // network changed: dial again now
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute { // was up a while: start over
+			backoff = 500 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.kick():
+		case <-time.After(backoff):
+			backoff = minDuration(backoff*2, 8*time.Second)
+		}
+	}
+}
+
+func (c *natsClient) listen(ctx context.Context, sub *natsConn, deliver func([]byte)) error {
+	stop := context.AfterFunc(ctx, func() { sub.conn.Close() })
+	defer stop()
+
+	_ = sub.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := sub.write("SUB %s 1\r\n", c.subject); err != nil {
+		return err
+	}
+	if err := sub.flush(); err != nil {
+		return err
+	}
+	// subscribed first, so nothing falls between the fetch and the feed
+	if sub.js {
+		_ = c.ensureStream(sub)
+		req, _ := json.Marshal(map[string]string{"last_by_subj": c.subject})
+		if reply, err := sub.request("$JS.API.STREAM.MSG.GET."+c.stream, req); err == nil {
+			var r struct {
+				Message struct {
+					Data []byte `json:"data"` // base64 in the JSON
+				} `json:"message"`
+			}
+			if json.Unmarshal(reply, &r) == nil && len(r.Message.Data) > 0 {
+				deliver(r.Message.Data)
+			}
+		}
+	}
+	_ = sub.conn.SetDeadline(time.Time{})
+
+	for {
+		m, err := sub.next()
+		if err != nil {
+			return err
+		}
+		if m.sid == "1" {
+			deliver(m.data)
+		}
+	}
+}
+
+// dial connects and logs in: INFO, CONNECT, PING → PONG.
+func (c *natsClient) dial(ctx context.Context) (*natsConn, error) {
+	d := &net.Dialer{Timeout: c.timeout, KeepAlive: 30 * time.Second}
+	raw, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	_ = raw.SetDeadline(time.Now().Add(c.timeout))
+	nc := &natsConn{conn: raw, r: bufio.NewReader(raw)}
+	line, err := nc.r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		raw.Close()
+		return nil, fmt.Errorf("nats: no INFO from %s", c.addr)
+	}
+	var info natsInfo
+	_ = json.Unmarshal([]byte(line[5:]), &info)
+	if info.TLSRequired || c.tls != nil {
+		tc := c.tls
+		if tc == nil {
+			host, _, _ := net.SplitHostPort(c.addr)
+			tc = &tls.Config{ServerName: host}
+		}
+		t := tls.Client(raw, tc)
+		if err := t.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		nc.conn, nc.r = t, bufio.NewReader(t)
+	}
+	nc.js = info.JetStream
+	nc.w = bufio.NewWriter(nc.conn)
+	c.observeLimits(info.MaxPayload, 0)
+	nc.max = int(max(info.MaxPayload, 1<<20)) + 1<<10
+
+	hello, _ := json.Marshal(c.connect)
+	if err := nc.write("CONNECT %s\r\n", hello); err != nil {
+		nc.conn.Close()
+		return nil, err
+	}
+	if err := nc.flush(); err != nil {
+		nc.conn.Close()
+		return nil, err
+	}
+	return nc, nil
+}
+
+/*──────── protocol, just what we use ──────────────────────────*/
+type natsConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+	js    bool // server has JetStream
+	max   int  // largest payload accepted
+	inbox int  // request counter
+}
+
+type natsMsg struct {
+	subject, sid string
+	data         []byte
+}
+
+func (nc *natsConn) write(format string, args ...any) error {
+	_, err := fmt.Fprintf(nc.w, format, args...)
+	return err
+}
+
+// flush sends what is buffered and waits for the server's PONG, so an
+// -ERR (bad auth, payload too big) is returned here.  Messages that
+// arrive meanwhile are dropped; only Send and setup use it.
+func (nc *natsConn) flush() error {
+	if err := nc.write("PING\r\n"); err != nil {
+		return err
+	}
+	if err := nc.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := nc.line()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "MSG "):
+			if _, err := nc.payload(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// request publishes to subject with a fresh reply inbox and waits for
+// the answer.  Other messages arriving meanwhile are dropped.
+func (nc *natsConn) request(subject string, body []byte) ([]byte, error) {
+	nc.inbox++
+	inbox := "_INBOX.clipsync." + randomID(6) + "." + strconv.Itoa(nc.inbox)
+	sid := "r" + strconv.Itoa(nc.inbox)
+	if err := nc.write("SUB %s %s\r\nUNSUB %s 1\r\nPUB %s %s %d\r\n%s\r\n",
+		inbox, sid, sid, subject, inbox, len(body), body); err != nil {
+		return nil, err
+	}
+	if err := nc.w.Flush(); err != nil {
+		return nil, err
+	}
+	for {
+		m, err := nc.next()
+		if err != nil {
+			return nil, err
+		}
+		if m.sid == sid {
+			return m.data, nil
+		}
+	}
+}
+
+// next returns the next message, answering PINGs on the way.
+func (nc *natsConn) next() (natsMsg, error) {
+	for {
+		line, err := nc.line()
+		if err != nil {
+			return natsMsg{}, err
+		}
+		switch {
+		case line == "PING":
+			if err := nc.write("PONG\r\n"); err != nil {
+				return natsMsg{}, err
+			}
+			if err := nc.w.Flush(); err != nil {
+				return natsMsg{}, err
+			}
+		case strings.HasPrefix(line, "MSG "):
+			return nc.payload(line)
+		}
+	}
+}
+
+// line reads one control line; -ERR becomes an error.
+func (nc *natsConn) line() (string, error) {
+	line, err := nc.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "-ERR") {
+		return "", fmt.Errorf("nats: %s", strings.Trim(line[4:], " '"))
+	}
+	return line, nil
+}
+
+// payload reads the body of "MSG <subject> <sid> [reply] <bytes>".
+func (nc *natsConn) payload(line string) (natsMsg, error) {
+	f := strings.Fields(line)
+	if len(f) < 4 {
+		return natsMsg{}, fmt.Errorf("nats: bad %q", line)
+	}
+	n, err := strconv.Atoi(f[len(f)-1])
+	if err != nil || n < 0 || n > nc.max {
+		return natsMsg{}, fmt.Errorf("nats: bad size in %q", line)
+	}
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(nc.r, b); err != nil {
+		return natsMsg{}, err
+	}
+	return natsMsg{subject: f[1], sid: f[2], data: b[:n]}, nil
+}
@@ -0,0 +1,159 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// fakeNATS speaks enough of the protocol for the transport, with a
+// JetStream that keeps the last message per subject.
+type fakeNATS struct {
+	mu   sync.Mutex
+	subs map[string][]natsSub
+	last map[string][]byte
+}
+
+type natsSub struct {
+	w   io.Writer
+	sid string
+}
+
+func startFakeNATS(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeNATS{subs: map[string][]natsSub{}, last: map[string][]byte{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, `INFO {"max_payload":1048576,"jetstream":true}`+"\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fld := strings.Fields(line)
+		if len(fld) == 0 {
+			continue
+		}
+		f.mu.Lock()
+		switch fld[0] {
+		case "CONNECT":
+			if !strings.Contains(line, `"auth_token":"tok"`) {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				f.mu.Unlock()
+				return
+			}
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "SUB":
+			f.subs[fld[1]] = append(f.subs[fld[1]], natsSub{conn, fld[2]})
+		case "PUB":
+			n, _ := strconv.Atoi(fld[len(fld)-1])
+			body := make([]byte, n+2)
+			io.ReadFull(r, body)
+			body = body[:n]
+			subj, reply := fld[1], ""
+			if len(fld) == 4 {
+				reply = fld[2]
+			}
+			switch {
+			case strings.HasPrefix(subj, "$JS.API.STREAM.CREATE."):
+				f.pub(reply, []byte(`{"config":{}}`))
+			case strings.HasPrefix(subj, "$JS.API.STREAM.MSG.GET."):
+				var req struct {
+					Subj string `json:"last_by_subj"`
+				}
+				json.Unmarshal(body, &req)
+				if m, ok := f.last[req.Subj]; ok {
+					out, _ := json.Marshal(map[string]any{"message": map[string]any{"data": m}})
+					f.pub(reply, out)
+				} else {
+					f.pub(reply, []byte(`{"error":{"code":404}}`))
+				}
+			default:
+				f.last[subj] = body
+				f.pub(subj, body)
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeNATS) pub(subj string, body []byte) {
+	for _, s := range f.subs[subj] {
+		fmt.Fprintf(s.w, "MSG %s %s %d\r\n%s\r\n", subj, s.sid, len(body), body)
+	}
+}
+
+func TestNATSPubSubAndCatchUp(t *testing.T) {
+	addr := startFakeNATS(t)
+	url := "nats://tok@" + addr
+	a, err := NewNATS(url, "aaaa", WithRoom("my.room"), WithCompression(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.subject != "clipsync.my_room" {
+		t.Fatalf("subject %q", a.subject)
+	}
+	if bad, _ := NewNATS("nats://"+addr, "x"); bad.Send(context.Background(), core.Snapshot{}) == nil {
+		t.Fatal("unauthenticated send accepted")
+	}
+
+	item := core.Item{MimeType: "text/plain", Payload: "aGk=", ByteLen: 2}
+	if err := a.Send(context.Background(), core.Snapshot{Origin: "aaaa", TS: 1, Items: []core.Item{item}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// b joins late: the stream hands it the last clip, then live ones
+	b, _ := NewNATS(url, "bbbb", WithRoom("my.room"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan core.Snapshot, 4)
+	go b.Poll(ctx, out)
+
+	recv := func() core.Snapshot {
+		select {
+		case s := <-out:
+			return s
+		case <-time.After(2 * time.Second):
+			t.Fatal("nothing arrived")
+		}
+		return core.Snapshot{}
+	}
+	if s := recv(); s.TS != 1 || s.Items[0].Payload != "aGk=" {
+		t.Fatalf("catch-up got %+v", s)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := a.Send(context.Background(), core.Snapshot{Origin: "aaaa", TS: 2, Items: []core.Item{item}}); err != nil {
+		t.Fatal(err)
+	}
+	if s := recv(); s.TS != 2 {
+		t.Fatalf("live got %+v", s)
+	}
+}
@@ -0,0 +1,219 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"clipsync/internal/persist"
+
+	"github.com/flynn/noise"
+	"nhooyr.io/websocket"
+)
+
+/*──────── Noise_XX over the WebSocket ────────────────────────*/
+// With WithNoise the WS transport runs a Noise_XX handshake right after
+// the upgrade (Noise Protocol Framework rev 34, X25519, AES-GCM,
+// SHA-256, by github.com/flynn/noise) and every data frame after it is
+// sealed with that connection's session keys.  The keys die with the
+// connection, so a recorded session stays sealed even if a static key
+// leaks later.
+//
+// The shared -key plays no part: anyone who has seen one auth header
+// can work it out from ts_enc, so it would prove nothing.  What the
+// handshake proves is the server's static key, and a client only knows
+// it is talking to the right server if that key is pinned
+// (WithNoise's pin, -noise-server-key).
+//
+// The dial carries "X-Noise: <NoiseProtocol>" and a server that speaks
+// it echoes the header on the upgrade response.  Handshake messages are
+// binary frames.  A sealed frame is one or more Noise transport
+// messages, each prefixed with its big-endian 16-bit length, since one
+// message holds at most 65535 bytes and a snapshot may not.
+
+// NoiseProtocol is the full Noise protocol name, also the X-Noise value.
+const NoiseProtocol = "Noise_XX_25519_AESGCM_SHA256"
+
+// noisePrologue names what the handshake is for.
+var noisePrologue = []byte("clipsync ws noise v2")
+
+var noiseSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherAESGCM, noise.HashSHA256)
+
+// noiseMax is the Noise message size limit; noiseTag the AEAD overhead.
+const (
+	noiseMax = noise.MaxMsgLen
+	noiseTag = 16
+)
+
+var (
+	ErrNoiseUnsupported = errors.New("ws: server does not speak " + NoiseProtocol)
+	ErrNoiseHandshake   = errors.New("ws: noise handshake failed")
+	ErrNoisePeer        = errors.New("ws: noise: server key is not the pinned one")
+)
+
+// NoiseKey is a static X25519 key pair.
+type NoiseKey = noise.DHKey
+
+// NewNoiseKey makes a fresh static key, such as a client's for one run.
+func NewNoiseKey() (NoiseKey, error) {
+	return noiseSuite.GenerateKeypair(rand.Reader)
+}
+
+// LoadNoiseKey reads the hex private key at path, creating it on first
+// use; the server's, so its public half stays what clients pinned.
+func LoadNoiseKey(path string) (NoiseKey, error) {
+	if b, err := os.ReadFile(path); err == nil {
+		priv, err := hex.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(priv) != 32 {
+			return NoiseKey{}, fmt.Errorf("ws: noise: %s: not an X25519 private key", path)
+		}
+		return noiseSuite.GenerateKeypair(bytes.NewReader(priv))
+	} else if !os.IsNotExist(err) {
+		return NoiseKey{}, err
+	}
+	k, err := NewNoiseKey()
+	if err != nil {
+		return NoiseKey{}, err
+	}
+	if err := persist.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return NoiseKey{}, err
+	}
+	if err := persist.WriteFile(path, []byte(hex.EncodeToString(k.Private)+"\n"), 0o600); err != nil {
+		return NoiseKey{}, err
+	}
+	return k, nil
+}
+
+// NoiseSession is one connection's pair of transport ciphers.
+type NoiseSession struct {
+	mu     sync.Mutex // Seal; Open is the read loop's alone
+	send   *noise.CipherState
+	recv   *noise.CipherState
+	remote []byte // peer's static X25519 public key
+}
+
+// RemoteStatic is the peer's static public key, as the handshake
+// proved it.
+func (s *NoiseSession) RemoteStatic() []byte { return s.remote }
+
+// Seal encrypts one frame's worth of msg.
+func (s *NoiseSession) Seal(msg []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]byte, 0, len(msg)+(len(msg)/(noiseMax-noiseTag)+1)*(2+noiseTag))
+	for first := true; first || len(msg) > 0; first = false {
+		n := min(len(msg), noiseMax-noiseTag)
+		out = binary.BigEndian.AppendUint16(out, uint16(n+noiseTag))
+		var err error
+		if out, err = s.send.Encrypt(out, nil, msg[:n]); err != nil {
+			return nil, fmt.Errorf("ws: noise: %w", err)
+		}
+		msg = msg[n:]
+	}
+	return out, nil
+}
+
+// Open decrypts a frame from Seal.  Any error leaves the session out of
+// step with the peer; the connection has to go.
+func (s *NoiseSession) Open(frame []byte) ([]byte, error) {
+	var out []byte
+	for len(frame) > 0 {
+		n := 0
+		if len(frame) >= 2 {
+			n = int(binary.BigEndian.Uint16(frame))
+		}
+		if n < noiseTag || len(frame) < 2+n {
+			return nil, errors.New("ws: noise: short message")
+		}
+		var err error
+		if out, err = s.recv.Decrypt(out, nil, frame[2:2+n]); err != nil {
+			return nil, fmt.Errorf("ws: noise: %w", err)
+		}
+		frame = frame[2+n:]
+	}
+	return out, nil
+}
+
+func newNoiseHandshake(static NoiseKey, initiator bool) (*noise.HandshakeState, error) {
+	return noise.NewHandshakeState(noise.Config{
+		CipherSuite:   noiseSuite,
+		Random:        rand.Reader,
+		Pattern:       noise.HandshakeXX,
+		Initiator:     initiator,
+		Prologue:      noisePrologue,
+		StaticKeypair: static,
+	})
+}
+
+// noiseInitiate is the client side of the handshake on a fresh conn.
+func noiseInitiate(ctx context.Context, conn *websocket.Conn, static NoiseKey) (*NoiseSession, error) {
+	hs, err := newNoiseHandshake(static, true)
+	if err != nil {
+		return nil, err
+	}
+	// -> e
+	msg, _, _, err := hs.WriteMessage(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Write(ctx, websocket.MessageBinary, msg); err != nil {
+		return nil, err
+	}
+	// <- e, ee, s, es
+	if _, msg, err = conn.Read(ctx); err != nil {
+		return nil, err
+	}
+	if _, _, _, err = hs.ReadMessage(nil, msg); err != nil {
+		return nil, ErrNoiseHandshake
+	}
+	// -> s, se
+	msg, send, recv, err := hs.WriteMessage(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Write(ctx, websocket.MessageBinary, msg); err != nil {
+		return nil, err
+	}
+	return &NoiseSession{send: send, recv: recv, remote: hs.PeerStatic()}, nil
+}
+
+// NoiseRespond is the server side of the handshake, for a conn accepted
+// after setting "X-Noise: NoiseProtocol" on the response.
+func NoiseRespond(ctx context.Context, conn *websocket.Conn, static NoiseKey) (*NoiseSession, error) {
+	hs, err := newNoiseHandshake(static, false)
+	if err != nil {
+		return nil, err
+	}
+	// -> e
+	_, msg, err := conn.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err = hs.ReadMessage(nil, msg); err != nil {
+		return nil, ErrNoiseHandshake
+	}
+	// <- e, ee, s, es
+	if msg, _, _, err = hs.WriteMessage(nil, nil); err != nil {
+		return nil, err
+	}
+	if err := conn.Write(ctx, websocket.MessageBinary, msg); err != nil {
+		return nil, err
+	}
+	// -> s, se
+	if _, msg, err = conn.Read(ctx); err != nil {
+		return nil, err
+	}
+	_, recv, send, err := hs.ReadMessage(nil, msg)
+	if err != nil {
+		return nil, ErrNoiseHandshake
+	}
+	return &NoiseSession{send: send, recv: recv, remote: hs.PeerStatic()}, nil
+}
@@ -0,0 +1,203 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+
+	"nhooyr.io/websocket"
+)
+
+const noiseKey = "0123456789abcdef"
+
+// noiseServer relays each sealed frame back to its sender with the
+// origin changed, so the client's own filter lets it through.  Handshake
+// errors go to errs.
+func noiseServer(t *testing.T, static NoiseKey, errs chan<- error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Noise") != NoiseProtocol {
+			http.Error(w, "noise required", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Noise", NoiseProtocol)
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close(websocket.StatusNormalClosure, "")
+		c.SetReadLimit(1 << 24)
+		ctx := r.Context()
+		sess, err := NoiseRespond(ctx, c, static)
+		if err != nil {
+			errs <- err
+			return
+		}
+		for {
+			_, frame, err := c.Read(ctx)
+			if err != nil {
+				return
+			}
+			msg, err := sess.Open(frame)
+			if err != nil {
+				errs <- err
+				return
+			}
+			msg = bytes.Replace(msg, []byte(`"origin":"me"`), []byte(`"origin":"peer"`), 1)
+			if msg, err = sess.Seal(msg); err != nil || c.Write(ctx, websocket.MessageBinary, msg) != nil {
+				return
+			}
+		}
+	}))
+}
+
+func noiseStatic(t *testing.T) NoiseKey {
+	k, err := NewNoiseKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// sendUntilEcho sends snap until the relay's echo comes back, riding
+// out the time the dial and handshake take.
+func sendUntilEcho(cli *wsClient, snap core.Snapshot, out <-chan core.Snapshot, d time.Duration) (core.Snapshot, bool) {
+	end := time.After(d)
+	for {
+		cli.Send(context.Background(), snap)
+		select {
+		case got := <-out:
+			return got, true
+		case <-end:
+			return core.Snapshot{}, false
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestNoiseRoundTrip(t *testing.T) {
+	static := noiseStatic(t)
+	errs := make(chan error, 4)
+	ts := noiseServer(t, static, errs)
+	defer ts.Close()
+
+	cli, err := NewWS("ws"+ts.URL[4:], "me", noiseKey, WithNoise(static.Public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan core.Snapshot, 1)
+	go cli.Poll(ctx, out)
+
+	text := strings.Repeat("sealed ", 100)
+	got, ok := sendUntilEcho(cli, core.Snapshot{Origin: "me", Items: []core.Item{core.TextItem([]byte(text))}}, out, 3*time.Second)
+	if !ok {
+		t.Fatalf("no echo; server: %v", drain(errs))
+	}
+	if b, _ := core.Text(got.Items); string(b) != text {
+		t.Fatalf("echo = %d bytes, want %d", len(b), len(text))
+	}
+}
+
+func TestNoiseRejectsWrongPin(t *testing.T) {
+	static := noiseStatic(t)
+	errs := make(chan error, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ts := noiseServer(t, static, errs)
+	defer ts.Close()
+	cli, _ := NewWS("ws"+ts.URL[4:], "me", noiseKey, WithNoise(noiseStatic(t).Public))
+	if err := cli.dial(ctx); !errors.Is(err, ErrNoisePeer) {
+		t.Fatalf("pin mismatch: %v", err)
+	}
+	cli, _ = NewWS("ws"+ts.URL[4:], "me", noiseKey, WithNoise(static.Public))
+	if err := cli.dial(ctx); err != nil {
+		t.Fatalf("pinned key: %v", err)
+	}
+
+	// a server that doesn't speak it
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err == nil {
+			c.Close(websocket.StatusNormalClosure, "")
+		}
+	}))
+	defer plain.Close()
+	cli, _ = NewWS("ws"+plain.URL[4:], "me", noiseKey, WithNoise(nil))
+	if err := cli.dial(ctx); !errors.Is(err, ErrNoiseUnsupported) {
+		t.Fatalf("plain server: %v", err)
+	}
+}
+
+func TestNoiseSessionTamper(t *testing.T) {
+	a, b := noiseStatic(t), noiseStatic(t)
+	// drive both ends over an in-process socket pair
+	srv := make(chan *NoiseSession, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Noise", NoiseProtocol)
+		c, _ := websocket.Accept(w, r, nil)
+		s, _ := NoiseRespond(r.Context(), c, b)
+		srv <- s
+		c.Read(r.Context()) // hold the conn until the client goes
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+ts.URL[4:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	cs, err := noiseInitiate(ctx, conn, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := <-srv
+	if ss == nil || !bytes.Equal(ss.RemoteStatic(), a.Public) || !bytes.Equal(cs.RemoteStatic(), b.Public) {
+		t.Fatal("static keys not exchanged")
+	}
+
+	seal := func(s *NoiseSession, msg []byte) []byte {
+		f, err := s.Seal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	f1, f2 := seal(cs, []byte("one")), seal(cs, []byte("two"))
+	if _, err := ss.Open(f2); err == nil {
+		t.Fatal("out-of-order frame opened") // nonces are sequential
+	}
+	if m, err := ss.Open(f1); err != nil || string(m) != "one" {
+		t.Fatalf("Open = %q, %v", m, err)
+	}
+	f2[len(f2)-1] ^= 1
+	if _, err := ss.Open(f2); err == nil {
+		t.Fatal("tampered frame opened")
+	}
+	if m, err := cs.Open(seal(ss, nil)); err != nil || len(m) != 0 {
+		t.Fatalf("empty frame: %q, %v", m, err)
+	}
+	// past one Noise message: split and rejoined
+	big := bytes.Repeat([]byte("sealed "), 20000)
+	if m, err := cs.Open(seal(ss, big)); err != nil || !bytes.Equal(m, big) {
+		t.Fatalf("big frame: %d bytes, %v", len(m), err)
+	}
+}
+
+func drain(errs chan error) error {
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
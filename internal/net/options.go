@@ -0,0 +1,285 @@
+package net
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"clipsync/internal/store"
+)
+
+/*──────── constructor options ────────────────────────────────*/
+
+// Option configures NewHTTP / NewWS / NewS3.  Options a transport has no use
+// for (upload workers on WS, say) are ignored.
+type Option func(*config)
+
+type config struct {
+	room       string
+	timeout    time.Duration // 0 = transport default
+	workers    int
+	maxUpKbps  int       // 0 = unlimited
+	parts      partStore // partial downloads; zero = memory only
+	lim        Limits
+	retry      RetryPolicy
+	tls        *tls.Config
+	headers    http.Header
+	compress   bool
+	every      time.Duration // S3 listing period
+	stale      time.Duration // HTTP: give up a download idle this long
+	noise      bool          // WS: Noise_XX handshake
+	noisePin   []byte
+	adaptive   bool                                  // X-Net-Stats / X-Hints
+	proxy      func(*http.Request) (*url.URL, error) // nil = from the environment
+	health     time.Duration                         // failover: between health checks
+	onFailover func(from, to string)                 // failover: endpoint changed
+	devTok     DeviceToken                           // X-Device-Auth; zero = none
+	wsDeflate  bool                                  // WS: offer permessage-deflate
+	wsPing     time.Duration                         // WS: between pings; 0 = none
+	wsPongWait time.Duration                         // WS: a pong later than this drops the conn
+	reconnect  ReconnectPolicy                       // WS: between failed dials
+	onWSState  func(WSEvent)                         // WS: connection state changed
+	quic       bool                                  // HTTP: HTTP/3 over QUIC
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{workers: 4, retry: DefaultRetry, stale: 10 * time.Minute,
+		wsPing: 15 * time.Second, wsPongWait: 5 * time.Second, reconnect: DefaultReconnect}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+	return cfg
+}
+
+// WithRoom joins a sync room; "" is the default room.
+func WithRoom(room string) Option { return func(c *config) { c.room = room } }
+
+// WithTimeout bounds each HTTP request (default 15s), or the WS dial
+// and each write (default 10s).
+func WithTimeout(d time.Duration) Option { return func(c *config) { c.timeout = d } }
+
+// WithUploadWorkers sets how many chunks upload at once (HTTP, default 4).
+func WithUploadWorkers(n int) Option { return func(c *config) { c.workers = n } }
+
+// WithMaxUpload caps what the transport sends at kbps kilobits per
+// second, parallel chunks, blobs and all (0 = unlimited).  Chunks
+// shrink to a second's worth each, so a big upload leaves room for
+// everything else on a slow link.  Bodies are paced whole: a WS or
+// Redis message goes out at once after waiting its turn.
+func WithMaxUpload(kbps int) Option { return func(c *config) { c.maxUpKbps = kbps } }
+
+// WithResumeDir keeps partial downloads in dir across restarts (HTTP;
+// default "" = memory only).
+func WithResumeDir(dir string) Option {
+	return func(c *config) {
+		c.parts = partStore{}
+		if dir != "" {
+			c.parts = partStore{st: store.Dir(dir)}
+		}
+	}
+}
+
+// WithResumeStore is WithResumeDir for any store.Storage; partial
+// downloads go under PartsNamespace.
+func WithResumeStore(st store.Storage) Option {
+	return func(c *config) { c.parts = partStore{st: st, ns: PartsNamespace} }
+}
+
+// WithStaleAfter drops a partial download, in memory and in the resume
+// dir, once it has made no progress for d (HTTP, default 10m; the
+// server forgets a snapshot well before that).
+func WithStaleAfter(d time.Duration) Option { return func(c *config) { c.stale = d } }
+
+// WithLimits overrides the body cap and chunk size; see Limits.
+func WithLimits(l Limits) Option { return func(c *config) { c.lim = l } }
+
+// WithRetryPolicy replaces DefaultRetry for chunk uploads.
+func WithRetryPolicy(p RetryPolicy) Option { return func(c *config) { c.retry = p } }
+
+// WithTLSConfig is used for every connection; a session cache is added
+// if it has none.  The config is cloned, not kept.
+func WithTLSConfig(t *tls.Config) Option { return func(c *config) { c.tls = t } }
+
+// WithProxy sends every HTTP request, WS dial and blob transfer through
+// u: http://, https:// or socks5:// (socks5h:// resolves names on the
+// proxy), credentials in the URL.  nil connects directly, ignoring
+// HTTP_PROXY and friends, which are used otherwise.
+func WithProxy(u *url.URL) Option {
+	return func(c *config) {
+		c.proxy = func(*http.Request) (*url.URL, error) { return u, nil }
+	}
+}
+
+// ParseProxy reads a proxy URL for WithProxy; "none" or "direct" is
+// nil.  Schemes other than the ones WithProxy takes are an error.
+func ParseProxy(s string) (*url.URL, error) {
+	if s == "none" || s == "direct" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy %q: want http, https, socks5 or socks5h", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q: no host", s)
+	}
+	return u, nil
+}
+
+// WithHeaders adds h to every request and WS dial (proxy auth, tracing).
+// The auth, device and room headers always win.
+func WithHeaders(h http.Header) Option { return func(c *config) { c.headers = h.Clone() } }
+
+// WithCompression gzips snapshot bodies that don't go inline.  Peers
+// detect it by the gzip magic, so mixed fleets interoperate.
+func WithCompression(on bool) Option { return func(c *config) { c.compress = on } }
+
+// WithWSDeflate offers permessage-deflate (RFC 7692) on every WS dial,
+// with the window kept across messages, so snapshots after the first
+// cost a fraction of their JSON.  Servers that don't take it up get
+// plain frames, and with WithNoise it is never offered: sealed frames
+// don't compress.
+func WithWSDeflate(on bool) Option { return func(c *config) { c.wsDeflate = on } }
+
+// WithKeepalive pings the WS server every interval and drops the
+// connection, re-dialling at once, when a pong takes longer than wait
+// (default 15s and 5s).  A half-open socket (the laptop slept, a NAT
+// forgot the mapping) reads nothing rather than failing, so without
+// this snapshots go missing until something else breaks it; 0 turns
+// pings off.
+func WithKeepalive(interval, wait time.Duration) Option {
+	return func(c *config) { c.wsPing, c.wsPongWait = interval, wait }
+}
+
+// WithListInterval is how often the S3 transport lists the bucket for
+// new clips (default 2s).  Each listing is a billed request.
+func WithListInterval(d time.Duration) Option { return func(c *config) { c.every = d } }
+
+// WithNoise runs a Noise_XX handshake on every WS connection and seals
+// each frame with its session keys (see noise.go); the server must
+// support it.  pin, if not nil, is the server's static X25519 public
+// key, and a server proving any other is refused.
+func WithNoise(pin []byte) Option {
+	return func(c *config) { c.noise, c.noisePin = true, pin }
+}
+
+// WithAdaptive reports this client's round trip, loss and throughput to
+// the server on each discover and WS dial, and follows the chunk size,
+// poll pause and compression the server hints back (HTTP and WS; see
+// adapt.go).  Hints replace WithLimits' chunk size and WithCompression,
+// never the server's advertised limits.
+func WithAdaptive(on bool) Option { return func(c *config) { c.adaptive = on } }
+
+// WithHealthCheck is how often NewFailover checks the active endpoint,
+// and the primary while away from it (default 10s).
+func WithHealthCheck(d time.Duration) Option { return func(c *config) { c.health = d } }
+
+// WithOnFailover calls fn whenever NewFailover changes endpoint, from
+// a failing one or back to the primary.
+func WithOnFailover(fn func(from, to string)) Option {
+	return func(c *config) { c.onFailover = fn }
+}
+
+// WithReconnect replaces DefaultReconnect for WS dials.
+func WithReconnect(p ReconnectPolicy) Option { return func(c *config) { c.reconnect = p } }
+
+// WithQUIC makes the HTTP transport speak HTTP/3 over QUIC to the
+// https:// URL's port on UDP (clipsyncd -quic).  Re-dials resume with
+// 0-RTT, so a discover after a network change costs no extra round
+// trip.  QUIC goes direct: WithProxy doesn't apply to it.
+func WithQUIC(on bool) Option { return func(c *config) { c.quic = on } }
+
+// WithOnWSState calls fn whenever the WS connection comes up, drops, or
+// a dial fails; see WSEvent.
+func WithOnWSState(fn func(WSEvent)) Option { return func(c *config) { c.onWSState = fn } }
+
+// RetryPolicy is exponential back-off with ±20% jitter.
+type RetryPolicy struct {
+	Max      int           // retries after the first attempt
+	Base     time.Duration // first delay
+	Factor   float64       // growth per retry
+	MaxDelay time.Duration
+}
+
+// DefaultRetry is what NewHTTP uses unless told otherwise.
+var DefaultRetry = RetryPolicy{Max: 5, Base: 100 * time.Millisecond, Factor: 1.5, MaxDelay: 2 * time.Second}
+
+// ReconnectPolicy is how the WS client backs off between failed dials.
+// A connection that comes up starts the next outage at Initial again.
+type ReconnectPolicy struct {
+	Initial    time.Duration // first delay
+	Factor     float64       // growth per failed dial
+	Max        time.Duration // the delay stops growing here; 0 = no cap
+	Jitter     float64       // each delay varies by ± this fraction
+	MaxRetries int           // failed retries in a row before Poll returns; 0 = never
+}
+
+// DefaultReconnect is what NewWS uses unless told otherwise.
+var DefaultReconnect = ReconnectPolicy{Initial: 500 * time.Millisecond, Factor: 2, Max: 8 * time.Second, Jitter: 0.2}
+
+// minReconnect is the least delay wherever a policy would go lower, so
+// a zero Initial or a shrinking Factor can't redial in a tight loop.
+const minReconnect = 100 * time.Millisecond
+
+// delay is the wait after the n-th failed dial in a row.  A Factor below
+// 1 counts as 1 and Jitter is held to [0, 1]: the wait never shrinks
+// between failures or goes negative.
+func (p ReconnectPolicy) delay(n int) time.Duration {
+	d := max(float64(p.Initial), float64(minReconnect))
+	f := max(p.Factor, 1)
+	for i := 1; i < n && (p.Max <= 0 || d < float64(p.Max)); i++ {
+		d *= f
+	}
+	if p.Max > 0 && d > float64(p.Max) {
+		d = max(float64(p.Max), float64(minReconnect))
+	}
+	j := min(max(p.Jitter, 0), 1)
+	return max(time.Duration(d*(1+j*(2*rand.Float64()-1))), minReconnect)
+}
+
+/*──────── body compression ───────────────────────────────────*/
+
+// gzipBody compresses b, or returns it unchanged if that doesn't help.
+func gzipBody(b []byte, level int) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, level)
+	zw.Write(b)
+	zw.Close()
+	if buf.Len() >= len(b) {
+		return b
+	}
+	return buf.Bytes()
+}
+
+// DecodeBody is what a receiver does to every body: gunzip it if it
+// starts with gzip's magic, else take it as it is (exported for interop
+// vectors).
+func DecodeBody(b []byte, limit int) ([]byte, error) { return gunzipBody(b, limit) }
+
+// gunzipBody undoes gzipBody; plain JSON passes through.  At most limit
+// bytes are inflated.
+func gunzipBody(b []byte, limit int) ([]byte, error) {
+	if len(b) < 2 || b[0] != 0x1f || b[1] != 0x8b {
+		return b, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, int64(limit)))
+}
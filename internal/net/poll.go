@@ -4,6 +4,8 @@ package net
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,112 +13,232 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	core "clipsync/internal"
+
+	"github.com/quic-go/quic-go/http3"
 )
 
-// httpClient does polling against /clip.
+// httpClient does polling against /clip.  Uploads get their own
+// connection pool (kept warm) so they never wait behind a discover.
 type httpClient struct {
 	url    string
-	client *http.Client
+	client *http.Client // uploads
+	poller *http.Client // discover + fetch
+	get    string       // GET, or over HTTP/3 the 0-RTT flavour
 	*shared
+
+	noInline atomic.Bool // server answered 400/501 to X-Inline once
+	noRange  atomic.Bool // server ignored X-Chunk-Range once
+	workers  int         // chunk uploads in flight at once
+	parts    partStore   // on-disk copy of the current download
+	retry    RetryPolicy
+
+	stale     time.Duration
+	abandoned atomic.Int64             // stale or corrupt downloads dropped so far
+	devices   atomic.Pointer[[]Device] // from the last discover that listed them
+
+	up, down progress // Transfers
 }
 
 var _ Client = (*httpClient)(nil)
 
-// NewHTTP builds an HTTP poll client.
-func NewHTTP(url string, id string, keyHex string, timeout time.Duration) (*httpClient, error) {
+// NewHTTP builds an HTTP poll client; see Option for the knobs.
+func NewHTTP(url, id, keyHex string, opts ...Option) (*httpClient, error) {
 	sh, err := newShared(id, keyHex)
 	if err != nil {
 		return nil, err
 	}
-	return &httpClient{
-		url:    url,
-		client: &http.Client{Timeout: timeout},
-		shared: sh,
-	}, nil
+	cfg := newConfig(opts)
+	sh.apply(cfg)
+	if cfg.timeout == 0 {
+		cfg.timeout = 15 * time.Second
+	}
+	c := &httpClient{
+		url:     url,
+		client:  &http.Client{Timeout: cfg.timeout, Transport: warmTransport(cfg)},
+		poller:  &http.Client{Timeout: cfg.timeout, Transport: warmTransport(cfg)},
+		get:     http.MethodGet,
+		shared:  sh,
+		workers: cfg.workers,
+		retry:   cfg.retry,
+		parts:   cfg.parts,
+		stale:   cfg.stale,
+	}
+	if cfg.quic {
+		// QUIC streams don't queue behind each other: one connection
+		// serves both.  Discovers and fetches are idempotent GETs, so
+		// they may go as early data; uploads wait for the handshake.
+		t := quicTransport(cfg, &sh.connMeter)
+		c.client = &http.Client{Timeout: cfg.timeout, Transport: t}
+		c.poller = &http.Client{Timeout: cfg.timeout, Transport: t}
+		c.get = http3.MethodGet0RTT
+	}
+	return c, nil
 }
 
 /*──────── Send (upload chunked snapshot) ──────────────────────*/
-func (c *httpClient) Send(snap core.Snapshot) error {
+// Send gives up between chunks and retries, and cuts requests short,
+// once ctx ends: the upload of a clip nobody wants any more stops.
+func (c *httpClient) Send(ctx context.Context, snap core.Snapshot) error {
 	snap.Quick = core.QuickKey(snap.Items)
+	snap.Room = c.room
+	snap.Items = core.Pack(snap.Items) // repeated formats go once
 
 	body := mustJSON(&snap)
 
-	// size check
-	if len(body) > bodyCap {
-		return errors.New("snapshot >32 MiB, dropped")
+	// acks / caps ride beside the active snapshot, never replace it
+	if snap.Kind != "" {
+		return c.postAck(ctx, body)
 	}
 
-	// slice into chunks
-	const chunkSize = 300 * 1024
-	var chunks [][]byte
-	for i := 0; i < len(body); i += chunkSize {
-		end := i + chunkSize
-		if end > len(body) {
-			end = len(body)
+	// size check: move big items out of band first
+	if len(body) > c.bodyCap() {
+		if err := c.offload(ctx, c.client, c.url, &snap); err != nil {
+			return err
+		}
+		if body = mustJSON(&snap); len(body) > c.bodyCap() {
+			return ErrTooLarge
 		}
-		chunks = append(chunks, body[i:end])
 	}
 
+	// small snapshot: one framed request, server fans out at once
+	if len(body) <= c.chunkSize() && !c.noInline.Load() {
+		err := c.postInline(ctx, body, randomID(8))
+		if !errors.Is(err, errNoInline) {
+			return err
+		}
+		c.noInline.Store(true) // old chunk-only server: fall back for good
+	}
+	body = c.squeeze(body)
+
+	// slice into chunks
+	chunks := chunksOf(body, c.chunkSize())
+
 	// generate chunk ID
 	cid := randomID(8)
 
-	// upload each chunk
-	for idx, part := range chunks {
-		totalHdr := len(chunks)          // send real total every time
-		if err := c.postChunkWithRetry(
-			part, cid, idx, totalHdr,    // <-- pass it here
-			maxRetries, baseDelay, delayFactor, maxDelay,
-		); err != nil {
-			return err
+	// the last chunk carries the checksum of the whole body
+	sums := make([]string, len(chunks))
+	sums[len(chunks)-1] = sha256Hex(body)
+
+	// chunk 0 alone opens the cid on the server; the rest go in parallel
+	c.up.start("up", cid, len(chunks))
+	defer c.up.clear()
+	if err := c.postChunkWithRetry(ctx,
+		chunks[0], cid, 0, len(chunks), // send real total every time
+		sums[0],
+	); err != nil {
+		return err
+	}
+	c.up.add()
+	return c.uploadRest(ctx, chunks, cid, sums)
+}
+
+// uploadRest posts chunks[1:] with at most c.workers in flight.  After
+// the first failure no new chunk is started; that error is returned.
+// bodySums[idx] is the body checksum chunk idx carries, if any.
+func (c *httpClient) uploadRest(ctx context.Context, chunks [][]byte, cid string, bodySums []string) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		failed   atomic.Bool
+	)
+	sem := make(chan struct{}, c.workers)
+	for idx := 1; idx < len(chunks); idx++ {
+		sem <- struct{}{}
+		if failed.Load() {
+			<-sem
+			break
 		}
+		wg.Add(1)
+		go func(idx int) {
+			defer func() { <-sem; wg.Done() }()
+			err := c.postChunkWithRetry(ctx,
+				chunks[idx], cid, idx, len(chunks),
+				bodySums[idx],
+			)
+			if err == nil {
+				c.up.add()
+			} else if !failed.Swap(true) {
+				mu.Lock()
+				firstErr = err
+				mu.Unlock()
+			}
+		}(idx)
 	}
-	return nil
+	wg.Wait()
+	return firstErr
 }
 
-// postChunkWithRetry uploads one chunk with exponential backoff.
-func (c *httpClient) postChunkWithRetry(
+// postChunkWithRetry uploads one chunk, backing off per c.retry, until
+// it's through, out of tries or ctx ends.  It carries its own checksum
+// and, if bodySum isn't "", the whole body's.
+func (c *httpClient) postChunkWithRetry(ctx context.Context,
 	chunkData []byte, cid string, idx, total int,
-	maxRetries int, baseDelay, delayFactor, maxDelay time.Duration,
+	bodySum string,
 ) error {
 	var lastErr error
-	delay := baseDelay
+	p := c.retry
+	delay := p.Base
+	sum := sha256Hex(chunkData)
 
-	for retry := 0; retry <= maxRetries; retry++ {
-		req, err := http.NewRequest("POST", c.url, bytes.NewReader(chunkData))
+	for retry := 0; retry <= p.Max; retry++ {
+		if err := c.pace(ctx, len(chunkData)); err != nil {
+			return fmt.Errorf("chunk %d: %w", idx, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(chunkData))
 		if err != nil {
 			return err
 		}
 
-		req.Header.Set("X-Auth-Token", c.buildAuthHeader())
-		req.Header.Set("X-Device-Id", c.id)
+		c.authHeaders(req.Header)
 		req.Header.Set("X-Chunk-Id", cid)
 		req.Header.Set("X-Chunk-Idx", strconv.Itoa(idx))
 		req.Header.Set("X-Chunk-Total", strconv.Itoa(total))
+		req.Header.Set("X-Chunk-SHA256", sum)
+		if bodySum != "" {
+			req.Header.Set("X-Body-SHA256", bodySum)
+		}
 		req.Header.Set("Content-Type", "application/octet-stream")
 
+		req, done := c.trace(req)
+		sent := time.Now()
 		resp, err := c.client.Do(req)
+		done()
+		if ctx.Err() != nil {
+			return fmt.Errorf("chunk %d: %w", idx, ctx.Err()) // not the network's fault
+		}
 		if err != nil {
+			c.observe(0, false)
 			lastErr = fmt.Errorf("POST chunk %d: %w", idx, err)
 		} else {
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
 
 			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				c.observe(time.Since(sent), true)
+				c.observeUpload(len(chunkData), time.Since(sent))
 				return nil // Success
 			}
 			lastErr = fmt.Errorf("chunk %d: status %d: %s", idx, resp.StatusCode, body)
 		}
 
-		if retry < maxRetries {
+		if retry < p.Max {
 			// Add jitter: +/- 20%
 			jitter := time.Duration(float64(delay) * (0.8 + 0.4*rand.Float64()))
-			time.Sleep(jitter)
-			delay = time.Duration(float64(delay) * delayFactor)
-			if delay > maxDelay {
-				delay = maxDelay
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("chunk %d: %w", idx, ctx.Err())
+			case <-time.After(jitter):
+			}
+			delay = time.Duration(float64(delay) * p.Factor)
+			if delay > p.MaxDelay {
+				delay = p.MaxDelay
 			}
 		}
 	}
@@ -124,17 +246,107 @@ func (c *httpClient) postChunkWithRetry(
 	return lastErr
 }
 
-// Constants for retry behavior
-const (
-	maxRetries  = 5
-	baseDelay   = 100 * time.Millisecond
-	delayFactor = 1.5
-	maxDelay    = 2 * time.Second
-)
+// Chunks slices a request body the way Send uploads it by default.
+func Chunks(body []byte) [][]byte { return chunksOf(body, defaultChunkSize) }
+
+func chunksOf(body []byte, size int) [][]byte {
+	var chunks [][]byte
+	for i := 0; i < len(body); i += size {
+		end := i + size
+		if end > len(body) {
+			end = len(body)
+		}
+		chunks = append(chunks, body[i:end])
+	}
+	return chunks
+}
+
+// Inline reports whether a body of n bytes goes up in one request
+// with the default chunk size.
+func Inline(n int) bool { return n <= defaultChunkSize }
+
+// errNoInline means the server rejected the single-request framing.
+var errNoInline = errors.New("server has no inline support")
+
+// postInline uploads a whole snapshot in one POST (X-Inline: 1).
+func (c *httpClient) postInline(ctx context.Context, body []byte, cid string) error {
+	if err := c.pace(ctx, len(body)); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	c.authHeaders(req.Header)
+	req.Header.Set("X-Chunk-Id", cid)
+	req.Header.Set("X-Inline", "1")
+	req.Header.Set("Content-Type", "application/json")
+
+	req, done := c.trace(req)
+	resp, err := c.client.Do(req)
+	done()
+	if err != nil {
+		return fmt.Errorf("POST inline: %w", err)
+	}
+	msg, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusNotImplemented:
+		return errNoInline
+	}
+	return fmt.Errorf("inline: status %d: %s", resp.StatusCode, msg)
+}
+
+// postAck hands a control message (receipt, caps) to the server
+// (X-Ack: 1); it is listed in discover replies for a short while, not
+// stored as a cid.
+func (c *httpClient) postAck(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	c.authHeaders(req.Header)
+	req.Header.Set("X-Ack", "1")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("POST ack: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ack: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Redial also forgets pooled connections, which would otherwise be
+// tried (and time out) first.
+func (c *httpClient) Redial() {
+	c.client.CloseIdleConnections()
+	c.poller.CloseIdleConnections()
+	c.shared.Redial()
+}
 
 /*──────── Poll (discover + fetch loop) ────────────────────────*/
 func (c *httpClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
-	var current state // tracks the current in-progress download
+	current := c.parts.load() // in-progress download, maybe from a previous run
+	var lastInline string
+	var lastDone string               // cid already delivered; the server keeps listing it
+	seenAcks := make(map[string]bool) // discover repeats acks until they age out
+	if current.cid != "" {
+		c.down.start("down", current.cid, current.total)
+		c.down.set(len(current.parts))
+	}
+
+	go c.keepWarm(ctx)
+
+	// requests in flight when the network changes are cut short
+	dctx, cancel := c.untilRedial(ctx)
+	defer func() { cancel() }()
 
 	for {
 		select {
@@ -144,73 +356,146 @@ func (c *httpClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
 		}
 
 		// discover
-		meta, err := c.discover(ctx)
+		meta, err := c.discover(dctx)
 		if err != nil {
+			if ctx.Err() == nil && dctx.Err() != nil {
+				cancel()
+				dctx, cancel = c.untilRedial(ctx)
+				continue // Redial: go again at once
+			}
 			time.Sleep(200 * time.Millisecond)
 			continue
 		}
 
+		// control messages: receipts, caps
+		for _, a := range meta.Acks {
+			k := a.Origin + a.Kind + a.Ack + strconv.FormatInt(a.TS, 10)
+			if a.Origin == c.id || a.Room != c.room || seenAcks[k] {
+				continue
+			}
+			if len(seenAcks) > 256 {
+				seenAcks = make(map[string]bool)
+			}
+			seenAcks[k] = true
+			out <- a
+		}
+
+		// small snapshot delivered inline: no fetch round trip
+		if meta.Snap != nil {
+			if meta.Cid != lastInline {
+				lastInline = meta.Cid
+				if meta.Snap.Origin != c.id && meta.Snap.Room == c.room && core.Unpack(meta.Snap.Items) == nil {
+					out <- *meta.Snap
+				}
+			}
+			if current.cid != "" {
+				c.parts.clear()
+				c.down.clear()
+			}
+			current = state{}
+			time.Sleep(c.pause(200 * time.Millisecond))
+			continue
+		}
+
 		// new snapshot?
-		if meta.cid != "" && meta.cid != current.cid {
+		if meta.Cid != "" && meta.Cid != current.cid && meta.Cid != lastDone {
 			current = state{
-				cid:   meta.cid,
-				total: meta.total,
-				parts: make(map[int][]byte),
+				cid:     meta.Cid,
+				total:   meta.Total,
+				parts:   make(map[int][]byte),
+				touched: time.Now(),
 			}
+			c.parts.begin(current)
+			c.down.start("down", current.cid, current.total)
+		}
+		if meta.Cid == current.cid {
+			current.sums, current.sum = meta.Sums, meta.SHA256
 		}
 
 		// fetch missing parts
 		if current.cid != "" {
-			for _, idx := range meta.have {
-				if _, exists := current.parts[idx]; !exists {
-					data, err := c.fetchChunk(ctx, current.cid, idx)
-					if err == nil {
-						current.parts[idx] = data
-					}
-				}
+			n := len(current.parts)
+			c.fetchMissing(dctx, &current, meta.Have)
+			if len(current.parts) > n {
+				current.touched = time.Now()
 			}
+			c.down.set(len(current.parts))
 
 			// assemble if complete
 			if current.total > 0 && len(current.parts) == current.total {
-				if snap := current.assemble(); snap != nil && snap.Origin != c.id {
-					out <- *snap
+				snap, err := current.assemble(c.bodyCap())
+				var bad badChunk
+				if errors.As(err, &bad) && !current.refetched {
+					// a chunk went bad on the way: fetch it once more
+					current.refetched = true
+					delete(current.parts, int(bad))
+					time.Sleep(c.pause(200 * time.Millisecond))
+					continue
+				}
+				if err != nil {
+					c.abandoned.Add(1)
+				} else if snap.Origin != c.id && snap.Room == c.room {
+					if c.inflate(ctx, c.poller, c.url, snap) == nil && core.Unpack(snap.Items) == nil {
+						out <- *snap
+					}
 				}
+				lastDone = current.cid
 				current = state{} // reset
+				c.parts.clear()
+				c.down.clear()
+			} else if c.stale > 0 && time.Since(current.touched) > c.stale {
+				// the server no longer has it all: stop holding the rest
+				lastDone = current.cid
+				current = state{}
+				c.parts.clear()
+				c.down.clear()
+				c.abandoned.Add(1)
 			}
 		}
 
-		time.Sleep(200 * time.Millisecond)
+		time.Sleep(c.pause(200 * time.Millisecond))
 	}
 }
 
 // discover fetches metadata from server.
 func (c *httpClient) discover(ctx context.Context) (discoverResp, error) {
-	req, _ := http.NewRequestWithContext(ctx, "GET", c.url, nil)
-	req.Header.Set("X-Auth-Token", c.buildAuthHeader())
-	req.Header.Set("X-Device-Id", c.id)
+	req, _ := http.NewRequestWithContext(ctx, c.get, c.url, nil)
+	c.authHeaders(req.Header)
+	c.statsHeader(req.Header)
 
-	resp, err := c.client.Do(req)
+	sent := time.Now()
+	resp, err := c.poller.Do(req)
 	if err != nil {
+		if ctx.Err() == nil {
+			c.observe(0, false)
+		}
 		return discoverResp{}, err
 	}
 	defer resp.Body.Close()
+	observeServerTime(resp.Header, sent, time.Now())
 
 	var meta discoverResp
 	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		c.observe(0, false)
 		return discoverResp{}, err
 	}
+	c.observe(time.Since(sent), true)
+	c.observeHints(resp.Header)
+	c.observeLimits(meta.MaxBody, meta.MaxChunk)
+	if meta.Devices != nil {
+		c.devices.Store(meta.Devices)
+	}
 	return meta, nil
 }
 
 // fetchChunk downloads one part.
 func (c *httpClient) fetchChunk(ctx context.Context, cid string, idx int) ([]byte, error) {
-	req, _ := http.NewRequestWithContext(ctx, "GET", c.url, nil)
-	req.Header.Set("X-Auth-Token", c.buildAuthHeader())
-	req.Header.Set("X-Device-Id", c.id)
+	req, _ := http.NewRequestWithContext(ctx, c.get, c.url, nil)
+	c.authHeaders(req.Header)
 	req.Header.Set("X-Chunk-Id", cid)
 	req.Header.Set("X-Chunk-Idx", strconv.Itoa(idx))
 
-	resp, err := c.client.Do(req)
+	resp, err := c.poller.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -220,7 +505,8 @@ func (c *httpClient) fetchChunk(ctx context.Context, cid string, idx int) ([]byt
 		return nil, errors.New(resp.Status)
 	}
 
-	data, _ := io.ReadAll(io.LimitReader(resp.Body, chunkSize+1024))
+	// other clients may slice larger than we do; the body cap bounds it
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, int64(c.bodyCap())))
 	return data, nil
 }
 
@@ -228,34 +514,97 @@ func (c *httpClient) fetchChunk(ctx context.Context, cid string, idx int) ([]byt
 
 // Response from discover endpoint
 type discoverResp struct {
-	cid   string   `json:"cid"`
-	total int      `json:"total"`
-	have  []int    `json:"have"`
+	Cid   string          `json:"cid"`
+	Total int             `json:"total"`
+	Have  []int           `json:"have"`
+	Snap  *core.Snapshot  `json:"snap,omitempty"` // inline small snapshot
+	Acks  []core.Snapshot `json:"acks,omitempty"` // recent acks / caps
+
+	MaxBody  int64 `json:"max_body,omitempty"` // server limits, 0 = not advertised
+	MaxChunk int64 `json:"max_chunk,omitempty"`
+
+	Sums   map[int]string `json:"sums,omitempty"`   // idx → chunk SHA-256, if relayed
+	SHA256 string         `json:"sha256,omitempty"` // of the whole body
+
+	Devices *[]Device `json:"devices,omitempty"` // active in the room; nil if not listed
+}
+
+// Device is one device a server lists as active in the room: it made a
+// request within the server's presence window.
+type Device struct {
+	ID   string `json:"id"`
+	Seen int64  `json:"seen"` // Unix ms of its last request
 }
 
 // Tracks current download state
 type state struct {
-	cid   string
-	total int
-	parts map[int][]byte
+	cid     string
+	total   int
+	parts   map[int][]byte
+	touched time.Time // last chunk that arrived
+
+	sums      map[int]string // chunk checksums, from discover
+	sum       string         // body checksum
+	refetched bool           // a bad chunk was fetched again already
+}
+
+// Devices is what the server last listed as active in the room, nil if
+// it doesn't list devices.
+func (c *httpClient) Devices() []Device {
+	if d := c.devices.Load(); d != nil {
+		return *d
+	}
+	return nil
 }
 
-// assemble merges chunks into a Snapshot.
-func (s *state) assemble() *core.Snapshot {
+// Abandoned counts partial downloads dropped for making no progress or
+// failing their checksums.
+func (c *httpClient) Abandoned() int64 { return c.abandoned.Load() }
+
+// errChecksum means a chunk or the assembled body doesn't hash to what
+// its uploader said.
+var errChecksum = errors.New("sha256 mismatch")
+
+// badChunk is a chunk index failing its checksum.
+type badChunk int
+
+func (b badChunk) Error() string { return fmt.Sprintf("chunk %d: %v", int(b), errChecksum) }
+func (b badChunk) Unwrap() error { return errChecksum }
+
+// assemble merges chunks into a Snapshot, inflating up to limit bytes
+// if the sender compressed.  Checksums the server relayed are checked
+// first, so a corrupt or truncated chunk is named rather than failing
+// to decode; servers that relay none get the bare decode.
+func (s *state) assemble(limit int) (*core.Snapshot, error) {
 	if s.total == 0 || len(s.parts) != s.total {
-		return nil
+		return nil, fmt.Errorf("%d of %d chunks", len(s.parts), s.total)
 	}
 
 	var full []byte
 	for i := 0; i < s.total; i++ {
+		if want := s.sums[i]; want != "" && sha256Hex(s.parts[i]) != want {
+			return nil, badChunk(i)
+		}
 		full = append(full, s.parts[i]...)
 	}
+	if s.sum != "" && sha256Hex(full) != s.sum {
+		return nil, fmt.Errorf("body of %d bytes: %w", len(full), errChecksum)
+	}
+	full, err := gunzipBody(full, limit)
+	if err != nil {
+		return nil, err
+	}
 
 	var snap core.Snapshot
 	if err := json.Unmarshal(full, &snap); err != nil {
-		return nil
+		return nil, fmt.Errorf("decode snapshot: %w", err)
 	}
-	return &snap
+	return &snap, nil
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
 }
 
 // randomID generates a random hex string.
@@ -264,6 +613,3 @@ func randomID(length int) string {
 	rand.Read(b)
 	return fmt.Sprintf("%x", b)
 }
-
-// Constants for chunking
-const chunkSize = 300 * 1024
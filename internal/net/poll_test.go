@@ -4,8 +4,15 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -21,9 +28,11 @@ func TestSendAddsAuthHeader(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	cli, _ := NewHTTP(ts.URL, "deadbeef", "test-secret-key", 5*time.Second)
-	err := cli.Send(core.Snapshot{}) // empty fine for this test
+	cli, err := NewHTTP(ts.URL, "deadbeef", hexKey)
 	if err != nil {
+		t.Fatalf("NewHTTP: %v", err)
+	}
+	if err := cli.Send(context.Background(), core.Snapshot{}); err != nil { // empty fine for this test
 		t.Fatalf("Send: %v", err)
 	}
 	if gotHeader == "" {
@@ -39,11 +48,14 @@ func TestPollPassesSnapshot(t *testing.T) {
 	want := core.Snapshot{Origin: "other"}
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_ = json.NewEncoder(w).Encode(&want)
+		_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: 1, Snap: &want}) // inline
 	}))
 	defer ts.Close()
 
-	cli, _ := NewHTTP(ts.URL, "deadbeef", "test-secret-key", 5*time.Second)
+	cli, err := NewHTTP(ts.URL, "deadbeef", hexKey)
+	if err != nil {
+		t.Fatalf("NewHTTP: %v", err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -87,9 +99,11 @@ func TestChunking(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	cli, _ := NewHTTP(ts.URL, "deadbeef", "test-secret-key", 5*time.Second)
-	err := cli.Send(snap)
+	cli, err := NewHTTP(ts.URL, "deadbeef", hexKey)
 	if err != nil {
+		t.Fatalf("NewHTTP: %v", err)
+	}
+	if err := cli.Send(context.Background(), snap); err != nil {
 		t.Fatalf("Send: %v", err)
 	}
 
@@ -98,3 +112,594 @@ func TestChunking(t *testing.T) {
 		t.Fatalf("expected 2 chunks, got %d", gotChunks)
 	}
 }
+
+// hex key for tests that need a working client
+const hexKey = "deadbeefdeadbeef"
+
+func TestSendSmallInline(t *testing.T) {
+	var inline, chunked int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Inline") == "1" {
+			inline++
+		} else if r.Header.Get("X-Chunk-Total") != "" {
+			chunked++
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	cli, err := NewHTTP(ts.URL, "deadbeef", hexKey)
+	if err != nil {
+		t.Fatalf("NewHTTP: %v", err)
+	}
+	if err := cli.Send(context.Background(), core.Snapshot{Origin: "me"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if inline != 1 || chunked != 0 {
+		t.Fatalf("want 1 inline / 0 chunked, got %d / %d", inline, chunked)
+	}
+}
+
+func TestSendInlineFallback(t *testing.T) {
+	var chunked int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Inline") != "" {
+			w.WriteHeader(http.StatusBadRequest) // chunk-only server
+			return
+		}
+		chunked++
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	for i := 0; i < 2; i++ {
+		if err := cli.Send(context.Background(), core.Snapshot{Origin: "me"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if chunked != 2 || !cli.noInline.Load() {
+		t.Fatalf("fallback not sticky: chunked=%d", chunked)
+	}
+}
+
+func TestPollInlineSnapshot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(discoverResp{
+			Cid:  "c1",
+			Snap: &core.Snapshot{Origin: "other"},
+		})
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan core.Snapshot, 4)
+	go cli.Poll(ctx, out)
+
+	select {
+	case got := <-out:
+		if got.Origin != "other" {
+			t.Fatalf("got origin %q", got.Origin)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for inline snapshot")
+	}
+	select {
+	case <-out:
+		t.Fatalf("same cid delivered twice")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestRoomHeaderAndFilter(t *testing.T) {
+	var gotRoom atomic.Value // string; the handler runs on the server's goroutines
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRoom.Store(r.Header.Get("X-Room"))
+		_ = json.NewEncoder(w).Encode(discoverResp{
+			Cid:  "c1",
+			Snap: &core.Snapshot{Origin: "other", Room: "work"},
+		})
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithRoom("home"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan core.Snapshot, 1)
+	go cli.Poll(ctx, out)
+
+	select {
+	case <-out:
+		t.Fatalf("snapshot from another room delivered")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if got, _ := gotRoom.Load().(string); got != "home" {
+		t.Fatalf("X-Room = %q, want home", got)
+	}
+}
+
+func TestConnStatsCountsReuse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	for i := 0; i < 3; i++ {
+		if err := cli.Send(context.Background(), core.Snapshot{Origin: "me"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	st := cli.ConnStats()
+	if st.Requests != 3 || st.NewConns != 1 {
+		t.Fatalf("want 3 requests over 1 connection, got %+v", st)
+	}
+}
+
+func TestAckSideChannel(t *testing.T) {
+	var ackHdr, inlineHdr string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			ackHdr, inlineHdr = r.Header.Get("X-Ack"), r.Header.Get("X-Inline")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(discoverResp{Acks: []core.Snapshot{
+			{Origin: "peer", Kind: core.KindAck, Ack: "k1"},
+			{Origin: "deadbeef", Kind: core.KindAck, Ack: "k1"}, // our own
+		}})
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	if err := cli.Send(context.Background(), core.Snapshot{Origin: "deadbeef", Kind: core.KindAck, Ack: "k0"}); err != nil {
+		t.Fatalf("Send ack: %v", err)
+	}
+	if ackHdr != "1" || inlineHdr != "" {
+		t.Fatalf("ack not posted on the side channel: X-Ack=%q X-Inline=%q", ackHdr, inlineHdr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan core.Snapshot, 4)
+	go cli.Poll(ctx, out)
+
+	select {
+	case got := <-out:
+		if got.Origin != "peer" || got.Ack != "k1" {
+			t.Fatalf("unexpected ack %+v", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for ack")
+	}
+	select {
+	case got := <-out:
+		t.Fatalf("ack delivered twice or own ack leaked: %+v", got)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestParallelChunkUpload(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		got         = map[string]bool{}
+		first       string
+		inFlight    int
+		maxInFlight int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Inline") != "" {
+			t.Errorf("large snapshot sent inline")
+		}
+		idx := r.Header.Get("X-Chunk-Idx")
+		mu.Lock()
+		if first == "" {
+			first = idx
+		}
+		got[idx] = true
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(30 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithUploadWorkers(3))
+	big := strings.Repeat("x", 10*defaultChunkSize)
+	if err := cli.Send(context.Background(), core.Snapshot{Origin: "me", Items: []core.Item{{Payload: big}}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if first != "0" {
+		t.Fatalf("chunk %s arrived before chunk 0", first)
+	}
+	if len(got) != 11 {
+		t.Fatalf("server saw %d chunks, want 11", len(got))
+	}
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Fatalf("max in flight %d, want 2..3", maxInFlight)
+	}
+}
+
+func TestPollResumesAcrossRestart(t *testing.T) {
+	body := mustJSON(&core.Snapshot{Origin: "other", Items: []core.Item{{Payload: strings.Repeat("y", 2*defaultChunkSize)}}})
+	chunks := Chunks(body)
+
+	var (
+		mu      sync.Mutex
+		have    = []int{0, 1}
+		fetched = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		idx := r.Header.Get("X-Chunk-Idx")
+		if idx == "" {
+			_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: len(chunks), Have: have})
+			return
+		}
+		fetched[idx]++
+		i, _ := strconv.Atoi(idx)
+		w.Write(chunks[i])
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	run := func(wait time.Duration) []core.Snapshot {
+		cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithResumeDir(dir))
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		defer cancel()
+		out := make(chan core.Snapshot, 4)
+		cli.Poll(ctx, out)
+		close(out)
+		var got []core.Snapshot
+		for s := range out {
+			got = append(got, s)
+		}
+		return got
+	}
+
+	if got := run(600 * time.Millisecond); len(got) != 0 {
+		t.Fatalf("snapshot delivered before all chunks were up")
+	}
+	mu.Lock()
+	have = []int{0, 1, 2}
+	mu.Unlock()
+
+	got := run(600 * time.Millisecond)
+	if len(got) == 0 || got[0].Origin != "other" {
+		t.Fatalf("resumed download not delivered: %+v", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fetched["0"] != 1 || fetched["1"] != 1 {
+		t.Fatalf("chunks re-fetched after restart: %v", fetched)
+	}
+}
+
+func TestServerAdvertisedChunkSize(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			_ = json.NewEncoder(w).Encode(discoverResp{MaxChunk: 64 << 10})
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		sizes = append(sizes, len(b))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithUploadWorkers(1), WithLimits(Limits{ChunkSize: 128 << 10}))
+	if _, err := cli.discover(context.Background()); err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	big := strings.Repeat("z", 200<<10)
+	if err := cli.Send(context.Background(), core.Snapshot{Origin: "me", Items: []core.Item{{Payload: big}}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, n := range sizes {
+		if n > 64<<10 {
+			t.Fatalf("chunk of %d bytes exceeds advertised 64 KiB", n)
+		}
+	}
+	if len(sizes) < 4 {
+		t.Fatalf("want ≥4 chunks at 64 KiB, got %d", len(sizes))
+	}
+}
+
+func TestCompressedChunksRoundTrip(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		chunks = map[int][]byte{}
+		total  int
+		extra  string
+		fails  = 1 // first chunk POST fails once, exercising the retry policy
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		idx, _ := strconv.Atoi(r.Header.Get("X-Chunk-Idx"))
+		switch {
+		case r.Method == "POST":
+			if fails > 0 {
+				fails--
+				w.WriteHeader(503)
+				return
+			}
+			extra = r.Header.Get("X-Trace")
+			total, _ = strconv.Atoi(r.Header.Get("X-Chunk-Total"))
+			chunks[idx], _ = io.ReadAll(r.Body)
+		case r.Header.Get("X-Chunk-Id") != "":
+			w.Write(chunks[idx])
+		default:
+			have := []int{}
+			for i := range chunks {
+				have = append(have, i)
+			}
+			_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: total, Have: have})
+		}
+	}))
+	defer ts.Close()
+
+	hdr := http.Header{}
+	hdr.Set("X-Trace", "abc")
+	hdr.Set("X-Device-Id", "spoofed")
+	retry := RetryPolicy{Max: 1, Base: time.Millisecond, Factor: 1, MaxDelay: time.Millisecond}
+	sender, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithCompression(true), WithHeaders(hdr), WithRetryPolicy(retry))
+	big := strings.Repeat("compress me ", defaultChunkSize)
+	if err := sender.Send(context.Background(), core.Snapshot{Origin: "other", Items: []core.Item{{Payload: big}}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	mu.Lock()
+	if total != 1 || chunks[0][0] != 0x1f {
+		t.Fatalf("want one gzipped chunk, got total=%d", total)
+	}
+	if extra != "abc" {
+		t.Fatalf("extra header lost: %q", extra)
+	}
+	mu.Unlock()
+
+	recv, _ := NewHTTP(ts.URL, "cafebabe", hexKey) // no option: detects gzip
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	out := make(chan core.Snapshot, 1)
+	go recv.Poll(ctx, out)
+	select {
+	case got := <-out:
+		if len(got.Items) != 1 || got.Items[0].Payload != big {
+			t.Fatalf("payload mangled after inflate")
+		}
+	case <-ctx.Done():
+		t.Fatalf("compressed snapshot not delivered")
+	}
+}
+
+func TestSendPacksRepeatedPayloads(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	img := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("png!", 1000)))
+	items := []core.Item{{FmtName: "PNG", Payload: img}, {FmtName: "image/png", Payload: img}}
+	if err := cli.Send(context.Background(), core.Snapshot{Origin: "me", Items: items}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if n := strings.Count(string(body), img); n != 1 {
+		t.Fatalf("payload on the wire %d times, want 1", n)
+	}
+	var got core.Snapshot
+	_ = json.Unmarshal(body, &got)
+	if core.Unpack(got.Items) != nil || got.Items[1].Payload != img {
+		t.Fatalf("receiver can't rebuild the second format")
+	}
+}
+
+func TestPollAbandonsStalledDownload(t *testing.T) {
+	body := mustJSON(&core.Snapshot{Origin: "other", Items: []core.Item{{Payload: strings.Repeat("y", 2*defaultChunkSize)}}})
+	chunks := Chunks(body)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if idx := r.Header.Get("X-Chunk-Idx"); idx != "" {
+			i, _ := strconv.Atoi(idx)
+			w.Write(chunks[i])
+			return
+		}
+		// the sender died after chunk 0
+		_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: len(chunks), Have: []int{0}})
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithResumeDir(dir), WithStaleAfter(300*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cli.Poll(ctx, make(chan core.Snapshot, 1))
+
+	if cli.Abandoned() != 1 {
+		t.Fatalf("abandoned %d downloads, want 1", cli.Abandoned())
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Fatalf("stale parts left on disk: %v", left)
+	}
+}
+
+func TestTransfersReportChunkProgress(t *testing.T) {
+	body := mustJSON(&core.Snapshot{Origin: "other", Items: []core.Item{{Payload: strings.Repeat("y", 2*defaultChunkSize)}}})
+	chunks := Chunks(body)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idx := r.Header.Get("X-Chunk-Idx")
+		switch {
+		case r.Method == "POST":
+			if idx != "0" {
+				<-release // hold the upload after its first chunk
+			}
+		case idx != "":
+			i, _ := strconv.Atoi(idx)
+			w.Write(chunks[i])
+		default: // a download whose sender is still on chunk 0
+			_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: len(chunks), Have: []int{0}})
+		}
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cli.Poll(ctx, make(chan core.Snapshot, 1))
+	sent := make(chan error, 1)
+	go func() {
+		sent <- cli.Send(context.Background(), core.Snapshot{Items: []core.Item{{Payload: strings.Repeat("x", 2*defaultChunkSize)}}})
+	}()
+
+	want := map[string]string{"up": "1/", "down": "1/" + strconv.Itoa(len(chunks))}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := map[string]string{}
+		for _, x := range cli.Transfers() {
+			got[x.Dir] = strconv.Itoa(x.Done) + "/" + strconv.Itoa(x.Total)
+		}
+		if strings.HasPrefix(got["up"], want["up"]) && got["down"] == want["down"] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transfers %v, want up 1/… and down %s", got, want["down"])
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	close(release)
+	if err := <-sent; err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for _, x := range cli.Transfers() {
+		if x.Dir == "up" {
+			t.Fatalf("finished upload still listed: %+v", x)
+		}
+	}
+}
+
+func TestSendStopsWhenCalledOff(t *testing.T) {
+	var posts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		http.Error(w, "busy", http.StatusServiceUnavailable) // retried, with long waits
+	}))
+	defer ts.Close()
+
+	retry := RetryPolicy{Max: 5, Base: time.Second, Factor: 2, MaxDelay: 8 * time.Second}
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithRetryPolicy(retry))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := cli.Send(ctx, core.Snapshot{Items: []core.Item{{Payload: strings.Repeat("x", 2*defaultChunkSize)}}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Send took %v to notice", d)
+	}
+	if n := posts.Load(); n != 1 {
+		t.Fatalf("%d POSTs, want just the first try", n)
+	}
+}
+
+func TestPollRefetchesCorruptChunk(t *testing.T) {
+	body := mustJSON(&core.Snapshot{Origin: "other", Items: []core.Item{{Payload: strings.Repeat("y", 2*defaultChunkSize)}}})
+	chunks := Chunks(body)
+	sums := map[int]string{}
+	for i, c := range chunks {
+		sums[i] = sha256Hex(c)
+	}
+	for _, alwaysBad := range []bool{false, true} {
+		var fetched atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idx := r.Header.Get("X-Chunk-Idx")
+			if idx == "" {
+				_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: len(chunks), Have: []int{0, 1, 2},
+					Sums: sums, SHA256: sha256Hex(body)})
+				return
+			}
+			i, _ := strconv.Atoi(idx)
+			if i == 1 && (fetched.Add(1) == 1 || alwaysBad) {
+				w.Write(chunks[i][:100]) // cut short on the way
+				return
+			}
+			w.Write(chunks[i])
+		}))
+
+		cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		out := make(chan core.Snapshot, 1)
+		cli.Poll(ctx, out)
+		cancel()
+		ts.Close()
+
+		switch {
+		case !alwaysBad && (len(out) != 1 || fetched.Load() != 2):
+			t.Fatalf("corrupt chunk not fetched again: %d delivered, chunk 1 fetched %d times", len(out), fetched.Load())
+		case alwaysBad && (len(out) != 0 || cli.Abandoned() != 1):
+			t.Fatalf("corrupt snapshot: %d delivered, %d abandoned", len(out), cli.Abandoned())
+		}
+	}
+}
+
+func TestAssembleNamesBadChunk(t *testing.T) {
+	body := []byte(`{"origin":"x","items":[]}`)
+	s := state{cid: "c1", total: 2, parts: map[int][]byte{0: body[:10], 1: body[10:]},
+		sums: map[int]string{0: sha256Hex(body[:10]), 1: sha256Hex(body[10:])}, sum: sha256Hex(body)}
+	if _, err := s.assemble(1 << 20); err != nil {
+		t.Fatalf("good chunks: %v", err)
+	}
+	s.parts[1] = body[10:20]
+	_, err := s.assemble(1 << 20)
+	var bad badChunk
+	if !errors.As(err, &bad) || bad != 1 || !errors.Is(err, errChecksum) {
+		t.Fatalf("truncated chunk 1: %v", err)
+	}
+	s.sums = nil
+	if _, err := s.assemble(1 << 20); !errors.Is(err, errChecksum) {
+		t.Fatalf("truncated body without chunk sums: %v", err)
+	}
+}
+
+func TestUploadsStayUnderRateLimit(t *testing.T) {
+	var got atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		got.Add(n)
+	}))
+	defer ts.Close()
+
+	// 640 kbps = 80 KB/s: 16 KiB of burst, then a 200 KiB snapshot
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey, WithMaxUpload(640), WithUploadWorkers(4))
+	h := cli
+	if cs := h.chunkSize(); cs != 80000 {
+		t.Fatalf("chunk size %d, want a second's worth", cs)
+	}
+	h.upRate.take(int(h.upRate.rate), time.Now()) // start from an empty bucket
+	snap := core.Snapshot{Origin: "me", Items: []core.Item{{Payload: strings.Repeat("z", 200*1024)}}}
+	start := time.Now()
+	if err := cli.Send(context.Background(), snap); err != nil {
+		t.Fatal(err)
+	}
+	el := time.Since(start)
+	if want := time.Duration(float64(got.Load()) / 80000 * float64(time.Second)); el < want*9/10 {
+		t.Fatalf("%d bytes up in %v, faster than the limit allows (%v)", got.Load(), el, want)
+	}
+}
@@ -0,0 +1,63 @@
+package net
+
+import "sync"
+
+/*──────── transfer progress (chunked HTTP) ────────────────────*/
+
+// Transfer is a chunked upload or download under way, counted in
+// chunks.
+type Transfer struct {
+	Dir   string `json:"dir"` // "up" or "down"
+	ID    string `json:"id"`  // chunk id
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+// progress tracks one direction; the uploader sends one snapshot at a
+// time and Poll assembles one, so one slot each is enough.
+type progress struct {
+	mu sync.Mutex
+	t  Transfer
+}
+
+func (p *progress) start(dir, id string, total int) {
+	p.mu.Lock()
+	p.t = Transfer{Dir: dir, ID: id, Total: total}
+	p.mu.Unlock()
+}
+
+func (p *progress) set(done int) {
+	p.mu.Lock()
+	p.t.Done = done
+	p.mu.Unlock()
+}
+
+func (p *progress) add() {
+	p.mu.Lock()
+	p.t.Done++
+	p.mu.Unlock()
+}
+
+func (p *progress) clear() {
+	p.mu.Lock()
+	p.t = Transfer{}
+	p.mu.Unlock()
+}
+
+func (p *progress) get() (Transfer, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.t, p.t.ID != ""
+}
+
+// Transfers lists the chunked upload and download under way, if any.
+// Inline snapshots are one request and never show up.
+func (c *httpClient) Transfers() []Transfer {
+	var out []Transfer
+	for _, p := range []*progress{&c.up, &c.down} {
+		if t, ok := p.get(); ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
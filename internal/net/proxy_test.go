@@ -0,0 +1,140 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// socks5 is a no-auth SOCKS5 proxy that sends every CONNECT to target,
+// whatever name it asks for.
+func socks5(t *testing.T, target string) (addr string, conns *atomic.Int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	conns = new(atomic.Int32)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 262)
+				// greeting: VER NMETHODS METHODS…, answer "no auth"
+				if _, err := io.ReadFull(c, buf[:2]); err != nil {
+					return
+				}
+				io.ReadFull(c, buf[:buf[1]])
+				c.Write([]byte{5, 0})
+				// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+				if _, err := io.ReadFull(c, buf[:4]); err != nil {
+					return
+				}
+				switch buf[3] {
+				case 1:
+					io.ReadFull(c, buf[:4+2])
+				case 3:
+					io.ReadFull(c, buf[:1])
+					io.ReadFull(c, buf[:int(buf[0])+2])
+				default:
+					return
+				}
+				up, err := net.Dial("tcp", target)
+				if err != nil {
+					c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer up.Close()
+				reply := []byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}
+				c.Write(reply)
+				go io.Copy(up, c)
+				io.Copy(c, up)
+			}()
+		}
+	}()
+	return ln.Addr().String(), conns
+}
+
+func TestProxyHTTPAndSOCKS(t *testing.T) {
+	clip := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			c, err := websocket.Accept(w, r, nil)
+			if err == nil {
+				c.Close(websocket.StatusNormalClosure, "")
+			}
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer clip.Close()
+	socksAddr, socksConns := socks5(t, clip.Listener.Addr().String())
+
+	// an HTTP proxy for plain http:// gets the request in absolute form
+	var viaHTTP atomic.Int32
+	httpProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		viaHTTP.Add(1)
+		if r.URL.Host != "clipsync.test" {
+			http.Error(w, "wrong target "+r.URL.Host, http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer httpProxy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, p := range []string{httpProxy.URL, "socks5h://" + socksAddr} {
+		u, err := ParseProxy(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the name only resolves on the proxy's side
+		c, err := NewHTTP("http://clipsync.test/clip", "me", "0123456789abcdef", WithProxy(u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.discover(ctx); err != nil {
+			t.Fatalf("discover via %s: %v", p, err)
+		}
+	}
+	if viaHTTP.Load() != 1 || socksConns.Load() != 1 {
+		t.Fatalf("proxied requests: http %d, socks %d", viaHTTP.Load(), socksConns.Load())
+	}
+
+	u, _ := url.Parse("socks5://" + socksAddr)
+	ws, _ := NewWS("ws://clipsync.test/ws", "me", "0123456789abcdef", WithProxy(u))
+	if err := ws.dial(ctx); err != nil {
+		t.Fatalf("WS dial via socks5: %v", err)
+	}
+	ws.close()
+	if socksConns.Load() != 2 {
+		t.Fatalf("WS dial bypassed the proxy")
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	if u, err := ParseProxy("none"); u != nil || err != nil {
+		t.Fatalf("none = %v, %v", u, err)
+	}
+	if u, err := ParseProxy("socks5://user:pw@proxy:1080"); err != nil || u.User.Username() != "user" {
+		t.Fatalf("socks5 = %v, %v", u, err)
+	}
+	for _, bad := range []string{"ftp://proxy", "socks5://", "proxy:8080"} {
+		if _, err := ParseProxy(bad); err == nil {
+			t.Errorf("ParseProxy(%q) accepted", bad)
+		}
+	}
+}
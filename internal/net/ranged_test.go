@@ -0,0 +1,83 @@
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+)
+
+func TestRuns(t *testing.T) {
+	got := map[int][]byte{4: nil}
+	r := runs([]int{7, 0, 1, 2, 4, 5, 9, 8}, got)
+	want := [][2]int{{0, 2}, {5, 5}, {7, 9}}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("runs = %v, want %v", r, want)
+	}
+}
+
+func TestRangedFetch(t *testing.T) {
+	body := mustJSON(&core.Snapshot{Origin: "other", Items: []core.Item{{Payload: strings.Repeat("r", 20*defaultChunkSize)}}})
+	chunks := Chunks(body)
+
+	var (
+		mu     sync.Mutex
+		ranged int
+		single int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Header.Get("X-Chunk-Range") != "":
+			ranged++
+			var lo, hi int
+			fmt.Sscanf(r.Header.Get("X-Chunk-Range"), "%d-%d", &lo, &hi)
+			w.Header().Set("X-Chunk-Range", r.Header.Get("X-Chunk-Range"))
+			for i := lo; i <= hi; i++ {
+				var hdr [8]byte
+				binary.BigEndian.PutUint32(hdr[:4], uint32(i))
+				binary.BigEndian.PutUint32(hdr[4:], uint32(len(chunks[i])))
+				w.Write(hdr[:])
+				w.Write(chunks[i])
+			}
+		case r.Header.Get("X-Chunk-Idx") != "":
+			single++
+		default:
+			have := make([]int, len(chunks))
+			for i := range have {
+				have[i] = i
+			}
+			_ = json.NewEncoder(w).Encode(discoverResp{Cid: "c1", Total: len(chunks), Have: have})
+		}
+	}))
+	defer ts.Close()
+
+	cli, _ := NewHTTP(ts.URL, "deadbeef", hexKey)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	out := make(chan core.Snapshot, 1)
+	go cli.Poll(ctx, out)
+	select {
+	case got := <-out:
+		if got.Origin != "other" {
+			t.Fatalf("unexpected snapshot %+v", got)
+		}
+	case <-ctx.Done():
+		t.Fatalf("ranged download not delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if ranged != 1 || single != 0 {
+		t.Fatalf("%d ranged + %d single GETs for %d chunks, want 1 + 0", ranged, single, len(chunks))
+	}
+}
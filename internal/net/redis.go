@@ -0,0 +1,360 @@
+// redis.go — Redis pub/sub transport implementing the Client interface.
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// redisClient publishes every snapshot on channel clipsync:<room> and
+// keeps the last clip under clipsync:<room>:last, so a device that
+// (re)subscribes catches up on what it missed.  Push delivery, no
+// relay server: any Redis the group can reach will do.
+type redisClient struct {
+	addr    string
+	tls     *tls.Config // rediss://
+	user    string
+	pass    string
+	db      int
+	channel string
+	last    string
+	timeout time.Duration
+	*shared
+
+	mu  sync.Mutex // guards cmd
+	cmd *respConn  // SET / PUBLISH / GET; the subscriber has its own
+}
+
+// redisLastTTL is how long the catch-up copy outlives its last update.
+const redisLastTTL = 24 * time.Hour
+
+var _ Client = (*redisClient)(nil)
+
+// NewRedis builds a Redis client for redis://[user:pass@]host[:port][/db]
+// (rediss:// for TLS).  The Redis password is the access control, so
+// there is no key.
+func NewRedis(rawURL, id string, opts ...Option) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, errors.New("redis: want redis://[user:pass@]host[:port][/db]")
+	}
+	cfg := newConfig(opts)
+	sh := &shared{id: id}
+	sh.apply(cfg)
+	if cfg.timeout == 0 {
+		cfg.timeout = 10 * time.Second
+	}
+	c := &redisClient{addr: u.Host, timeout: cfg.timeout, shared: sh}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+		if cfg.tls != nil {
+			c.tls = cfg.tls.Clone()
+		}
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.pass, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis: bad db %q", db)
+		}
+	}
+	room := cfg.room
+	if room == "" {
+		room = "_"
+	}
+	c.channel = "clipsync:" + room
+	c.last = c.channel + ":last"
+	return c, nil
+}
+
+/*──────── Send (SET last + PUBLISH) ───────────────────────────*/
+func (c *redisClient) Send(ctx context.Context, snap core.Snapshot) error {
+	snap.Quick = core.QuickKey(snap.Items)
+	snap.Room = c.room
+	snap.Items = core.Pack(snap.Items) // repeated formats go once
+
+	body := mustJSON(&snap)
+	if len(body) > c.bodyCap() {
+		return ErrTooLarge
+	}
+	body = c.squeeze(body)
+	if err := c.pace(ctx, len(body)); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := time.Now()
+	fresh := c.cmd == nil
+	if fresh {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return err
+		}
+		c.cmd = conn
+	}
+	conn := c.cmd.conn
+	defer context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })()
+	cmds := [][]string{{"PUBLISH", c.channel, string(body)}}
+	if snap.Kind == "" { // acks / caps are not worth catching up on
+		ttl := strconv.Itoa(int(redisLastTTL / time.Second))
+		cmds = append([][]string{{"SET", c.last, string(body), "EX", ttl}}, cmds...)
+	}
+	_ = c.cmd.conn.SetDeadline(time.Now().Add(c.timeout))
+	for _, cmd := range cmds {
+		if _, err := c.cmd.do(cmd...); err != nil {
+			c.cmd.conn.Close()
+			c.cmd = nil
+			return err
+		}
+	}
+	c.record(0, time.Since(start), fresh)
+	return nil
+}
+
+/*──────── Poll (SUBSCRIBE, then catch up) ─────────────────────*/
+// Redial drops the publishing connection as well.
+func (c *redisClient) Redial() {
+	c.mu.Lock()
+	if c.cmd != nil {
+		c.cmd.conn.Close()
+		c.cmd = nil
+	}
+	c.mu.Unlock()
+	c.shared.Redial()
+}
+
+func (c *redisClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
+	backoff := 500 * time.Millisecond
+	var lastKey string
+	deliver := func(data []byte) {
+		if snap, ok := c.pushed(data, &lastKey); ok {
+			out <- snap
+		}
+	}
+
+	for ctx.Err() == nil {
+		start := time.Now()
+		if sub, err := c.dial(ctx); err == nil {
+			lctx, cancel := c.untilRedial(ctx)
+			_ = c.listen(lctx, sub, deliver)
+			sub.conn.Close()
+			redial := ctx.Err() == nil && lctx.Err() != nil
+			cancel()
+			if redial {
+				continue // network changed: dial again now
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute { // was up a while: start over
+			backoff = 500 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.kick():
+		case <-time.After(backoff):
+			backoff = minDuration(backoff*2, 8*time.Second)
+		}
+	}
+}
+
+// listen subscribes on sub, delivers the catch-up copy, then every
+// published message until the connection drops.
+func (c *redisClient) listen(ctx context.Context, sub *respConn, deliver func([]byte)) error {
+	stop := context.AfterFunc(ctx, func() { sub.conn.Close() })
+	defer stop()
+
+	_ = sub.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := sub.do("SUBSCRIBE", c.channel); err != nil {
+		return err
+	}
+	// subscribed first, so nothing falls between GET and the first message
+	if last, err := c.getLast(ctx); err == nil && last != nil {
+		deliver(last)
+	}
+	_ = sub.conn.SetDeadline(time.Time{})
+
+	for {
+		v, err := sub.read()
+		if err != nil {
+			return err
+		}
+		m, ok := v.([]any)
+		if !ok || len(m) != 3 || m[0] != "message" {
+			continue // subscribe confirmations, pongs
+		}
+		if data, ok := m[2].([]byte); ok {
+			deliver(data)
+		}
+	}
+}
+
+func (c *redisClient) getLast(ctx context.Context) ([]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.conn.Close()
+	_ = conn.conn.SetDeadline(time.Now().Add(c.timeout))
+	v, err := conn.do("GET", c.last)
+	b, _ := v.([]byte)
+	return b, err
+}
+
+// pushed decodes a message from a pub/sub transport (Redis, NATS).
+// lastKey is the AckKey of the last clip delivered: the catch-up copy
+// fetched on every (re)connect is often that same clip.
+func (s *shared) pushed(data []byte, lastKey *string) (core.Snapshot, bool) {
+	var snap core.Snapshot
+	if len(data) > s.bodyCap() {
+		return snap, false
+	}
+	data, err := gunzipBody(data, s.bodyCap())
+	if err != nil || json.Unmarshal(data, &snap) != nil || snap.Origin == s.id || snap.Room != s.room {
+		return snap, false
+	}
+	if snap.Kind == "" {
+		k := core.AckKey(snap)
+		if k == *lastKey {
+			return snap, false
+		}
+		*lastKey = k
+	}
+	return snap, core.Unpack(snap.Items) == nil
+}
+
+// dial connects, authenticates and selects the database.
+func (c *redisClient) dial(ctx context.Context) (*respConn, error) {
+	d := &net.Dialer{Timeout: c.timeout, KeepAlive: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &respConn{conn: conn, r: bufio.NewReader(conn), max: c.bodyCap() + 1<<10}
+	_ = conn.SetDeadline(time.Now().Add(c.timeout))
+	var setup [][]string
+	switch {
+	case c.user != "":
+		setup = append(setup, []string{"AUTH", c.user, c.pass})
+	case c.pass != "":
+		setup = append(setup, []string{"AUTH", c.pass})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, cmd := range setup {
+		if _, err := rc.do(cmd...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+/*──────── RESP, just what we use ──────────────────────────────*/
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	max  int // largest bulk string accepted
+}
+
+// redisError is an error reply ("-ERR …"); the connection is still fine.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do sends one command and reads its reply.
+func (rc *respConn) do(args ...string) (any, error) {
+	w := bufio.NewWriter(rc.conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	v, err := rc.read()
+	if err == nil {
+		if e, ok := v.(redisError); ok {
+			return nil, e
+		}
+	}
+	return v, err
+}
+
+// read parses one reply: string, redisError, int64, []byte (nil for a
+// null bulk) or []any.
+func (rc *respConn) read() (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return []byte(nil), err
+		}
+		if n > rc.max {
+			return nil, fmt.Errorf("redis: %d-byte reply over the body cap", n)
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		arr := make([]any, n)
+		for i := range arr {
+			if arr[i], err = rc.read(); err != nil {
+				return nil, err
+			}
+			if b, ok := arr[i].([]byte); ok && i == 0 {
+				arr[i] = string(b) // message kind
+			}
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("redis: bad reply %q", line)
+}
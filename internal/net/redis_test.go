@@ -0,0 +1,219 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/store"
+)
+
+// fakeRedis speaks enough RESP for the transport: AUTH, SET, GET,
+// PUBLISH and SUBSCRIBE; and HSET, HGET, HKEYS and HDEL for storage.
+type fakeRedis struct {
+	mu     sync.Mutex
+	kv     map[string]string
+	hashes map[string]map[string]string
+	subs   map[string][]net.Conn
+}
+
+func startFakeRedis(t *testing.T) (string, *fakeRedis) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{kv: map[string]string{}, hashes: map[string]map[string]string{}, subs: map[string][]net.Conn{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return ln.Addr().String(), f
+}
+
+// subscribed counts SUBSCRIBEs to channel so far.
+func (f *fakeRedis) subscribed(channel string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs[channel])
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rc := &respConn{conn: conn, r: bufio.NewReader(conn), max: 64 << 20}
+	for {
+		v, err := rc.read()
+		if err != nil {
+			return
+		}
+		arr, _ := v.([]any)
+		args := make([]string, len(arr))
+		for i, a := range arr {
+			switch a := a.(type) {
+			case string:
+				args[i] = a
+			case []byte:
+				args[i] = string(a)
+			}
+		}
+		f.mu.Lock()
+		switch args[0] {
+		case "AUTH":
+			if args[len(args)-1] == "pw" {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case "SET":
+			f.kv[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		case "GET":
+			if v, ok := f.kv[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "PUBLISH":
+			for _, s := range f.subs[args[1]] {
+				fmt.Fprintf(s, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+					len(args[1]), args[1], len(args[2]), args[2])
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(f.subs[args[1]]))
+		case "HSET":
+			if f.hashes[args[1]] == nil {
+				f.hashes[args[1]] = map[string]string{}
+			}
+			f.hashes[args[1]][args[2]] = args[3]
+			fmt.Fprint(conn, ":1\r\n")
+		case "HGET":
+			if v, ok := f.hashes[args[1]][args[2]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "HKEYS":
+			fmt.Fprintf(conn, "*%d\r\n", len(f.hashes[args[1]]))
+			for k := range f.hashes[args[1]] {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(k), k)
+			}
+		case "HDEL":
+			delete(f.hashes[args[1]], args[2])
+			fmt.Fprint(conn, ":1\r\n")
+		case "SUBSCRIBE":
+			f.subs[args[1]] = append(f.subs[args[1]], conn)
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		}
+		f.mu.Unlock()
+	}
+}
+
+func TestRedisPubSubAndCatchUp(t *testing.T) {
+	addr, _ := startFakeRedis(t)
+	url := "redis://:pw@" + addr
+	a, err := NewRedis(url, "aaaa", WithRoom("r"), WithCompression(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad, _ := NewRedis("redis://:nope@"+addr, "x"); bad.Send(context.Background(), core.Snapshot{}) == nil {
+		t.Fatal("wrong password accepted")
+	}
+
+	item := core.Item{MimeType: "text/plain", Payload: "aGk=", ByteLen: 2}
+	if err := a.Send(context.Background(), core.Snapshot{Origin: "aaaa", TS: 1, Items: []core.Item{item}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// b joins late: it gets the last clip, then live ones
+	b, _ := NewRedis(url, "bbbb", WithRoom("r"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan core.Snapshot, 4)
+	go b.Poll(ctx, out)
+
+	recv := func() core.Snapshot {
+		select {
+		case s := <-out:
+			return s
+		case <-time.After(2 * time.Second):
+			t.Fatal("nothing arrived")
+		}
+		return core.Snapshot{}
+	}
+	if s := recv(); s.TS != 1 || s.Items[0].Payload != "aGk=" {
+		t.Fatalf("catch-up got %+v", s)
+	}
+	time.Sleep(50 * time.Millisecond) // subscribed by now
+	if err := a.Send(context.Background(), core.Snapshot{Origin: "aaaa", TS: 2, Items: []core.Item{item}}); err != nil {
+		t.Fatal(err)
+	}
+	if s := recv(); s.TS != 2 {
+		t.Fatalf("live got %+v", s)
+	}
+}
+
+func TestRedisRedialsAtOnce(t *testing.T) {
+	addr, f := startFakeRedis(t)
+	c, _ := NewRedis("redis://:pw@"+addr, "aaaa")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Poll(ctx, make(chan core.Snapshot, 4))
+
+	subscribed := func(n int) bool {
+		for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+			if f.subscribed(c.channel) >= n {
+				return true
+			}
+		}
+		return false
+	}
+	if !subscribed(1) {
+		t.Fatal("never subscribed")
+	}
+	start := time.Now()
+	c.Redial()
+	if !subscribed(2) || time.Since(start) > 400*time.Millisecond {
+		t.Fatalf("no fresh subscription right after Redial (%v)", time.Since(start))
+	}
+}
+
+func TestRedisStorage(t *testing.T) {
+	addr, f := startFakeRedis(t)
+	st, err := NewRedisStorage("redis://:pw@"+addr, "clipsyncd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Get("rooms", "a"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get missing: %v", err)
+	}
+	st.Put("rooms", "b", []byte("2"))
+	st.Put("rooms", "a", []byte("bin\x00\r\nary"))
+	st.Put("parts", "a", []byte("other"))
+	if keys, _ := st.List("rooms"); !slices.Equal(keys, []string{"a", "b"}) {
+		t.Fatalf("List = %q", keys)
+	}
+	if b, err := st.Get("rooms", "a"); err != nil || string(b) != "bin\x00\r\nary" {
+		t.Fatalf("Get = %q, %v", b, err)
+	}
+	if f.hashes["clipsyncd:parts"]["a"] != "other" {
+		t.Fatalf("hashes %v", f.hashes)
+	}
+	st.Delete("rooms", "a")
+	if keys, _ := st.List("rooms"); !slices.Equal(keys, []string{"b"}) {
+		t.Fatalf("List after Delete = %q", keys)
+	}
+	if keys, err := st.List("none"); err != nil || len(keys) != 0 {
+		t.Fatalf("empty List = %q, %v", keys, err)
+	}
+}
@@ -0,0 +1,108 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"clipsync/internal/store"
+)
+
+/*──────── Redis as a store.Storage ────────────────────────────*/
+// A self-hosted relay that keeps its state in the Redis the group
+// already runs: one hash per namespace, <prefix>:<ns>, field per key.
+// It rides on the transport's dialer (URL, AUTH, SELECT, TLS).
+
+type redisStorage struct {
+	c      *redisClient
+	prefix string
+
+	mu   sync.Mutex
+	conn *respConn
+}
+
+var _ store.Storage = (*redisStorage)(nil)
+
+// NewRedisStorage keeps values in the Redis at rawURL, as for the
+// transport (redis:// or rediss://), under hashes named prefix:<ns>.
+func NewRedisStorage(rawURL, prefix string, opts ...Option) (store.Storage, error) {
+	c, err := NewRedis(rawURL, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &redisStorage{c: c, prefix: prefix}, nil
+}
+
+// do runs one command, dialling first if need be, and once more on a
+// fresh connection if the old one broke.
+func (r *redisStorage) do(args ...string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for try := 0; ; try++ {
+		if r.conn == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), r.c.timeout)
+			conn, err := r.c.dial(ctx)
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+			r.conn = conn
+		}
+		_ = r.conn.conn.SetDeadline(time.Now().Add(r.c.timeout))
+		v, err := r.conn.do(args...)
+		var rerr redisError
+		if err == nil || errors.As(err, &rerr) || try > 0 {
+			return v, err
+		}
+		r.conn.conn.Close()
+		r.conn = nil
+	}
+}
+
+func (r *redisStorage) hash(ns string) string { return r.prefix + ":" + ns }
+
+func (r *redisStorage) Put(ns, key string, val []byte) error {
+	if key == "" {
+		return errors.New("store: empty key")
+	}
+	_, err := r.do("HSET", r.hash(ns), key, string(val))
+	return err
+}
+
+func (r *redisStorage) Get(ns, key string) ([]byte, error) {
+	v, err := r.do("HGET", r.hash(ns), key)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := v.([]byte)
+	if b == nil {
+		return nil, store.ErrNotFound
+	}
+	return b, nil
+}
+
+func (r *redisStorage) List(ns string) ([]string, error) {
+	v, err := r.do("HKEYS", r.hash(ns))
+	if err != nil {
+		return nil, err
+	}
+	arr, _ := v.([]any)
+	keys := make([]string, 0, len(arr))
+	for _, k := range arr {
+		switch k := k.(type) {
+		case string: // read() turns an array's first bulk into one
+			keys = append(keys, k)
+		case []byte:
+			keys = append(keys, string(k))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (r *redisStorage) Delete(ns, key string) error {
+	_, err := r.do("HDEL", r.hash(ns), key)
+	return err
+}
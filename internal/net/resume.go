@@ -0,0 +1,100 @@
+package net
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"clipsync/internal/store"
+)
+
+/*──────── resumable downloads ────────────────────────────────*/
+// partStore mirrors the in-progress download in a store.Storage, so a
+// restarted client resumes a large snapshot instead of fetching it from
+// chunk 0 (the server keeps a cid for SNAP_TTL).  A nil st disables
+// it.  Keys are meta.json and <idx>.part, in namespace ns.
+type partStore struct {
+	st store.Storage
+	ns string
+}
+
+// PartsNamespace is where WithResumeStore keeps partial downloads.
+const PartsNamespace = "parts"
+
+const metaKey = "meta.json"
+
+type partMeta struct {
+	Cid   string `json:"cid"`
+	Total int    `json:"total"`
+}
+
+// modified is when key was written, or now if the backend can't say.
+func (p partStore) modified(key string) time.Time {
+	if t, ok := p.st.(store.Timed); ok {
+		if at, err := t.Modified(p.ns, key); err == nil {
+			return at
+		}
+	}
+	return time.Now()
+}
+
+// load returns the saved download, or an empty state.
+func (p partStore) load() state {
+	if p.st == nil {
+		return state{}
+	}
+	b, err := p.st.Get(p.ns, metaKey)
+	if err != nil {
+		return state{}
+	}
+	var m partMeta
+	if json.Unmarshal(b, &m) != nil || m.Cid == "" {
+		return state{}
+	}
+	s := state{cid: m.Cid, total: m.Total, parts: make(map[int][]byte), touched: p.modified(metaKey)}
+	keys, _ := p.st.List(p.ns)
+	for _, k := range keys {
+		idx, err := strconv.Atoi(strings.TrimSuffix(k, ".part"))
+		if err != nil || !strings.HasSuffix(k, ".part") {
+			continue
+		}
+		if data, err := p.st.Get(p.ns, k); err == nil {
+			s.parts[idx] = data
+		}
+		if at := p.modified(k); at.After(s.touched) {
+			s.touched = at // so a long-dead download ages out at once
+		}
+	}
+	return s
+}
+
+// begin starts persisting a new download, dropping the previous one.
+func (p partStore) begin(s state) {
+	if p.st == nil {
+		return
+	}
+	p.clear()
+	b, _ := json.Marshal(partMeta{Cid: s.cid, Total: s.total})
+	_ = p.st.Put(p.ns, metaKey, b)
+}
+
+func (p partStore) put(idx int, data []byte) {
+	if p.st == nil {
+		return
+	}
+	_ = p.st.Put(p.ns, strconv.Itoa(idx)+".part", data)
+}
+
+func (p partStore) clear() {
+	if p.st == nil {
+		return
+	}
+	keys, _ := p.st.List(p.ns)
+	for _, k := range keys {
+		if strings.HasSuffix(k, ".part") {
+			p.st.Delete(p.ns, k)
+		}
+	}
+	p.st.Delete(p.ns, metaKey)
+}
@@ -0,0 +1,365 @@
+// s3.go — object-storage transport implementing the Client interface.
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// s3Client syncs through a bucket on any S3-compatible store, no relay
+// needed.  Every snapshot is one object
+//
+//	<prefix>/<room or _>/<unix nanos, 20 digits>-<device id>.json
+//
+// so a listing is in send order; Poll lists what came after the last
+// key it saw.  Each device deletes its own objects once they are a few
+// minutes old (a lifecycle rule is a good backstop for crashed ones).
+type s3Client struct {
+	endpoint string // scheme://host, path-style requests
+	bucket   string
+	prefix   string // "<prefix>/<room>/"
+	region   string
+	creds    s3Creds
+	client   *http.Client
+	every    time.Duration
+	*shared
+
+	mu   sync.Mutex
+	mine []s3Put // own objects, oldest first
+}
+
+type s3Creds struct{ id, secret, token string }
+
+type s3Put struct {
+	key string
+	at  time.Time
+}
+
+// s3Keep is how long our own objects stay for slow pollers.
+const s3Keep = 5 * time.Minute
+
+var _ Client = (*s3Client)(nil)
+
+// NewS3 builds an object-storage client for s3://bucket[/prefix].
+// Credentials and region come from the usual AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION; set
+// AWS_ENDPOINT_URL (or ?endpoint= on the URL) for MinIO, R2 and the
+// like.  The bucket's own credentials guard it, so there is no key.
+func NewS3(rawURL, id string, opts ...Option) (*s3Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, errors.New("s3: want s3://bucket[/prefix]")
+	}
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := u.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	creds := s3Creds{os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}
+	if creds.id == "" || creds.secret == "" {
+		return nil, errors.New("s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	cfg := newConfig(opts)
+	sh := &shared{id: id}
+	sh.apply(cfg)
+	if cfg.timeout == 0 {
+		cfg.timeout = 15 * time.Second
+	}
+	if cfg.every <= 0 {
+		cfg.every = 2 * time.Second
+	}
+	room := cfg.room
+	if room == "" {
+		room = "_"
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		bucket:   u.Host,
+		prefix:   prefix + url.PathEscape(room) + "/",
+		region:   region,
+		creds:    creds,
+		client:   &http.Client{Timeout: cfg.timeout, Transport: warmTransport(cfg)},
+		every:    cfg.every,
+		shared:   sh,
+	}, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+/*──────── Send (one PUT per snapshot) ─────────────────────────*/
+func (c *s3Client) Send(ctx context.Context, snap core.Snapshot) error {
+	snap.Quick = core.QuickKey(snap.Items)
+	snap.Room = c.room
+	snap.Items = core.Pack(snap.Items) // repeated formats go once
+
+	body := mustJSON(&snap)
+	if len(body) > c.bodyCap() {
+		return ErrTooLarge
+	}
+	body = c.squeeze(body)
+	if err := c.pace(ctx, len(body)); err != nil {
+		return err
+	}
+
+	now := Now()
+	key := fmt.Sprintf("%s%020d-%s.json", c.prefix, now.UnixNano(), c.id)
+	resp, err := c.do(ctx, "PUT", key, nil, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	c.mu.Lock()
+	c.mine = append(c.mine, s3Put{key, time.Now()})
+	var old []string
+	for len(c.mine) > 0 && time.Since(c.mine[0].at) > s3Keep {
+		old = append(old, c.mine[0].key)
+		c.mine = c.mine[1:]
+	}
+	c.mu.Unlock()
+	for _, k := range old {
+		if resp, err := c.do(context.Background(), "DELETE", k, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+/*──────── Poll (list after the last key seen) ─────────────────*/
+func (c *s3Client) Poll(ctx context.Context, out chan<- core.Snapshot) {
+	// start at "now": what was sent before we came up is history
+	after := fmt.Sprintf("%s%020d", c.prefix, Now().UnixNano())
+	for {
+		keys, err := c.list(ctx, after)
+		for _, k := range keys {
+			after = k
+			if strings.HasSuffix(k, "-"+c.id+".json") {
+				continue // our own
+			}
+			snap, err := c.get(ctx, k)
+			if err != nil { // deleted already, or not ours to read
+				continue
+			}
+			if snap.Origin != c.id && snap.Room == c.room && core.Unpack(snap.Items) == nil {
+				out <- snap
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			time.Sleep(c.every) // transient; don't hammer the store
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.kick(): // network changed: fresh connections, list now
+			c.client.CloseIdleConnections()
+		case <-time.After(c.pause(c.every)):
+		}
+	}
+}
+
+// list returns keys under the room prefix that sort after after.
+func (c *s3Client) list(ctx context.Context, after string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {c.prefix}, "start-after": {after}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, "GET", "", q, nil)
+		if err != nil {
+			return keys, err
+		}
+		var res struct {
+			Contents  []struct{ Key string }
+			Truncated bool   `xml:"IsTruncated"`
+			Next      string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return keys, err
+		}
+		for _, o := range res.Contents {
+			keys = append(keys, o.Key)
+		}
+		if !res.Truncated || res.Next == "" {
+			return keys, nil
+		}
+		token = res.Next
+	}
+}
+
+func (c *s3Client) get(ctx context.Context, key string) (core.Snapshot, error) {
+	var snap core.Snapshot
+	resp, err := c.do(ctx, "GET", key, nil, nil)
+	if err != nil {
+		return snap, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(c.bodyCap())+1))
+	if err != nil {
+		return snap, err
+	}
+	if data, err = gunzipBody(data, c.bodyCap()); err != nil {
+		return snap, err
+	}
+	return snap, json.Unmarshal(data, &snap)
+}
+
+// do sends a signed request for key ("" = the bucket); any non-2xx
+// answer is an error.
+func (c *s3Client) do(ctx context.Context, method, key string, q url.Values, body []byte) (*http.Response, error) {
+	u := c.endpoint + "/" + s3Escape(c.bucket)
+	if key != "" {
+		u += "/" + s3Escape(key)
+	}
+	if len(q) > 0 {
+		u += "?" + s3Query(q)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.headers {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	signV4(req, body, c.creds, c.region, time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: status %d: %s", method, key, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+/*──────── AWS Signature V4 ────────────────────────────────────*/
+
+// signV4 signs req (host and every header already set) for service s3.
+func signV4(req *http.Request, body []byte, cr s3Creds, region string, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	stamp := now.UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if cr.token != "" {
+		req.Header.Set("X-Amz-Security-Token", cr.token)
+	}
+
+	hdrs := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		hdrs[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(hdrs))
+	for k := range hdrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHdrs strings.Builder
+	for _, k := range names {
+		canonHdrs.WriteString(k + ":" + hdrs[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canon := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3Query(req.URL.Query()),
+		canonHdrs.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	csum := sha256.Sum256([]byte(canon))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(csum[:])
+
+	k := hmacSHA256([]byte("AWS4"+cr.secret), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		k = hmacSHA256(k, part)
+	}
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cr.id+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+// s3Escape is SigV4's URI encoding, keeping '/' between key segments.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// s3Query is the canonical query string: sorted, fully escaped.
+func s3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, strings.ReplaceAll(s3Escape(k), "/", "%2F")+"="+
+				strings.ReplaceAll(s3Escape(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,84 @@
+package net
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*──────── upload rate limit ──────────────────────────────────*/
+// A bucket holds up to one second of upload budget.  Every request
+// body takes its size out before it goes, running the bucket into debt
+// if it must, and waits until the debt is paid; parallel chunk workers
+// share one bucket, so together they stay under the rate.  Pacing whole
+// bodies keeps request timeouts meaningful; chunkSize keeps each one
+// at most a second's worth, so the link sees short bursts, not a flood.
+
+// minPacedChunk is the smallest chunk a low rate limit shrinks to.
+const minPacedChunk = 16 * 1024
+
+type bucket struct {
+	rate float64 // bytes per second
+
+	mu     sync.Mutex
+	tokens float64
+	at     time.Time
+}
+
+// newBucket limits uploads to kbps kilobits per second; nil (no limit)
+// for kbps <= 0.
+func newBucket(kbps int) *bucket {
+	if kbps <= 0 {
+		return nil
+	}
+	rate := float64(kbps) * 1000 / 8
+	return &bucket{rate: rate, tokens: rate, at: time.Now()}
+}
+
+// take removes n bytes and returns how long to wait before sending.
+func (b *bucket) take(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.at).Seconds()*b.rate)
+	b.at = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// give returns n bytes a cancelled request didn't send.
+func (b *bucket) give(n int) {
+	b.mu.Lock()
+	b.tokens += float64(n)
+	b.mu.Unlock()
+}
+
+// pace waits until n more bytes may go up, or ctx ends.
+func (s *shared) pace(ctx context.Context, n int) error {
+	if s.upRate == nil {
+		return nil
+	}
+	d := s.upRate.take(n, time.Now())
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		s.upRate.give(n)
+		return ctx.Err()
+	}
+}
+
+// paced caps a chunk size at a second of upload budget.
+func (s *shared) paced(size int) int {
+	if s.upRate == nil {
+		return size
+	}
+	return min(size, max(int(s.upRate.rate), minPacedChunk))
+}
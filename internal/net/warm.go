@@ -0,0 +1,168 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+/*──────── connection warmth ──────────────────────────────────*/
+
+// warmTransport keeps idle connections around long enough to matter and
+// caches TLS sessions so a re-dial resumes instead of a full handshake.
+// cfg.tls (may be nil) is cloned as the base TLS config; requests go
+// through cfg.proxy, else the HTTP_PROXY / HTTPS_PROXY / NO_PROXY ones.
+func warmTransport(cfg config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.IdleConnTimeout = 5 * time.Minute
+	t.MaxIdleConnsPerHost = 8 // parallel chunk uploads
+	if cfg.proxy != nil {
+		t.Proxy = cfg.proxy
+	}
+	if tc := cfg.tls; tc != nil {
+		t.TLSClientConfig = tc.Clone()
+	} else {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if t.TLSClientConfig.ClientSessionCache == nil {
+		t.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(8)
+	}
+	return t
+}
+
+// warmEvery is below the usual 60–75 s server keep-alive timeouts.
+const warmEvery = 30 * time.Second
+
+// keepWarm sends a discover over the upload pool every warmEvery, so it
+// always holds a live connection; the first copy after idle then skips
+// setup.  It is the same authenticated request Poll makes: a bare
+// GET / would be refused by servers that authenticate everything.
+func (c *httpClient) keepWarm(ctx context.Context) {
+	t := time.NewTicker(warmEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			req, _ := http.NewRequestWithContext(ctx, c.get, c.url, nil)
+			c.authHeaders(req.Header)
+			if resp, err := c.client.Do(req); err == nil {
+				io.Copy(io.Discard, resp.Body) // so the connection goes back to the pool
+				resp.Body.Close()
+			}
+		}
+	}
+}
+
+/*──────── HTTP/3 ─────────────────────────────────────────────*/
+
+// quicTransport speaks HTTP/3 to the server's UDP port.  The TLS
+// session cache keeps the server's tickets, so a re-dial (after a
+// network change, or the server's idle timeout) sends its first
+// request as 0-RTT early data instead of waiting for a handshake;
+// keep-alive PINGs make re-dials rare to begin with.  Dials are
+// metered here, as httptrace sees nothing of them.
+func quicTransport(cfg config, m *connMeter) *http3.Transport {
+	tc := &tls.Config{}
+	if cfg.tls != nil {
+		tc = cfg.tls.Clone()
+	}
+	if tc.ClientSessionCache == nil {
+		tc.ClientSessionCache = tls.NewLRUClientSessionCache(8)
+	}
+	return &http3.Transport{
+		TLSClientConfig: tc,
+		QUICConfig:      &quic.Config{KeepAlivePeriod: warmEvery / 2},
+		Dial: func(ctx context.Context, addr string, tc *tls.Config, qc *quic.Config) (quic.EarlyConnection, error) {
+			start := time.Now()
+			conn, err := quic.DialAddrEarly(ctx, addr, tc, qc)
+			if err == nil {
+				m.dialed(time.Since(start))
+			}
+			return conn, err
+		},
+	}
+}
+
+/*──────── connection-setup statistics ───────────────────────*/
+
+// ConnStats says how much of send latency went into connection setup
+// (DNS + TCP + TLS, or the QUIC dial).  WS connections are dialed ahead
+// of any send, so they add to NewConns only.
+type ConnStats struct {
+	Requests int
+	NewConns int
+	Setup    time.Duration
+	Total    time.Duration
+}
+
+func (s ConnStats) String() string {
+	share := 0.0
+	if s.Total > 0 {
+		share = 100 * float64(s.Setup) / float64(s.Total)
+	}
+	return fmt.Sprintf("requests=%d new-conns=%d setup=%v of %v (%.0f%%)",
+		s.Requests, s.NewConns, s.Setup.Round(time.Millisecond),
+		s.Total.Round(time.Millisecond), share)
+}
+
+type connMeter struct {
+	mu sync.Mutex
+	st ConnStats
+}
+
+// dialed counts a connection set up outside any traced request: a QUIC
+// dial, whose time the request that waited for it already has in its
+// total, or a WS dial, which Poll makes and no send waits for (setup 0).
+func (m *connMeter) dialed(setup time.Duration) {
+	m.mu.Lock()
+	m.st.NewConns++
+	m.st.Setup += setup
+	m.mu.Unlock()
+}
+
+func (m *connMeter) record(setup, total time.Duration, fresh bool) {
+	m.mu.Lock()
+	m.st.Requests++
+	if fresh {
+		m.st.NewConns++
+	}
+	m.st.Setup += setup
+	m.st.Total += total
+	m.mu.Unlock()
+}
+
+// ConnStats returns the totals so far.
+func (m *connMeter) ConnStats() ConnStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.st
+}
+
+// trace instruments req; call done() after Do returns.
+func (m *connMeter) trace(req *http.Request) (_ *http.Request, done func()) {
+	start := time.Now()
+	var getAt time.Time
+	var setup time.Duration
+	fresh := false
+	t := &httptrace.ClientTrace{
+		GetConn: func(string) { getAt = time.Now() },
+		GotConn: func(i httptrace.GotConnInfo) {
+			if !i.Reused {
+				fresh = true
+				setup = time.Since(getAt)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t))
+	return req, func() { m.record(setup, time.Since(start), fresh) }
+}
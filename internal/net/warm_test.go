@@ -0,0 +1,76 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	core "clipsync/internal"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+type quicConnKey struct{}
+
+// TestQUICResumesWith0RTT: after a re-dial the discover goes out as
+// early data on a resumed session.
+func TestQUICResumesWith0RTT(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler()) // for its certificate
+	defer ts.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	early := make(chan bool, 4)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 3 || r.Header.Get("X-Auth-Token") == "" {
+			t.Errorf("%s request, auth %q", r.Proto, r.Header.Get("X-Auth-Token"))
+		}
+		conn := r.Context().Value(quicConnKey{}).(quic.EarlyConnection)
+		<-conn.HandshakeComplete()
+		early <- conn.ConnectionState().Used0RTT
+		_ = json.NewEncoder(w).Encode(discoverResp{})
+	})
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	srv := &http3.Server{
+		Handler:    h,
+		TLSConfig:  http3.ConfigureTLSConfig(&tls.Config{Certificates: ts.TLS.Certificates}),
+		QUICConfig: &quic.Config{Allow0RTT: true},
+		ConnContext: func(ctx context.Context, c quic.Connection) context.Context {
+			return context.WithValue(ctx, quicConnKey{}, c)
+		},
+	}
+	go srv.Serve(udp)
+	defer srv.Close()
+
+	url := "https://" + udp.LocalAddr().String() + "/clip"
+	cli, _ := NewHTTP(url, "deadbeef", hexKey, WithQUIC(true), WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if _, err := cli.discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if <-early {
+		t.Fatal("first connection used 0-RTT without a ticket")
+	}
+	cli.Redial()
+	if _, err := cli.discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !<-early {
+		t.Fatal("re-dial didn't use 0-RTT")
+	}
+	if err := cli.Send(context.Background(), core.Snapshot{Origin: "me"}); err != nil {
+		t.Fatal(err)
+	}
+	<-early
+	if st := cli.ConnStats(); st.NewConns != 2 || st.Requests != 1 {
+		t.Fatalf("want 2 dials and 1 traced send, got %+v", st)
+	}
+}
@@ -3,10 +3,16 @@
 package net
 
 import (
+    "bytes"
     "context"
     "encoding/json"
     "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
     "sync"
+    "sync/atomic"
     "time"
 
     core "clipsync/internal"
@@ -19,105 +25,355 @@ type wsClient struct {
     url string
     *shared
     conn *websocket.Conn
-    mu   sync.Mutex // serialises all writes (Ping + Send)
+    mu   sync.Mutex // serialises Send's seal + write
+
+    transport *http.Transport // TLS session cache survives re-dials
+    timeout   time.Duration   // dial and per-write
+    ping      time.Duration   // WithKeepalive; 0 = no pings
+    pongWait  time.Duration
+
+    deflate  bool        // WithWSDeflate
+    deflated atomic.Bool // the server took it up on this connection
+
+    abandoned atomic.Int64 // chunked messages dropped half-received
+
+    reconnect ReconnectPolicy
+    onState   func(WSEvent) // WithOnWSState, else nil
+
+    static *NoiseKey     // WithNoise: this run's handshake key, else nil
+    pin    []byte        // WithNoise: the server's, if pinned
+    sess   *NoiseSession // this connection's, with static
 }
 
 var _ Client = (*wsClient)(nil)
 
-func NewWS(url, id, keyHex string) (*wsClient, error) {
+// NewWS builds a WebSocket client; see Option for the knobs.
+func NewWS(url, id, keyHex string, opts ...Option) (*wsClient, error) {
     sh, err := newShared(id, keyHex)
     if err != nil {
         return nil, err
     }
-    return &wsClient{url: url, shared: sh}, nil
+    cfg := newConfig(opts)
+    sh.apply(cfg)
+    if cfg.timeout == 0 {
+        cfg.timeout = 10 * time.Second
+    }
+    c := &wsClient{url: url, shared: sh, transport: warmTransport(cfg), timeout: cfg.timeout,
+        ping: cfg.wsPing, pongWait: cfg.wsPongWait, deflate: cfg.wsDeflate && !cfg.noise,
+        reconnect: cfg.reconnect, onState: cfg.onWSState}
+    if cfg.noise {
+        k, err := NewNoiseKey()
+        if err != nil {
+            return nil, err
+        }
+        c.static, c.pin = &k, cfg.noisePin
+    }
+    return c, nil
 }
 
 /*──────────── dial / close helpers ───────────────*/
 func (c *wsClient) dial(ctx context.Context) error {
-    hdr := map[string][]string{"X-Auth-Token": {c.buildAuthHeader()}}
-    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    hdr := http.Header{}
+    c.authHeaders(hdr)
+    if c.static != nil {
+        hdr.Set("X-Noise", NoiseProtocol)
+    }
+    c.statsHeader(hdr)
+    ctx, cancel := context.WithTimeout(ctx, c.timeout)
     defer cancel()
-    conn, _, err := websocket.Dial(ctx, c.url, &websocket.DialOptions{HTTPHeader: hdr})
+    start := time.Now()
+    mode := websocket.CompressionDisabled
+    if c.deflate {
+        mode = websocket.CompressionContextTakeover
+    }
+    conn, resp, err := websocket.Dial(ctx, c.url, &websocket.DialOptions{
+        HTTPHeader:      hdr,
+        HTTPClient:      &http.Client{Transport: c.transport},
+        CompressionMode: mode,
+    })
     if err != nil {
+        if !errors.Is(ctx.Err(), context.Canceled) {
+            c.observe(0, false) // not the daemon shutting down
+        }
         return err
     }
-    c.conn = conn
+    var sess *NoiseSession
+    if c.static != nil {
+        if sess, err = c.handshake(ctx, conn, resp.Header); err != nil {
+            _ = conn.Close(websocket.StatusPolicyViolation, "noise")
+            return err
+        }
+    }
+    dial := time.Since(start)
+    conn.SetReadLimit(int64(c.bodyCap()) + 1024) // whole messages from unchunked peers; room for the seal
+    observeServerTime(resp.Header, start, time.Now())
+    c.observe(dial, true)
+    c.observeHints(resp.Header)
+    body, _ := strconv.ParseInt(resp.Header.Get("X-Max-Body"), 10, 64)
+    c.observeLimits(body, 0)
+    c.dialed(0) // Poll dials ahead of any send: no send latency to it
+    c.deflated.Store(c.deflate && strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate"))
+    c.mu.Lock()
+    c.conn, c.sess = conn, sess
+    c.mu.Unlock()
     return nil
 }
 
+// Deflate reports whether the current connection compresses its frames
+// (WithWSDeflate, and the server agreed).
+func (c *wsClient) Deflate() bool { return c.deflated.Load() }
+
+// handshake runs Noise_XX on a fresh conn, see noise.go.
+func (c *wsClient) handshake(ctx context.Context, conn *websocket.Conn, h http.Header) (*NoiseSession, error) {
+    if h.Get("X-Noise") != NoiseProtocol {
+        return nil, ErrNoiseUnsupported
+    }
+    sess, err := noiseInitiate(ctx, conn, *c.static)
+    if err != nil {
+        return nil, err
+    }
+    if c.pin != nil && !bytes.Equal(sess.RemoteStatic(), c.pin) {
+        return nil, ErrNoisePeer
+    }
+    return sess, nil
+}
+
+// keepalive pings conn until ctx ends, and calls drop when a pong is
+// late: Poll's Read then fails and it re-dials.  Pings need no lock,
+// the library serialises frames itself, and Poll's Read takes the pong.
+func (c *wsClient) keepalive(ctx context.Context, conn *websocket.Conn, drop context.CancelFunc) {
+    if c.ping <= 0 {
+        return
+    }
+    t := time.NewTicker(c.ping)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+        }
+        pctx, cancel := context.WithTimeout(ctx, c.pongWait)
+        err := conn.Ping(pctx)
+        cancel()
+        if err != nil {
+            drop()
+            return
+        }
+    }
+}
+
 func (c *wsClient) close() {
-    if c.conn != nil {
-        _ = c.conn.Close(websocket.StatusNormalClosure, "bye")
-        c.conn = nil
+    c.mu.Lock()
+    conn := c.conn
+    c.conn, c.sess = nil, nil
+    c.mu.Unlock()
+    if conn != nil {
+        _ = conn.Close(websocket.StatusNormalClosure, "bye")
     }
 }
 
 /*──────────── Client.Send ───────────────*/
-func (c *wsClient) Send(snap core.Snapshot) error {
-    if c.conn == nil {
+// Send is one message; ctx ending halfway through it costs the
+// connection (a frame can't be taken back), which Poll then re-dials.
+func (c *wsClient) Send(ctx context.Context, snap core.Snapshot) error {
+    c.mu.Lock()
+    conn, sess := c.conn, c.sess // Poll swaps them on every re-dial
+    c.mu.Unlock()
+    if conn == nil {
         return errors.New("ws: not connected")
     }
     snap.Quick = core.QuickKey(snap.Items)
+    snap.Room = c.room
+    snap.Items = core.Pack(snap.Items) // repeated formats go once
     msg := mustJSON(snap)
-    if len(msg) > bodyCap {
-        return errors.New("body >32 MiB, dropped")
+    if len(msg) > c.bodyCap() {
+        if err := c.offload(ctx, c.blobs(), c.url, &snap); err != nil {
+            return err
+        }
+        if msg = mustJSON(snap); len(msg) > c.bodyCap() {
+            return ErrTooLarge
+        }
+    }
+    typ := websocket.MessageText
+    if !c.deflated.Load() { // else the frames are compressed already
+        if z := c.squeeze(msg); len(z) < len(msg) {
+            msg, typ = z, websocket.MessageBinary
+        }
+    }
+    frames := [][]byte{msg}
+    if len(msg) > c.chunkSize() { // relays and peers cap a message well below the body cap
+        frames, typ = wsFrames(msg, c.chunkSize()), websocket.MessageBinary
+    }
+    for _, f := range frames {
+        if err := c.write(ctx, conn, sess, typ, f); err != nil {
+            return err
+        }
     }
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    return nil
+}
+
+// write sends one message, paced and, with Noise, sealed.
+func (c *wsClient) write(ctx context.Context, conn *websocket.Conn, sess *NoiseSession, typ websocket.MessageType, msg []byte) error {
+    if err := c.pace(ctx, len(msg)); err != nil {
+        return err
+    }
+    ctx, cancel := context.WithTimeout(ctx, c.timeout)
     defer cancel()
 
+    start := time.Now()
     c.mu.Lock()
-    err := c.conn.Write(ctx, websocket.MessageText, msg)
+    var err error
+    if sess != nil {
+        msg, err = sess.Seal(msg)
+        typ = websocket.MessageBinary
+    }
+    if err == nil {
+        err = conn.Write(ctx, typ, msg)
+    }
     c.mu.Unlock()
+    c.record(0, time.Since(start), false)
+    if err == nil {
+        c.observeUpload(len(msg), time.Since(start))
+    }
     return err
 }
 
+// Abandoned counts chunked messages dropped half-received or failing
+// their checksums.
+func (c *wsClient) Abandoned() int64 { return c.abandoned.Load() }
+
+/*──────────── connection state ───────────────*/
+
+// WSState is a step in the WS connection's life.
+type WSState int
+
+const (
+    WSConnected WSState = iota // a dial succeeded
+    WSLost                     // the connection dropped; re-dialling at once
+    WSRetrying                 // a dial failed; the next after Wait
+    WSGaveUp                   // ReconnectPolicy.MaxRetries dials failed; Poll returns
+)
+
+// WSEvent is what WithOnWSState reports.
+type WSEvent struct {
+    State  WSState
+    Failed int           // dials failed in a row, this one included
+    Wait   time.Duration // WSRetrying: until the next dial
+    Err    error         // why, except for WSConnected
+}
+
+func (e WSEvent) String() string {
+    switch e.State {
+    case WSConnected:
+        return "connected"
+    case WSLost:
+        return fmt.Sprintf("connection lost (%v), reconnecting", e.Err)
+    case WSRetrying:
+        return fmt.Sprintf("dial failed (%v), %d in a row; retrying in %v", e.Err, e.Failed, e.Wait.Round(time.Millisecond))
+    default:
+        return fmt.Sprintf("dial failed (%v), %d in a row; giving up", e.Err, e.Failed)
+    }
+}
+
+func (c *wsClient) event(e WSEvent) {
+    if c.onState != nil {
+        c.onState(e)
+    }
+}
+
 /*──────────── Client.Poll ───────────────*/
+// Poll returns when ctx ends, or after ReconnectPolicy.MaxRetries
+// failed retries in a row.
 func (c *wsClient) Poll(ctx context.Context, out chan<- core.Snapshot) {
-    backoff := 500 * time.Millisecond
+    failed := 0 // dials in a row
+    var cctx context.Context // this connection's life; ends on Redial too
+    cancel := func() {}
+    defer func() { cancel() }()
 reconnect:
+    cancel()
     if err := c.dial(ctx); err != nil {
+        if ctx.Err() != nil {
+            return
+        }
+        failed++
+        if p := c.reconnect; p.MaxRetries > 0 && failed > p.MaxRetries {
+            c.event(WSEvent{State: WSGaveUp, Failed: failed, Err: err})
+            return
+        }
+        wait := c.reconnect.delay(failed)
+        c.event(WSEvent{State: WSRetrying, Failed: failed, Wait: wait, Err: err})
         select {
         case <-ctx.Done():
             return
-        case <-time.After(backoff):
-            backoff = minDuration(backoff*2, 8*time.Second)
+        case <-c.kick(): // network changed: try now
+            c.transport.CloseIdleConnections()
+            goto reconnect
+        case <-time.After(wait):
             goto reconnect
         }
     }
-    backoff = 500 * time.Millisecond // reset on success
-
-    ping := time.NewTicker(25 * time.Second)
-    defer ping.Stop()
+    failed = 0
+    c.event(WSEvent{State: WSConnected})
+    cctx, cancel = c.untilRedial(ctx)
+    conn, sess := c.conn, c.sess
+    go c.keepalive(cctx, conn, cancel)
+    pieces := wsPieces{} // this connection's; a re-dial loses the rest
 
     for {
-        select {
-        case <-ctx.Done():
+        _, data, err := conn.Read(cctx)
+        if err != nil {
             c.close()
-            return
-        case <-ping.C:
-            c.mu.Lock()
-            _ = c.conn.Ping(context.Background())
-            c.mu.Unlock()
-        default:
-            _, data, err := c.conn.Read(ctx)
-            if err != nil {
-                c.close()
+            if ctx.Err() != nil {
+                return
+            }
+            if cctx.Err() != nil {
+                c.transport.CloseIdleConnections() // Redial or no pong: no stale TLS conns either
+            }
+            c.event(WSEvent{State: WSLost, Err: err})
+            goto reconnect
+        }
+        if sess != nil {
+            if data, err = sess.Open(data); err != nil {
+                c.close() // out of step with the server now
+                c.event(WSEvent{State: WSLost, Err: err})
                 goto reconnect
             }
-            if len(data) > bodyCap {
+        }
+        var snap core.Snapshot
+        if s, piece, err := pieces.add(data, c.bodyCap()); piece {
+            c.abandoned.Add(int64(pieces.sweep()))
+            if err != nil {
+                c.abandoned.Add(1)
+            }
+            if s == nil {
+                continue
+            }
+            snap = *s
+        } else {
+            if len(data) > c.bodyCap() {
+                continue
+            }
+            if data, err = gunzipBody(data, c.bodyCap()); err != nil {
                 continue
             }
-            var snap core.Snapshot
             if json.Unmarshal(data, &snap) != nil {
                 continue
             }
-            if snap.Origin != c.id {
+        }
+        if snap.Origin != c.id && snap.Room == c.room {
+            if c.inflate(ctx, c.blobs(), c.url, &snap) == nil && core.Unpack(snap.Items) == nil {
                 out <- snap
             }
         }
     }
 }
 
+// blobs is the HTTP client for out-of-band payloads.
+func (c *wsClient) blobs() *http.Client {
+    return &http.Client{Transport: c.transport, Timeout: 5 * time.Minute}
+}
+
 func minDuration(a, b time.Duration) time.Duration {
     if a < b {
         return a
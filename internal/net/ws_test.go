@@ -2,9 +2,15 @@ package net
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,11 +21,11 @@ import (
 
 // TestWSHandshake verifies WebSocket client sends auth header.
 func TestWSHandshake(t *testing.T) {
-	var gotAuth string
+	var gotAuth atomic.Value // string
 
 	// WebSocket server that captures the auth header
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		gotAuth = r.Header.Get("X-Auth-Token")
+		gotAuth.Store(r.Header.Get("X-Auth-Token"))
 		c, err := websocket.Accept(w, r, nil)
 		if err != nil {
 			t.Fatalf("accept: %v", err)
@@ -31,7 +37,7 @@ func TestWSHandshake(t *testing.T) {
 	// convert http:// to ws://
 	wsURL := "ws" + ts.URL[4:]
 
-	cli, err := NewWS(wsURL, "deadbeef", "test-secret-key")
+	cli, err := NewWS(wsURL, "deadbeef", hexKey)
 	if err != nil {
 		t.Fatalf("NewWS: %v", err)
 	}
@@ -45,7 +51,7 @@ func TestWSHandshake(t *testing.T) {
 	// wait for connection
 	time.Sleep(100 * time.Millisecond)
 
-	if gotAuth == "" {
+	if a, _ := gotAuth.Load().(string); a == "" {
 		t.Fatalf("no auth header received")
 	}
 }
@@ -74,7 +80,10 @@ func TestWSEcho(t *testing.T) {
 	defer ts.Close()
 
 	wsURL := "ws" + ts.URL[4:]
-	cli, _ := NewWS(wsURL, "me", "test-secret-key")
+	cli, err := NewWS(wsURL, "me", hexKey)
+	if err != nil {
+		t.Fatalf("NewWS: %v", err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -91,7 +100,7 @@ func TestWSEcho(t *testing.T) {
 		Items:  []core.Item{{Fmt: 1, Payload: "dGVzdA=="}},
 	}
 
-	if err := cli.Send(want); err != nil {
+	if err := cli.Send(context.Background(), want); err != nil {
 		t.Fatalf("Send: %v", err)
 	}
 
@@ -108,12 +117,11 @@ func TestWSEcho(t *testing.T) {
 
 // TestWSReconnect verifies reconnection behavior.
 func TestWSReconnect(t *testing.T) {
-	var connCount int
+	var connCount atomic.Int32
 
 	// server that accepts only first connection
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		connCount++
-		if connCount == 1 {
+		if connCount.Add(1) == 1 {
 			c, _ := websocket.Accept(w, r, nil)
 			// immediately close to trigger reconnect
 			c.Close(websocket.StatusNormalClosure, "test")
@@ -127,7 +135,10 @@ func TestWSReconnect(t *testing.T) {
 	defer ts.Close()
 
 	wsURL := "ws" + ts.URL[4:]
-	cli, _ := NewWS(wsURL, "me", "test-secret-key")
+	cli, err := NewWS(wsURL, "me", hexKey)
+	if err != nil {
+		t.Fatalf("NewWS: %v", err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -138,7 +149,238 @@ func TestWSReconnect(t *testing.T) {
 	// wait for reconnect
 	time.Sleep(1500 * time.Millisecond)
 
-	if connCount < 2 {
-		t.Fatalf("expected at least 2 connections, got %d", connCount)
+	if n := connCount.Load(); n < 2 {
+		t.Fatalf("expected at least 2 connections, got %d", n)
+	}
+}
+
+// TestWSDeflate checks permessage-deflate is offered, noticed when the
+// server takes it up, and replaces gzip on the wire.
+func TestWSDeflate(t *testing.T) {
+	types := make(chan websocket.MessageType, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{CompressionMode: websocket.CompressionContextTakeover})
+		if err != nil {
+			return
+		}
+		defer c.Close(websocket.StatusNormalClosure, "")
+		for {
+			typ, _, err := c.Read(context.Background())
+			if err != nil {
+				return
+			}
+			types <- typ
+		}
+	}))
+	defer ts.Close()
+
+	snap := core.Snapshot{Origin: "me", Items: []core.Item{{Fmt: 1, Payload: strings.Repeat("dGVzdA==", 512)}}}
+	for _, on := range []bool{true, false} {
+		cli, err := NewWS("ws"+ts.URL[4:], "me", "0123456789abcdef", WithWSDeflate(on), WithCompression(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cli.dial(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := cli.Send(context.Background(), snap); err != nil {
+			t.Fatal(err)
+		}
+		if cli.Deflate() != on {
+			t.Fatalf("WithWSDeflate(%v): Deflate() = %v", on, cli.Deflate())
+		}
+		if typ := <-types; (typ == websocket.MessageText) != on {
+			t.Fatalf("WithWSDeflate(%v): sent %v", on, typ)
+		}
+		cli.close()
+	}
+}
+
+// TestWSKeepalive checks a connection whose pongs stop is dropped and
+// re-dialled, and one that answers is kept.
+func TestWSKeepalive(t *testing.T) {
+	for _, answer := range []bool{false, true} {
+		var dials atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.Close(websocket.StatusNormalClosure, "")
+			dials.Add(1)
+			if !answer { // half-open: never reads, so never pongs
+				<-r.Context().Done()
+				return
+			}
+			for {
+				if _, _, err := c.Read(context.Background()); err != nil {
+					return
+				}
+			}
+		}))
+
+		cli, _ := NewWS("ws"+ts.URL[4:], "me", "0123456789abcdef", WithKeepalive(50*time.Millisecond, 100*time.Millisecond))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		cli.Poll(ctx, make(chan core.Snapshot))
+		cancel()
+		ts.Close()
+
+		if n := dials.Load(); answer && n != 1 || !answer && n < 3 {
+			t.Fatalf("answering=%v: %d dials in 1s", answer, n)
+		}
+	}
+}
+
+// TestWSChunkedMessages relays a snapshot several chunks big between
+// two clients and checks it went as pieces and arrived whole.
+func TestWSChunkedMessages(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		peers []*websocket.Conn
+		sizes []int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.SetReadLimit(1 << 24)
+		mu.Lock()
+		peers = append(peers, c)
+		mu.Unlock()
+		for {
+			typ, msg, err := c.Read(context.Background())
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			sizes = append(sizes, len(msg))
+			for _, p := range peers {
+				if p != c {
+					p.Write(context.Background(), typ, msg)
+				}
+			}
+			mu.Unlock()
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	recv, _ := NewWS("ws"+ts.URL[4:], "them", "0123456789abcdef")
+	out := make(chan core.Snapshot, 1)
+	go recv.Poll(ctx, out)
+	send, _ := NewWS("ws"+ts.URL[4:], "me", "0123456789abcdef")
+	if err := send.dial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer send.close()
+	for connected := 0; connected < 2; time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		connected = len(peers)
+		mu.Unlock()
+	}
+
+	raw := make([]byte, 2<<20)
+	rand.Read(raw)
+	payload := base64.StdEncoding.EncodeToString(raw)
+	if err := send.Send(ctx, core.Snapshot{Origin: "me", Items: []core.Item{{Fmt: 1, Payload: payload}}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-out:
+		if len(got.Items) != 1 || got.Items[0].Payload != payload {
+			t.Fatal("payload changed on the way")
+		}
+	case <-ctx.Done():
+		t.Fatal("snapshot never arrived")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sizes) < 8 {
+		t.Fatalf("sent as %d messages", len(sizes))
+	}
+	for _, n := range sizes {
+		if n > defaultChunkSize+512 {
+			t.Fatalf("a %d-byte message", n)
+		}
+	}
+
+	pieces := wsPieces{}
+	frames := wsFrames([]byte(`{"origin":"x"}`), 4)
+	frames[1][len(frames[1])-1] ^= 1
+	var err error
+	for _, f := range frames {
+		if _, _, e := pieces.add(f, 1<<10); e != nil {
+			err = e
+		}
+	}
+	if !errors.Is(err, errChecksum) {
+		t.Fatalf("corrupted piece: %v", err)
+	}
+}
+
+// TestReconnectDelayClamped checks a zero or negative policy still waits
+// at least minReconnect and never shrinks between failures.
+func TestReconnectDelayClamped(t *testing.T) {
+	for _, p := range []ReconnectPolicy{
+		{},
+		{Initial: -time.Second, Factor: -2, Jitter: 3},
+		{Initial: time.Second, Factor: 0.5},
+		{Initial: time.Second, Factor: -1, Max: time.Second},
+	} {
+		prev := time.Duration(0)
+		for n := 1; n <= 5; n++ {
+			d := p.delay(n)
+			if d < minReconnect {
+				t.Fatalf("%+v: delay(%d) = %v, want at least %v", p, n, d, minReconnect)
+			}
+			if p.Jitter == 0 && d < prev {
+				t.Fatalf("%+v: delay(%d) = %v shrank from %v", p, n, d, prev)
+			}
+			prev = d
+		}
+	}
+}
+
+// TestWSReconnectPolicy checks the back-off follows the policy, the
+// state changes are reported, and Poll gives up after MaxRetries.
+func TestWSReconnectPolicy(t *testing.T) {
+	p := ReconnectPolicy{Initial: 100 * time.Millisecond, Factor: 3, Max: time.Second, Jitter: 0.1}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 300 * time.Millisecond, 3: 900 * time.Millisecond, 4: time.Second, 9: time.Second} {
+		if d := p.delay(n); d < want*9/10 || d > want*11/10 {
+			t.Fatalf("delay(%d) = %v, want %v ±10%%", n, d, want)
+		}
+	}
+
+	var up atomic.Bool
+	up.Store(true)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		up.Store(false) // one connection, dropped at once; then nothing
+		c.Close(websocket.StatusGoingAway, "restart")
+	}))
+	defer ts.Close()
+
+	var states []WSState
+	cli, _ := NewWS("ws"+ts.URL[4:], "me", "0123456789abcdef",
+		WithReconnect(ReconnectPolicy{Initial: 10 * time.Millisecond, Factor: 2, MaxRetries: 2}),
+		WithOnWSState(func(e WSEvent) { states = append(states, e.State) }))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cli.Poll(ctx, make(chan core.Snapshot))
+	if ctx.Err() != nil {
+		t.Fatal("Poll never gave up")
+	}
+	want := []WSState{WSConnected, WSLost, WSRetrying, WSRetrying, WSGaveUp}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Fatalf("states %v, want %v", states, want)
 	}
 }
@@ -0,0 +1,108 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	core "clipsync/internal"
+)
+
+/*──────── chunked WS messages ────────────────────────────────*/
+// A snapshot bigger than one chunk goes over WS as several binary
+// messages, each carrying what an HTTP upload puts in its X-Chunk-*
+// headers ahead of the piece itself:
+//
+//	0x00 {"chunk_id":"…","chunk_idx":0,"chunk_total":3,"chunk_sha256":"…"} \n <bytes>
+//
+// The last piece adds body_sha256.  No JSON or gzip body starts with a
+// zero byte, so receivers tell pieces from whole messages by it, and
+// relays pass pieces on like any other message.
+
+type wsChunk struct {
+	ID    string `json:"chunk_id"`
+	Idx   int    `json:"chunk_idx"`
+	Total int    `json:"chunk_total"`
+	Sum   string `json:"chunk_sha256"`
+	Body  string `json:"body_sha256,omitempty"`
+}
+
+// wsChunkIdle drops a message none of whose pieces arrived for this long.
+const wsChunkIdle = time.Minute
+
+var errBadPiece = errors.New("ws: malformed chunk")
+
+// wsFrames slices msg into pieces of at most size bytes, framed.
+func wsFrames(msg []byte, size int) [][]byte {
+	pieces := chunksOf(msg, size)
+	cid := randomID(8)
+	frames := make([][]byte, len(pieces))
+	for i, p := range pieces {
+		h := wsChunk{ID: cid, Idx: i, Total: len(pieces), Sum: sha256Hex(p)}
+		if i == len(pieces)-1 {
+			h.Body = sha256Hex(msg)
+		}
+		f := append([]byte{0}, mustJSON(h)...)
+		f = append(f, '\n')
+		frames[i] = append(f, p...)
+	}
+	return frames
+}
+
+// wsPieces holds partly received messages by chunk id.
+type wsPieces map[string]*state
+
+// add takes one received message.  piece is false if it isn't one (the
+// caller decodes it whole); else snap is the snapshot it completed, if
+// any.  err means the piece's message was dropped: a bad piece, a
+// checksum mismatch or more than limit bytes.
+func (w wsPieces) add(msg []byte, limit int) (snap *core.Snapshot, piece bool, err error) {
+	if len(msg) == 0 || msg[0] != 0 {
+		return nil, false, nil
+	}
+	nl := bytes.IndexByte(msg, '\n')
+	var h wsChunk
+	if nl < 0 || json.Unmarshal(msg[1:nl], &h) != nil || h.ID == "" || h.Idx < 0 || h.Idx >= h.Total {
+		return nil, true, errBadPiece
+	}
+	s := w[h.ID]
+	if s == nil {
+		s = &state{cid: h.ID, total: h.Total, parts: map[int][]byte{}, sums: map[int]string{}}
+		w[h.ID] = s
+	}
+	if h.Total != s.total {
+		delete(w, h.ID)
+		return nil, true, errBadPiece
+	}
+	s.parts[h.Idx], s.sums[h.Idx], s.touched = msg[nl+1:], h.Sum, time.Now()
+	if h.Body != "" {
+		s.sum = h.Body
+	}
+	size := 0
+	for _, p := range s.parts {
+		size += len(p)
+	}
+	if size > limit {
+		delete(w, h.ID)
+		return nil, true, ErrTooLarge
+	}
+	if len(s.parts) < s.total {
+		return nil, true, nil
+	}
+	delete(w, h.ID)
+	snap, err = s.assemble(limit)
+	return snap, true, err
+}
+
+// sweep drops messages no piece arrived for in wsChunkIdle (the sender
+// went away halfway) and says how many.
+func (w wsPieces) sweep() (n int) {
+	for id, s := range w {
+		if time.Since(s.touched) > wsChunkIdle {
+			delete(w, id)
+			n++
+		}
+	}
+	return n
+}
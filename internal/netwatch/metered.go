@@ -0,0 +1,61 @@
+package netwatch
+
+import (
+	"context"
+)
+
+/*──────── metered connections ────────────────────────────────*/
+
+// WatchMetered calls set with whether the way to the internet is billed
+// by the byte (a phone hotspot, a capped mobile plan), as the user or
+// the OS marked it: the connection cost API on Windows, NetworkManager
+// on Linux.  It calls it once at start and again whenever the answer
+// changes, until ctx ends; the OS is asked in process, and only after a
+// network change (or, on Linux, NetworkManager's own notice), never on
+// a timer.  Elsewhere, or when the OS can't be asked, it returns an
+// error.
+func WatchMetered(ctx context.Context, set func(bool)) error {
+	return watchMetered(ctx, set)
+}
+
+// follow calls set with ask's answer at once and after every tick of
+// changes, when it differs from the last one.
+func follow(ctx context.Context, changes <-chan struct{}, ask func() (bool, error), set func(bool)) error {
+	var last, known bool
+	for {
+		on, err := ask()
+		if err != nil {
+			return err
+		}
+		if !known || on != last {
+			set(on)
+			last, known = on, true
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		}
+	}
+}
+
+// NLM_CONNECTION_COST flags, netlistmgr.h.
+const (
+	costFixed         = 0x2
+	costVariable      = 0x4
+	costOverDataLimit = 0x10000
+	costRoaming       = 0x40000
+)
+
+// costMetered reads a Windows connection cost.  Fixed and variable
+// plans, roaming and a plan over its limit are billed; unrestricted and
+// unknown (no profile) are not.
+func costMetered(cost uint32) bool {
+	return cost&(costFixed|costVariable|costOverDataLimit|costRoaming) != 0
+}
+
+// nmMetered reads NetworkManager's Metered property: 1 yes and 3
+// guessed yes are metered; 0 unknown, 2 no and 4 guessed no are not.
+func nmMetered(v uint32) bool {
+	return v == 1 || v == 3
+}
@@ -0,0 +1,65 @@
+package netwatch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	nmName = "org.freedesktop.NetworkManager"
+	nmPath = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+)
+
+// watchMetered asks NetworkManager over the system bus, again whenever
+// it announces a new Metered value; without it there is no answer.
+func watchMetered(ctx context.Context, set func(bool)) error {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("netwatch: NetworkManager: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(nmPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		return fmt.Errorf("netwatch: NetworkManager: %w", err)
+	}
+	sigs := make(chan *dbus.Signal, 8)
+	conn.Signal(sigs)
+	changes := make(chan struct{}, 1)
+	go func() {
+		for sig := range sigs { // closed with conn
+			if meteredChanged(sig) {
+				signal(changes)
+			}
+		}
+	}()
+
+	nm := conn.Object(nmName, nmPath)
+	return follow(ctx, changes, func() (bool, error) {
+		v, err := nm.GetProperty(nmName + ".Metered")
+		if err != nil {
+			return false, fmt.Errorf("netwatch: NetworkManager: %w", err)
+		}
+		m, ok := v.Value().(uint32)
+		if !ok {
+			return false, fmt.Errorf("netwatch: unexpected Metered value %s", v)
+		}
+		return nmMetered(m), nil
+	}, set)
+}
+
+// meteredChanged tells whether a PropertiesChanged signal is
+// NetworkManager's and touches Metered.
+func meteredChanged(sig *dbus.Signal) bool {
+	if len(sig.Body) < 2 {
+		return false
+	}
+	iface, _ := sig.Body[0].(string)
+	props, _ := sig.Body[1].(map[string]dbus.Variant)
+	_, ok := props["Metered"]
+	return iface == nmName && ok
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package netwatch
+
+import (
+	"context"
+	"errors"
+)
+
+func watchMetered(context.Context, func(bool)) error {
+	return errors.New("netwatch: metered connections can't be detected on this platform")
+}
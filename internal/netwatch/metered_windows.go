@@ -0,0 +1,73 @@
+package netwatch
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procCoCreateInstance = windows.NewLazySystemDLL("ole32.dll").NewProc("CoCreateInstance")
+
+	clsidNetworkListManager = windows.GUID{Data1: 0xdcb00c01, Data2: 0x570f, Data3: 0x4a9b,
+		Data4: [8]byte{0x8d, 0x69, 0x19, 0x9f, 0xdb, 0xa5, 0x72, 0x3b}}
+	iidINetworkCostManager = windows.GUID{Data1: 0xdcb00008, Data2: 0x570f, Data3: 0x4a9b,
+		Data4: [8]byte{0x8d, 0x69, 0x19, 0x9f, 0xdb, 0xa5, 0x72, 0x3b}}
+)
+
+// CLSCTX_ALL, and what CoInitializeEx says when COM is already up.
+const (
+	clsctxAll = 0x17
+	sFalse    = syscall.Errno(1)
+)
+
+// costManager is the Network List Manager's INetworkCostManager.
+type costManager struct {
+	vtbl *struct {
+		QueryInterface, AddRef, Release                     uintptr
+		GetCost, GetDataPlanStatus, SetDestinationAddresses uintptr
+	}
+}
+
+// cost is the machine-wide connection cost, NLM_CONNECTION_COST flags.
+func (m *costManager) cost() (uint32, error) {
+	var c uint32
+	r, _, _ := syscall.SyscallN(m.vtbl.GetCost, uintptr(unsafe.Pointer(m)), uintptr(unsafe.Pointer(&c)), 0)
+	if r != 0 {
+		return 0, fmt.Errorf("netwatch: connection cost: HRESULT %#x", uint32(r))
+	}
+	return c, nil
+}
+
+func (m *costManager) release() {
+	syscall.SyscallN(m.vtbl.Release, uintptr(unsafe.Pointer(m)))
+}
+
+// watchMetered keeps one cost manager on a thread of its own and asks
+// it again after every network change.
+func watchMetered(ctx context.Context, set func(bool)) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := windows.CoInitializeEx(0, windows.COINIT_MULTITHREADED); err != nil && err != sFalse {
+		return fmt.Errorf("netwatch: COM: %w", err)
+	}
+	defer windows.CoUninitialize()
+
+	var m *costManager
+	r, _, _ := procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidNetworkListManager)), 0, clsctxAll,
+		uintptr(unsafe.Pointer(&iidINetworkCostManager)), uintptr(unsafe.Pointer(&m)))
+	if r != 0 {
+		return fmt.Errorf("netwatch: Network List Manager: HRESULT %#x", uint32(r))
+	}
+	defer m.release()
+
+	return follow(ctx, Changes(ctx), func() (bool, error) {
+		c, err := m.cost()
+		return costMetered(c), err
+	}, set)
+}
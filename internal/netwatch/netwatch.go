@@ -0,0 +1,58 @@
+// Package netwatch tells when the machine's network changed: an address
+// came or went, a link went up or down (Wi-Fi switch, docking, VPN).
+// Connections made before such a change are often dead without knowing
+// it, so transports re-dial at once instead of waiting out a timeout.
+package netwatch
+
+import (
+	"context"
+	"time"
+)
+
+// Settle is how long a burst of raw events must go quiet before it is
+// reported: one dock plugs in several interfaces.
+const Settle = time.Second
+
+// Changes ticks once per settled burst of network changes until ctx
+// ends.  Where the OS can't notify (or refuses), it polls the
+// interface addresses instead.
+func Changes(ctx context.Context) <-chan struct{} {
+	raw := make(chan struct{}, 1)
+	go func() {
+		if watch(ctx, raw) != nil && ctx.Err() == nil {
+			poll(ctx, raw, 5*time.Second)
+		}
+	}()
+	return settle(ctx, raw, Settle)
+}
+
+// settle turns raw events into one tick per burst quiet for d.
+func settle(ctx context.Context, raw <-chan struct{}, d time.Duration) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	go func() {
+		var quiet <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-raw:
+				quiet = time.After(d)
+			case <-quiet:
+				quiet = nil
+				select {
+				case out <- struct{}{}:
+				default: // the last tick is still unread: same news
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// signal reports one raw event without ever blocking the watcher.
+func signal(raw chan<- struct{}) {
+	select {
+	case raw <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,76 @@
+package netwatch
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSettleCoalescesBursts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	raw := make(chan struct{}, 1)
+	out := settle(ctx, raw, 100*time.Millisecond)
+
+	for i := 0; i < 5; i++ { // a dock plugging in
+		signal(raw)
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case <-out:
+		t.Fatal("ticked before the burst settled")
+	default:
+	}
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("no tick after the burst")
+	}
+	select {
+	case <-out:
+		t.Fatal("one burst ticked twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMeteredValues(t *testing.T) {
+	for cost, want := range map[uint32]bool{
+		0x0: false, 0x1: false, 0x2: true, 0x4: true,
+		0x1 | 0x20000: false, 0x1 | 0x40000: true, 0x2 | 0x80000: true,
+	} {
+		if got := costMetered(cost); got != want {
+			t.Errorf("costMetered(%#x) = %v", cost, got)
+		}
+	}
+	for v, want := range map[uint32]bool{0: false, 1: true, 2: false, 3: true, 4: false} {
+		if got := nmMetered(v); got != want {
+			t.Errorf("nmMetered(%d) = %v", v, got)
+		}
+	}
+}
+
+func TestFollowReportsChangesOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	answers := []bool{false, false, true, true, false}
+	changes := make(chan struct{})
+	var got []bool
+	done := make(chan error)
+	go func() {
+		done <- follow(ctx, changes, func() (bool, error) {
+			on := answers[0]
+			answers = answers[1:]
+			return on, nil
+		}, func(on bool) { got = append(got, on) })
+	}()
+	for i := 0; i < 4; i++ {
+		changes <- struct{}{}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] || !got[1] || got[2] {
+		t.Errorf("set calls = %v, want [false true false]", got)
+	}
+}
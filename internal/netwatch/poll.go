@@ -0,0 +1,36 @@
+package netwatch
+
+import (
+	"context"
+	"net"
+	"slices"
+	"time"
+)
+
+// poll compares the interface addresses every period.
+func poll(ctx context.Context, raw chan<- struct{}, period time.Duration) {
+	last := addrs()
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if now := addrs(); !slices.Equal(now, last) {
+			last = now
+			signal(raw)
+		}
+	}
+}
+
+func addrs() []string {
+	as, _ := net.InterfaceAddrs()
+	out := make([]string, len(as))
+	for i, a := range as {
+		out[i] = a.String()
+	}
+	slices.Sort(out)
+	return out
+}
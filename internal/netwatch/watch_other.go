@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+
+package netwatch
+
+import (
+	"context"
+	"errors"
+)
+
+// watch has no notification source here; Changes polls instead.
+func watch(context.Context, chan<- struct{}) error {
+	return errors.New("netwatch: no change notifications on this platform")
+}
@@ -0,0 +1,25 @@
+package netwatch
+
+import (
+	"context"
+	"syscall"
+)
+
+var procNotifyAddrChange = syscall.NewLazyDLL("iphlpapi.dll").NewProc("NotifyAddrChange")
+
+// watch blocks in NotifyAddrChange, which returns whenever an IPv4
+// address is added or removed (the same event the Network List
+// Manager's connectivity changes are built on).  The call can't be
+// interrupted, so the goroutine outlives ctx until the next change.
+func watch(ctx context.Context, raw chan<- struct{}) error {
+	if err := procNotifyAddrChange.Find(); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		if r, _, _ := procNotifyAddrChange.Call(0, 0); r != 0 {
+			return syscall.Errno(r)
+		}
+		signal(raw)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package osc52 bridges terminal clipboards.  Programs inside tmux or
+// an SSH session set the clipboard by printing OSC 52,
+//
+//	ESC ] 52 ; c ; <base64 text> BEL      (or ESC \ instead of BEL)
+//
+// which normally only reaches the local terminal.  Clipboard watches a
+// byte stream for these sequences and turns each into a local copy, so
+// a headless host can join a sync group; with Emit it also prints
+// received text as OSC 52, which the user's terminal then puts on its
+// clipboard.  pty_linux.go runs a command on a PTY to watch its output.
+package osc52
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"sync"
+
+	core "clipsync/internal"
+)
+
+// MaxBytes caps one sequence; longer ones are dropped, not truncated.
+const MaxBytes = 8 << 20
+
+/*──────── stream scanner ──────────────────────────────────────*/
+
+// Scan copies r to pass (may be nil) unchanged and calls got with the
+// decoded text of every OSC 52 set-clipboard sequence in it.  Queries
+// ("?") and malformed sequences are ignored.  It returns r's error; nil
+// at EOF.
+func Scan(r io.Reader, pass io.Writer, got func(text []byte)) error {
+	const (
+		plain = iota
+		esc   // saw ESC
+		osc   // inside ESC ]
+		oscEsc
+	)
+	var (
+		state int
+		body  []byte
+		over  bool // body passed MaxBytes
+		buf   = make([]byte, 32<<10)
+	)
+	end := func() {
+		if !over {
+			if text, ok := parse(body); ok {
+				got(text)
+			}
+		}
+		body, over, state = body[:0], false, plain
+	}
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			switch state {
+			case plain:
+				if b == 0x1b {
+					state = esc
+				}
+			case esc:
+				if b == ']' {
+					state = osc
+				} else if b != 0x1b {
+					state = plain
+				}
+			case osc:
+				switch {
+				case b == 0x07:
+					end()
+				case b == 0x1b:
+					state = oscEsc
+				case len(body) >= MaxBytes:
+					over = true
+				default:
+					body = append(body, b)
+				}
+			case oscEsc:
+				if b == '\\' {
+					end()
+				} else { // not a terminator: a new sequence starts
+					body, over = body[:0], false
+					state = esc
+					if b == ']' {
+						state = osc
+					}
+				}
+			}
+		}
+		if pass != nil && n > 0 {
+			if _, werr := pass.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Encode is the sequence that sets the terminal clipboard to text.
+// With tmux it is wrapped in a DCS passthrough, for panes where tmux
+// would otherwise swallow it (set-clipboard off, allow-passthrough on).
+func Encode(text []byte, tmux bool) []byte {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString(text) + "\a"
+	if tmux {
+		seq = "\x1bPtmux;\x1b" + seq + "\x1b\\"
+	}
+	return []byte(seq)
+}
+
+// parse decodes "52;<selection>;<base64>".
+func parse(body []byte) ([]byte, bool) {
+	rest, ok := bytes.CutPrefix(body, []byte("52;"))
+	if !ok {
+		return nil, false
+	}
+	_, data, ok := bytes.Cut(rest, []byte(";"))
+	if !ok || string(data) == "?" {
+		return nil, false
+	}
+	text, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil || len(text) == 0 {
+		return nil, false
+	}
+	return text, true
+}
+
+/*──────── Clipboard ───────────────────────────────────────────*/
+
+// Clipboard holds the last text set through the stream.  It satisfies
+// clipsync.Clipboard (text only).
+type Clipboard struct {
+	in  io.Reader
+	out *lockedWriter
+	o   Options
+
+	mu      sync.Mutex
+	items   []core.Item
+	seq     uint32
+	changed chan struct{}
+}
+
+type Options struct {
+	Emit bool // print received text to out as OSC 52
+	Tmux bool // ...wrapped for tmux passthrough
+}
+
+// New reads OSC 52 from in (nil = nothing to read) once Run starts;
+// everything read is copied to out (nil = swallowed).
+func New(in io.Reader, out io.Writer, o Options) *Clipboard {
+	c := &Clipboard{in: in, o: o, changed: make(chan struct{}, 1)}
+	if out != nil {
+		c.out = &lockedWriter{w: out}
+	}
+	return c
+}
+
+// Run scans the stream.  At EOF it idles until ctx ends, so a closed
+// input is not mistaken for a crash.
+func (c *Clipboard) Run(ctx context.Context) error {
+	if c.in != nil {
+		var pass io.Writer
+		if c.out != nil {
+			pass = c.out
+		}
+		if err := Scan(c.in, pass, c.set); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *Clipboard) set(text []byte) {
+	c.mu.Lock()
+	c.items = []core.Item{core.TextItem(text)}
+	c.seq++
+	c.mu.Unlock()
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Clipboard) Watch() (<-chan struct{}, string) { return c.changed, "osc52" }
+
+func (c *Clipboard) Read() ([]core.Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items, nil
+}
+
+// Write keeps remote clips so Read stays current and, with Emit,
+// hands their text to the terminal.
+func (c *Clipboard) Write(items []core.Item) error {
+	c.mu.Lock()
+	c.items = items
+	c.seq++
+	c.mu.Unlock()
+
+	if !c.o.Emit || c.out == nil {
+		return nil
+	}
+	// no items clears the terminal's clipboard too (an expired secret)
+	if text, ok := core.Text(items); ok || len(items) == 0 {
+		_, err := c.out.Write(Encode(text, c.o.Tmux))
+		return err
+	}
+	return nil
+}
+
+func (c *Clipboard) Seq() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+func (c *Clipboard) Accessible() bool  { return true }
+func (c *Clipboard) Accepts() []string { return []string{"text/plain"} }
+
+// lockedWriter keeps an emitted sequence from landing inside a chunk of
+// passed-through output.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,82 @@
+package osc52
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	core "clipsync/internal"
+)
+
+func seq(text, term string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + term
+}
+
+func TestScan(t *testing.T) {
+	stream := "ls\r\n" + seq("one", "\a") + "more output" + seq("two", "\x1b\\") +
+		"\x1b]52;c;?\a" + // query: ignored
+		"\x1b]0;window title\a" + // other OSC: ignored
+		"\x1b]52;c;!!notbase64\a" + seq("three", "\a")
+
+	var got []string
+	var pass bytes.Buffer
+	err := Scan(iotest.OneByteReader(strings.NewReader(stream)), &pass, func(b []byte) {
+		got = append(got, string(b))
+	})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if pass.String() != stream {
+		t.Fatalf("stream not passed through unchanged")
+	}
+}
+
+func TestScanDropsOversized(t *testing.T) {
+	big := "\x1b]52;c;" + strings.Repeat("A", MaxBytes+4) + "\a"
+	var got int
+	_ = Scan(strings.NewReader(big+seq("ok", "\a")), nil, func([]byte) { got++ })
+	if got != 1 {
+		t.Fatalf("want only the small sequence, got %d", got)
+	}
+}
+
+func TestClipboardTracksSets(t *testing.T) {
+	c := New(strings.NewReader(seq("hello", "\a")), nil, Options{})
+	_ = Scan(c.in, nil, c.set)
+
+	items, _ := c.Read()
+	if c.Seq() != 1 || len(items) != 1 || items[0] != core.TextItem([]byte("hello")) {
+		t.Fatalf("seq %d, items %+v", c.Seq(), items)
+	}
+	select {
+	case <-c.changed:
+	default:
+		t.Fatalf("no change tick")
+	}
+}
+
+func TestWriteEmits(t *testing.T) {
+	var term bytes.Buffer
+	c := New(nil, &term, Options{Emit: true})
+	if err := c.Write([]core.Item{{MimeType: "image/png", Payload: "AAAA"}, core.TextItem([]byte("hi"))}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if term.String() != seq("hi", "\a") {
+		t.Fatalf("emitted %q", term.String())
+	}
+
+	// what we emit is what Scan reads back, tmux-wrapped or not
+	for _, tmux := range []bool{false, true} {
+		var got string
+		_ = Scan(bytes.NewReader(Encode([]byte("round trip"), tmux)), nil, func(b []byte) { got = string(b) })
+		if got != "round trip" {
+			t.Fatalf("tmux=%v: scanned %q", tmux, got)
+		}
+	}
+}
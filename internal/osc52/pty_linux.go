@@ -0,0 +1,109 @@
+package osc52
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+/*──────── PTY bridge ──────────────────────────────────────────*/
+
+// Exec runs cmd on a fresh PTY wired to our terminal: keystrokes go in,
+// and its output comes back through the returned reader (pipe that
+// through Scan to stdout).  restore puts the terminal back; done yields
+// cmd's exit.
+func Exec(cmd *exec.Cmd) (out io.Reader, restore func(), done <-chan error, err error) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(m.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		m.Close()
+		return nil, nil, nil, err
+	}
+	var unlock int32
+	if err := ioctl(m.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		m.Close()
+		return nil, nil, nil, err
+	}
+	s, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		m.Close()
+		return nil, nil, nil, err
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = s, s, s
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	resize(m)
+	if err := cmd.Start(); err != nil {
+		s.Close()
+		m.Close()
+		return nil, nil, nil, err
+	}
+	s.Close()
+
+	restore = rawMode(os.Stdin.Fd())
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resize(m)
+		}
+	}()
+	go io.Copy(m, os.Stdin)
+
+	ch := make(chan error, 1)
+	go func() { ch <- cmd.Wait() }()
+	return ptyReader{m}, func() { signal.Stop(winch); restore() }, ch, nil
+}
+
+// ptyReader ends with EOF, not EIO, once the command is gone.
+type ptyReader struct{ f *os.File }
+
+func (r ptyReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if errors.Is(err, syscall.EIO) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// resize copies our terminal's size to the PTY.
+func resize(m *os.File) {
+	var ws [4]uint16 // rows, cols, xpixel, ypixel
+	if ioctl(os.Stdin.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))) == nil {
+		ioctl(m.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+	}
+}
+
+// rawMode hands every keystroke straight to the PTY (the command's own
+// terminal does the line editing); the result undoes it.
+func rawMode(fd uintptr) func() {
+	var old syscall.Termios
+	if ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&old))) != nil {
+		return func() {} // not a terminal: nothing to undo
+	}
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+	ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&raw)))
+	return func() { ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&old))) }
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package osc52
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// Exec needs a Linux PTY; elsewhere pipe the session into -osc52.
+func Exec(*exec.Cmd) (io.Reader, func(), <-chan error, error) {
+	return nil, nil, nil, errors.New("osc52: the PTY bridge needs Linux")
+}
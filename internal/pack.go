@@ -0,0 +1,43 @@
+package internal
+
+import "fmt"
+
+/*──────── shared payloads within one snapshot ────────────────*/
+// One image usually lands on the clipboard as PNG, image/png and a DIB
+// converted back to PNG: the same bytes two or three times.  Pack sends
+// each distinct payload once; the repeats carry SameAs instead and
+// Unpack copies the payload back before anyone looks at the items.
+
+// Pack blanks every payload already carried by an earlier item and
+// points it there with SameAs.  Items are copied, never modified.
+func Pack(items []Item) []Item {
+	first := make(map[string]int, len(items))
+	out := make([]Item, len(items))
+	for i, it := range items {
+		if it.Payload != "" {
+			if j, ok := first[it.Payload]; ok {
+				it.Payload, it.SameAs = "", j+1
+			} else {
+				first[it.Payload] = i
+			}
+		}
+		out[i] = it
+	}
+	return out
+}
+
+// Unpack restores what Pack blanked, in place.  A SameAs that does not
+// point at an earlier item is an error: the snapshot is corrupt.
+func Unpack(items []Item) error {
+	for i := range items {
+		j := items[i].SameAs - 1
+		if j < 0 {
+			continue
+		}
+		if j >= i {
+			return fmt.Errorf("item %d: same_as %d is not an earlier item", i, j+1)
+		}
+		items[i].Payload, items[i].SameAs = items[j].Payload, 0
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package internal
+
+import "testing"
+
+func TestPackSendsEachPayloadOnce(t *testing.T) {
+	items := []Item{
+		{FmtName: "PNG", Payload: "aaaa", ByteLen: 3},
+		{FmtName: "image/png", Payload: "aaaa", ByteLen: 3},
+		{FmtName: "text", Payload: "bbbb"},
+		{FmtName: "DIB", Payload: "aaaa", ByteLen: 3},
+	}
+	packed := Pack(items)
+	if items[1].Payload != "aaaa" {
+		t.Fatalf("Pack modified its input")
+	}
+	if packed[0].Payload != "aaaa" || packed[2].Payload != "bbbb" {
+		t.Fatalf("first copies must keep their payload: %+v", packed)
+	}
+	if packed[1].Payload != "" || packed[1].SameAs != 1 || packed[3].SameAs != 1 {
+		t.Fatalf("repeats not referenced: %+v", packed)
+	}
+
+	if err := Unpack(packed); err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	for i := range items {
+		if packed[i] != items[i] {
+			t.Fatalf("item %d: got %+v, want %+v", i, packed[i], items[i])
+		}
+	}
+}
+
+func TestUnpackRejectsForwardRefs(t *testing.T) {
+	for _, items := range [][]Item{
+		{{SameAs: 1}},
+		{{Payload: "x"}, {SameAs: 3}, {Payload: "y"}},
+	} {
+		if Unpack(items) == nil {
+			t.Fatalf("accepted bad same_as: %+v", items)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Package persist is the single gate for putting clipsync state on
+// disk.  Every subsystem that saves something (offline queue, partial
+// downloads, text-as-file spool, …) writes through here, so ephemeral
+// mode is one Disable call and cannot be forgotten by a new subsystem.
+package persist
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sync/atomic"
+)
+
+var off atomic.Bool
+
+// ErrEphemeral is returned by every write once Disable has been called.
+var ErrEphemeral = errors.New("ephemeral mode: nothing is written to disk")
+
+// Disable turns every later write into ErrEphemeral, for the rest of
+// the process.  There is deliberately no Enable.
+func Disable() { off.Store(true) }
+
+// Enabled reports whether writes are allowed.
+func Enabled() bool { return !off.Load() }
+
+// MkdirAll is os.MkdirAll behind the gate.
+func MkdirAll(dir string, perm fs.FileMode) error {
+	if off.Load() {
+		return ErrEphemeral
+	}
+	return os.MkdirAll(dir, perm)
+}
+
+// WriteFile writes data to name via a temp file and rename, so readers
+// never see half a file.
+func WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if off.Load() {
+		return ErrEphemeral
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name) // atomic on the same volume
+}
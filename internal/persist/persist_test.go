@@ -0,0 +1,30 @@
+package persist
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDisableBlocksWrites(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteFile(filepath.Join(dir, "a"), []byte("x"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	Disable()
+	if Enabled() {
+		t.Fatalf("still enabled after Disable")
+	}
+	if err := WriteFile(filepath.Join(dir, "b"), []byte("x"), 0o600); !errors.Is(err, ErrEphemeral) {
+		t.Fatalf("WriteFile after Disable: %v", err)
+	}
+	if err := MkdirAll(filepath.Join(dir, "sub"), 0o700); !errors.Is(err, ErrEphemeral) {
+		t.Fatalf("MkdirAll after Disable: %v", err)
+	}
+	left, _ := os.ReadDir(dir)
+	if len(left) != 1 {
+		t.Fatalf("want only the pre-Disable file, found %d entries", len(left))
+	}
+}
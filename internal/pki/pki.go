@@ -0,0 +1,208 @@
+// Package pki is the small certificate authority behind `clipsync cert`:
+// one CA per deployment, a certificate for the relay and one per device,
+// for mutual TLS on the HTTP and WS transports.  Keys are ECDSA P-256,
+// files are PEM, named after what they are for (<name>.crt, <name>.key)
+// in one directory next to ca.crt and ca.key.
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"clipsync/internal/persist"
+)
+
+// CA is the name of the authority's own files in a directory: ca.crt
+// (hand it to every device and the relay) and ca.key (keep it there).
+const CA = "ca"
+
+var (
+	ErrExists = errors.New("pki: already exists")
+	ErrNoCA   = errors.New("pki: no CA here; run clipsync cert init")
+)
+
+// Paths is where name's certificate and key live in dir.
+func Paths(dir, name string) (cert, key string) {
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+// InitCA creates the authority in dir, valid for days.  It refuses to
+// replace one, which would orphan every certificate it issued.
+func InitCA(dir, org string, days int) error {
+	certFile, _ := Paths(dir, CA)
+	if _, err := os.Stat(certFile); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, certFile)
+	}
+	tmpl := template(org+" CA", days)
+	tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	tmpl.MaxPathLenZero = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	return create(dir, CA, tmpl, nil, nil)
+}
+
+// Issue signs a certificate for name with dir's CA.  With no hosts it
+// is a device's client certificate, name being what the relay knows the
+// device by; with hosts (names or IPs) it is the relay's.
+func Issue(dir, name string, hosts []string, days int) error {
+	if name == "" || name == CA || filepath.Base(name) != name {
+		return fmt.Errorf("pki: bad certificate name %q", name)
+	}
+	caCert, caKey, err := load(Paths(dir, CA))
+	if err != nil {
+		return ErrNoCA
+	}
+	tmpl := template(name, days)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	if len(hosts) == 0 {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else {
+				tmpl.DNSNames = append(tmpl.DNSNames, h)
+			}
+		}
+	}
+	return create(dir, name, tmpl, caCert, caKey)
+}
+
+func template(cn string, days int) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Hour), // a little clock skew
+		NotAfter:     now.AddDate(0, 0, days),
+	}
+}
+
+// create makes a key, signs tmpl with it (self-signed when parent is
+// nil) and writes both files.
+func create(dir, name string, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := persist.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	certFile, keyFile := Paths(dir, name)
+	if err := persist.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return persist.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
+
+func load(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("pki: CA key is not ECDSA")
+	}
+	return cert, key, nil
+}
+
+// pool reads the PEM certificates in file.
+func pool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := x509.NewCertPool()
+	if !p.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("pki: no certificates in %s", file)
+	}
+	return p, nil
+}
+
+/*──────── TLS configs ─────────────────────────────────────────*/
+
+// ClientConfig presents certFile / keyFile to the server, if given, and
+// trusts only caFile's servers, if given (else the system roots).
+func ClientConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{pair}
+	}
+	if caFile != "" {
+		p, err := pool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = p
+	}
+	return tc, nil
+}
+
+// ServerConfig serves certFile / keyFile and, with clientCAFile,
+// refuses clients without a certificate it signed.
+func ServerConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{pair}}
+	if clientCAFile != "" {
+		if err := RequireClients(tc, clientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	return tc, nil
+}
+
+// RequireClients makes tc refuse clients without a certificate that
+// clientCAFile's CA signed, whatever tc serves itself.
+func RequireClients(tc *tls.Config, clientCAFile string) error {
+	p, err := pool(clientCAFile)
+	if err != nil {
+		return err
+	}
+	tc.ClientCAs, tc.ClientAuth = p, tls.RequireAndVerifyClientCert
+	return nil
+}
+
+// PeerName is the name on a connection's verified client certificate,
+// or "" if it presented none.
+func PeerName(cs *tls.ConnectionState) string {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return cs.VerifiedChains[0][0].Subject.CommonName
+}
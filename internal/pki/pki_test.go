@@ -0,0 +1,73 @@
+package pki
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMutualTLS(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	if err := Issue(dir, "laptop", nil, 30); !errors.Is(err, ErrNoCA) {
+		t.Fatalf("issue without a CA: %v", err)
+	}
+	for _, d := range []string{dir, other} {
+		if err := InitCA(d, "test", 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitCA(dir, "test", 30); !errors.Is(err, ErrExists) {
+		t.Fatalf("second init: %v", err)
+	}
+	for _, c := range []struct {
+		dir, name string
+		hosts     []string
+	}{{dir, "relay", []string{"127.0.0.1"}}, {dir, "laptop", nil}, {other, "stranger", nil}} {
+		if err := Issue(c.dir, c.name, c.hosts, 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	caFile, _ := Paths(dir, CA)
+	relayCert, relayKey := Paths(dir, "relay")
+	stc, err := ServerConfig(relayCert, relayKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, PeerName(r.TLS))
+	}))
+	hs.TLS = stc
+	hs.StartTLS()
+	defer hs.Close()
+
+	get := func(certDir, name string) (string, error) {
+		var cert, key string
+		if name != "" {
+			cert, key = Paths(certDir, name)
+		}
+		tc, err := ClientConfig(cert, key, caFile)
+		if err != nil {
+			return "", err
+		}
+		resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: tc}}).Get(hs.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		var who string
+		fmt.Fscan(resp.Body, &who)
+		return who, nil
+	}
+	if who, err := get(dir, "laptop"); err != nil || who != "laptop" {
+		t.Fatalf("device certificate: %q, %v", who, err)
+	}
+	if _, err := get(dir, ""); err == nil {
+		t.Fatal("a client without a certificate got in")
+	}
+	if _, err := get(other, "stranger"); err == nil {
+		t.Fatal("a certificate from another CA got in")
+	}
+}
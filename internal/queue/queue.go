@@ -0,0 +1,102 @@
+// Package queue keeps snapshots that could not be uploaded until the
+// server is reachable again.  One JSON value per QuickKey, so
+// re-queuing identical content just replaces the older copy.
+package queue
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	core "clipsync/internal"
+	"clipsync/internal/persist"
+	"clipsync/internal/store"
+)
+
+// Namespace is where New keeps the queue in a shared Storage.
+const Namespace = "queue"
+
+type Queue struct {
+	st store.Storage
+	ns string
+	mu sync.Mutex
+}
+
+// Open keeps the queue as files in dir, creating it if needed.
+func Open(dir string) (*Queue, error) {
+	if err := persist.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Queue{st: store.Dir(dir)}, nil
+}
+
+// New keeps the queue in st, under Namespace.
+func New(st store.Storage) *Queue { return &Queue{st: st, ns: Namespace} }
+
+// Put stores s, replacing any queued snapshot with the same content.
+func (q *Queue) Put(s core.Snapshot) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b, err := json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+	return q.st.Put(q.ns, hex.EncodeToString([]byte(core.QuickKey(s.Items)))+".json", b)
+}
+
+// Len is the number of queued snapshots.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.keys())
+}
+
+// Drain hands queued snapshots to send, oldest first, deleting each one
+// that succeeds.  It stops at the first error and leaves the rest.
+func (q *Queue) Drain(send func(core.Snapshot) error) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	type entry struct {
+		key  string
+		snap core.Snapshot
+	}
+	var all []entry
+	for _, k := range q.keys() {
+		b, err := q.st.Get(q.ns, k)
+		if err != nil {
+			continue
+		}
+		var s core.Snapshot
+		if json.Unmarshal(b, &s) != nil {
+			q.st.Delete(q.ns, k) // corrupt: nothing to replay
+			continue
+		}
+		all = append(all, entry{k, s})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].snap.TS < all[j].snap.TS })
+
+	sent := 0
+	for _, e := range all {
+		if err := send(e.snap); err != nil {
+			return sent, err
+		}
+		q.st.Delete(q.ns, e.key)
+		sent++
+	}
+	return sent, nil
+}
+
+func (q *Queue) keys() []string {
+	all, _ := q.st.List(q.ns)
+	var out []string
+	for _, k := range all {
+		if strings.HasSuffix(k, ".json") {
+			out = append(out, k)
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	core "clipsync/internal"
+	"clipsync/internal/store"
+)
+
+func snap(ts int64, payload string) core.Snapshot {
+	return core.Snapshot{TS: ts, Items: []core.Item{{Payload: payload}}}
+}
+
+func TestPutReplacesSameContent(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	q.Put(snap(1, "YQ=="))
+	q.Put(snap(5, "YQ==")) // same content, newer
+	q.Put(snap(3, "Yg=="))
+	if n := q.Len(); n != 2 {
+		t.Fatalf("want 2 queued, got %d", n)
+	}
+
+	var got []int64
+	n, err := q.Drain(func(s core.Snapshot) error {
+		got = append(got, s.TS)
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("drain: %d, %v", n, err)
+	}
+	if got[0] != 3 || got[1] != 5 {
+		t.Fatalf("want oldest-first [3 5], got %v", got)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("queue not empty after drain")
+	}
+}
+
+func TestDrainStopsOnError(t *testing.T) {
+	q, _ := Open(t.TempDir())
+	q.Put(snap(1, "YQ=="))
+	q.Put(snap(2, "Yg=="))
+
+	calls := 0
+	n, err := q.Drain(func(core.Snapshot) error {
+		calls++
+		return errors.New("offline")
+	})
+	if err == nil || n != 0 || calls != 1 {
+		t.Fatalf("want stop after first failure, got n=%d calls=%d err=%v", n, calls, err)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("failed items must stay queued")
+	}
+}
+
+func TestQueueInStorage(t *testing.T) {
+	st := store.Memory()
+	q := New(st)
+	q.Put(snap(1, "YQ=="))
+	q.Put(snap(2, "Yg=="))
+	if keys, _ := st.List(Namespace); len(keys) != 2 {
+		t.Fatalf("want 2 keys under %q, got %q", Namespace, keys)
+	}
+	// a second queue over the same storage sees them, as after a restart
+	if n, err := New(st).Drain(func(core.Snapshot) error { return nil }); n != 2 || err != nil {
+		t.Fatalf("drain: %d, %v", n, err)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("queue not empty after drain")
+	}
+}
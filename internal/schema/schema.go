@@ -0,0 +1,192 @@
+// Package schema derives the published wire schema (JSON Schema and a
+// protobuf definition) from the snapshot types in internal, so non-Go
+// peers have something formal to build against.  The generated files
+// live next to this one; schema_test.go fails when they go stale
+// (regenerate with `go test ./internal/schema -update`).
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	core "clipsync/internal"
+)
+
+// field is one struct field as it appears on the wire.
+type field struct {
+	Name     string // JSON name
+	Kind     reflect.Kind
+	Elem     reflect.Type // element type for slices
+	Optional bool         // omitempty
+}
+
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fd := field{Name: name, Kind: f.Type.Kind(), Optional: strings.Contains(opts, "omitempty")}
+		if fd.Kind == reflect.Slice {
+			fd.Elem = f.Type.Elem()
+		}
+		out = append(out, fd)
+	}
+	return out
+}
+
+/*──────── JSON Schema ─────────────────────────────────────────*/
+
+func jsonType(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "integer"
+	}
+}
+
+func objectSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var req []string
+	for _, f := range fields(t) {
+		p := map[string]any{"type": jsonType(f.Kind)}
+		if f.Kind == reflect.Slice {
+			p["items"] = map[string]any{"$ref": "#/$defs/" + f.Elem.Name()}
+		}
+		if strings.HasPrefix(f.Kind.String(), "uint") {
+			p["minimum"] = 0
+		}
+		props[f.Name] = p
+		if !f.Optional {
+			req = append(req, f.Name)
+		}
+	}
+	// unknown fields are allowed: newer peers may add some
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             req,
+		"additionalProperties": true,
+	}
+}
+
+// JSONSchema returns the draft 2020-12 schema for one Snapshot message.
+func JSONSchema() []byte {
+	s := objectSchema(reflect.TypeOf(core.Snapshot{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "clipsync Snapshot"
+	s["$defs"] = map[string]any{"Item": objectSchema(reflect.TypeOf(core.Item{}))}
+	b, _ := json.MarshalIndent(s, "", "  ")
+	return append(b, '\n')
+}
+
+/*──────── protobuf ────────────────────────────────────────────*/
+
+func protoType(f field) string {
+	switch f.Kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Uint32:
+		return "uint32"
+	case reflect.Uint64:
+		return "uint64"
+	case reflect.Slice:
+		return "repeated " + f.Elem.Name()
+	default:
+		return "int64"
+	}
+}
+
+func protoMessage(b *strings.Builder, t reflect.Type) {
+	fmt.Fprintf(b, "message %s {\n", t.Name())
+	for i, f := range fields(t) {
+		opt := ""
+		if f.Optional && f.Kind != reflect.Slice {
+			opt = "optional "
+		}
+		fmt.Fprintf(b, "  %s%s %s = %d;\n", opt, protoType(f), f.Name, i+1)
+	}
+	b.WriteString("}\n")
+}
+
+// Proto returns a proto3 file mirroring the JSON wire form field for
+// field.  Field numbers follow struct order, so new fields in
+// internal/types.go must be appended, never inserted.
+func Proto() []byte {
+	var b strings.Builder
+	b.WriteString("// Code generated from internal/types.go by internal/schema; DO NOT EDIT.\n\n")
+	b.WriteString("syntax = \"proto3\";\n\npackage clipsync;\n\n")
+	protoMessage(&b, reflect.TypeOf(core.Item{}))
+	b.WriteString("\n")
+	protoMessage(&b, reflect.TypeOf(core.Snapshot{}))
+	return []byte(b.String())
+}
+
+/*──────── validation ──────────────────────────────────────────*/
+
+// Validate checks a JSON snapshot from any peer against the schema:
+// required fields present, known fields of the right type.
+func Validate(data []byte) error {
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if err := check(m, reflect.TypeOf(core.Snapshot{}), "snapshot"); err != nil {
+		return err
+	}
+	items, _ := m["items"].([]any)
+	for i, it := range items {
+		im, ok := it.(map[string]any)
+		if !ok {
+			return fmt.Errorf("items[%d]: not an object", i)
+		}
+		if err := check(im, reflect.TypeOf(core.Item{}), fmt.Sprintf("items[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func check(m map[string]any, t reflect.Type, where string) error {
+	for _, f := range fields(t) {
+		v, ok := m[f.Name]
+		if !ok {
+			if f.Optional {
+				continue
+			}
+			return fmt.Errorf("%s: missing %q", where, f.Name)
+		}
+		var good bool
+		switch jsonType(f.Kind) {
+		case "string":
+			_, good = v.(string)
+		case "boolean":
+			_, good = v.(bool)
+		case "array":
+			_, good = v.([]any)
+			good = good || v == nil
+		case "integer":
+			n, isNum := v.(float64)
+			good = isNum && n == float64(int64(n)) && !(n < 0 && f.Kind >= reflect.Uint && f.Kind <= reflect.Uint64)
+		}
+		if !good {
+			return fmt.Errorf("%s: %q should be %s", where, f.Name, jsonType(f.Kind))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	core "clipsync/internal"
+)
+
+var update = flag.Bool("update", false, "rewrite the generated schema files")
+
+func TestGeneratedUpToDate(t *testing.T) {
+	for name, want := range map[string][]byte{
+		"snapshot.schema.json": JSONSchema(),
+		"snapshot.proto":       Proto(),
+	} {
+		if *update {
+			if err := os.WriteFile(name, want, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is stale; run go test ./internal/schema -update", name)
+		}
+	}
+}
+
+// Every fixture is what some peer actually sends; all must validate and
+// decode into a Snapshot that survives a Go round trip unchanged.
+func TestFixturesCompatible(t *testing.T) {
+	files, _ := filepath.Glob("testdata/*.json")
+	if len(files) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		bad := strings.HasPrefix(filepath.Base(f), "bad_")
+		err := Validate(data)
+		if bad {
+			if err == nil {
+				t.Errorf("%s: invalid fixture accepted", f)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		var s core.Snapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Errorf("%s: decode: %v", f, err)
+			continue
+		}
+		again, _ := json.Marshal(&s)
+		if err := Validate(again); err != nil {
+			t.Errorf("%s: Go re-encoding no longer valid: %v", f, err)
+		}
+	}
+}
+
+func TestGoOutputValidates(t *testing.T) {
+	s := core.Snapshot{
+		Origin: "deadbeef", TS: 1, Seq: 7,
+		Items: []core.Item{{Fmt: 13, Payload: "aGk=", ByteLen: 2}},
+	}
+	b, _ := json.Marshal(&s)
+	if err := Validate(b); err != nil {
+		t.Fatalf("Go snapshot fails its own schema: %v", err)
+	}
+}
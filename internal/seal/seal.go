@@ -0,0 +1,335 @@
+// Package seal encrypts clips end to end, per room.  Every device has
+// an X25519 key pair; a room's members share a random room key that is
+// handed out as a Ring: the key wrapped once for each member's public
+// key, under an epoch number.  A Ring holds no secret in the clear, so
+// it can travel any way at all (chat, the bucket, a USB stick).
+//
+// Removing a member is a new Ring with a higher epoch and without them:
+// clips sealed from then on use the new key, which they cannot unwrap.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	core "clipsync/internal"
+	"clipsync/internal/persist"
+)
+
+// Mime marks the one item a sealed clip travels as.
+const Mime = "application/x-clipsync-sealed"
+
+var (
+	ErrNotMember = errors.New("seal: this device is not in the ring")
+	ErrNotSealed = errors.New("seal: clip is not sealed")
+	ErrNoKey     = errors.New("seal: no key for this room / epoch")
+)
+
+/*──────── device keys ─────────────────────────────────────────*/
+
+// Device is this device's key pair.
+type Device struct{ priv *ecdh.PrivateKey }
+
+// LoadDevice reads the private key at path, creating it on first use.
+func LoadDevice(path string) (*Device, error) {
+	if b, err := os.ReadFile(path); err == nil {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, fmt.Errorf("seal: %s: %w", path, err)
+		}
+		priv, err := ecdh.X25519().NewPrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("seal: %s: %w", path, err)
+		}
+		return &Device{priv}, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	d, err := NewDevice()
+	if err != nil {
+		return nil, err
+	}
+	if err := persist.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	enc := base64.StdEncoding.EncodeToString(d.priv.Bytes())
+	if err := persist.WriteFile(path, []byte(enc+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DeviceFromKey is the key pair for a 32-byte X25519 private key (for
+// interop vectors, which need a fixed one).
+func DeviceFromKey(priv []byte) (*Device, error) {
+	k, err := ecdh.X25519().NewPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{k}, nil
+}
+
+// NewDevice makes a key pair that lives only in memory.
+func NewDevice() (*Device, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{priv}, nil
+}
+
+// Public is the key others put in a Ring for this device.
+func (d *Device) Public() string {
+	return base64.StdEncoding.EncodeToString(d.priv.PublicKey().Bytes())
+}
+
+/*──────── rings ───────────────────────────────────────────────*/
+
+// Ring is a room key wrapped for each member, by public key.
+type Ring struct {
+	Room    string            `json:"room"`
+	Epoch   int               `json:"epoch"`
+	Members map[string]string `json:"members"` // public key → wrapped room key
+}
+
+// NewRing makes a fresh room key and wraps it for members (public keys).
+func NewRing(room string, epoch int, members []string) (*Ring, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	r := &Ring{Room: room, Epoch: epoch, Members: make(map[string]string)}
+	for _, m := range members {
+		pub, err := parsePublic(m)
+		if err != nil {
+			return nil, fmt.Errorf("seal: member %q: %w", m, err)
+		}
+		w, err := wrap(pub, key, r.aad())
+		if err != nil {
+			return nil, err
+		}
+		r.Members[m] = base64.StdEncoding.EncodeToString(w)
+	}
+	return r, nil
+}
+
+// ReadRing loads a ring written as JSON.
+func ReadRing(path string) (*Ring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Ring
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("seal: %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// Key unwraps the room key for d.
+func (r *Ring) Key(d *Device) ([]byte, error) {
+	w, ok := r.Members[d.Public()]
+	if !ok {
+		return nil, ErrNotMember
+	}
+	raw, err := base64.StdEncoding.DecodeString(w)
+	if err != nil {
+		return nil, err
+	}
+	return unwrap(d.priv, raw, r.aad())
+}
+
+func (r *Ring) aad() []byte { return []byte("clipsync ring " + r.Room + " " + strconv.Itoa(r.Epoch)) }
+
+func parsePublic(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// wrap is ECIES: ephemeral X25519 with the member's key, HKDF, AES-GCM.
+// Output: ephemeral public (32) | nonce | ciphertext.
+func wrap(to *ecdh.PublicKey, key, aad []byte) ([]byte, error) {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(to)
+	if err != nil {
+		return nil, err
+	}
+	epub := eph.PublicKey().Bytes()
+	kek := hkdf(shared, append(append([]byte{}, epub...), to.Bytes()...), "clipsync wrap")
+	ct, err := sealGCM(kek, key, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(epub, ct...), nil
+}
+
+func unwrap(priv *ecdh.PrivateKey, w, aad []byte) ([]byte, error) {
+	if len(w) < 32 {
+		return nil, errors.New("seal: wrapped key too short")
+	}
+	epub, err := ecdh.X25519().NewPublicKey(w[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(epub)
+	if err != nil {
+		return nil, err
+	}
+	kek := hkdf(shared, append(append([]byte{}, w[:32]...), priv.PublicKey().Bytes()...), "clipsync wrap")
+	return openGCM(kek, w[32:], aad)
+}
+
+/*──────── clips ───────────────────────────────────────────────*/
+
+// Sealer seals and opens clips for one room.  It knows every epoch it
+// was given a ring for and seals with the newest.
+type Sealer struct {
+	room string
+	keys map[int][]byte // content keys by epoch
+	cur  int
+}
+
+// NewSealer unwraps d's room key from each ring.  Rings d is not in are
+// skipped; at least one must work, and all must be for the same room.
+func NewSealer(d *Device, rings ...*Ring) (*Sealer, error) {
+	s := &Sealer{keys: make(map[int][]byte), cur: -1}
+	for _, r := range rings {
+		if s.room != "" && r.Room != s.room {
+			return nil, fmt.Errorf("seal: rings for rooms %q and %q", s.room, r.Room)
+		}
+		s.room = r.Room
+		key, err := r.Key(d)
+		if errors.Is(err, ErrNotMember) {
+			continue // an old epoch from before we joined
+		}
+		if err != nil {
+			return nil, fmt.Errorf("seal: epoch %d: %w", r.Epoch, err)
+		}
+		// per-room content key: the same room key never seals two rooms
+		s.keys[r.Epoch] = hkdf(key, nil, "clipsync content "+r.Room+" "+strconv.Itoa(r.Epoch))
+		s.cur = max(s.cur, r.Epoch)
+	}
+	if s.cur < 0 {
+		return nil, ErrNotMember
+	}
+	return s, nil
+}
+
+// Room is the room the rings are for.
+func (s *Sealer) Room() string { return s.room }
+
+// Epoch is the epoch new clips are sealed with.
+func (s *Sealer) Epoch() int { return s.cur }
+
+// Seal turns items into one opaque item.
+func (s *Sealer) Seal(items []core.Item) ([]core.Item, error) {
+	plain, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := sealGCM(s.keys[s.cur], plain, s.aad(s.cur))
+	if err != nil {
+		return nil, err
+	}
+	return []core.Item{{
+		MimeType: Mime,
+		FmtName:  "epoch " + strconv.Itoa(s.cur),
+		Payload:  base64.StdEncoding.EncodeToString(ct),
+		ByteLen:  len(ct),
+	}}, nil
+}
+
+// Open reverses Seal.  Unsealed clips are ErrNotSealed: a sealed room
+// takes nothing in the clear.
+func (s *Sealer) Open(items []core.Item) ([]core.Item, error) {
+	if len(items) != 1 || items[0].MimeType != Mime {
+		return nil, ErrNotSealed
+	}
+	epoch, err := strconv.Atoi(strings.TrimPrefix(items[0].FmtName, "epoch "))
+	if err != nil {
+		return nil, ErrNotSealed
+	}
+	key, ok := s.keys[epoch]
+	if !ok {
+		return nil, fmt.Errorf("%w (epoch %d)", ErrNoKey, epoch)
+	}
+	ct, err := base64.StdEncoding.DecodeString(items[0].Payload)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openGCM(key, ct, s.aad(epoch))
+	if err != nil {
+		return nil, err
+	}
+	var out []core.Item
+	return out, json.Unmarshal(plain, &out)
+}
+
+func (s *Sealer) aad(epoch int) []byte {
+	return []byte("clipsync clip " + s.room + " " + strconv.Itoa(epoch))
+}
+
+/*──────── primitives ──────────────────────────────────────────*/
+
+// hkdf is RFC 5869 HKDF-SHA256 for one 32-byte block.
+func hkdf(secret, salt []byte, info string) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	ext := hmac.New(sha256.New, salt)
+	ext.Write(secret)
+	exp := hmac.New(sha256.New, ext.Sum(nil))
+	exp.Write([]byte(info))
+	exp.Write([]byte{1})
+	return exp.Sum(nil)
+}
+
+// sealGCM is nonce | AES-256-GCM ciphertext.
+func sealGCM(key, plain, aad []byte) ([]byte, error) {
+	g, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, g.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return g.Seal(nonce, nonce, plain, aad), nil
+}
+
+func openGCM(key, ct, aad []byte) ([]byte, error) {
+	g, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ct) < g.NonceSize() {
+		return nil, errors.New("seal: ciphertext too short")
+	}
+	return g.Open(nil, ct[:g.NonceSize()], ct[g.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
@@ -0,0 +1,82 @@
+package seal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	core "clipsync/internal"
+)
+
+func devices(t *testing.T, names ...string) map[string]*Device {
+	dir := t.TempDir()
+	out := map[string]*Device{}
+	for _, n := range names {
+		d, err := LoadDevice(filepath.Join(dir, n, "device.key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[n] = d
+	}
+	return out
+}
+
+func TestLoadDeviceKeepsKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device.key")
+	a, err := LoadDevice(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadDevice(path)
+	if err != nil || a.Public() != b.Public() {
+		t.Fatalf("reload gave another key (%v)", err)
+	}
+}
+
+func TestRotationExcludesRemovedMember(t *testing.T) {
+	d := devices(t, "alice", "bob", "mallory")
+	items := []core.Item{core.TextItem([]byte("secret"))}
+
+	r1, err := NewRing("work", 1, []string{d["alice"].Public(), d["bob"].Public(), d["mallory"].Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, _ := NewRing("work", 2, []string{d["alice"].Public(), d["bob"].Public()})
+
+	alice, err := NewSealer(d["alice"], r1, r2)
+	if err != nil || alice.Epoch() != 2 {
+		t.Fatalf("alice: epoch %v, %v", alice, err)
+	}
+	bob, _ := NewSealer(d["bob"], r2)
+	mallory, err := NewSealer(d["mallory"], r1, r2)
+	if err != nil || mallory.Epoch() != 1 {
+		t.Fatalf("mallory should still hold epoch 1 only: %v", err)
+	}
+
+	sealed, err := alice.Seal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := bob.Open(sealed); err != nil || got[0] != items[0] {
+		t.Fatalf("bob: %+v, %v", got, err)
+	}
+	if _, err := mallory.Open(sealed); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("mallory opened epoch 2: %v", err)
+	}
+	if _, err := NewSealer(d["mallory"], r2); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("mallory unwrapped epoch 2: %v", err)
+	}
+
+	// old clips still open for members, tampering does not
+	old, _ := mallory.Seal(items)
+	if _, err := alice.Open(old); err != nil {
+		t.Fatalf("alice can't read epoch 1: %v", err)
+	}
+	old[0].FmtName = "epoch 2"
+	if _, err := alice.Open(old); err == nil {
+		t.Fatal("epoch swap accepted")
+	}
+	if _, err := bob.Open(items); !errors.Is(err, ErrNotSealed) {
+		t.Fatalf("plain clip accepted: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package secret guesses whether copied text is a credential: a private
+// key, a token with a known shape (JWT, cloud and forge tokens), or what
+// a password manager puts on the clipboard, a short run of characters
+// with no spaces and high entropy.  It is a heuristic for -secret-guard:
+// it misses secrets and flags the odd random-looking id, and says which
+// rule fired so a log line can explain itself without the secret in it.
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kinds Detect reports.
+const (
+	PrivateKey = "private key"
+	JWT        = "JWT"
+	Token      = "API token"
+	Password   = "password"
+)
+
+var (
+	pemKey = regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)
+	tokens = regexp.MustCompile(`^(` + strings.Join([]string{
+		`AKIA[0-9A-Z]{16}`,             // AWS access key id
+		`gh[pousr]_[A-Za-z0-9]{36,}`,   // GitHub
+		`github_pat_[A-Za-z0-9_]{60,}`, // GitHub fine-grained
+		`glpat-[A-Za-z0-9_-]{20,}`,     // GitLab
+		`xox[abprs]-[A-Za-z0-9-]{10,}`, // Slack
+		`sk-[A-Za-z0-9_-]{20,}`,        // OpenAI and alike
+		`sk_live_[A-Za-z0-9]{20,}`,     // Stripe
+		`AIza[0-9A-Za-z_-]{35}`,        // Google API key
+		`[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}:[A-Za-z0-9_-]{16,}`, // id:secret pairs
+	}, "|") + `)$`)
+)
+
+// Detect reports what kind of secret text looks like, if any.
+func Detect(text []byte) (string, bool) {
+	if pemKey.Match(text) {
+		return PrivateKey, true
+	}
+	s := strings.TrimSpace(string(text))
+	if s == "" || strings.ContainsAny(s, " \t\r\n") || !utf8.ValidString(s) {
+		return "", false // secrets of the other kinds are one word
+	}
+	switch {
+	case isJWT(s):
+		return JWT, true
+	case tokens.MatchString(s):
+		return Token, true
+	case isPassword(s):
+		return Password, true
+	}
+	return "", false
+}
+
+// isJWT is three base64url parts whose first is a JSON header naming
+// an algorithm.
+func isJWT(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || !strings.HasPrefix(s, "eyJ") {
+		return false
+	}
+	head, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(head, &h) == nil && h.Alg != ""
+}
+
+// isPassword is the shape of a generated password: 12 to 64 printable
+// characters of at least three classes (lower, upper, digit, symbol),
+// high entropy, and a change of class between at least every other pair
+// of neighbours, which words, identifiers ("ParseHTTPHeader2") and
+// numbers don't have.  URLs, paths and e-mail addresses are excluded:
+// they pass the rest too easily.
+func isPassword(s string) bool {
+	if n := len(s); n < 12 || n > 64 || strings.Contains(s, "://") ||
+		strings.HasPrefix(s, "/") || strings.Count(s, "@") == 1 && strings.Contains(s, ".") {
+		return false
+	}
+	var seen [4]bool
+	n, switches, prev := 0, 0, -1
+	for _, r := range s {
+		c := 0
+		switch {
+		case unicode.IsLower(r):
+		case unicode.IsUpper(r):
+			c = 1
+		case unicode.IsDigit(r):
+			c = 2
+		case unicode.IsPrint(r):
+			c = 3
+		default:
+			return false
+		}
+		if prev >= 0 && c != prev {
+			switches++
+		}
+		seen[c], prev = true, c
+		n++
+	}
+	classes := 0
+	for _, c := range seen {
+		if c {
+			classes++
+		}
+	}
+	return classes >= 3 && 2*switches >= n && entropy(s) >= 3.5
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Redact is a preview of text that gives nothing away: its first four
+// characters (none for a private key, whose header says enough) and its
+// length, e.g. "eyJh… (212 chars)".
+func Redact(text []byte) string {
+	text = bytes.TrimSpace(text)
+	n := utf8.RuneCount(text)
+	if kind, _ := Detect(text); kind == PrivateKey || n < 8 {
+		return fmt.Sprintf("… (%d chars)", n)
+	}
+	head := []rune(string(text))[:4]
+	return fmt.Sprintf("%s… (%d chars)", string(head), n)
+}
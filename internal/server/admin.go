@@ -0,0 +1,237 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*──────── admin API (WithAdmin) ───────────────────────────────*/
+// Under /admin/, for whoever runs the relay rather than its clients:
+//
+//	GET    /admin/devices              every device seen in ActivityTTL
+//	POST   /admin/revoke?device=<id>   refuse the device with 403
+//	DELETE /admin/revoke?device=<id>   let it back in
+//	POST   /admin/purge[?room=<name>]  flush one room's snapshot, or all
+//	GET    /admin/tokens               the device tokens issued
+//	POST   /admin/tokens?name=<name>   issue one (see tokens.go)
+//	DELETE /admin/tokens?name=<name>   withdraw it
+//
+// Requests carry "Authorization: Bearer <token>".  Without WithAdmin
+// the whole tree is 404.
+
+// ActivityTTL is how long the admin API remembers a device after its
+// last request.
+const ActivityTTL = 24 * time.Hour
+
+const nsRevoked = "revoked"
+
+// WithAdmin serves the admin API to requests bearing token (default:
+// no admin API).
+func WithAdmin(token string) Option { return func(s *Server) { s.admin = token } }
+
+// activity is what the admin API knows of one device.
+type activity struct {
+	room     string
+	first    time.Time
+	last     time.Time
+	requests int64
+}
+
+// DeviceInfo is one entry of GET /admin/devices.
+type DeviceInfo struct {
+	ID       string    `json:"id"`
+	Room     string    `json:"room"`              // of its latest request
+	First    time.Time `json:"first"`             // since it was last unseen for ActivityTTL
+	Last     time.Time `json:"last"`              // latest request
+	Requests int64     `json:"requests"`          // since First
+	Active   bool      `json:"active"`            // within DeviceTTL
+	Revoked  bool      `json:"revoked,omitempty"` // refused by POST /admin/revoke
+}
+
+// seen records a request from dev in room.  s.mu must be held.
+func (s *Server) seen(dev, room string, now time.Time) {
+	a := s.activity[dev]
+	if a == nil {
+		a = &activity{first: now}
+		s.activity[dev] = a
+	}
+	a.room, a.last = room, now
+	a.requests++
+}
+
+// DeviceList is every device the server heard from in ActivityTTL, and
+// every revoked one, by id.
+func (s *Server) DeviceList() []DeviceInfo {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]DeviceInfo, 0, len(s.activity))
+	for id, a := range s.activity {
+		if now.Sub(a.last) > ActivityTTL {
+			delete(s.activity, id)
+			continue
+		}
+		out = append(out, DeviceInfo{ID: id, Room: a.room, First: a.first, Last: a.last, Requests: a.requests,
+			Active: now.Sub(a.last) <= DeviceTTL, Revoked: s.revoked[id]})
+	}
+	for id := range s.revoked {
+		if s.activity[id] == nil {
+			out = append(out, DeviceInfo{ID: id, Revoked: true})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Revoke refuses dev's requests from now on, or with on false lets it
+// back in.  With WithStorage this survives a restart.  Device ids are
+// chosen by clients: a revoked device that holds the key can come back
+// under another, so for a lost or stolen one rotate the key as well.
+func (s *Server) Revoke(dev string, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if on {
+		s.revoked[dev] = true
+		for _, rm := range s.rooms {
+			delete(rm.devices, dev)
+		}
+	} else {
+		delete(s.revoked, dev)
+	}
+	if s.st == nil {
+		return
+	}
+	var err error
+	if on {
+		err = s.st.Put(nsRevoked, hex.EncodeToString([]byte(dev)), []byte(dev))
+	} else {
+		err = s.st.Delete(nsRevoked, hex.EncodeToString([]byte(dev)))
+	}
+	if err != nil {
+		s.logf("%s storage: %v", stamp(), err)
+	}
+}
+
+// isRevoked reports whether dev was revoked.
+func (s *Server) isRevoked(dev string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revoked[dev]
+}
+
+// Purge flushes the snapshot of room, or of every room if room is
+// empty, from memory and storage, and reports how many went.
+func (s *Server) Purge(room string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for name, rm := range s.rooms {
+		if (room != "" && name != room) || rm.cid == "" {
+			continue
+		}
+		rm.cid, rm.total, rm.parts, rm.inline = "", 0, nil, nil
+		rm.sums, rm.sum = nil, ""
+		s.drop(name, false)
+		n++
+	}
+	return n
+}
+
+// loadRevoked reads the revoked devices back from storage.
+func (s *Server) loadRevoked() error {
+	keys, err := s.st.List(nsRevoked)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if dev, err := s.st.Get(nsRevoked, k); err == nil {
+			s.revoked[string(dev)] = true
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if s.admin == "" {
+		http.NotFound(w, r)
+		return
+	}
+	tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(tok), []byte(s.admin)) != 1 {
+		http.Error(w, "bad admin token", http.StatusUnauthorized)
+		return
+	}
+	switch path := strings.TrimPrefix(r.URL.Path, "/admin/"); {
+	case path == "devices" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Devices []DeviceInfo `json:"devices"`
+		}{s.DeviceList()})
+
+	case path == "revoke" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		dev := r.URL.Query().Get("device")
+		if dev == "" {
+			http.Error(w, "revoke needs ?device=", http.StatusBadRequest)
+			return
+		}
+		on := r.Method == http.MethodPost
+		s.Revoke(dev, on)
+		if on {
+			s.logf("%s admin: revoked %s", stamp(), dev)
+		} else {
+			s.logf("%s admin: let %s back in", stamp(), dev)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case path == "purge" && r.Method == http.MethodPost:
+		room := r.URL.Query().Get("room")
+		n := s.Purge(room)
+		if room == "" {
+			room = "all rooms"
+		}
+		s.logf("%s admin: purged %d snapshot(s) from %s", stamp(), n, room)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Purged int `json:"purged"`
+		}{n})
+
+	case path == "tokens" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Tokens []TokenInfo `json:"tokens"`
+		}{s.Tokens()})
+
+	case path == "tokens" && r.Method == http.MethodPost:
+		tok, err := s.IssueToken(r.URL.Query().Get("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logf("%s admin: issued a device token to %s", stamp(), tok.Name)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Name  string `json:"name"`
+			Token string `json:"token"`
+		}{tok.Name, tok.String()})
+
+	case path == "tokens" && r.Method == http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if !s.WithdrawToken(name) {
+			http.Error(w, "no token named "+strconv.Quote(name), http.StatusNotFound)
+			return
+		}
+		s.logf("%s admin: withdrew %s's device token", stamp(), name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case path == "devices" || path == "revoke" || path == "purge" || path == "tokens":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
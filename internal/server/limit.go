@@ -0,0 +1,182 @@
+package server
+
+import (
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"clipsync/internal/pki"
+)
+
+/*──────── per-device limits (WithLimits) ─────────────────────*/
+// Every device gets two token buckets, one counting requests and one
+// bytes in and out, so a client stuck in a loop, or someone holding a
+// leaked key, can't crowd out the rest or run up the host's traffic
+// bill.  Devices are told apart by X-Device-Id, which the key holder
+// chooses: this bounds each client, not the key as a whole.
+
+// Limits caps what one device may ask of the server.  Zero fields are
+// unlimited.
+type Limits struct {
+	Requests float64 // sustained requests per second
+	Burst    int     // requests allowed back to back above that (default: 2s worth)
+	Bytes    int64   // sustained bytes per second, request bodies plus responses
+}
+
+// byteBurst is how many seconds of Bytes a device may spend at once.
+// At least one full chunk always fits, whatever Bytes is.
+const byteBurst = 4
+
+// WithLimits refuses a device's requests with 429 Too Many Requests
+// while it is over l (default: no limits).
+func WithLimits(l Limits) Option {
+	return func(s *Server) {
+		if l.Requests > 0 || l.Bytes > 0 {
+			s.limits = newLimiter(l)
+		}
+	}
+}
+
+type limiter struct {
+	l Limits
+
+	mu    sync.Mutex
+	devs  map[string]*bucket
+	swept time.Time
+}
+
+// bucket is one device's allowance.  bytes may go negative: a response
+// is charged after it is written, and the debt is paid off before the
+// device's next request.
+type bucket struct {
+	reqs, bytes float64
+	last        time.Time
+	limited     bool // refused since the last request let through
+}
+
+func newLimiter(l Limits) *limiter {
+	if l.Requests > 0 && l.Burst <= 0 {
+		l.Burst = max(1, int(2*l.Requests))
+	}
+	return &limiter{l: l, devs: make(map[string]*bucket)}
+}
+
+func (lm *limiter) byteCap() float64 {
+	return max(float64(lm.l.Bytes)*byteBurst, ChunkMax)
+}
+
+// allow takes a request from dev's allowance.  If there is none left it
+// says how long until there is, and whether this is the first refusal
+// in a row.
+func (lm *limiter) allow(dev string, now time.Time) (wait time.Duration, first bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if now.Sub(lm.swept) > SweepEvery {
+		for d, b := range lm.devs {
+			if lm.refill(b, now); lm.full(b) {
+				delete(lm.devs, d)
+			}
+		}
+		lm.swept = now
+	}
+	b := lm.devs[dev]
+	if b == nil {
+		b = &bucket{reqs: float64(lm.l.Burst), bytes: lm.byteCap(), last: now}
+		lm.devs[dev] = b
+	}
+	lm.refill(b, now)
+	if lm.l.Requests > 0 && b.reqs < 1 {
+		wait = time.Duration((1 - b.reqs) / lm.l.Requests * float64(time.Second))
+	}
+	if lm.l.Bytes > 0 && b.bytes < 0 {
+		wait = max(wait, time.Duration(-b.bytes/float64(lm.l.Bytes)*float64(time.Second)))
+	}
+	if wait > 0 {
+		first, b.limited = !b.limited, true
+		return wait, first
+	}
+	if lm.l.Requests > 0 {
+		b.reqs--
+	}
+	b.limited = false
+	return 0, false
+}
+
+// spend charges n bytes to dev.
+func (lm *limiter) spend(dev string, n int64) {
+	if lm.l.Bytes <= 0 || n == 0 {
+		return
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if b := lm.devs[dev]; b != nil {
+		b.bytes -= float64(n)
+	}
+}
+
+func (lm *limiter) refill(b *bucket, now time.Time) {
+	dt := now.Sub(b.last).Seconds()
+	if dt <= 0 {
+		return
+	}
+	b.last = now
+	b.reqs = math.Min(b.reqs+dt*lm.l.Requests, float64(lm.l.Burst))
+	b.bytes = math.Min(b.bytes+dt*float64(lm.l.Bytes), lm.byteCap())
+}
+
+func (lm *limiter) full(b *bucket) bool {
+	return b.reqs >= float64(lm.l.Burst) && b.bytes >= lm.byteCap()
+}
+
+// limitKey is who a request is charged to: its device token or client
+// certificate, which can't be made up, else its device, else its
+// address.
+func limitKey(r *http.Request, dev, tokName string) string {
+	if tokName != "" {
+		return "token " + tokName
+	}
+	if name := pki.PeerName(r.TLS); name != "" {
+		return "cert " + name
+	}
+	if dev != "" {
+		return dev
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter is wait in whole seconds, as Retry-After wants it.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// countingWriter tallies the response bytes written through it.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// countingReader tallies the request body bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"clipsync/internal/store"
+)
+
+/*──────── state that survives a restart (WithStorage) ────────*/
+// Each room's snapshot, finished or half uploaded, is written through
+// to a store.Storage: its metadata under "rooms", its chunks under
+// "parts".  Receipts and presence last seconds and stay in memory.
+
+const (
+	nsRooms = "rooms"
+	nsParts = "parts"
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithStorage keeps the rooms' snapshots in st, so a restarted server
+// carries on with the clip and the uploads under way (default: memory
+// only).
+func WithStorage(st store.Storage) Option { return func(s *Server) { s.st = st } }
+
+type savedRoom struct {
+	Room    string         `json:"room"`
+	Cid     string         `json:"cid"`
+	Total   int            `json:"total"`
+	Started time.Time      `json:"started"`
+	Inline  bool           `json:"inline,omitempty"`
+	Sums    map[int]string `json:"sums,omitempty"`
+	Sum     string         `json:"sum,omitempty"`
+}
+
+// roomKey is a room name as a storage key: any name, no separators.
+func roomKey(name string) string { return "r" + hex.EncodeToString([]byte(name)) }
+
+func partKey(name string, idx int) string { return roomKey(name) + "-" + strconv.Itoa(idx) }
+
+// load brings back the snapshots st holds, dropping those past SnapTTL.
+func (s *Server) load(now time.Time) error {
+	keys, err := s.st.List(nsRooms)
+	if err != nil {
+		return err
+	}
+	parts, err := s.st.List(nsParts)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		b, err := s.st.Get(nsRooms, k)
+		var sr savedRoom
+		if err != nil || json.Unmarshal(b, &sr) != nil || roomKey(sr.Room) != k || now.Sub(sr.Started) > SnapTTL {
+			s.st.Delete(nsRooms, k)
+			continue
+		}
+		rm := &room{cid: sr.Cid, total: sr.Total, started: sr.Started, sums: sr.Sums, sum: sr.Sum,
+			parts: make(map[int][]byte)}
+		for _, pk := range parts {
+			idx, err := strconv.Atoi(strings.TrimPrefix(pk, k+"-"))
+			if !strings.HasPrefix(pk, k+"-") || err != nil {
+				continue
+			}
+			if p, err := s.st.Get(nsParts, pk); err == nil {
+				rm.parts[idx] = p
+			}
+		}
+		if sr.Inline {
+			rm.inline = rm.parts[0]
+		}
+		s.rooms[sr.Room] = rm
+	}
+	// chunks whose room is gone
+	for _, pk := range parts {
+		if k, _, _ := strings.Cut(pk, "-"); !slices.Contains(keys, k) {
+			s.st.Delete(nsParts, pk)
+		}
+	}
+	return nil
+}
+
+// save writes name's metadata, and chunk idx (-1: none).  s.mu must be
+// held.
+func (s *Server) save(name string, rm *room, idx int) {
+	if s.st == nil {
+		return
+	}
+	if idx >= 0 {
+		if err := s.st.Put(nsParts, partKey(name, idx), rm.parts[idx]); err != nil {
+			s.logf("%s storage: %v", stamp(), err)
+		}
+	}
+	b, _ := json.Marshal(savedRoom{Room: name, Cid: rm.cid, Total: rm.total, Started: rm.started,
+		Inline: rm.inline != nil, Sums: rm.sums, Sum: rm.sum})
+	if err := s.st.Put(nsRooms, roomKey(name), b); err != nil {
+		s.logf("%s storage: %v", stamp(), err)
+	}
+}
+
+// drop deletes name's snapshot, or only its chunks with keepMeta (a new
+// cid is about to replace them).  s.mu must be held.
+func (s *Server) drop(name string, keepMeta bool) {
+	if s.st == nil {
+		return
+	}
+	parts, err := s.st.List(nsParts)
+	if err != nil {
+		s.logf("%s storage: %v", stamp(), err)
+	}
+	prefix := roomKey(name) + "-"
+	for _, pk := range parts {
+		if strings.HasPrefix(pk, prefix) {
+			s.st.Delete(nsParts, pk)
+		}
+	}
+	if !keepMeta {
+		s.st.Delete(nsRooms, roomKey(name))
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// WithRequireNonce refuses auth tokens without a nonce, which can't be
+// told apart from a replay; only clients too old to send one need them.
+func WithRequireNonce() Option { return func(s *Server) { s.needNonce = true } }
+
+// replayWindow is how far out of order a nonce's counters may arrive:
+// upload workers and the poll loop share one counter, so requests
+// overtake each other.
+const replayWindow = 64
+
+// Replays remembers the auth token counters seen per nonce, so a token
+// captured off the wire is refused if sent again while its timestamp is
+// still fresh.  Safe for concurrent use.
+type Replays struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]*counters
+	swept time.Time
+}
+
+// counters is one nonce's highest counter, and which of the
+// replayWindow below it were seen.
+type counters struct {
+	top  uint64
+	bits uint64 // bit i: top-i seen
+	last time.Time
+}
+
+// NewReplays forgets a nonce ttl after its last token; ttl must cover
+// how long a token stays fresh (twice the allowed clock skew).
+func NewReplays(ttl time.Duration) *Replays {
+	return &Replays{ttl: ttl, seen: make(map[string]*counters)}
+}
+
+// Fresh reports whether counter n of nonce is new, and records it.
+// Counters more than replayWindow below the highest seen are refused.
+func (r *Replays) Fresh(nonce string, n uint64, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.swept) > r.ttl {
+		for k, c := range r.seen {
+			if now.Sub(c.last) > r.ttl {
+				delete(r.seen, k)
+			}
+		}
+		r.swept = now
+	}
+	c := r.seen[nonce]
+	if c == nil {
+		r.seen[nonce] = &counters{top: n, bits: 1, last: now}
+		return true
+	}
+	switch d := c.top - n; {
+	case n > c.top:
+		if shift := n - c.top; shift < replayWindow {
+			c.bits = c.bits<<shift | 1
+		} else {
+			c.bits = 1
+		}
+		c.top = n
+	case d >= replayWindow || c.bits&(1<<d) != 0:
+		return false
+	default:
+		c.bits |= 1 << d
+	}
+	c.last = now
+	return true
+}
@@ -0,0 +1,477 @@
+// Package server is an in-process relay speaking the HTTP poll protocol
+// of internal/net/server_design.md: chunked and inline snapshots,
+// ranged fetches, delivery receipts and server time, one active
+// snapshot per room, plus WebSocket fan-out (ws.go).  It backs `clipsync demo`, tests and
+// cmd/clipsyncd, the self-hosted relay; with WithStorage its snapshots
+// survive a restart.  Out-of-band blobs are not
+// supported, so snapshots over the body cap fail to send.
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	netw "clipsync/internal/net"
+	"clipsync/internal/store"
+)
+
+// Limits from the protocol; see server_design.md §4.
+const (
+	ChunkMax = 300 * 1024       // largest POST body
+	BodyMax  = 32 * 1024 * 1024 // largest snapshot, advertised as max_body
+	SnapTTL  = 120 * time.Second
+	AckTTL   = 30 * time.Second
+	MaxSkew  = 5 * time.Minute // auth token freshness
+
+	// DeviceTTL is how long a device counts as active after its last
+	// request; pollers ask several times a second, idle WS-less
+	// clients at least every few seconds.
+	DeviceTTL = 60 * time.Second
+	// SweepEvery is how often rooms nobody asks about are expired.
+	SweepEvery = time.Minute
+)
+
+// Server relays snapshots between the clients of one shared key.
+type Server struct {
+	key     string
+	log     *log.Logger
+	replays *Replays
+	st      store.Storage // nil = memory only
+	limits  *limiter      // nil = unlimited
+	admin   string        // bearer token for /admin/; "" = no admin API
+
+	needTokens bool           // WithDeviceTokens
+	needNonce  bool           // WithRequireNonce
+	noise      *netw.NoiseKey // WithNoise; nil = plain WS only
+
+	mu       sync.Mutex
+	rooms    map[string]*room
+	swept    time.Time
+	activity map[string]*activity // by device, for the admin API
+	revoked  map[string]bool
+	tokens   map[string]*issued          // device tokens, by name
+	ws       map[string]map[*wsPeer]bool // WS clients, by room
+}
+
+// room is what discover shows the members of one room.
+type room struct {
+	cid     string
+	total   int
+	parts   map[int][]byte
+	sums    map[int]string  // X-Chunk-SHA256 per chunk, relayed as is
+	sum     string          // X-Body-SHA256
+	inline  json.RawMessage // the snapshot, if it came in one request
+	started time.Time
+	acks    []ack
+	devices map[string]time.Time // X-Device-Id → last request
+}
+
+type ack struct {
+	at  time.Time
+	raw json.RawMessage
+}
+
+// New serves clients using keyHex (16 hex chars, like -key).  logger,
+// if not nil, hears about every snapshot and receipt relayed.
+func New(keyHex string, logger *log.Logger, opts ...Option) (*Server, error) {
+	if _, err := netw.AuthToken(keyHex, 0); err != nil {
+		return nil, err
+	}
+	s := &Server{key: keyHex, log: logger, replays: NewReplays(2 * MaxSkew),
+		rooms: make(map[string]*room), activity: make(map[string]*activity), revoked: make(map[string]bool),
+		tokens: make(map[string]*issued), ws: make(map[string]map[*wsPeer]bool)}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.st != nil {
+		if err := s.load(time.Now()); err != nil {
+			return nil, fmt.Errorf("server: storage: %w", err)
+		}
+		if err := s.loadRevoked(); err != nil {
+			return nil, fmt.Errorf("server: storage: %w", err)
+		}
+		if err := s.loadTokens(); err != nil {
+			return nil, fmt.Errorf("server: storage: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Server) logf(format string, a ...any) {
+	if s.log != nil {
+		s.log.Printf(format, a...)
+	}
+}
+
+// ServeHTTP answers the health ping on /, the admin API under /admin/
+// and the protocol on any other path, so clients may be pointed at
+// /clip or anything else.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		s.serveAdmin(w, r)
+		return
+	}
+	t, ok := s.authorized(r.Header.Get("X-Auth-Token"))
+	if !ok {
+		http.Error(w, "bad auth token", http.StatusUnauthorized)
+		return
+	}
+	name, dev := r.Header.Get("X-Room"), r.Header.Get("X-Device-Id")
+	tokName, ok := s.deviceAuthorized(r.Header.Get("X-Device-Auth"), t, dev)
+	if !ok {
+		http.Error(w, "bad or missing device token", http.StatusUnauthorized)
+		return
+	}
+	if dev != "" && s.isRevoked(dev) {
+		http.Error(w, "device revoked", http.StatusForbidden)
+		return
+	}
+	who := ""
+	if s.limits != nil {
+		who = limitKey(r, dev, tokName)
+		if wait, first := s.limits.allow(who, time.Now()); wait > 0 {
+			if first {
+				s.logf("%s %s over its limits, refused for %v", stamp(), who, wait.Round(time.Millisecond))
+			}
+			w.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+	}
+	if isUpgrade(r) {
+		s.serveWS(w, r, name, dev, who)
+		return
+	}
+	if s.limits != nil {
+		cw, cr := &countingWriter{ResponseWriter: w}, &countingReader{ReadCloser: r.Body}
+		w, r.Body = cw, cr
+		defer func() { s.limits.spend(who, cw.n+cr.n) }()
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.post(w, r, name, dev)
+	case http.MethodGet, http.MethodHead:
+		s.get(w, r, name, dev)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authToken is what an X-Auth-Token carries.
+type authToken struct {
+	TS    int64  `json:"ts"`
+	Nonce string `json:"nonce"`
+	N     uint64 `json:"n"`
+}
+
+// authorized checks the token against the key and the clock, and one
+// carrying a nonce against the tokens seen before.  Tokens without one,
+// from older clients, can't be told apart from a replay and pass,
+// unless WithRequireNonce.
+func (s *Server) authorized(tok string) (authToken, bool) {
+	var t authToken
+	raw, err := base64.StdEncoding.DecodeString(tok)
+	if err != nil {
+		return t, false
+	}
+	if json.Unmarshal(raw, &t) != nil {
+		return t, false
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(t.TS, 0)); d > MaxSkew || d < -MaxSkew {
+		return t, false
+	}
+	if want, _ := netw.AuthTokenNonce(s.key, t.TS, t.Nonce, t.N); tok != want {
+		return t, false
+	}
+	if t.Nonce == "" {
+		return t, !s.needNonce
+	}
+	return t, s.replays.Fresh(t.Nonce, t.N, now)
+}
+
+// room returns name's state with dev (if any) marked active, after
+// expiring it.  Every SweepEvery the other rooms are expired too, and
+// dropped once nothing is left in them.  s.mu must be held.
+func (s *Server) room(name, dev string, now time.Time) *room {
+	if now.Sub(s.swept) > SweepEvery {
+		for n, rm := range s.rooms {
+			flushed, empty := rm.expire(now)
+			if flushed {
+				s.drop(n, false)
+			}
+			if empty {
+				delete(s.rooms, n)
+			}
+		}
+		for d, a := range s.activity {
+			if now.Sub(a.last) > ActivityTTL {
+				delete(s.activity, d)
+			}
+		}
+		s.swept = now
+	}
+	rm := s.rooms[name]
+	if rm == nil {
+		rm = &room{}
+		s.rooms[name] = rm
+	}
+	if flushed, _ := rm.expire(now); flushed {
+		s.drop(name, false)
+	}
+	if dev != "" {
+		if rm.devices == nil {
+			rm.devices = make(map[string]time.Time)
+		}
+		rm.devices[dev] = now
+		s.seen(dev, name, now)
+	}
+	return rm
+}
+
+// expire flushes a snapshot past SnapTTL, complete or not, receipts
+// past AckTTL and devices past DeviceTTL.  It reports whether the
+// snapshot went, and whether nothing is left.
+func (rm *room) expire(now time.Time) (flushed, empty bool) {
+	if rm.cid != "" && now.Sub(rm.started) > SnapTTL {
+		rm.cid, rm.total, rm.parts, rm.inline = "", 0, nil, nil
+		rm.sums, rm.sum = nil, ""
+		flushed = true
+	}
+	keep := rm.acks[:0]
+	for _, a := range rm.acks {
+		if now.Sub(a.at) <= AckTTL {
+			keep = append(keep, a)
+		}
+	}
+	rm.acks = keep
+	for d, at := range rm.devices {
+		if now.Sub(at) > DeviceTTL {
+			delete(rm.devices, d)
+		}
+	}
+	return flushed, rm.cid == "" && len(rm.acks) == 0 && len(rm.devices) == 0
+}
+
+// Devices lists the devices active in room, by id.
+func (s *Server) Devices(room string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm := s.rooms[room]
+	if rm == nil {
+		return nil
+	}
+	if flushed, _ := rm.expire(time.Now()); flushed {
+		s.drop(room, false)
+	}
+	out := make([]string, 0, len(rm.devices))
+	for d := range rm.devices {
+		out = append(out, d)
+	}
+	sort.Strings(out)
+	return out
+}
+
+/*──────── uploads ─────────────────────────────────────────────*/
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request, name, dev string) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, ChunkMax+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > ChunkMax {
+		http.Error(w, "chunk over 300 KiB", http.StatusRequestEntityTooLarge)
+		return
+	}
+	cid := r.Header.Get("X-Chunk-Id")
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm := s.room(name, dev, now)
+	switch {
+	case r.Header.Get("X-Ack") == "1":
+		var snap struct{ Kind string }
+		if json.Unmarshal(body, &snap) != nil {
+			http.Error(w, "ack is not JSON", http.StatusBadRequest)
+			return
+		}
+		rm.acks = append(rm.acks, ack{now, body})
+		s.logf("%s %s from %s", stamp(), snap.Kind, dev)
+
+	case r.Header.Get("X-Inline") == "1":
+		if cid == "" || !json.Valid(body) {
+			http.Error(w, "inline snapshot needs X-Chunk-Id and a JSON body", http.StatusBadRequest)
+			return
+		}
+		s.drop(name, true)
+		rm.cid, rm.total, rm.started = cid, 1, now
+		rm.parts, rm.inline = map[int][]byte{0: body}, body
+		rm.sums, rm.sum = nil, ""
+		s.save(name, rm, 0)
+		s.logf("%s clip %s from %s: inline, %d bytes", stamp(), cid, dev, len(body))
+
+	default:
+		idx, err1 := strconv.Atoi(r.Header.Get("X-Chunk-Idx"))
+		total, err2 := strconv.Atoi(r.Header.Get("X-Chunk-Total"))
+		if cid == "" || err1 != nil || err2 != nil || idx < 0 || total < 0 || (total > 0 && idx >= total) {
+			http.Error(w, "bad chunk headers", http.StatusBadRequest)
+			return
+		}
+		sum := r.Header.Get("X-Chunk-SHA256")
+		if h := sha256.Sum256(body); sum != "" && !strings.EqualFold(sum, hex.EncodeToString(h[:])) {
+			http.Error(w, "chunk doesn't match X-Chunk-SHA256", http.StatusBadRequest)
+			return
+		}
+		if cid != rm.cid {
+			s.drop(name, true)
+			rm.cid, rm.total, rm.started = cid, total, now
+			rm.parts, rm.inline = make(map[int][]byte), nil
+			rm.sums, rm.sum = make(map[int]string), ""
+		}
+		if rm.total != 0 && total != 0 && total != rm.total {
+			http.Error(w, "X-Chunk-Total changed within snapshot", http.StatusBadRequest)
+			return
+		}
+		if rm.total == 0 {
+			rm.total = total
+		}
+		rm.parts[idx] = body
+		if sum != "" {
+			rm.sums[idx] = strings.ToLower(sum)
+		}
+		if b := r.Header.Get("X-Body-SHA256"); b != "" {
+			rm.sum = strings.ToLower(b)
+		}
+		s.save(name, rm, idx)
+		if len(rm.parts) == rm.total {
+			s.logf("%s clip %s from %s: %d chunks complete", stamp(), cid, dev, rm.total)
+		}
+	}
+}
+
+/*──────── discover and fetch ──────────────────────────────────*/
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, name, dev string) {
+	cid := r.Header.Get("X-Chunk-Id")
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm := s.room(name, dev, now)
+
+	switch {
+	case cid != "" && r.Header.Get("X-Chunk-Range") != "":
+		lo, hi, ok := parseRange(r.Header.Get("X-Chunk-Range"))
+		switch {
+		case !ok:
+			http.Error(w, "bad X-Chunk-Range", http.StatusBadRequest)
+		case cid != rm.cid:
+			http.Error(w, "snapshot flushed", http.StatusGone)
+		default:
+			w.Header().Set("X-Chunk-Range", r.Header.Get("X-Chunk-Range"))
+			var hdr [8]byte
+			for idx := lo; idx <= hi && idx < rm.total; idx++ {
+				p, ok := rm.parts[idx]
+				if !ok {
+					continue
+				}
+				binary.BigEndian.PutUint32(hdr[:4], uint32(idx))
+				binary.BigEndian.PutUint32(hdr[4:], uint32(len(p)))
+				w.Write(hdr[:])
+				w.Write(p)
+			}
+		}
+
+	case cid != "" && r.Header.Get("X-Chunk-Idx") != "":
+		idx, _ := strconv.Atoi(r.Header.Get("X-Chunk-Idx"))
+		p, ok := rm.parts[idx]
+		switch {
+		case cid != rm.cid:
+			http.Error(w, "snapshot flushed", http.StatusGone)
+		case !ok:
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(p)
+		}
+
+	default:
+		meta := struct {
+			Cid      string            `json:"cid,omitempty"`
+			Total    int               `json:"total"`
+			Have     []int             `json:"have"`
+			Snap     json.RawMessage   `json:"snap,omitempty"`
+			Acks     []json.RawMessage `json:"acks,omitempty"`
+			MaxBody  int64             `json:"max_body"`
+			MaxChunk int64             `json:"max_chunk"`
+			Sums     map[int]string    `json:"sums,omitempty"`
+			SHA256   string            `json:"sha256,omitempty"`
+			Devices  []netw.Device     `json:"devices"`
+		}{Cid: rm.cid, Total: rm.total, Have: []int{}, Snap: rm.inline, MaxBody: BodyMax, MaxChunk: ChunkMax,
+			Sums: rm.sums, SHA256: rm.sum, Devices: []netw.Device{}}
+		for idx := range rm.parts {
+			meta.Have = append(meta.Have, idx)
+		}
+		sort.Ints(meta.Have)
+		for d, at := range rm.devices {
+			meta.Devices = append(meta.Devices, netw.Device{ID: d, Seen: at.UnixMilli()})
+		}
+		sort.Slice(meta.Devices, func(i, j int) bool { return meta.Devices[i].ID < meta.Devices[j].ID })
+		for _, a := range rm.acks {
+			meta.Acks = append(meta.Acks, a.raw)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Server-Time", strconv.FormatInt(now.UnixMilli(), 10))
+		if st, ok := netw.ParseNetStats(r.Header.Get("X-Net-Stats")); ok {
+			w.Header().Set("X-Hints", Advise(st).String())
+		}
+		json.NewEncoder(w).Encode(&meta)
+	}
+}
+
+// Advise turns a client's X-Net-Stats into X-Hints.  Lossy paths get
+// small chunks, so a lost request costs little to resend, and a slower
+// poll; slow links get gzip, fast ones skip the CPU.
+func Advise(st netw.NetStats) netw.Hints {
+	h := netw.Hints{Chunk: ChunkMax, Poll: 200 * time.Millisecond, Gzip: -1}
+	switch {
+	case st.Loss >= 0.05:
+		h.Chunk, h.Poll = 64*1024, time.Second
+	case st.Loss >= 0.01:
+		h.Chunk, h.Poll = 128*1024, 500*time.Millisecond
+	}
+	if st.RTT > 500*time.Millisecond {
+		h.Poll = max(h.Poll, time.Second) // each discover costs a round trip anyway
+	}
+	if (st.Kbps > 0 && st.Kbps < 5000) || st.RTT > 300*time.Millisecond {
+		h.Gzip = 1
+	}
+	return h
+}
+
+// parseRange reads "lo-hi", inclusive.
+func parseRange(v string) (lo, hi int, ok bool) {
+	a, b, found := strings.Cut(v, "-")
+	lo, err1 := strconv.Atoi(a)
+	hi, err2 := strconv.Atoi(b)
+	return lo, hi, found && err1 == nil && err2 == nil && lo >= 0 && hi >= lo
+}
+
+func stamp() string { return time.Now().Format("15:04:05.000") }
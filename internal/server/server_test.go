@@ -0,0 +1,559 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+	netw "clipsync/internal/net"
+	"clipsync/internal/store"
+)
+
+const key = "0123456789abcdef"
+
+// relay runs a server with a sending client a and a polling client b.
+func relay(t *testing.T, room string) (a netw.Client, gotB chan core.Snapshot) {
+	srv, err := New(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := func(id string) (netw.Client, chan core.Snapshot) {
+		c, err := netw.NewHTTP(hs.URL+"/clip", id, key, netw.WithRoom(room))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(chan core.Snapshot, 16)
+		go c.Poll(ctx, got)
+		return c, got
+	}
+	a, _ = client("aaaaaaaa")
+	_, gotB = client("bbbbbbbb")
+	return
+}
+
+func TestDevicePresence(t *testing.T) {
+	srv, _ := New(key, nil)
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var clients []interface{ Devices() []netw.Device }
+	for _, id := range []string{"bbbbbbbb", "aaaaaaaa"} {
+		c, err := netw.NewHTTP(hs.URL+"/clip", id, key, netw.WithRoom("r"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go c.Poll(ctx, make(chan core.Snapshot, 16))
+		clients = append(clients, c)
+	}
+	other, _ := netw.NewHTTP(hs.URL+"/clip", "cccccccc", key, netw.WithRoom("elsewhere"))
+	go other.Poll(ctx, make(chan core.Snapshot, 16))
+
+	for end := time.Now().Add(5 * time.Second); len(clients[0].Devices()) < 2; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(end) {
+			t.Fatalf("client sees %+v", clients[0].Devices())
+		}
+	}
+	if d := clients[0].Devices(); d[0].ID != "aaaaaaaa" || d[1].ID != "bbbbbbbb" || len(d) != 2 || d[0].Seen == 0 {
+		t.Fatalf("client sees %+v", d)
+	}
+	if d := srv.Devices("r"); strings.Join(d, " ") != "aaaaaaaa bbbbbbbb" {
+		t.Fatalf("server lists %q", d)
+	}
+
+	// a room nobody polls any more empties, then goes at the next sweep
+	cancel()
+	later := time.Now().Add(SnapTTL + DeviceTTL)
+	srv.mu.Lock()
+	srv.room("r", "", later)
+	_, kept := srv.rooms["elsewhere"]
+	n := len(srv.rooms["r"].devices)
+	srv.mu.Unlock()
+	if n != 0 || kept {
+		t.Fatalf("after expiry: %d devices in r, elsewhere kept %v", n, kept)
+	}
+}
+
+func next(t *testing.T, got chan core.Snapshot, kind string) core.Snapshot {
+	t.Helper()
+	for timeout := time.After(5 * time.Second); ; {
+		select {
+		case s := <-got:
+			if s.Kind == kind {
+				return s
+			}
+		case <-timeout:
+			t.Fatalf("no %q snapshot relayed", kind)
+		}
+	}
+}
+
+func TestInlineChunkedAndAcks(t *testing.T) {
+	a, gotB := relay(t, "r")
+
+	small := core.Snapshot{Origin: "aaaaaaaa", TS: 1, Items: []core.Item{core.TextItem([]byte("hi"))}}
+	if err := a.Send(context.Background(), small); err != nil {
+		t.Fatalf("inline Send: %v", err)
+	}
+	if s := next(t, gotB, ""); s.Items[0].Payload != small.Items[0].Payload {
+		t.Fatalf("inline: got %+v", s.Items)
+	}
+
+	text := strings.Repeat("0123456789", 70000) // three chunks
+	big := core.Snapshot{Origin: "aaaaaaaa", TS: 2, Items: []core.Item{core.TextItem([]byte(text))}}
+	if err := a.Send(context.Background(), big); err != nil {
+		t.Fatalf("chunked Send: %v", err)
+	}
+	if s := next(t, gotB, ""); s.Items[0].Payload != big.Items[0].Payload {
+		t.Fatalf("chunked snapshot came back different")
+	}
+
+	if err := a.Send(context.Background(), core.Snapshot{Origin: "aaaaaaaa", TS: 3, Kind: core.KindAck, Ack: "x-1"}); err != nil {
+		t.Fatalf("ack Send: %v", err)
+	}
+	if s := next(t, gotB, core.KindAck); s.Ack != "x-1" {
+		t.Fatalf("ack: got %+v", s)
+	}
+}
+
+func TestRejectsBadTokens(t *testing.T) {
+	srv, _ := New(key, nil)
+	for _, tok := range []string{"", "bm90IGpzb24=", mustToken(t, "fedcba9876543210", time.Now().Unix()),
+		mustToken(t, key, time.Now().Add(-time.Hour).Unix())} {
+		req := httptest.NewRequest("GET", "/clip", nil)
+		req.Header.Set("X-Auth-Token", tok)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d", tok, rec.Code)
+		}
+	}
+	req := httptest.NewRequest("GET", "/clip", nil)
+	req.Header.Set("X-Auth-Token", mustToken(t, key, time.Now().Unix()))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Server-Time") == "" {
+		t.Fatalf("good token: status %d, headers %v", rec.Code, rec.Header())
+	}
+}
+
+func mustToken(t *testing.T, k string, ts int64) string {
+	tok, err := netw.AuthToken(k, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestAdvise(t *testing.T) {
+	for _, c := range []struct {
+		st   netw.NetStats
+		want netw.Hints
+	}{
+		{netw.NetStats{RTT: 20 * time.Millisecond, Kbps: 50000}, netw.Hints{Chunk: ChunkMax, Poll: 200 * time.Millisecond, Gzip: -1}},
+		{netw.NetStats{RTT: 80 * time.Millisecond, Loss: 0.02, Kbps: 1000}, netw.Hints{Chunk: 128 * 1024, Poll: 500 * time.Millisecond, Gzip: 1}},
+		{netw.NetStats{RTT: 900 * time.Millisecond, Loss: 0.1}, netw.Hints{Chunk: 64 * 1024, Poll: time.Second, Gzip: 1}},
+	} {
+		if got := Advise(c.st); got != c.want {
+			t.Errorf("Advise(%v) = %+v, want %+v", c.st, got, c.want)
+		}
+	}
+}
+
+func TestRejectsReplayedTokens(t *testing.T) {
+	srv, _ := New(key, nil)
+	now := time.Now().Unix()
+	status := func(tok string) int {
+		req := httptest.NewRequest("GET", "/clip", nil)
+		req.Header.Set("X-Auth-Token", tok)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	tok := func(n uint64) string {
+		s, err := netw.AuthTokenNonce(key, now, "0123abcd", n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	raw, _ := base64.StdEncoding.DecodeString(tok(201))
+	forged := base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(raw), `"n":201`, `"n":202`, 1)))
+	for _, c := range []struct {
+		tok  string
+		want int
+	}{
+		{tok(5), http.StatusOK},
+		{tok(5), http.StatusUnauthorized}, // replay
+		{tok(3), http.StatusOK},           // overtaken, still new
+		{tok(3), http.StatusUnauthorized},
+		{tok(200), http.StatusOK},
+		{tok(100), http.StatusUnauthorized}, // too far behind to tell
+		{mustToken(t, key, now), http.StatusOK},
+		{mustToken(t, key, now), http.StatusOK}, // no nonce: can't tell
+		{forged, http.StatusUnauthorized},       // counter changed, MAC not
+	} {
+		if got := status(c.tok); got != c.want {
+			t.Errorf("token %q: status %d, want %d", c.tok, got, c.want)
+		}
+	}
+
+	srv, _ = New(key, nil, WithRequireNonce())
+	if got := status(mustToken(t, key, now)); got != http.StatusUnauthorized {
+		t.Errorf("WithRequireNonce, no nonce: status %d", got)
+	}
+	if got := status(tok(1)); got != http.StatusOK {
+		t.Errorf("WithRequireNonce, nonce: status %d", got)
+	}
+}
+
+func TestRejectsChunkFailingChecksum(t *testing.T) {
+	srv, _ := New(key, nil)
+	post := func(sum string) int {
+		req := httptest.NewRequest("POST", "/clip", strings.NewReader("chunk"))
+		req.Header.Set("X-Auth-Token", mustToken(t, key, time.Now().Unix()))
+		req.Header.Set("X-Chunk-Id", "c1")
+		req.Header.Set("X-Chunk-Idx", "0")
+		req.Header.Set("X-Chunk-Total", "2")
+		req.Header.Set("X-Chunk-SHA256", sum)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	good := sha256.Sum256([]byte("chunk"))
+	if c := post(hex.EncodeToString(good[:8])); c != http.StatusBadRequest {
+		t.Fatalf("bad checksum: status %d", c)
+	}
+	if c := post(hex.EncodeToString(good[:])); c != http.StatusOK {
+		t.Fatalf("good checksum: status %d", c)
+	}
+}
+
+func TestStorageSurvivesRestart(t *testing.T) {
+	bo, err := store.OpenBolt(filepath.Join(t.TempDir(), "clipsyncd.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bo.Close()
+	for name, st := range map[string]store.Storage{"memory": store.Memory(), "bolt": bo} {
+		t.Run(name, func(t *testing.T) { survivesRestart(t, st) })
+	}
+}
+
+func survivesRestart(t *testing.T, st store.Storage) {
+	srv, err := New(key, nil, WithStorage(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(srv *Server, method, room string, hdr map[string]string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/clip", strings.NewReader(body))
+		req.Header.Set("X-Auth-Token", mustToken(t, key, time.Now().Unix()))
+		req.Header.Set("X-Room", room)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	do(srv, "POST", "inline", map[string]string{"X-Inline": "1", "X-Chunk-Id": "c1"}, `{"origin":"aaaaaaaa"}`)
+	do(srv, "POST", "chunked", map[string]string{"X-Chunk-Id": "c2", "X-Chunk-Idx": "1", "X-Chunk-Total": "3"}, "second")
+	do(srv, "POST", "replaced", map[string]string{"X-Chunk-Id": "old", "X-Chunk-Idx": "0", "X-Chunk-Total": "2"}, "gone")
+	do(srv, "POST", "replaced", map[string]string{"X-Chunk-Id": "new", "X-Chunk-Idx": "1", "X-Chunk-Total": "2"}, "kept")
+
+	again, err := New(key, nil, WithStorage(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := do(again, "GET", "inline", nil, "").Body.String(); !strings.Contains(b, `"cid":"c1"`) ||
+		!strings.Contains(b, `"snap":{"origin":"aaaaaaaa"}`) {
+		t.Fatalf("inline room after restart: %s", b)
+	}
+	if b := do(again, "GET", "chunked", nil, "").Body.String(); !strings.Contains(b, `"cid":"c2","total":3,"have":[1]`) {
+		t.Fatalf("chunked room after restart: %s", b)
+	}
+	if b := do(again, "GET", "chunked", map[string]string{"X-Chunk-Id": "c2", "X-Chunk-Idx": "1"}, "").Body.String(); b != "second" {
+		t.Fatalf("chunk after restart: %q", b)
+	}
+	if b := do(again, "GET", "replaced", nil, "").Body.String(); !strings.Contains(b, `"cid":"new","total":2,"have":[1]`) {
+		t.Fatalf("replaced room after restart: %s", b)
+	}
+
+	// past SnapTTL the snapshots go from storage too
+	again.mu.Lock()
+	again.room("inline", "", time.Now().Add(SnapTTL+SweepEvery+time.Second))
+	again.mu.Unlock()
+	if keys, _ := st.List(nsRooms); len(keys) != 0 {
+		t.Fatalf("rooms left in storage: %q", keys)
+	}
+	if keys, _ := st.List(nsParts); len(keys) != 0 {
+		t.Fatalf("chunks left in storage: %q", keys)
+	}
+}
+
+func TestLimitsPerDevice(t *testing.T) {
+	srv, err := New(key, nil, WithLimits(Limits{Requests: 1, Burst: 2, Bytes: 1000}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(dev, method string, hdr map[string]string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/clip", strings.NewReader(body))
+		req.Header.Set("X-Auth-Token", mustToken(t, key, time.Now().Unix()))
+		req.Header.Set("X-Room", "r")
+		req.Header.Set("X-Device-Id", dev)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		if rec := do("aaaaaaaa", "GET", nil, ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within burst: %d", i, rec.Code)
+		}
+	}
+	rec := do("aaaaaaaa", "GET", nil, "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("over the request rate: %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := do("bbbbbbbb", "GET", nil, ""); rec.Code != http.StatusOK {
+		t.Fatalf("another device was held back: %d", rec.Code)
+	}
+
+	// a full chunk fits the byte allowance; fetching it back runs up a
+	// debt, paid off at Bytes per second before the next request
+	chunk := strings.Repeat("x", ChunkMax)
+	hdr := map[string]string{"X-Chunk-Id": "c", "X-Chunk-Idx": "0", "X-Chunk-Total": "2"}
+	if rec := do("cccccccc", "POST", hdr, chunk); rec.Code != http.StatusOK {
+		t.Fatalf("chunk up: %d", rec.Code)
+	}
+	if rec := do("cccccccc", "GET", map[string]string{"X-Chunk-Id": "c", "X-Chunk-Idx": "0"}, ""); rec.Body.Len() != ChunkMax {
+		t.Fatalf("chunk down: %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	time.Sleep(time.Second) // past the request rate, so only bytes hold it back
+	rec = do("cccccccc", "GET", nil, "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the byte rate: %d", rec.Code)
+	}
+	if ra, _ := strconv.Atoi(rec.Header().Get("Retry-After")); ra < 300 || ra > 310 {
+		t.Fatalf("Retry-After for a chunk of debt at 1000 B/s: %q", rec.Header().Get("Retry-After"))
+	}
+	if wait, _ := srv.limits.allow("cccccccc", time.Now().Add(400*time.Second)); wait != 0 {
+		t.Fatalf("still limited once the debt is paid: %v", wait)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	st := store.Memory()
+	srv, err := New(key, nil, WithStorage(st), WithAdmin("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := func(srv *Server, dev, method string, hdr map[string]string, body string) int {
+		req := httptest.NewRequest(method, "/clip", strings.NewReader(body))
+		req.Header.Set("X-Auth-Token", mustToken(t, key, time.Now().Unix()))
+		req.Header.Set("X-Room", "r")
+		req.Header.Set("X-Device-Id", dev)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	admin := func(srv *Server, method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	client(srv, "aaaaaaaa", "POST", map[string]string{"X-Inline": "1", "X-Chunk-Id": "c1"}, `{"origin":"aaaaaaaa"}`)
+	client(srv, "bbbbbbbb", "GET", nil, "")
+	client(srv, "bbbbbbbb", "GET", nil, "")
+
+	for _, tok := range []string{"", "wrong"} {
+		if rec := admin(srv, "GET", "/admin/devices", tok); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("admin token %q: %d", tok, rec.Code)
+		}
+	}
+	rec := admin(srv, "GET", "/admin/devices", "s3cret")
+	var list struct{ Devices []DeviceInfo }
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Devices) != 2 {
+		t.Fatalf("devices: %v %s", err, rec.Body)
+	}
+	if b := list.Devices[1]; b.ID != "bbbbbbbb" || b.Room != "r" || b.Requests != 2 || !b.Active || b.Revoked {
+		t.Fatalf("device b: %+v", b)
+	}
+
+	if rec := admin(srv, "POST", "/admin/revoke?device=bbbbbbbb", "s3cret"); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", rec.Code)
+	}
+	if code := client(srv, "bbbbbbbb", "GET", nil, ""); code != http.StatusForbidden {
+		t.Fatalf("revoked device: %d", code)
+	}
+	if code := client(srv, "aaaaaaaa", "GET", nil, ""); code != http.StatusOK {
+		t.Fatalf("other device after revoke: %d", code)
+	}
+	again, err := New(key, nil, WithStorage(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := client(again, "bbbbbbbb", "GET", nil, ""); code != http.StatusForbidden {
+		t.Fatalf("revoked device after restart: %d", code)
+	}
+	if rec := admin(again, "GET", "/admin/devices", "s3cret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("admin API without WithAdmin: %d", rec.Code)
+	}
+	admin(srv, "DELETE", "/admin/revoke?device=bbbbbbbb", "s3cret")
+	if code := client(srv, "bbbbbbbb", "GET", nil, ""); code != http.StatusOK {
+		t.Fatalf("device let back in: %d", code)
+	}
+
+	rec = admin(srv, "POST", "/admin/purge", "s3cret")
+	if strings.TrimSpace(rec.Body.String()) != `{"purged":1}` {
+		t.Fatalf("purge: %d %s", rec.Code, rec.Body)
+	}
+	if keys, _ := st.List(nsRooms); len(keys) != 0 {
+		t.Fatalf("rooms left in storage after purge: %q", keys)
+	}
+}
+
+func TestDeviceTokens(t *testing.T) {
+	st := store.Memory()
+	srv, err := New(key, nil, WithStorage(st), WithDeviceTokens())
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop, err := srv.IssueToken("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.IssueToken("no spaces"); err == nil {
+		t.Fatal("token issued under a bad name")
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a real client presents its token with every request
+	c, err := netw.NewHTTP(hs.URL+"/clip", "aaaaaaaa", key, netw.WithRoom("r"), netw.WithDeviceToken(laptop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go c.Poll(ctx, make(chan core.Snapshot, 16))
+	for end := time.Now().Add(5 * time.Second); srv.Tokens()[0].Device != "aaaaaaaa"; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(end) {
+			t.Fatalf("token never used: %+v", srv.Tokens())
+		}
+	}
+
+	const nonce = "0011223344556677"
+	do := func(srv *Server, tok *netw.DeviceToken, n uint64) int {
+		ts := time.Now().Unix()
+		at, _ := netw.AuthTokenNonce(key, ts, nonce, n)
+		req := httptest.NewRequest("GET", "/clip", nil)
+		req.Header.Set("X-Auth-Token", at)
+		req.Header.Set("X-Device-Id", "bbbbbbbb")
+		if tok != nil {
+			req.Header.Set("X-Device-Auth", tok.Auth(ts, nonce, n))
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	stolen, _ := netw.NewDeviceToken("laptop") // right name, wrong secret
+	for i, c := range []struct {
+		tok  *netw.DeviceToken
+		want int
+	}{
+		{nil, http.StatusUnauthorized},
+		{&stolen, http.StatusUnauthorized},
+		{&laptop, http.StatusOK},
+	} {
+		if got := do(srv, c.tok, uint64(i+1)); got != c.want {
+			t.Fatalf("case %d: %d, want %d", i, got, c.want)
+		}
+	}
+
+	again, err := New(key, nil, WithStorage(st), WithDeviceTokens())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := do(again, &laptop, 9); got != http.StatusOK {
+		t.Fatalf("token after restart: %d", got)
+	}
+	if !again.WithdrawToken("laptop") || again.WithdrawToken("laptop") {
+		t.Fatal("withdraw should find the token once")
+	}
+	if got := do(again, &laptop, 10); got != http.StatusUnauthorized {
+		t.Fatalf("withdrawn token: %d", got)
+	}
+}
+
+func TestWSFanOut(t *testing.T) {
+	static, err := netw.NewNoiseKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, noise := range []bool{false, true} {
+		srv, _ := New(key, nil, WithNoise(static))
+		hs := httptest.NewServer(srv)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		client := func(id string) (netw.Client, chan core.Snapshot) {
+			opts := []netw.Option{netw.WithRoom("r")}
+			if noise {
+				opts = append(opts, netw.WithNoise(static.Public))
+			}
+			c, err := netw.NewWS("ws"+hs.URL[4:]+"/clip", id, key, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(chan core.Snapshot, 16)
+			go c.Poll(ctx, got)
+			return c, got
+		}
+		a, _ := client("aaaaaaaa")
+		_, gotB := client("bbbbbbbb")
+
+		// Send until b is connected too; the server keeps nothing for it.
+		snap := core.Snapshot{Origin: "aaaaaaaa", TS: 1, Items: []core.Item{core.TextItem([]byte("hi"))}}
+		var s core.Snapshot
+	wait:
+		for timeout := time.After(5 * time.Second); ; {
+			_ = a.Send(ctx, snap)
+			select {
+			case s = <-gotB:
+				break wait
+			case <-time.After(50 * time.Millisecond):
+			case <-timeout:
+				t.Fatalf("noise %v: nothing relayed", noise)
+			}
+		}
+		if s.Items[0].Payload != snap.Items[0].Payload {
+			t.Fatalf("noise %v: got %+v", noise, s.Items)
+		}
+		cancel()
+		hs.Close()
+	}
+}
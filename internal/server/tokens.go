@@ -0,0 +1,133 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	netw "clipsync/internal/net"
+)
+
+/*──────── per-device tokens (WithDeviceTokens) ───────────────*/
+// Tokens are issued and withdrawn through the admin API and kept, with
+// WithStorage, under "tokens".  A request presenting one must present
+// it correctly; with WithDeviceTokens every request must present one.
+
+const nsTokens = "tokens"
+
+// WithDeviceTokens refuses protocol requests that don't carry a valid
+// per-device token in X-Device-Auth (default: the shared key is
+// enough).
+func WithDeviceTokens() Option { return func(s *Server) { s.needTokens = true } }
+
+// issued is one device token and what was last seen of it.
+type issued struct {
+	tok    netw.DeviceToken
+	issued time.Time
+	used   time.Time
+	device string // X-Device-Id of its latest request
+}
+
+type savedToken struct {
+	Token  string    `json:"token"`
+	Issued time.Time `json:"issued"`
+}
+
+// TokenInfo is one entry of GET /admin/tokens.
+type TokenInfo struct {
+	Name   string    `json:"name"`
+	Issued time.Time `json:"issued"`
+	Used   time.Time `json:"used,omitempty"`   // latest request carrying it
+	Device string    `json:"device,omitempty"` // and its X-Device-Id
+}
+
+// IssueToken makes a token for the device called name, replacing any
+// it had, and returns it to be handed over (clipsync -device-token).
+func (s *Server) IssueToken(name string) (netw.DeviceToken, error) {
+	tok, err := netw.NewDeviceToken(name)
+	if err != nil {
+		return tok, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st != nil {
+		b, _ := json.Marshal(savedToken{tok.String(), now})
+		if err := s.st.Put(nsTokens, name, b); err != nil {
+			return tok, err
+		}
+	}
+	s.tokens[name] = &issued{tok: tok, issued: now}
+	return tok, nil
+}
+
+// WithdrawToken stops accepting name's token, and reports whether
+// there was one.
+func (s *Server) WithdrawToken(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens[name] == nil {
+		return false
+	}
+	delete(s.tokens, name)
+	if s.st != nil {
+		if err := s.st.Delete(nsTokens, name); err != nil {
+			s.logf("%s storage: %v", stamp(), err)
+		}
+	}
+	return true
+}
+
+// Tokens lists the issued tokens, by name.
+func (s *Server) Tokens() []TokenInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]TokenInfo, 0, len(s.tokens))
+	for name, it := range s.tokens {
+		out = append(out, TokenInfo{Name: name, Issued: it.issued, Used: it.used, Device: it.device})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// deviceAuthorized checks an X-Device-Auth header against the issued
+// tokens and the request's X-Auth-Token t, and returns the token's
+// name.  A missing header passes unless WithDeviceTokens.
+func (s *Server) deviceAuthorized(hdr string, t authToken, dev string) (string, bool) {
+	if hdr == "" {
+		return "", !s.needTokens
+	}
+	name, _, _ := strings.Cut(hdr, ":")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := s.tokens[name]
+	if it == nil || t.Nonce == "" ||
+		subtle.ConstantTimeCompare([]byte(hdr), []byte(it.tok.Auth(t.TS, t.Nonce, t.N))) != 1 {
+		return "", false
+	}
+	it.used, it.device = time.Now(), dev
+	return name, true
+}
+
+// loadTokens reads the issued tokens back from storage.
+func (s *Server) loadTokens() error {
+	names, err := s.st.List(nsTokens)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		b, err := s.st.Get(nsTokens, name)
+		var st savedToken
+		if err != nil || json.Unmarshal(b, &st) != nil {
+			continue
+		}
+		tok, err := netw.ParseDeviceToken(st.Token)
+		if err != nil || tok.Name != name {
+			continue
+		}
+		s.tokens[name] = &issued{tok: tok, issued: st.Issued}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	netw "clipsync/internal/net"
+
+	"nhooyr.io/websocket"
+)
+
+/*──────── WebSocket fan-out ──────────────────────────────────*/
+// A WS client gets every message the others in its room send, relayed
+// as is: whole snapshots, receipts and chunk pieces alike (see
+// internal/net/wschunk.go).  Nothing is kept, so a device that connects
+// later doesn't see earlier clips, and WS clients don't hear HTTP ones.
+// With WithNoise, a client that asks for it (X-Noise) gets a Noise_XX
+// handshake and sealed frames: the server opens each message and seals
+// it again for every receiver.
+
+// WithNoise answers WS clients that ask for Noise_XX with static as
+// the server's key (default: no Noise).  Clients pin its public half.
+func WithNoise(static netw.NoiseKey) Option { return func(s *Server) { s.noise = &static } }
+
+// wsQueue is how many messages may wait for a slow receiver; one more
+// and its connection is dropped.
+const wsQueue = 64
+
+type wsPeer struct {
+	conn *websocket.Conn
+	sess *netw.NoiseSession // WithNoise, if the client asked
+	out  chan wsMsg
+}
+
+type wsMsg struct {
+	typ  websocket.MessageType
+	data []byte
+}
+
+func isUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// serveWS runs one WS client until it goes; who is its limits key.
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request, name, dev, who string) {
+	noise := s.noise != nil && r.Header.Get("X-Noise") == netw.NoiseProtocol
+	if noise {
+		w.Header().Set("X-Noise", netw.NoiseProtocol)
+	}
+	w.Header().Set("X-Max-Body", strconv.Itoa(BodyMax))
+	w.Header().Set("X-Server-Time", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{CompressionMode: websocket.CompressionContextTakeover})
+	if err != nil {
+		return // Accept answered
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(BodyMax + BodyMax/16) // room for pieces' headers and Noise tags
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	p := &wsPeer{conn: conn, out: make(chan wsMsg, wsQueue)}
+	if noise {
+		hctx, done := context.WithTimeout(ctx, 10*time.Second)
+		p.sess, err = netw.NoiseRespond(hctx, conn, *s.noise)
+		done()
+		if err != nil {
+			s.logf("%s %s: noise handshake: %v", stamp(), dev, err)
+			conn.Close(websocket.StatusPolicyViolation, "noise")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.room(name, dev, time.Now())
+	if s.ws[name] == nil {
+		s.ws[name] = make(map[*wsPeer]bool)
+	}
+	s.ws[name][p] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.ws[name], p)
+		if len(s.ws[name]) == 0 {
+			delete(s.ws, name)
+		}
+		s.mu.Unlock()
+	}()
+
+	go p.writeLoop(ctx, cancel)
+	for {
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if p.sess != nil {
+			if data, err = p.sess.Open(data); err != nil {
+				return // out of step: nothing after this opens
+			}
+			typ = websocket.MessageText
+			if len(data) == 0 || data[0] != '{' {
+				typ = websocket.MessageBinary
+			}
+		}
+		now := time.Now()
+		if dev != "" && s.isRevoked(dev) {
+			conn.Close(websocket.StatusPolicyViolation, "device revoked")
+			return
+		}
+		if s.limits != nil {
+			if wait, first := s.limits.allow(who, now); wait > 0 {
+				if first {
+					s.logf("%s %s over its limits, messages dropped for %v", stamp(), who, wait.Round(time.Millisecond))
+				}
+				continue
+			}
+			s.limits.spend(who, int64(len(data)))
+		}
+		s.relay(name, dev, p, wsMsg{typ, data}, now)
+	}
+}
+
+// relay queues m for everyone in the room but its sender.
+func (s *Server) relay(name, dev string, from *wsPeer, m wsMsg, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.room(name, dev, now)
+	for p := range s.ws[name] {
+		if p == from {
+			continue
+		}
+		select {
+		case p.out <- m:
+		default:
+			s.logf("%s ws receiver in room %q too slow, dropped", stamp(), name)
+			p.conn.CloseNow()
+		}
+	}
+}
+
+// writeLoop sends what relay queues, sealed for this peer; stop ends
+// the connection when a write fails.
+func (p *wsPeer) writeLoop(ctx context.Context, stop func()) {
+	defer stop()
+	for {
+		var m wsMsg
+		select {
+		case <-ctx.Done():
+			return
+		case m = <-p.out:
+		}
+		if p.sess != nil {
+			var err error
+			if m.data, err = p.sess.Seal(m.data); err != nil {
+				return
+			}
+			m.typ = websocket.MessageBinary
+		}
+		wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := p.conn.Write(wctx, m.typ, m.data)
+		cancel()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package sign signs snapshots with a per-device Ed25519 key, so a peer
+// can tell which device really sent a clip (or an ack, or a presence
+// announcement) whatever the transport secret and the relay do.  The
+// signer's public key travels in the snapshot; which keys to believe is
+// up to Trust.
+package sign
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	core "clipsync/internal"
+	"clipsync/internal/persist"
+)
+
+var (
+	ErrUnsigned   = errors.New("sign: snapshot is not signed")
+	ErrBadSig     = errors.New("sign: bad signature")
+	ErrUntrusted  = errors.New("sign: signed by a key that is not trusted")
+	ErrKeyChanged = errors.New("sign: signed by a different key than before")
+)
+
+/*──────── device keys ─────────────────────────────────────────*/
+
+// Key is this device's signing key.
+type Key struct{ priv ed25519.PrivateKey }
+
+// LoadKey reads the key at path, creating it on first use.
+func LoadKey(path string) (*Key, error) {
+	if b, err := os.ReadFile(path); err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("sign: %s: not an Ed25519 seed", path)
+		}
+		return KeyFromSeed(seed), nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := persist.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	enc := base64.StdEncoding.EncodeToString(seed)
+	if err := persist.WriteFile(path, []byte(enc+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return KeyFromSeed(seed), nil
+}
+
+// KeyFromSeed is the key for a 32-byte seed (interop vectors).
+func KeyFromSeed(seed []byte) *Key { return &Key{ed25519.NewKeyFromSeed(seed)} }
+
+// Public is the key peers list in their trusted keys for this device.
+func (k *Key) Public() string {
+	return base64.StdEncoding.EncodeToString(k.priv.Public().(ed25519.PublicKey))
+}
+
+// Sign stamps snap with k's public key and signature.
+func (k *Key) Sign(snap *core.Snapshot) {
+	snap.SigKey = k.Public()
+	snap.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(k.priv, Message(*snap)))
+}
+
+// Message is what a signature covers, version 2: the line "clipsync
+// snapshot v2", then a fixed list of fields, each a 4-byte big-endian
+// length and its bytes.  Numbers are decimal, true is "1" and false
+// empty.  In order: origin, ts, room, force, seq, kind, ack, the number
+// of caps and each cap, ttl, n, name, sig_key, hash, to, the number of
+// items and, for each, fmt, fmt_name, mime_type, byte_len and payload.
+// Sig, qkey and the items' blob and same_as are left out: transports
+// fill them in or rewrite them on the way.  A field added to Snapshot
+// later is not covered until a new version lists it, so peers that
+// don't know it still sign the same bytes.  Items are signed as the
+// sender's Syncer handed them over, sealed if -ring is on.  The interop
+// vectors pin it down for other implementations.
+func Message(snap core.Snapshot) []byte {
+	var m message
+	m.buf = []byte("clipsync snapshot v2\n")
+	m.str(snap.Origin)
+	m.num(uint64(snap.TS))
+	m.str(snap.Room)
+	m.flag(snap.Force)
+	m.num(snap.Seq)
+	m.str(snap.Kind)
+	m.str(snap.Ack)
+	m.num(uint64(len(snap.Caps)))
+	for _, c := range snap.Caps {
+		m.str(c)
+	}
+	m.num(uint64(snap.TTL))
+	m.num(snap.N)
+	m.str(snap.Name)
+	m.str(snap.SigKey)
+	m.str(snap.Hash)
+	m.str(snap.To)
+	m.num(uint64(len(snap.Items)))
+	for _, it := range snap.Items {
+		m.num(uint64(it.Fmt))
+		m.str(it.FmtName)
+		m.str(it.MimeType)
+		m.num(uint64(it.ByteLen))
+		m.str(it.Payload)
+	}
+	return m.buf
+}
+
+// message builds Message's length-prefixed fields.
+type message struct{ buf []byte }
+
+func (m *message) str(s string) {
+	m.buf = binary.BigEndian.AppendUint32(m.buf, uint32(len(s)))
+	m.buf = append(m.buf, s...)
+}
+
+func (m *message) num(n uint64) { m.str(strconv.FormatUint(n, 10)) }
+
+func (m *message) flag(b bool) {
+	if b {
+		m.str("1")
+	} else {
+		m.str("")
+	}
+}
+
+// verify checks snap's signature against the key it carries.
+func verify(snap core.Snapshot) error {
+	if snap.Sig == "" {
+		return ErrUnsigned
+	}
+	pub, err := base64.StdEncoding.DecodeString(snap.SigKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return ErrBadSig
+	}
+	sig, err := base64.StdEncoding.DecodeString(snap.Sig)
+	if err != nil || !ed25519.Verify(pub, Message(snap), sig) {
+		return ErrBadSig
+	}
+	return nil
+}
+
+/*──────── trust ───────────────────────────────────────────────*/
+
+// Trust decides which key may speak for which device.  Device ids are
+// random per run, so keys are bound to device names (Snapshot.Name),
+// falling back to the id for peers without one.
+//
+// With a list of trusted keys only those are believed, each for the
+// name listed with it, if any.  Without one, the first key seen for a
+// name is pinned (trust on first use, like ssh) and any other key for
+// that name is refused; pins are kept in a file when one is given.
+type Trust struct {
+	mu      sync.Mutex
+	allowed map[string]string // key → name it must sign as ("" = any); nil = TOFU
+	pins    map[string]string // name → key
+	path    string            // pins file; "" = memory only
+
+	// OnPin, if set, hears about every newly pinned name.
+	OnPin func(name, key string)
+}
+
+// NewTrust reads the trusted keys file, one "key [name]" per line, or
+// with keysFile "" pins on first use, remembered in pinsFile ("" = only
+// for this run).  The pins file has the same format, so it can serve
+// as a keys file once every device has been seen.
+func NewTrust(keysFile, pinsFile string) (*Trust, error) {
+	t := &Trust{pins: make(map[string]string), path: pinsFile}
+	if keysFile != "" {
+		t.allowed = make(map[string]string)
+		if err := readPairs(keysFile, func(key, name string) { t.allowed[key] = name }); err != nil {
+			return nil, err
+		}
+		if len(t.allowed) == 0 {
+			return nil, fmt.Errorf("sign: %s lists no keys", keysFile)
+		}
+		return t, nil
+	}
+	if pinsFile != "" {
+		err := readPairs(pinsFile, func(key, name string) { t.pins[name] = key })
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func readPairs(path string, add func(a, b string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a, b, _ := strings.Cut(line, " ")
+		add(a, strings.TrimSpace(b))
+	}
+	return sc.Err()
+}
+
+// check reports whether key may sign as name.
+func (t *Trust) check(name, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.allowed != nil {
+		want, ok := t.allowed[key]
+		switch {
+		case !ok:
+			return ErrUntrusted
+		case want != "" && want != name:
+			return fmt.Errorf("%w for %q", ErrUntrusted, name)
+		}
+		return nil
+	}
+	switch pinned, ok := t.pins[name]; {
+	case ok && pinned != key:
+		return fmt.Errorf("%w for %q", ErrKeyChanged, name)
+	case ok:
+		return nil
+	}
+	t.pins[name] = key
+	if t.path != "" {
+		t.save()
+	}
+	if t.OnPin != nil {
+		t.OnPin(name, key)
+	}
+	return nil
+}
+
+// save writes the pins; a failed write only costs remembering them.
+func (t *Trust) save() {
+	names := make([]string, 0, len(t.pins))
+	for n := range t.pins {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("# key name, pinned on first use by clipsync -sign\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "%s %s\n", t.pins[n], n)
+	}
+	if persist.MkdirAll(filepath.Dir(t.path), 0o700) == nil {
+		_ = persist.WriteFile(t.path, []byte(b.String()), 0o600)
+	}
+}
+
+/*──────── the pkg/clipsync Signer ─────────────────────────────*/
+
+// Signer signs what this device sends and checks what it receives.
+type Signer struct {
+	key     *Key
+	trust   *Trust
+	room    string
+	require bool // drop unsigned snapshots too
+}
+
+// NewSigner signs with key for room and believes what trust does.
+// require drops unsigned snapshots; otherwise only bad or untrusted
+// signatures are refused, so peers without signing keep working.
+func NewSigner(key *Key, trust *Trust, room string, require bool) *Signer {
+	return &Signer{key: key, trust: trust, room: room, require: require}
+}
+
+// Sign signs snap in place.  The transport stamps the room only after
+// this, so it is filled in here, the same, for the signature to cover.
+func (s *Signer) Sign(snap *core.Snapshot) error {
+	snap.Room = s.room
+	s.key.Sign(snap)
+	return nil
+}
+
+// Verify reports why snap must be dropped, or nil.
+func (s *Signer) Verify(snap core.Snapshot) error {
+	err := verify(snap)
+	switch {
+	case errors.Is(err, ErrUnsigned) && !s.require:
+		return nil
+	case err != nil:
+		return err
+	}
+	name := snap.Name
+	if name == "" {
+		name = snap.Origin
+	}
+	return s.trust.check(name, snap.SigKey)
+}
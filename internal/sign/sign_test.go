@@ -0,0 +1,159 @@
+package sign
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	core "clipsync/internal"
+)
+
+func clip(name, text string) core.Snapshot {
+	return core.Snapshot{Origin: "ab12cd34", TS: 1700000000, Name: name, Items: []core.Item{core.TextItem([]byte(text))}}
+}
+
+func TestSignVerifyAndTamper(t *testing.T) {
+	k := KeyFromSeed(make([]byte, 32))
+	snap := clip("laptop", "hello")
+	k.Sign(&snap)
+	if err := verify(snap); err != nil {
+		t.Fatalf("fresh signature: %v", err)
+	}
+
+	// what transports rewrite on the way isn't covered
+	moved := snap
+	moved.Quick = "q"
+	moved.Items = []core.Item{snap.Items[0]}
+	moved.Items[0].Blob, moved.Items[0].SameAs = "ff", 1
+	if err := verify(moved); err != nil {
+		t.Fatalf("transport fields changed the signature: %v", err)
+	}
+	// the room is: a relay can't move a clip to another one
+	rerouted := snap
+	rerouted.Room = "r"
+	if err := verify(rerouted); !errors.Is(err, ErrBadSig) {
+		t.Fatalf("moved to another room: %v", err)
+	}
+
+	tampered := snap
+	tampered.Items = []core.Item{core.TextItem([]byte("hellO"))}
+	if err := verify(tampered); !errors.Is(err, ErrBadSig) {
+		t.Fatalf("tampered clip: %v", err)
+	}
+	renamed := snap
+	renamed.Name = "desktop"
+	if err := verify(renamed); !errors.Is(err, ErrBadSig) {
+		t.Fatalf("renamed sender: %v", err)
+	}
+	if err := verify(clip("laptop", "hello")); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("unsigned: %v", err)
+	}
+}
+
+func TestPinOnFirstUse(t *testing.T) {
+	pins := filepath.Join(t.TempDir(), "pins")
+	tr, err := NewTrust("", pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pinned []string
+	tr.OnPin = func(name, _ string) { pinned = append(pinned, name) }
+	s := NewSigner(KeyFromSeed(make([]byte, 32)), tr, "", false)
+	mallory := KeyFromSeed([]byte(strings.Repeat("m", 32)))
+
+	a := clip("laptop", "one")
+	s.Sign(&a)
+	if err := s.Verify(a); err != nil {
+		t.Fatalf("first key for a name: %v", err)
+	}
+	b := clip("laptop", "two")
+	mallory.Sign(&b)
+	if err := s.Verify(b); !errors.Is(err, ErrKeyChanged) {
+		t.Fatalf("second key for a name: %v", err)
+	}
+	if err := s.Verify(clip("laptop", "unsigned")); err != nil {
+		t.Fatalf("unsigned without require: %v", err)
+	}
+	if len(pinned) != 1 || pinned[0] != "laptop" {
+		t.Fatalf("OnPin heard %v", pinned)
+	}
+
+	// the pin survives a restart
+	tr2, err := NewTrust("", pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSigner(mallory, tr2, "", false).Verify(b); !errors.Is(err, ErrKeyChanged) {
+		t.Fatalf("after reload: %v", err)
+	}
+}
+
+func TestTrustedKeys(t *testing.T) {
+	laptop := KeyFromSeed(make([]byte, 32))
+	other := KeyFromSeed([]byte(strings.Repeat("o", 32)))
+	file := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(file, []byte("# peers\n"+laptop.Public()+" laptop\n"), 0o600)
+	tr, err := NewTrust(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSigner(other, tr, "", true)
+
+	ok := clip("laptop", "x")
+	laptop.Sign(&ok)
+	if err := s.Verify(ok); err != nil {
+		t.Fatalf("listed key: %v", err)
+	}
+	wrongName := clip("desktop", "x")
+	laptop.Sign(&wrongName)
+	if err := s.Verify(wrongName); !errors.Is(err, ErrUntrusted) {
+		t.Fatalf("listed key, other name: %v", err)
+	}
+	unknown := clip("laptop", "x")
+	other.Sign(&unknown)
+	if err := s.Verify(unknown); !errors.Is(err, ErrUntrusted) {
+		t.Fatalf("unlisted key: %v", err)
+	}
+	if err := s.Verify(clip("laptop", "x")); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("unsigned with require: %v", err)
+	}
+}
+
+// Fields decode the same whatever JSON library or field order a peer
+// has, and a boundary between fields can't be shifted.
+func TestMessageIsExplicit(t *testing.T) {
+	a := core.Snapshot{Origin: "ab", Name: "cd"}
+	b := core.Snapshot{Origin: "abc", Name: "d"}
+	if string(Message(a)) == string(Message(b)) {
+		t.Fatal("field boundaries not encoded")
+	}
+	var fresh core.Snapshot
+	if err := json.Unmarshal([]byte(`{"origin":"ab","name":"cd","some_later_field":1}`), &fresh); err != nil {
+		t.Fatal(err)
+	}
+	if string(Message(fresh)) != string(Message(a)) {
+		t.Fatal("unknown JSON fields changed the message")
+	}
+	if !strings.HasPrefix(string(Message(a)), "clipsync snapshot v2\n") {
+		t.Fatal("version line missing")
+	}
+}
+
+func TestSignerSignsItsRoom(t *testing.T) {
+	trust, _ := NewTrust("", "")
+	s := NewSigner(KeyFromSeed(make([]byte, 32)), trust, "work", true)
+	snap := clip("laptop", "hi")
+	if err := s.Sign(&snap); err != nil || snap.Room != "work" {
+		t.Fatalf("room %q, %v", snap.Room, err)
+	}
+	if err := s.Verify(snap); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	snap.Room = "home"
+	if err := s.Verify(snap); !errors.Is(err, ErrBadSig) {
+		t.Fatalf("other room: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"time"
+
+	"clipsync/internal/persist"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+/*──────── bolt ───────────────────────────────────────────────*/
+
+// Bolt keeps everything in one bbolt file, a bucket per namespace: no
+// file per entry, and every Put is a transaction that either lands
+// whole or not at all.  Each value is stored behind the 8-byte time it
+// was written, for Modified.
+type Bolt struct{ db *bolt.DB }
+
+// rootBucket holds namespace "", which bolt can't name; valid keeps
+// "/" out of namespaces, so it can't clash with one.
+var rootBucket = []byte("/")
+
+// OpenBolt opens the database at path, creating it (and its directory)
+// if missing.  Only one process can have it open; another waits a few
+// seconds for it, then fails.
+func OpenBolt(path string) (*Bolt, error) {
+	if err := persist.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Bolt{db}, nil
+}
+
+// Close releases the file.
+func (b *Bolt) Close() error { return b.db.Close() }
+
+func bucket(ns string) []byte {
+	if ns == "" {
+		return rootBucket
+	}
+	return []byte(ns)
+}
+
+func (b *Bolt) Put(ns, key string, val []byte) error {
+	if err := valid(ns, key); err != nil || key == "" {
+		return errName
+	}
+	v := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(val)), uint64(time.Now().UnixNano()))
+	v = append(v, val...)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk, err := tx.CreateBucketIfNotExists(bucket(ns))
+		if err != nil {
+			return err
+		}
+		return bk.Put([]byte(key), v)
+	})
+}
+
+// get copies out key's stored value, written time first.
+func (b *Bolt) get(ns, key string) (v []byte, err error) {
+	if err := valid(ns, key); err != nil {
+		return nil, err
+	}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if bk := tx.Bucket(bucket(ns)); bk != nil && key != "" {
+			v = append([]byte(nil), bk.Get([]byte(key))...)
+		}
+		if len(v) < 8 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return v, err
+}
+
+func (b *Bolt) Get(ns, key string) ([]byte, error) {
+	v, err := b.get(ns, key)
+	if err != nil {
+		return nil, err
+	}
+	return v[8:], nil
+}
+
+func (b *Bolt) Modified(ns, key string) (time.Time, error) {
+	v, err := b.get(ns, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v))), nil
+}
+
+func (b *Bolt) List(ns string) (keys []string, err error) {
+	if err := valid(ns); err != nil {
+		return nil, err
+	}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(bucket(ns))
+		if bk == nil {
+			return nil
+		}
+		return bk.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err // bolt keeps keys sorted
+}
+
+func (b *Bolt) Delete(ns, key string) error {
+	if err := valid(ns, key); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if bk := tx.Bucket(bucket(ns)); bk != nil {
+			return bk.Delete([]byte(key))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"time"
+)
+
+/*──────── encrypted at rest ──────────────────────────────────*/
+
+// ErrSealed is Get's error for a value Sealed can't open: written
+// without encryption, under another key, or tampered with.
+var ErrSealed = errors.New("store: value does not open with this key")
+
+// sealedMark starts every sealed value.  No text or JSON starts with a
+// zero byte, so Seal tells what was written in the clear from it.
+var sealedMark = []byte("\x00cs1")
+
+// Sealed encrypts every value st holds with AES-256-GCM under key (32
+// bytes), bound to its namespace and key so values can't be swapped
+// around on disk.  Names stay in the clear; they are ids, not content.
+func Sealed(st Storage, key []byte) (Storage, error) {
+	if len(key) != 32 {
+		return nil, errors.New("store: sealed key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return sealed{st, aead}, nil
+}
+
+// Seal encrypts in place the values in namespaces of st that were
+// written in the clear, as Sealed(st, key) would have written them, so
+// turning encryption on keeps what was there.  Values already sealed,
+// under any key, are left alone.  It returns how many it sealed.
+func Seal(st Storage, key []byte, namespaces ...string) (n int, err error) {
+	sd, err := Sealed(st, key)
+	if err != nil {
+		return 0, err
+	}
+	for _, ns := range namespaces {
+		keys, err := st.List(ns)
+		if err != nil {
+			return n, err
+		}
+		for _, k := range keys {
+			b, err := st.Get(ns, k)
+			if errors.Is(err, ErrNotFound) || bytes.HasPrefix(b, sealedMark) {
+				continue
+			} else if err != nil {
+				return n, err
+			}
+			if err := sd.Put(ns, k, b); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+type sealed struct {
+	Storage
+	aead cipher.AEAD
+}
+
+func sealedAAD(ns, key string) []byte { return []byte("clipsync store " + ns + "/" + key) }
+
+// Put stores sealedMark | nonce | ciphertext.
+func (s sealed) Put(ns, key string, val []byte) error {
+	m, n := len(sealedMark), s.aead.NonceSize()
+	b := make([]byte, m+n, m+n+len(val)+s.aead.Overhead())
+	copy(b, sealedMark)
+	if _, err := rand.Read(b[m:]); err != nil {
+		return err
+	}
+	return s.Storage.Put(ns, key, s.aead.Seal(b, b[m:], val, sealedAAD(ns, key)))
+}
+
+func (s sealed) Get(ns, key string) ([]byte, error) {
+	b, err := s.Storage.Get(ns, key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, sealedMark) {
+		return nil, ErrSealed // written in the clear: Seal it first
+	}
+	b = b[len(sealedMark):]
+	n := s.aead.NonceSize()
+	if len(b) < n {
+		return nil, ErrSealed
+	}
+	val, err := s.aead.Open(nil, b[:n], b[n:], sealedAAD(ns, key))
+	if err != nil {
+		return nil, ErrSealed
+	}
+	return val, nil
+}
+
+// Modified passes through to st, when it is Timed.
+func (s sealed) Modified(ns, key string) (time.Time, error) {
+	t, ok := s.Storage.(Timed)
+	if !ok {
+		return time.Time{}, errors.New("store: backend keeps no times")
+	}
+	return t.Modified(ns, key)
+}
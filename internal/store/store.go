@@ -0,0 +1,193 @@
+// Package store is the key/value interface clipsync keeps state behind:
+// the offline queue, the clip history and partial downloads.  Each
+// subsystem works in its own namespace, so one Storage can hold them
+// all, and tests run against Memory instead of a temp dir.
+//
+// Dir is the file backend, and writes through persist like everything
+// else.  Bolt keeps it all in one bbolt file instead, for state with
+// many small entries.
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"clipsync/internal/persist"
+)
+
+// Storage keeps values by namespace and key.  Namespace "" is the
+// backend's root; keys and namespaces are plain names, no separators.
+// Implementations are safe for concurrent use.
+type Storage interface {
+	Put(ns, key string, val []byte) error
+	Get(ns, key string) ([]byte, error) // ErrNotFound if missing
+	List(ns string) ([]string, error)   // keys, sorted
+	Delete(ns, key string) error        // nil if missing
+}
+
+// Timed is a Storage that knows when each value was last written.
+// All the backends here are; callers that age state out check for it.
+type Timed interface {
+	Modified(ns, key string) (time.Time, error)
+}
+
+// ErrNotFound is Get's error for a key that isn't there.
+var ErrNotFound = errors.New("store: not found")
+
+var errName = errors.New("store: bad namespace or key")
+
+// valid rejects names that would leave the namespace on disk.
+func valid(names ...string) error {
+	for _, n := range names {
+		if n == "." || n == ".." || strings.ContainsAny(n, `/\`) || strings.HasSuffix(n, ".tmp") {
+			return errName
+		}
+	}
+	return nil
+}
+
+/*──────── files ──────────────────────────────────────────────*/
+
+// Dir stores each value as a file: root/ns/key, or root/key for
+// namespace "".  Nothing is created until the first Put.
+func Dir(root string) Storage { return dirStore(root) }
+
+type dirStore string
+
+func (d dirStore) path(ns, key string) string { return filepath.Join(string(d), ns, key) }
+
+func (d dirStore) Put(ns, key string, val []byte) error {
+	if err := valid(ns, key); err != nil || key == "" {
+		return errName
+	}
+	if err := persist.MkdirAll(filepath.Join(string(d), ns), 0o700); err != nil {
+		return err
+	}
+	return persist.WriteFile(d.path(ns, key), val, 0o600)
+}
+
+func (d dirStore) Get(ns, key string) ([]byte, error) {
+	if err := valid(ns, key); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(d.path(ns, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// List skips subdirectories (other namespaces, under root) and the
+// temp files of writes in flight.
+func (d dirStore) List(ns string) ([]string, error) {
+	if err := valid(ns); err != nil {
+		return nil, err
+	}
+	ents, err := os.ReadDir(filepath.Join(string(d), ns))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	var keys []string
+	for _, e := range ents {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			keys = append(keys, e.Name())
+		}
+	}
+	return keys, err // ReadDir sorts by name
+}
+
+func (d dirStore) Modified(ns, key string) (time.Time, error) {
+	if err := valid(ns, key); err != nil {
+		return time.Time{}, err
+	}
+	fi, err := os.Stat(d.path(ns, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, ErrNotFound
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (d dirStore) Delete(ns, key string) error {
+	if err := valid(ns, key); err != nil {
+		return err
+	}
+	if err := os.Remove(d.path(ns, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+/*──────── memory ─────────────────────────────────────────────*/
+
+// Memory keeps everything in the process, for tests and for embedders
+// that want nothing on disk.
+func Memory() Storage { return &memStore{m: make(map[string]map[string]memValue)} }
+
+type memStore struct {
+	mu sync.Mutex
+	m  map[string]map[string]memValue
+}
+
+type memValue struct {
+	b  []byte
+	at time.Time
+}
+
+func (s *memStore) Put(ns, key string, val []byte) error {
+	if err := valid(ns, key); err != nil || key == "" {
+		return errName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m[ns] == nil {
+		s.m[ns] = make(map[string]memValue)
+	}
+	s.m[ns][key] = memValue{append([]byte(nil), val...), time.Now()}
+	return nil
+}
+
+func (s *memStore) Get(ns, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[ns][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v.b...), nil
+}
+
+func (s *memStore) Modified(ns, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[ns][key]
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	return v.at, nil
+}
+
+func (s *memStore) List(ns string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.m[ns]))
+	for k := range s.m[ns] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *memStore) Delete(ns, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m[ns], key)
+	return nil
+}
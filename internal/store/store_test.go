@@ -0,0 +1,154 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// every backend, and Sealed over one, must behave the same
+func backends(t *testing.T) map[string]Storage {
+	sd, err := Sealed(Dir(t.TempDir()), make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bo, err := OpenBolt(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bo.Close() })
+	return map[string]Storage{"dir": Dir(t.TempDir()), "memory": Memory(), "sealed": sd, "bolt": bo}
+}
+
+func TestStorage(t *testing.T) {
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if keys, err := st.List("queue"); err != nil || len(keys) != 0 {
+				t.Fatalf("empty List = %q, %v", keys, err)
+			}
+			if _, err := st.Get("queue", "a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get missing: %v", err)
+			}
+			st.Put("queue", "b", []byte("2"))
+			st.Put("queue", "a", []byte("1"))
+			st.Put("queue", "a", []byte("one")) // replaces
+			st.Put("history", "a", []byte("other"))
+			st.Put("", "top", []byte("root"))
+
+			if keys, _ := st.List("queue"); !slices.Equal(keys, []string{"a", "b"}) {
+				t.Fatalf("List = %q", keys)
+			}
+			if b, err := st.Get("queue", "a"); err != nil || string(b) != "one" {
+				t.Fatalf("Get = %q, %v", b, err)
+			}
+			if b, _ := st.Get("history", "a"); string(b) != "other" {
+				t.Fatalf("namespaces leak: %q", b)
+			}
+			if keys, _ := st.List(""); !slices.Equal(keys, []string{"top"}) {
+				t.Fatalf("root List = %q", keys)
+			}
+
+			if at, err := st.(Timed).Modified("queue", "a"); err != nil || time.Since(at) > time.Minute {
+				t.Fatalf("Modified = %v, %v", at, err)
+			}
+			if _, err := st.(Timed).Modified("queue", "zz"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Modified missing: %v", err)
+			}
+
+			if err := st.Delete("queue", "a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Delete("queue", "a"); err != nil {
+				t.Fatalf("second Delete: %v", err)
+			}
+			if keys, _ := st.List("queue"); !slices.Equal(keys, []string{"b"}) {
+				t.Fatalf("List after Delete = %q", keys)
+			}
+
+			for _, bad := range [][2]string{{"..", "x"}, {"q", "../x"}, {"q", `a\b`}, {"q", ""}, {"q", "x.tmp"}} {
+				if st.Put(bad[0], bad[1], nil) == nil {
+					t.Fatalf("Put(%q, %q) accepted", bad[0], bad[1])
+				}
+			}
+		})
+	}
+}
+
+func TestDirLayout(t *testing.T) {
+	root := t.TempDir()
+	st := Dir(root)
+	st.Put("", "k.json", []byte("x"))
+	st.Put("ns", "k", []byte("y"))
+	if _, err := os.Stat(filepath.Join(root, "k.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "ns", "k")); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "half.tmp"), nil, 0o600) // a write in flight
+	if keys, _ := st.List(""); !slices.Equal(keys, []string{"k.json"}) {
+		t.Fatalf("root List = %q", keys)
+	}
+}
+
+func TestBoltReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	st, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Put("queue", "a", []byte("1"))
+	st.Close()
+	if st, err = OpenBolt(path); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if b, err := st.Get("queue", "a"); err != nil || string(b) != "1" {
+		t.Fatalf("after reopen: %q, %v", b, err)
+	}
+}
+
+func TestSealed(t *testing.T) {
+	root := t.TempDir()
+	key := bytes.Repeat([]byte{7}, 32)
+	st, _ := Sealed(Dir(root), key)
+	st.Put("history", "1", []byte("my password"))
+	st.Put("history", "2", []byte("other"))
+
+	raw, _ := os.ReadFile(filepath.Join(root, "history", "1"))
+	if bytes.Contains(raw, []byte("password")) {
+		t.Fatalf("plaintext on disk: %q", raw)
+	}
+	if b, err := st.Get("history", "1"); err != nil || string(b) != "my password" {
+		t.Fatalf("Get = %q, %v", b, err)
+	}
+
+	other, _ := Sealed(Dir(root), make([]byte, 32))
+	if _, err := other.Get("history", "1"); !errors.Is(err, ErrSealed) {
+		t.Fatalf("other key: %v", err)
+	}
+	os.WriteFile(filepath.Join(root, "history", "2"), raw, 0o600) // moved around
+	if _, err := st.Get("history", "2"); !errors.Is(err, ErrSealed) {
+		t.Fatalf("swapped value: %v", err)
+	}
+	Dir(root).Put("history", "3", []byte("old plaintext"))
+	if _, err := st.Get("history", "3"); !errors.Is(err, ErrSealed) {
+		t.Fatalf("plaintext value: %v", err)
+	}
+	if n, err := Seal(Dir(root), key, "history"); n != 1 || err != nil {
+		t.Fatalf("Seal = %d, %v", n, err)
+	}
+	if b, err := st.Get("history", "3"); err != nil || string(b) != "old plaintext" {
+		t.Fatalf("sealed in place: %q, %v", b, err)
+	}
+	if n, _ := Seal(Dir(root), key, "history"); n != 0 {
+		t.Fatalf("second Seal sealed %d", n)
+	}
+	if _, err := Sealed(Memory(), key[:16]); err == nil {
+		t.Fatal("16-byte key accepted")
+	}
+}
@@ -0,0 +1,125 @@
+// Package supervise restarts a failed subsystem on its own instead of
+// taking the whole process down.  Each subsystem has an error budget:
+// the restart delay doubles with every failure in the recent window and
+// falls back to the base once failures age out.
+package supervise
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"clipsync/internal/crash"
+)
+
+const (
+	baseDelay = time.Second
+	maxDelay  = time.Minute
+	window    = 5 * time.Minute // failures older than this are forgiven
+)
+
+type sub struct {
+	restarts int
+	recent   []time.Time
+	lastErr  error
+}
+
+type Supervisor struct {
+	mu   sync.Mutex
+	subs map[string]*sub
+
+	base time.Duration // overridable in tests
+}
+
+func New() *Supervisor {
+	return &Supervisor{subs: make(map[string]*sub), base: baseDelay}
+}
+
+// Go runs fn as subsystem name until ctx ends.  Whenever fn returns or
+// panics before that, it is restarted after the current backoff.
+func (s *Supervisor) Go(ctx context.Context, name string, fn func(context.Context) error) {
+	s.mu.Lock()
+	if s.subs[name] == nil {
+		s.subs[name] = &sub{}
+	}
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			err := run(ctx, name, fn)
+			if ctx.Err() != nil {
+				return
+			}
+			d := s.fail(name, err, time.Now())
+			log.Printf("↻  %s stopped (%v); restarting in %v", name, err, d)
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// run calls fn, turning a panic into an error (and a crash report, if
+// enabled).
+func run(ctx context.Context, name string, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			crash.Record(name+" (restarted)", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if err = fn(ctx); err == nil {
+		err = fmt.Errorf("exited")
+	}
+	return err
+}
+
+// fail records a failure and returns the delay before the restart.
+func (s *Supervisor) fail(name string, err error, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.subs[name]
+	st.restarts++
+	st.lastErr = err
+	kept := st.recent[:0]
+	for _, t := range st.recent {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	st.recent = append(kept, now)
+
+	d := s.base << (len(st.recent) - 1)
+	if d > maxDelay || d <= 0 {
+		d = maxDelay
+	}
+	return d
+}
+
+// Status is one line per subsystem: restarts so far and the last error.
+func (s *Supervisor) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.subs))
+	for n := range s.subs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		st := s.subs[n]
+		fmt.Fprintf(&b, "%s: %d restarts", n, st.restarts)
+		if st.lastErr != nil {
+			fmt.Fprintf(&b, " (last: %v)", st.lastErr)
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
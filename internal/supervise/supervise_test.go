@@ -0,0 +1,64 @@
+package supervise
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestartsAfterPanicAndError(t *testing.T) {
+	s := New()
+	s.base = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs atomic.Int32
+	done := make(chan struct{})
+	s.Go(ctx, "flaky", func(ctx context.Context) error {
+		switch runs.Add(1) {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("broken pipe")
+		}
+		close(done)
+		<-ctx.Done()
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("not restarted, runs=%d", runs.Load())
+	}
+	st := s.Status()
+	if !strings.Contains(st, "flaky: 2 restarts") || !strings.Contains(st, "broken pipe") {
+		t.Fatalf("status: %q", st)
+	}
+}
+
+func TestBackoffBudget(t *testing.T) {
+	s := New()
+	s.subs["x"] = &sub{}
+	t0 := time.Now()
+	var last time.Duration
+	for i := 0; i < 3; i++ {
+		last = s.fail("x", errors.New("e"), t0)
+	}
+	if last != 4*time.Second {
+		t.Fatalf("third quick failure: %v, want 4s", last)
+	}
+	for i := 0; i < 20; i++ {
+		last = s.fail("x", errors.New("e"), t0)
+	}
+	if last != maxDelay {
+		t.Fatalf("backoff not capped: %v", last)
+	}
+	// budget refills once the failures age out
+	if d := s.fail("x", errors.New("e"), t0.Add(window+time.Second)); d != time.Second {
+		t.Fatalf("after window: %v, want 1s", d)
+	}
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+)
+
+/*──────── text normalization across platforms ────────────────*/
+// Windows ends lines with CRLF, everything else with LF; pasting one
+// into the other leaves stray ^M in terminals or a single long line in
+// old editors.  Receivers can rewrite text/plain to one convention, and
+// drop the spaces and tabs a line ends with while they are at it.
+
+// Line ending conventions for NormalizeText.
+const (
+	EOLKeep = "keep"
+	EOLLF   = "lf"
+	EOLCRLF = "crlf"
+)
+
+// NormalizeText rewrites every line ending in text to eol (EOLLF or
+// EOLCRLF; anything else leaves them as they are) and, with trim, drops
+// trailing spaces and tabs from every line.  A lone CR is not a line
+// ending.  The result is text itself if nothing changed.
+func NormalizeText(text []byte, eol string, trim bool) []byte {
+	if eol != EOLLF && eol != EOLCRLF && !trim {
+		return text
+	}
+	out := make([]byte, 0, len(text)+bytes.Count(text, []byte("\n")))
+	for rest := text; len(rest) > 0; {
+		line, after, found := bytes.Cut(rest, []byte("\n"))
+		end := "\n"
+		if l, ok := bytes.CutSuffix(line, []byte("\r")); ok && found {
+			line, end = l, "\r\n"
+		}
+		if trim {
+			line = bytes.TrimRight(line, " \t")
+		}
+		out = append(out, line...)
+		if found {
+			switch eol {
+			case EOLLF:
+				end = "\n"
+			case EOLCRLF:
+				end = "\r\n"
+			}
+			out = append(out, end...)
+		}
+		rest = after
+	}
+	if bytes.Equal(out, text) {
+		return text
+	}
+	return out
+}
+
+// NormalizeItems applies NormalizeText to every inline text/plain item,
+// keeping the rest as they are.
+func NormalizeItems(items []Item, eol string, trim bool) []Item {
+	var out []Item
+	for i, it := range items {
+		if it.MimeType != "text/plain" || it.Blob != "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(it.Payload)
+		if err != nil {
+			continue
+		}
+		norm := NormalizeText(raw, eol, trim)
+		if bytes.Equal(norm, raw) {
+			continue
+		}
+		if out == nil {
+			out = append([]Item(nil), items...)
+		}
+		out[i].Payload, out[i].ByteLen = base64.StdEncoding.EncodeToString(norm), len(norm)
+	}
+	if out == nil {
+		return items
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package internal
+
+import "testing"
+
+func TestNormalizeText(t *testing.T) {
+	for _, c := range []struct {
+		in, eol string
+		trim    bool
+		want    string
+	}{
+		{"a\r\nb\r\n", EOLLF, false, "a\nb\n"},
+		{"a\nb", EOLCRLF, false, "a\r\nb"},
+		{"a\r\nb\n", EOLKeep, false, "a\r\nb\n"},
+		{"a \t\r\nb  \nc ", EOLKeep, true, "a\r\nb\nc"},
+		{"a  \r\n", EOLLF, true, "a\n"},
+		{"x\ry\r", EOLLF, false, "x\ry\r"}, // a lone CR stays
+		{"", EOLCRLF, true, ""},
+	} {
+		if got := string(NormalizeText([]byte(c.in), c.eol, c.trim)); got != c.want {
+			t.Errorf("%q %s trim=%v: got %q, want %q", c.in, c.eol, c.trim, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeItemsLeavesOthersAlone(t *testing.T) {
+	items := []Item{TextItem([]byte("a\r\nb")), {MimeType: "text/html", Payload: "YQ0KYg==", ByteLen: 4}}
+	out := NormalizeItems(items, EOLLF, false)
+	if got, _ := Text(out); string(got) != "a\nb" || out[0].ByteLen != 3 {
+		t.Fatalf("text %q (%d bytes)", got, out[0].ByteLen)
+	}
+	if out[1] != items[1] {
+		t.Fatalf("html rewritten: %+v", out[1])
+	}
+	if got, _ := Text(items); string(got) != "a\r\nb" {
+		t.Fatalf("input modified: %q", got)
+	}
+}
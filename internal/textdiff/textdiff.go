@@ -0,0 +1,175 @@
+// Package textdiff renders a unified diff of two texts, for `clipsync
+// diff`.  It is Myers' algorithm over lines, with the characters that
+// make two pastes look alike but differ spelled out.
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Context is how many unchanged lines surround each change.
+const Context = 3
+
+// MaxEdits bounds the work: texts further apart than this many line
+// insertions and deletions aren't diffed.
+const MaxEdits = 4000
+
+// ErrTooDifferent is returned past MaxEdits.
+var ErrTooDifferent = errors.New("textdiff: texts too different to diff")
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified diffs a (called aName) against b; "" if they are the same.
+// Lines keep their terminator, so a missing final newline or CRLF
+// against LF is a difference, and shows as one.  Carriage returns,
+// no-break spaces, zero-width spaces and byte order marks are printed
+// as ␍, ⍽, ‹ZWSP› and ‹BOM›, so the output is for reading, not patch.
+func Unified(aName, bName, a, b string) (string, error) {
+	if a == b {
+		return "", nil
+	}
+	ops, err := diff(lines(a), lines(b))
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	writeHunks(&out, ops)
+	return out.String(), nil
+}
+
+// lines splits s after each newline.
+func lines(s string) []string {
+	l := strings.SplitAfter(s, "\n")
+	if l[len(l)-1] == "" {
+		l = l[:len(l)-1]
+	}
+	return l
+}
+
+// diff is Myers' O(ND) shortest edit script.  Each round's frontier is
+// kept (only the diagonals it reached) to walk the path back.
+func diff(a, b []string) ([]op, error) {
+	n, m := len(a), len(b)
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > MaxEdits {
+			return nil, ErrTooDifferent
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1] // down: insert from b
+			} else {
+				x = v[off+k-1] + 1 // right: delete from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace), nil
+			}
+		}
+	}
+	return nil, ErrTooDifferent // unreachable: d = n+m always ends
+}
+
+func backtrack(a, b []string, trace [][]int) []op {
+	var rev []op
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d] // frontier after round d-1, index k+d
+		k := x - y
+		prev := k - 1
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prev = k + 1
+		}
+		px := v[prev+d]
+		py := px - prev
+		for x > px && y > py {
+			x, y = x-1, y-1
+			rev = append(rev, op{' ', a[x]})
+		}
+		if x == px {
+			y--
+			rev = append(rev, op{'+', b[y]})
+		} else {
+			x--
+			rev = append(rev, op{'-', a[x]})
+		}
+	}
+	for x > 0 {
+		x, y = x-1, y-1
+		rev = append(rev, op{' ', a[x]})
+	}
+	ops := make([]op, len(rev))
+	for i, o := range rev {
+		ops[len(rev)-1-i] = o
+	}
+	return ops
+}
+
+// writeHunks prints the changes with Context lines around them; changes
+// closer than twice that share a hunk.
+func writeHunks(w *strings.Builder, ops []op) {
+	// line numbers reached before each op
+	an, bn := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		an[i+1], bn[i+1] = an[i], bn[i]
+		if o.kind != '+' {
+			an[i+1]++
+		}
+		if o.kind != '-' {
+			bn[i+1]++
+		}
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start, end := max(0, i-Context), i
+		for j := i; j < len(ops) && j < end+2*Context+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		end = min(len(ops), end+Context+1)
+
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", span(an[start], an[end]), span(bn[start], bn[end]))
+		for _, o := range ops[start:end] {
+			w.WriteByte(o.kind)
+			w.WriteString(visible(o.line))
+			if !strings.HasSuffix(o.line, "\n") {
+				w.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+}
+
+// span is a hunk range as diff -u prints it: 1-based start, and the
+// count unless it is 1.
+func span(from, to int) string {
+	switch to - from {
+	case 0:
+		return fmt.Sprintf("%d,0", from)
+	case 1:
+		return fmt.Sprint(from + 1)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+var invisible = strings.NewReplacer("\r", "␍", "\u00a0", "⍽", "\u200b", "‹ZWSP›", "\ufeff", "‹BOM›")
+
+func visible(line string) string { return invisible.Replace(line) }
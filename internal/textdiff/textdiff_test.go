@@ -0,0 +1,61 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+	got, err := Unified("remote", "local", a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `--- remote
++++ local
+@@ -1,7 +1,7 @@
+ one
+ two
+ three
+-four
++FOUR
+ five
+ six
+ seven
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedShowsWhatLooksTheSame(t *testing.T) {
+	got, _ := Unified("a", "b", "x\r\ny\u00a0z", "x\ny z\n")
+	for _, s := range []string{"-x␍\n", "+x\n", "-y⍽z\n\\ No newline at end of file\n", "+y z\n"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("diff lacks %q:\n%s", s, got)
+		}
+	}
+	if got, _ := Unified("a", "b", "same\n", "same\n"); got != "" {
+		t.Errorf("equal texts diffed: %q", got)
+	}
+	if got, _ := Unified("a", "b", "", "new\n"); !strings.Contains(got, "@@ -0,0 +1 @@\n+new\n") {
+		t.Errorf("diff from empty: %q", got)
+	}
+}
+
+func TestUnifiedGivesUp(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < MaxEdits; i++ {
+		a.WriteString("a\n")
+		b.WriteString("b\n")
+	}
+	if _, err := Unified("a", "b", a.String(), b.String()); err != ErrTooDifferent {
+		t.Fatalf("err = %v, want ErrTooDifferent", err)
+	}
+}
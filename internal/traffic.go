@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+/*──────── traffic totals ──────────────────────────────────────*/
+// Traffic totals what a session moved: data snapshots each way, the
+// payload bytes they carried, and how long peers took to confirm ours.
+type Traffic struct {
+	mu sync.Mutex
+	st TrafficStats
+}
+
+// TrafficStats is a snapshot of Traffic.  Bytes are item payloads as
+// they travel (base64, sealed if sealing is on), before compression and
+// without protocol overhead.
+type TrafficStats struct {
+	Since     time.Time     `json:"since"`
+	Sent      int64         `json:"sent"`
+	SentBytes int64         `json:"sent_bytes"`
+	Recv      int64         `json:"received"`
+	RecvBytes int64         `json:"received_bytes"`
+	Receipts  int64         `json:"receipts"`    // delivery receipts for our sends
+	Delivery  time.Duration `json:"delivery_ns"` // their total send → receipt time
+}
+
+func NewTraffic(now time.Time) *Traffic {
+	return &Traffic{st: TrafficStats{Since: now}}
+}
+
+// Sent counts a data snapshot of items handed to the transport.
+func (t *Traffic) Sent(items []Item) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.st.Sent++
+	t.st.SentBytes += payloadBytes(items)
+}
+
+// Received counts a data snapshot of items that came in, wanted or not.
+func (t *Traffic) Received(items []Item) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.st.Recv++
+	t.st.RecvBytes += payloadBytes(items)
+}
+
+// Receipt counts a delivery receipt that took d after the send.
+func (t *Traffic) Receipt(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.st.Receipts++
+	t.st.Delivery += d
+}
+
+// Stats returns the totals so far.
+func (t *Traffic) Stats() TrafficStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.st
+}
+
+// MeanDelivery is the average send → receipt time, 0 before any receipt.
+func (st TrafficStats) MeanDelivery() time.Duration {
+	if st.Receipts == 0 {
+		return 0
+	}
+	return st.Delivery / time.Duration(st.Receipts)
+}
+
+func payloadBytes(items []Item) (n int64) {
+	for _, it := range items {
+		n += int64(len(it.Payload))
+	}
+	return n
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrafficTotals(t *testing.T) {
+	tr := NewTraffic(time.Unix(100, 0))
+	if tr.Stats().MeanDelivery() != 0 {
+		t.Fatalf("mean delivery before any receipt")
+	}
+	tr.Sent([]Item{{Payload: "aGVsbG8="}, {Payload: "aGk="}})
+	tr.Received([]Item{{Payload: "eA=="}})
+	tr.Receipt(100 * time.Millisecond)
+	tr.Receipt(300 * time.Millisecond)
+	st := tr.Stats()
+	if st.Sent != 1 || st.SentBytes != 12 || st.Recv != 1 || st.RecvBytes != 4 || st.Receipts != 2 {
+		t.Fatalf("totals %+v", st)
+	}
+	if st.MeanDelivery() != 200*time.Millisecond || !st.Since.Equal(time.Unix(100, 0)) {
+		t.Fatalf("mean %v since %v", st.MeanDelivery(), st.Since)
+	}
+}
@@ -1,32 +1,166 @@
 package internal
 
-import "crypto/sha256"
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
 
 /*──────── data types shared by everything ─────────────────────*/
 type Item struct {
-	Fmt      uint32 `json:"fmt"`      // numeric clipboard format
-	Payload  string `json:"payload"`  // base64-encoded data
+	Fmt      uint32 `json:"fmt"`     // numeric clipboard format
+	Payload  string `json:"payload"` // base64-encoded data
 	ByteLen  int    `json:"byte_len"`
-	FmtName  string `json:"fmt_name"`  // opt (PNG, image/png)
-	MimeType string `json:"mime_type"` // opt (image/png)
+	FmtName  string `json:"fmt_name"`          // opt (PNG, image/png)
+	MimeType string `json:"mime_type"`         // opt (image/png)
+	Blob     string `json:"blob,omitempty"`    // sha256 hex; payload fetched out of band
+	SameAs   int    `json:"same_as,omitempty"` // 1-based index of an earlier item with this payload, see pack.go
+}
+
+// TextItem is text in the shape the Windows clipboard produces it.
+func TextItem(text []byte) Item {
+	return Item{
+		Fmt:      13, // CF_UNICODETEXT
+		FmtName:  "CF_UNICODETEXT",
+		MimeType: "text/plain",
+		Payload:  base64.StdEncoding.EncodeToString(text),
+		ByteLen:  len(text),
+	}
+}
+
+// MimePrimary is the format of text from the X11 / Wayland PRIMARY
+// selection, what a middle click pastes.  It is not text/plain, so a
+// peer that has no such selection never takes it for a copy: caps
+// filtering drops it unless the peer accepts it by name.
+const MimePrimary = "text/x-primary-selection"
+
+// PrimaryItem is text from the PRIMARY selection.
+func PrimaryItem(text []byte) Item {
+	return Item{
+		FmtName:  "PRIMARY",
+		MimeType: MimePrimary,
+		Payload:  base64.StdEncoding.EncodeToString(text),
+		ByteLen:  len(text),
+	}
+}
+
+// Text is the first text/plain item's text, if there is one.
+func Text(items []Item) ([]byte, bool) {
+	for _, it := range items {
+		if it.MimeType == "text/plain" && it.Blob == "" {
+			b, err := base64.StdEncoding.DecodeString(it.Payload)
+			return b, err == nil
+		}
+	}
+	return nil, false
 }
 
 /*──────── a batch of clipboard items ─────────────────────────*/
+// Wire form is published in internal/schema: append new fields at the
+// end (proto numbers follow field order) and regenerate.
 type Snapshot struct {
-	Origin string `json:"origin"` // 8-char client ID
-	TS     int64  `json:"ts"`     // Unix timestamp
-	Items  []Item `json:"items"`
-	Quick  string `json:"qkey"` // for filtering dupes
+	Origin string   `json:"origin"` // 8-char client ID
+	TS     int64    `json:"ts"`     // Unix timestamp
+	Items  []Item   `json:"items"`
+	Quick  string   `json:"qkey"`              // for filtering dupes
+	Force  bool     `json:"force,omitempty"`   // explicit re-push: skip dedupe
+	Room   string   `json:"room,omitempty"`    // sync group; server fans out within it
+	Seq    uint64   `json:"seq,omitempty"`     // Lamport stamp, see lamport.go
+	Kind   string   `json:"kind,omitempty"`    // "" = clipboard data, else KindAck / KindCaps
+	Ack    string   `json:"ack,omitempty"`     // KindAck: AckKey of the snapshot received
+	Caps   []string `json:"caps,omitempty"`    // KindCaps: formats this device accepts
+	TTL    int      `json:"ttl,omitempty"`     // seconds until receivers clear a secret; 0 = keep
+	N      uint64   `json:"n,omitempty"`       // origin's data snapshot count, see inorder.go
+	Name   string   `json:"name,omitempty"`    // origin's device name, for people (WithDeviceName)
+	SigKey string   `json:"sig_key,omitempty"` // signer's Ed25519 public key, base64, see internal/sign
+	Sig    string   `json:"sig,omitempty"`     // signature over sign.Message
+	Hash   string   `json:"hash,omitempty"`    // ContentHash of Items as sent
+	To     string   `json:"to,omitempty"`      // the one device id that applies it; "" = every peer
+}
+
+// KindAck marks a delivery receipt: no items, Ack names what arrived.
+const KindAck = "ack"
+
+// AckKey is the printable id a receiver echoes back in Snapshot.Ack.
+func AckKey(s Snapshot) string {
+	return hex.EncodeToString([]byte(QuickKey(s.Items))) + fmt.Sprintf("-%d", s.TS)
 }
 
 /*──────── helper: dedupe key ──────────────────────────────────*/
+
+// QuickKey is the first 8 bytes of a SHA-256 over every item's format
+// identity and payload, in order, each field length-prefixed so no two
+// different item lists hash the same bytes (see quickWrite).  The same
+// payload under two formats is two different clips.
 func QuickKey(items []Item) string {
 	if len(items) == 0 {
 		return "empty"
 	}
 	h := sha256.New()
 	for _, it := range items {
-		h.Write([]byte(it.Payload)) // base64 string good enough
+		quickWrite(h, it)
 	}
 	return string(h.Sum(nil)[:8])
 }
+
+// ContentHash is the hex SHA-256 over the same fields as QuickKey, all
+// 32 bytes of it.  Senders stamp it on the items they hand to the
+// transport (sealed, if sealing is on) and receivers check it on what
+// the transport hands back, so a payload damaged anywhere on the way
+// never reaches the clipboard.
+func ContentHash(items []Item) string {
+	h := sha256.New()
+	for _, it := range items {
+		quickWrite(h, it)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// registeredFmt is where Windows starts numbering formats registered
+// by name; those numbers differ from one machine to the next.
+const registeredFmt = 0xC000
+
+// quickWrite feeds one item to QuickKey's hash: the format, as a 4-byte
+// big-endian number (0 for a registered one or none, whose number is
+// local to a machine), then FmtName for those only, then the base64
+// payload, both prefixed with a 4-byte big-endian length.  MimeType and
+// ByteLen follow from these and are left out; so are Blob and SameAs,
+// which only say how the payload travelled.
+func quickWrite(h hash.Hash, it Item) {
+	var b [4]byte
+	num, name := it.Fmt, ""
+	if num == 0 || num >= registeredFmt {
+		num, name = 0, it.FmtName
+	}
+	binary.BigEndian.PutUint32(b[:], num)
+	h.Write(b[:])
+	for _, f := range []string{name, it.Payload} {
+		binary.BigEndian.PutUint32(b[:], uint32(len(f)))
+		h.Write(b[:])
+		h.Write([]byte(f))
+	}
+}
+
+// VerboseKey spells out what QuickKey hashed, item by item, for logs
+// and bug reports: the key in hex, then per item its format and a
+// digest of the payload (never the payload itself).
+func VerboseKey(items []Item) string {
+	var sb strings.Builder
+	sb.WriteString(hex.EncodeToString([]byte(QuickKey(items))))
+	for i, it := range items {
+		sum := sha256.Sum256([]byte(it.Payload))
+		fmt.Fprintf(&sb, " [%d fmt=%d", i, it.Fmt)
+		if it.FmtName != "" {
+			fmt.Fprintf(&sb, " name=%q", it.FmtName)
+		}
+		if it.Fmt == 0 || it.Fmt >= registeredFmt {
+			sb.WriteString(" by-name")
+		}
+		fmt.Fprintf(&sb, " payload=%d:%x]", len(it.Payload), sum[:4])
+	}
+	return sb.String()
+}
@@ -1,6 +1,10 @@
 package internal
 
-import "testing"
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
 
 /*──────── test the QuickKey deduplication key ─────────────────*/
 func TestQuickKey(t *testing.T) {
@@ -29,3 +33,46 @@ func TestQuickKeyEmpty(t *testing.T) {
 		t.Fatalf("expected 'empty' for nil items, got %q", k)
 	}
 }
+
+func TestQuickKeyFormatIdentity(t *testing.T) {
+	same := "aGVsbG8="
+	a := []Item{{Fmt: 13, FmtName: "CF_UNICODETEXT", Payload: same}}
+	b := []Item{{Fmt: 1, FmtName: "CF_TEXT", Payload: same}}
+	if QuickKey(a) == QuickKey(b) {
+		t.Fatalf("same bytes under two formats collide")
+	}
+	// registered formats are numbered per machine: only the name counts
+	c := []Item{{Fmt: 0xC123, FmtName: "PNG", Payload: same}}
+	d := []Item{{Fmt: 0xC0AA, FmtName: "PNG", Payload: same}}
+	e := []Item{{Fmt: 0xC123, FmtName: "HTML Format", Payload: same}}
+	if QuickKey(c) != QuickKey(d) {
+		t.Fatalf("one registered format, two machines: keys differ")
+	}
+	if QuickKey(c) == QuickKey(e) {
+		t.Fatalf("two registered formats collide")
+	}
+	// how the payload travelled doesn't matter
+	f := []Item{{Fmt: 13, FmtName: "CF_UNICODETEXT", MimeType: "text/plain", Payload: same, ByteLen: 5, Blob: "x", SameAs: 1}}
+	if QuickKey(a) != QuickKey(f) {
+		t.Fatalf("transport fields changed the key")
+	}
+	// field boundaries are part of the hash
+	g := []Item{{Payload: "YWI="}, {Payload: "Yw=="}}
+	h := []Item{{Payload: "YWI=Yw=="}}
+	if QuickKey(g) == QuickKey(h) {
+		t.Fatalf("split payloads collide with the joined one")
+	}
+}
+
+func TestVerboseKey(t *testing.T) {
+	items := []Item{TextItem([]byte("secret")), {Fmt: 0xC123, FmtName: "PNG", Payload: "iVBO"}}
+	v := VerboseKey(items)
+	for _, want := range []string{hex.EncodeToString([]byte(QuickKey(items))), `fmt=13 name="CF_UNICODETEXT"`, `name="PNG" by-name`, "payload=4:"} {
+		if !strings.Contains(v, want) {
+			t.Errorf("VerboseKey = %s, missing %s", v, want)
+		}
+	}
+	if strings.Contains(v, items[0].Payload) {
+		t.Fatalf("VerboseKey shows the payload: %s", v)
+	}
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+/*──────── links ───────────────────────────────────────────────*/
+// A copied link travels as text and, next to it, as text/uri-list
+// (RFC 2483: one URI per line, CRLF, "#" starts a comment), so a
+// receiver can also put it where links go: the URL formats browsers
+// use on Windows.  Text that only looks like a URI ("note:this") is no
+// link: a URI needs a host, or be a file: or mailto: one.
+
+// MimeURIList is the format of a copied link or list of links.
+const MimeURIList = "text/uri-list"
+
+// URIs reads text as a uri-list: ok if every line that isn't blank or
+// a comment is an absolute URI, and there is at least one.
+func URIs(text []byte) ([]string, bool) {
+	var uris []string
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isURI(line) {
+			return nil, false
+		}
+		uris = append(uris, line)
+	}
+	return uris, len(uris) > 0
+}
+
+func isURI(s string) bool {
+	if strings.ContainsAny(s, " \t") {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+	switch {
+	case u.Host != "":
+		return true
+	case u.Scheme == "file":
+		return u.Path != ""
+	case u.Scheme == "mailto":
+		return strings.Contains(u.Opaque, "@")
+	}
+	return false
+}
+
+// TagURLs adds a text/uri-list item after the first text/plain one when
+// that text is nothing but URIs, unless items already carry one.
+func TagURLs(items []Item) []Item {
+	at := -1
+	for i, it := range items {
+		if it.MimeType == MimeURIList {
+			return items
+		}
+		if at < 0 && it.MimeType == "text/plain" && it.Blob == "" {
+			at = i
+		}
+	}
+	if at < 0 {
+		return items
+	}
+	text, err := base64.StdEncoding.DecodeString(items[at].Payload)
+	if err != nil || len(text) > 64<<10 { // a page of links at most
+		return items
+	}
+	uris, ok := URIs(text)
+	if !ok {
+		return items
+	}
+	list := []byte(strings.Join(uris, "\r\n") + "\r\n")
+	tagged := make([]Item, 0, len(items)+1)
+	tagged = append(tagged, items[:at+1]...)
+	tagged = append(tagged, Item{
+		FmtName:  MimeURIList,
+		MimeType: MimeURIList,
+		Payload:  base64.StdEncoding.EncodeToString(list),
+		ByteLen:  len(list),
+	})
+	return append(tagged, items[at+1:]...)
+}
+
+// URLText adds a text/plain item holding a text/uri-list item's URIs,
+// one per line, when items carry no text/plain of their own: the links
+// then paste as text too.
+func URLText(items []Item) []Item {
+	var list []byte
+	for _, it := range items {
+		switch {
+		case it.MimeType == "text/plain":
+			return items
+		case it.MimeType == MimeURIList && list == nil && it.Blob == "":
+			list, _ = base64.StdEncoding.DecodeString(it.Payload)
+		}
+	}
+	uris, ok := URIs(list)
+	if !ok {
+		return items
+	}
+	text := []byte(strings.Join(uris, "\n"))
+	return append([]Item{TextItem(text)}, items...)
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestURIs(t *testing.T) {
+	for in, want := range map[string]int{
+		"https://example.com/a?b=c":                        1,
+		"  https://example.com  \n":                        1,
+		"# links\r\nhttp://a.example\r\nfile:///tmp/x\r\n": 2,
+		"mailto:someone@example.com":                       1,
+		"note:this":                                        0,
+		"see https://example.com":                          0,
+		"https://example.com\nand some text":               0,
+		"C:\\Users\\me":                                    0,
+		"":                                                 0,
+	} {
+		uris, ok := URIs([]byte(in))
+		if got := len(uris); got != want || ok != (want > 0) {
+			t.Errorf("%q: %v, %v", in, uris, ok)
+		}
+	}
+}
+
+func TestTagURLsAndURLText(t *testing.T) {
+	items := TagURLs([]Item{TextItem([]byte("https://example.com\n"))})
+	if len(items) != 2 || items[1].MimeType != MimeURIList {
+		t.Fatalf("tagged: %+v", items)
+	}
+	if list, _ := base64.StdEncoding.DecodeString(items[1].Payload); string(list) != "https://example.com\r\n" {
+		t.Fatalf("uri-list %q", list)
+	}
+	if again := TagURLs(items); len(again) != 2 {
+		t.Fatalf("tagged twice: %+v", again)
+	}
+	if plain := TagURLs([]Item{TextItem([]byte("hello"))}); len(plain) != 1 {
+		t.Fatalf("plain text tagged: %+v", plain)
+	}
+
+	if got := URLText(items); len(got) != 2 {
+		t.Fatalf("text added next to text: %+v", got)
+	}
+	got := URLText(items[1:])
+	if text, _ := Text(got); string(text) != "https://example.com" || len(got) != 2 {
+		t.Fatalf("from uri-list alone: %+v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package webp
+
+// boolWriter is the boolean entropy encoder of RFC 6386 section 7.3,
+// the counterpart of the decoder's partition reader.
+type boolWriter struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolWriter() *boolWriter {
+	return &boolWriter{rng: 255, bitCount: 24}
+}
+
+// putBit codes b, which is false with probability prob/256.
+func (w *boolWriter) putBit(prob uint8, b bool) {
+	split := 1 + (w.rng-1)*uint32(prob)>>8
+	if b {
+		w.bottom += split
+		w.rng -= split
+	} else {
+		w.rng = split
+	}
+	for w.rng < 128 {
+		w.rng <<= 1
+		if w.bottom&(1<<31) != 0 {
+			w.carry()
+		}
+		w.bottom <<= 1
+		if w.bitCount--; w.bitCount == 0 {
+			w.buf = append(w.buf, byte(w.bottom>>24))
+			w.bottom &= 1<<24 - 1
+			w.bitCount = 8
+		}
+	}
+}
+
+// carry propagates an overflow of bottom into the bytes already out.
+func (w *boolWriter) carry() {
+	i := len(w.buf) - 1
+	for ; i >= 0 && w.buf[i] == 0xff; i-- {
+		w.buf[i] = 0
+	}
+	if i >= 0 {
+		w.buf[i]++
+	}
+}
+
+// putUint codes the low n bits of v, most significant first, at even odds.
+func (w *boolWriter) putUint(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.putBit(uniformProb, v>>uint(i)&1 != 0)
+	}
+}
+
+// bytes pushes out what is still held in bottom, the way libvpx does:
+// 32 even-odds zeros, then the coded bytes.
+func (w *boolWriter) bytes() []byte {
+	for i := 0; i < 32; i++ {
+		w.putBit(uniformProb, false)
+	}
+	return w.buf
+}
+
+// uniformProb is a 50% probability that the next bit is 0.
+const uniformProb = 128
@@ -0,0 +1,522 @@
+package webp
+
+import "math"
+
+/*──────── VP8 key frame ──────────────────────────────────────*/
+// Every macroblock is coded the simplest way the format allows: one
+// 16×16 luma prediction (DC, V, H or TM, whichever is closest) with its
+// DC terms gathered in a Y2 block, one 8×8 chroma prediction, and the
+// residuals quantised without trellis or skip flags.  The frame keeps
+// the default token probabilities and no loop filter, so the only
+// header fields that vary are the size and the quantiser index.
+
+// Prediction modes, numbered as in the decoder.
+const (
+	predDC = iota
+	predTM
+	predVE
+	predHE
+	nPred
+)
+
+// quant holds the DC and AC step sizes of one plane type.
+type quant [2]int32
+
+// nzCtx is what a neighbouring macroblock tells the token coder: for
+// each 4×4 column (above) or row (left), whether its last block coded
+// any coefficient.  uv holds U in 0–1 and V in 2–3.
+type nzCtx struct {
+	y2 uint8
+	y  [4]uint8
+	uv [4]uint8
+}
+
+type plane struct {
+	pix    []uint8
+	stride int
+}
+
+func (p *plane) at(x, y int) uint8 { return p.pix[y*p.stride+x] }
+
+type encoder struct {
+	mbw, mbh   int
+	src, rec   [3]plane // Y, U, V; padded to whole macroblocks
+	y1, y2, uv quant
+	hdr, tok   *boolWriter
+	up         []nzCtx
+	left       nzCtx
+}
+
+func newEncoder(mbw, mbh, qi int) *encoder {
+	e := &encoder{mbw: mbw, mbh: mbh, hdr: newBoolWriter(), tok: newBoolWriter(), up: make([]nzCtx, mbw)}
+	for i := range e.src {
+		w, h := 16*mbw, 16*mbh
+		if i > 0 {
+			w, h = w/2, h/2
+		}
+		e.src[i] = plane{make([]uint8, w*h), w}
+		e.rec[i] = plane{make([]uint8, w*h), w}
+	}
+	e.y1 = quant{int32(dequantTableDC[qi]), int32(dequantTableAC[qi])}
+	e.y2 = quant{int32(dequantTableDC[qi]) * 2, int32(dequantTableAC[qi]) * 155 / 100}
+	if e.y2[1] < 8 {
+		e.y2[1] = 8
+	}
+	e.uv = quant{int32(dequantTableDC[min(qi, 117)]), int32(dequantTableAC[qi])}
+	return e
+}
+
+// frameHeader codes the first partition's header (section 9.2–9.11).
+func (e *encoder) frameHeader(qi int) {
+	w := e.hdr
+	w.putUint(0, 2) // colour space, clamping
+	w.putUint(0, 1) // no segmentation
+	w.putUint(0, 1) // normal filter…
+	w.putUint(0, 6) // …at level 0, i.e. off
+	w.putUint(0, 3) // sharpness
+	w.putUint(0, 1) // no loop filter deltas
+	w.putUint(0, 2) // one token partition
+	w.putUint(uint32(qi), 7)
+	w.putUint(0, 5) // no quantiser deltas
+	w.putUint(0, 1) // refresh_entropy_probs
+	for i := range tokenProbUpdateProb {
+		for j := range tokenProbUpdateProb[i] {
+			for k := range tokenProbUpdateProb[i][j] {
+				for _, p := range tokenProbUpdateProb[i][j][k] {
+					w.putBit(p, false)
+				}
+			}
+		}
+	}
+	w.putUint(0, 1) // no skip flags
+}
+
+func (e *encoder) encode() {
+	for mby := 0; mby < e.mbh; mby++ {
+		e.left = nzCtx{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.macroblock(mbx, mby)
+		}
+	}
+}
+
+func (e *encoder) macroblock(mbx, mby int) {
+	var yPred [256]uint8
+	yMode := e.bestMode(0, mbx, mby, 16, yPred[:])
+	var uPred, vPred [64]uint8
+	uvMode := e.bestMode(1, mbx, mby, 8, uPred[:])
+	e.predict(2, mbx, mby, 8, uvMode, vPred[:])
+
+	// Mode header, section 11.2: 16×16 luma, then the trees.
+	w := e.hdr
+	w.putBit(145, true)
+	switch yMode {
+	case predDC, predVE:
+		w.putBit(156, false)
+		w.putBit(163, yMode == predVE)
+	default:
+		w.putBit(156, true)
+		w.putBit(128, yMode == predTM)
+	}
+	w.putBit(142, uvMode != predDC)
+	if uvMode != predDC {
+		w.putBit(114, uvMode != predVE)
+		if uvMode != predVE {
+			w.putBit(183, uvMode == predTM)
+		}
+	}
+
+	// Luma: transform each 4×4 block, then move the DC terms to Y2.
+	var coef [16][16]float64
+	var dc [16]float64
+	for n := range coef {
+		bx, by := n%4*4, n/4*4
+		var res [16]float64
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				s := e.src[0].at(16*mbx+bx+i, 16*mby+by+j)
+				res[4*j+i] = float64(s) - float64(yPred[(by+j)*16+bx+i])
+			}
+		}
+		coef[n] = fdct(res)
+		dc[n] = coef[n][0]
+	}
+	var y2Lvl [16]int32
+	y2Deq := quantize(fwht(dc), e.y2, 0, &y2Lvl)
+	ydc := iwht(y2Deq)
+	nz := e.tokens(planeY2, e.left.y2+e.up[mbx].y2, 0, &y2Lvl)
+	e.left.y2, e.up[mbx].y2 = nz, nz
+
+	var yLvl [16][16]int32
+	for n := range coef {
+		deq := quantize(coef[n], e.y1, 1, &yLvl[n])
+		deq[0] = ydc[n]
+		bx, by := n%4*4, n/4*4
+		e.reconstruct(&e.rec[0], 16*mbx+bx, 16*mby+by, yPred[by*16+bx:], 16, deq)
+	}
+	for n := range yLvl {
+		x, y := n%4, n/4
+		nz := e.tokens(planeY1WithY2, e.left.y[y]+e.up[mbx].y[x], 1, &yLvl[n])
+		e.left.y[y], e.up[mbx].y[x] = nz, nz
+	}
+
+	// Chroma: U then V, four 4×4 blocks each.
+	for c, pred := range [2][]uint8{uPred[:], vPred[:]} {
+		p := 1 + c
+		var lvl [4][16]int32
+		for n := range lvl {
+			bx, by := n%2*4, n/2*4
+			var res [16]float64
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					s := e.src[p].at(8*mbx+bx+i, 8*mby+by+j)
+					res[4*j+i] = float64(s) - float64(pred[(by+j)*8+bx+i])
+				}
+			}
+			deq := quantize(fdct(res), e.uv, 0, &lvl[n])
+			e.reconstruct(&e.rec[p], 8*mbx+bx, 8*mby+by, pred[by*8+bx:], 8, deq)
+		}
+		for n := range lvl {
+			x, y := 2*c+n%2, 2*c+n/2
+			nz := e.tokens(planeUV, e.left.uv[y]+e.up[mbx].uv[x], 0, &lvl[n])
+			e.left.uv[y], e.up[mbx].uv[x] = nz, nz
+		}
+	}
+}
+
+// bestMode fills pred with the prediction of plane p (0 luma, 1 or 2
+// chroma; for chroma the choice is scored over U and V together) that
+// is closest to the source, and returns its mode.
+func (e *encoder) bestMode(p, mbx, mby, size int, pred []uint8) int {
+	best, bestErr := predDC, int64(math.MaxInt64)
+	var try, try2 [256]uint8
+	for mode := 0; mode < nPred; mode++ {
+		e.predict(p, mbx, mby, size, mode, try[:])
+		err := e.sse(p, mbx, mby, size, try[:])
+		if p > 0 {
+			e.predict(p+1, mbx, mby, size, mode, try2[:])
+			err += e.sse(p+1, mbx, mby, size, try2[:])
+		}
+		if err < bestErr {
+			best, bestErr = mode, err
+			copy(pred, try[:size*size])
+		}
+	}
+	return best
+}
+
+func (e *encoder) sse(p, mbx, mby, size int, pred []uint8) (sum int64) {
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			d := int64(e.src[p].at(size*mbx+i, size*mby+j)) - int64(pred[j*size+i])
+			sum += d * d
+		}
+	}
+	return sum
+}
+
+// predict builds a size×size prediction from the reconstructed
+// neighbours, with the decoder's stand-ins at the frame edges: 127
+// above the first row, 129 left of the first column.
+func (e *encoder) predict(p, mbx, mby, size, mode int, out []uint8) {
+	r := &e.rec[p]
+	x0, y0 := size*mbx, size*mby
+	var top, left [16]int32
+	for i := 0; i < size; i++ {
+		top[i], left[i] = 0x7f, 0x81
+		if mby > 0 {
+			top[i] = int32(r.at(x0+i, y0-1))
+		}
+		if mbx > 0 {
+			left[i] = int32(r.at(x0-1, y0+i))
+		}
+	}
+	corner := int32(0x7f)
+	switch {
+	case mby == 0:
+	case mbx == 0:
+		corner = 0x81
+	default:
+		corner = int32(r.at(x0-1, y0-1))
+	}
+	var dc int32
+	if mode == predDC {
+		// The decoder averages only the edges that exist.
+		shift := 3
+		if size == 16 {
+			shift = 4
+		}
+		var sum int32
+		switch {
+		case mbx == 0 && mby == 0:
+			dc = 0x80
+		case mbx == 0:
+			for i := 0; i < size; i++ {
+				sum += top[i]
+			}
+			dc = (sum + int32(size/2)) >> shift
+		case mby == 0:
+			for i := 0; i < size; i++ {
+				sum += left[i]
+			}
+			dc = (sum + int32(size/2)) >> shift
+		default:
+			for i := 0; i < size; i++ {
+				sum += top[i] + left[i]
+			}
+			dc = (sum + int32(size)) >> (shift + 1)
+		}
+	}
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			var v int32
+			switch mode {
+			case predDC:
+				v = dc
+			case predTM:
+				v = left[j] + top[i] - corner
+			case predVE:
+				v = top[i]
+			case predHE:
+				v = left[j]
+			}
+			out[j*size+i] = clip8(v)
+		}
+	}
+}
+
+// reconstruct adds the inverse transform of coef to the prediction and
+// stores the 4×4 result at (x, y), exactly as the decoder will.
+func (e *encoder) reconstruct(r *plane, x, y int, pred []uint8, predStride int, coef [16]int32) {
+	res := idct(coef)
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			r.pix[(y+j)*r.stride+x+i] = clip8(int32(pred[j*predStride+i]) + res[4*j+i])
+		}
+	}
+}
+
+// tokens codes one block's quantised levels (section 13) and returns 1
+// if any was non-zero, for the neighbours' contexts.
+func (e *encoder) tokens(pl int, ctx uint8, first int, lvl *[16]int32) uint8 {
+	w, prob := e.tok, &defaultTokenProb[pl]
+	last := -1
+	for n := first; n < 16; n++ {
+		if lvl[zigzag[n]] != 0 {
+			last = n
+		}
+	}
+	p := &prob[bands[first]][ctx]
+	if last < 0 {
+		w.putBit(p[0], false)
+		return 0
+	}
+	w.putBit(p[0], true)
+	for n := first; n < 16; n++ {
+		v := lvl[zigzag[n]]
+		if v == 0 {
+			w.putBit(p[1], false)
+			p = &prob[bands[n+1]][0]
+			continue
+		}
+		w.putBit(p[1], true)
+		a := uint32(v)
+		if v < 0 {
+			a = uint32(-v)
+		}
+		if a == 1 {
+			w.putBit(p[2], false)
+			p = &prob[bands[n+1]][1]
+		} else {
+			w.putBit(p[2], true)
+			putLevel(w, p, a)
+			p = &prob[bands[n+1]][2]
+		}
+		w.putBit(uniformProb, v < 0)
+		if n == 15 {
+			break
+		}
+		w.putBit(p[0], n < last)
+		if n == last {
+			break
+		}
+	}
+	return 1
+}
+
+// putLevel codes a level of 2 or more: the token tree below the "one"
+// branch and any extra bits of its category.
+func putLevel(w *boolWriter, p *[nProb]uint8, a uint32) {
+	switch {
+	case a <= 4:
+		w.putBit(p[3], false)
+		w.putBit(p[4], a > 2)
+		if a > 2 {
+			w.putBit(p[5], a == 4)
+		}
+	case a <= 10:
+		w.putBit(p[3], true)
+		w.putBit(p[6], false)
+		w.putBit(p[7], a > 6)
+		if a <= 6 {
+			w.putBit(159, a == 6)
+		} else {
+			w.putBit(165, (a-7)&2 != 0)
+			w.putBit(145, (a-7)&1 != 0)
+		}
+	default:
+		w.putBit(p[3], true)
+		w.putBit(p[6], true)
+		cat := 0
+		for cat < 3 && a >= 3+(8<<uint(cat+1)) {
+			cat++
+		}
+		w.putBit(p[8], cat >= 2)
+		w.putBit(p[9+cat/2], cat&1 != 0)
+		tab := &cat3456[cat]
+		n := 0
+		for tab[n] != 0 {
+			n++
+		}
+		extra := a - 3 - 8<<uint(cat)
+		for i := 0; i < n; i++ {
+			w.putBit(tab[i], extra>>uint(n-1-i)&1 != 0)
+		}
+	}
+}
+
+/*──────── transforms ─────────────────────────────────────────*/
+// The forward transforms are the exact inverses of the decoder's, done
+// in floating point; reconstruction uses the decoder's integer code, so
+// encoder and decoder never drift apart.
+
+// idctBasis is the decoder's 1-D inverse DCT as a matrix: out = M·in.
+var idctBasis = func() (m [4][4]float64) {
+	c1, c2 := math.Sqrt2*math.Cos(math.Pi/8), math.Sqrt2*math.Sin(math.Pi/8)
+	return [4][4]float64{
+		{1, c1, 1, c2},
+		{1, c2, -1, -c1},
+		{1, -c2, -1, c1},
+		{1, -c1, 1, -c2},
+	}
+}()
+
+// whtBasis is the decoder's 1-D inverse Walsh–Hadamard transform.
+var whtBasis = [4][4]float64{
+	{1, 1, 1, 1},
+	{1, 1, -1, -1},
+	{1, -1, -1, 1},
+	{1, -1, 1, -1},
+}
+
+// fdct inverts R = M·C·Mᵀ/8: as MᵀM = 4I, C = Mᵀ·R·M/2.
+func fdct(res [16]float64) [16]float64 {
+	return sandwich(&idctBasis, res, 0.5)
+}
+
+// fwht inverts D = H·C·H/8, H being symmetric with H·H = 4I.
+func fwht(dc [16]float64) [16]float64 {
+	return sandwich(&whtBasis, dc, 0.5)
+}
+
+// sandwich returns scale·Mᵀ·X·M for 4×4 X in raster order.
+func sandwich(m *[4][4]float64, x [16]float64, scale float64) (out [16]float64) {
+	var t [4][4]float64
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			for k := 0; k < 4; k++ {
+				t[r][c] += m[k][r] * x[4*k+c]
+			}
+		}
+	}
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			var s float64
+			for k := 0; k < 4; k++ {
+				s += t[r][k] * m[k][c]
+			}
+			out[4*r+c] = s * scale
+		}
+	}
+	return out
+}
+
+// quantize rounds coefficients first… to levels in lvl and returns them
+// dequantised, as the decoder will see them.  AC terms round with a
+// small dead zone, which costs little quality and saves many bits.
+func quantize(c [16]float64, q quant, first int, lvl *[16]int32) (deq [16]int32) {
+	for i := first; i < 16; i++ {
+		step := q[min(i, 1)]
+		bias := 0.5
+		if i > 0 {
+			bias = 0.4
+		}
+		a := int32(math.Abs(c[i])/float64(step) + bias)
+		a = min(a, 2048, 32767/step)
+		if c[i] < 0 {
+			a = -a
+		}
+		lvl[i], deq[i] = a, a*step
+	}
+	return deq
+}
+
+// idct is the decoder's integer inverse DCT, less the prediction.
+func idct(in [16]int32) (out [16]int32) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2).
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2).
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		out[4*j+0] = (a + d) >> 3
+		out[4*j+1] = (b + c) >> 3
+		out[4*j+2] = (b - c) >> 3
+		out[4*j+3] = (a - d) >> 3
+	}
+	return out
+}
+
+// iwht is the decoder's integer inverse WHT: the DC term of each of the
+// 16 luma blocks, in raster order.
+func iwht(in [16]int32) (out [16]int32) {
+	var m [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := in[i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[i] - in[12+i]
+		m[i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := m[4*i] + 3
+		a0 := dc + m[4*i+3]
+		a1 := m[4*i+1] + m[4*i+2]
+		a2 := m[4*i+1] - m[4*i+2]
+		a3 := dc - m[4*i+3]
+		out[4*i+0] = (a0 + a1) >> 3
+		out[4*i+1] = (a3 + a2) >> 3
+		out[4*i+2] = (a0 - a1) >> 3
+		out[4*i+3] = (a3 - a2) >> 3
+	}
+	return out
+}
+
+func clip8(v int32) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
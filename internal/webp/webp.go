@@ -0,0 +1,144 @@
+// Package webp writes lossy WebP: one VP8 key frame in a RIFF box, so
+// photographs cross the wire smaller than as JPEG at the same quality.
+// It is a plain encoder (see encode.go) that any WebP decoder reads;
+// Decode pairs it with golang.org/x/image/webp for the receiving side.
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+// MaxSize is the largest width or height VP8 can describe.
+const MaxSize = 1<<14 - 1
+
+var ErrTooLarge = errors.New("webp: image too large")
+
+// Encode writes m as lossy WebP at quality 1–100, as jpeg.Options
+// reads it.  Alpha is dropped: callers only hand over opaque images.
+func Encode(w io.Writer, m image.Image, quality int) error {
+	b := m.Bounds()
+	if b.Dx() > MaxSize || b.Dy() > MaxSize {
+		return ErrTooLarge
+	}
+	if b.Empty() {
+		return errors.New("webp: empty image")
+	}
+	quality = min(max(quality, 1), 100)
+	qi := (100 - quality) * 127 / 99
+
+	mbw, mbh := (b.Dx()+15)/16, (b.Dy()+15)/16
+	e := newEncoder(mbw, mbh, qi)
+	toYUV(m, &e.src)
+	e.frameHeader(qi)
+	e.encode()
+	first, tok := e.hdr.bytes(), e.tok.bytes()
+
+	// Frame tag and key frame header, section 9.1.
+	var vp8 bytes.Buffer
+	n := len(first)
+	vp8.Write([]byte{
+		byte(n<<5) | 1<<4, // key frame, version 0, shown
+		byte(n >> 3), byte(n >> 11),
+		0x9d, 0x01, 0x2a,
+		byte(b.Dx()), byte(b.Dx() >> 8),
+		byte(b.Dy()), byte(b.Dy() >> 8),
+	})
+	vp8.Write(first)
+	vp8.Write(tok)
+	if vp8.Len()&1 != 0 {
+		vp8.WriteByte(0)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(12+vp8.Len()))
+	out.WriteString("WEBPVP8 ")
+	binary.Write(&out, binary.LittleEndian, uint32(len(first)+len(tok)+10))
+	out.Write(vp8.Bytes())
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// toYUV fills the Y, U and V planes from m with the BT.601 studio-range
+// colours VP8 uses, repeating the last row and column into the padding.
+func toYUV(m image.Image, p *[3]plane) {
+	b := m.Bounds()
+	rgba, ok := m.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, m, b.Min, draw.Src)
+	}
+	w, h := b.Dx(), b.Dy()
+	px := func(x, y int) (r, g, b float64) {
+		o := rgba.PixOffset(rgba.Rect.Min.X+min(x, w-1), rgba.Rect.Min.Y+min(y, h-1))
+		s := rgba.Pix[o : o+3 : o+3]
+		return float64(s[0]), float64(s[1]), float64(s[2])
+	}
+	y := &p[0]
+	for j := 0; j < len(y.pix)/y.stride; j++ {
+		for i := 0; i < y.stride; i++ {
+			r, g, b := px(i, j)
+			y.pix[j*y.stride+i] = clip8(int32(16.5 + 0.2568*r + 0.5041*g + 0.0979*b))
+		}
+	}
+	u, v := &p[1], &p[2]
+	for j := 0; j < len(u.pix)/u.stride; j++ {
+		for i := 0; i < u.stride; i++ {
+			var r, g, b float64
+			for k := 0; k < 4; k++ {
+				r1, g1, b1 := px(2*i+k%2, 2*j+k/2)
+				r, g, b = r+r1/4, g+g1/4, b+b1/4
+			}
+			u.pix[j*u.stride+i] = clip8(int32(128.5 - 0.1482*r - 0.2910*g + 0.4392*b))
+			v.pix[j*v.stride+i] = clip8(int32(128.5 + 0.4392*r - 0.3678*g - 0.0714*b))
+		}
+	}
+}
+
+// Decode reads a WebP image.  Lossy ones come back as RGBA converted
+// with the studio-range colours Encode (and libwebp) use; x/image
+// would read them as full-range JPEG colours, a little washed out.
+func Decode(r io.Reader) (image.Image, error) {
+	m, err := xwebp.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	var ycc *image.YCbCr
+	switch m := m.(type) {
+	case *image.YCbCr:
+		ycc = m
+	case *image.NYCbCrA:
+		ycc = &m.YCbCr
+	default:
+		return m, nil
+	}
+	b := ycc.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			yy := 1.164 * (float64(ycc.Y[ycc.YOffset(x, y)]) - 16)
+			co := ycc.COffset(x, y)
+			cb, cr := float64(ycc.Cb[co])-128, float64(ycc.Cr[co])-128
+			o := out.PixOffset(x, y)
+			out.Pix[o+0] = clip8(int32(yy + 1.596*cr + 0.5))
+			out.Pix[o+1] = clip8(int32(yy - 0.392*cb - 0.813*cr + 0.5))
+			out.Pix[o+2] = clip8(int32(yy + 2.017*cb + 0.5))
+			out.Pix[o+3] = 0xff
+		}
+	}
+	if a, ok := m.(*image.NYCbCrA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				out.Pix[out.PixOffset(x, y)+3] = a.A[a.AOffset(x, y)]
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// photo is a smooth gradient with some texture, in an odd size so the
+// padding to whole macroblocks gets exercised.
+func photo(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.Set(x, y, color.RGBA{
+				R: uint8(x * 255 / w),
+				G: uint8(y * 255 / h),
+				B: uint8(128 + 60*math.Sin(float64(x)/7)*math.Cos(float64(y)/5)),
+				A: 0xff,
+			})
+		}
+	}
+	return m
+}
+
+func psnr(a, b image.Image) float64 {
+	var sse float64
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			for _, d := range []float64{
+				float64(r1>>8) - float64(r2>>8),
+				float64(g1>>8) - float64(g2>>8),
+				float64(b1>>8) - float64(b2>>8),
+			} {
+				sse += d * d
+			}
+		}
+	}
+	mse := sse / float64(3*r.Dx()*r.Dy())
+	return 10 * math.Log10(255*255/mse)
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := photo(157, 83)
+	for _, c := range []struct {
+		q   int
+		min float64 // dB
+	}{{30, 24}, {80, 32}, {95, 36}} {
+		q := c.q
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, q); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("q%d: %v", q, err)
+		}
+		if got.Bounds() != src.Bounds() {
+			t.Fatalf("q%d: bounds %v", q, got.Bounds())
+		}
+		if p := psnr(src, got); p < c.min {
+			t.Errorf("q%d: PSNR %.1f dB (%d bytes)", q, p, buf.Len())
+		}
+	}
+}
+
+func TestQualityShrinks(t *testing.T) {
+	src := photo(256, 256)
+	size := func(q int) int {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, q); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Len()
+	}
+	if lo, hi := size(20), size(90); lo >= hi {
+		t.Errorf("q20 %d bytes, q90 %d", lo, hi)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, MaxSize+1, 1))
+	if err := Encode(new(bytes.Buffer), m, 80); err != ErrTooLarge {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+// Package xclip is the Linux desktop clipboard, driven through
+// wl-clipboard (wl-paste, wl-copy) under Wayland or xclip under X11,
+// and Android's under Termux through Termux:API: text only.  None of
+// them tells anyone when a selection changes, so Run reads them every
+// Interval.  With Options.Primary the PRIMARY selection, what a middle
+// click pastes, is synced too where there is one, as items of its own
+// format (core.MimePrimary); a change to either selection is a copy of
+// its own, holding that selection's text alone.
+package xclip
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/clip"
+)
+
+// Selections.
+const (
+	selClipboard = "clipboard"
+	selPrimary   = "primary"
+)
+
+// Tool is the program pair that reads and sets a selection.  Get's
+// command prints the selection's text; Set's takes it on stdin.
+type Tool struct {
+	Name     string
+	Get      func(ctx context.Context, sel string) *exec.Cmd
+	Set      func(ctx context.Context, sel string) *exec.Cmd
+	Primary  bool          // has a PRIMARY selection
+	Interval time.Duration // default Options.Interval, if not 500ms
+}
+
+// Wayland is wl-clipboard.
+var Wayland = Tool{
+	Name: "wl-clipboard",
+	Get: func(ctx context.Context, sel string) *exec.Cmd {
+		return exec.CommandContext(ctx, "wl-paste", wlArgs(sel, "--no-newline", "--type", "text")...)
+	},
+	Set: func(ctx context.Context, sel string) *exec.Cmd {
+		return exec.CommandContext(ctx, "wl-copy", wlArgs(sel, "--type", "text/plain;charset=utf-8")...)
+	},
+	Primary: true,
+}
+
+func wlArgs(sel string, args ...string) []string {
+	if sel == selPrimary {
+		return append(args, "--primary")
+	}
+	return args
+}
+
+// X11 is xclip.
+var X11 = Tool{
+	Name: "xclip",
+	Get: func(ctx context.Context, sel string) *exec.Cmd {
+		return exec.CommandContext(ctx, "xclip", "-o", "-selection", sel, "-t", "UTF8_STRING")
+	},
+	Set: func(ctx context.Context, sel string) *exec.Cmd {
+		return exec.CommandContext(ctx, "xclip", "-i", "-selection", sel, "-t", "UTF8_STRING")
+	},
+	Primary: true,
+}
+
+// Termux is Termux:API's clipboard commands, on Android.  Each run
+// goes through the Termux:API app, a few hundred milliseconds, so it
+// is read less often.
+var Termux = Tool{
+	Name: "termux-api",
+	Get: func(ctx context.Context, _ string) *exec.Cmd {
+		return exec.CommandContext(ctx, "termux-clipboard-get")
+	},
+	Set: func(ctx context.Context, _ string) *exec.Cmd {
+		return exec.CommandContext(ctx, "termux-clipboard-set")
+	},
+	Interval: 2 * time.Second,
+}
+
+// Detect picks the tool for this session: Termux:API under Termux,
+// wl-clipboard under Wayland, xclip under X11, whichever is installed.
+// false outside those or with none of them.
+func Detect() (Tool, bool) {
+	if os.Getenv("TERMUX_VERSION") != "" {
+		if _, err := exec.LookPath("termux-clipboard-get"); err == nil {
+			return Termux, true
+		}
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-paste"); err == nil {
+			return Wayland, true
+		}
+	}
+	if os.Getenv("DISPLAY") != "" {
+		if _, err := exec.LookPath("xclip"); err == nil {
+			return X11, true
+		}
+	}
+	return Tool{}, false
+}
+
+// toolTimeout bounds one run of a tool: a selection owner that never
+// answers must not stall polling.
+const toolTimeout = 2 * time.Second
+
+type Options struct {
+	Primary  bool          // also sync the PRIMARY selection
+	Interval time.Duration // how often selections are read (default 500ms, Tool.Interval)
+	MaxBytes int           // texts larger than this are skipped (0 = no limit)
+}
+
+/*──────── Clipboard ───────────────────────────────────────────*/
+
+// Clipboard holds the text of whichever selection changed last.  It
+// satisfies clipsync.Clipboard.
+type Clipboard struct {
+	t Tool
+	o Options
+
+	mu      sync.Mutex
+	seen    map[string][]byte // last text of each selection, read or written
+	items   []core.Item
+	tooBig  bool // the last change was over MaxBytes
+	seq     uint32
+	changed chan struct{}
+}
+
+// New drives the desktop clipboard through t once Run starts.
+func New(t Tool, o Options) *Clipboard {
+	if o.Interval <= 0 {
+		o.Interval = cmp.Or(t.Interval, 500*time.Millisecond)
+	}
+	return &Clipboard{t: t, o: o, seen: make(map[string][]byte), changed: make(chan struct{}, 1)}
+}
+
+func (c *Clipboard) selections() []string {
+	if c.o.Primary && c.t.Primary {
+		return []string{selClipboard, selPrimary}
+	}
+	return []string{selClipboard}
+}
+
+// Run reads the selections every Interval until ctx ends.  What they
+// hold when it starts counts as old: only later changes are copies.
+func (c *Clipboard) Run(ctx context.Context) error {
+	for _, sel := range c.selections() {
+		if text, err := c.get(ctx, sel); err == nil {
+			c.mu.Lock()
+			c.seen[sel] = text
+			if sel == selClipboard && c.items == nil {
+				c.items = itemsFor(sel, text)
+			}
+			c.mu.Unlock()
+		}
+	}
+	t := time.NewTicker(c.o.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		for _, sel := range c.selections() {
+			if text, err := c.get(ctx, sel); err == nil {
+				c.update(sel, text)
+			}
+		}
+	}
+}
+
+// get is sel's text.  A failed read (nothing copied, owner gone) is an
+// error, not an empty selection, so it never counts as a change.
+func (c *Clipboard) get(ctx context.Context, sel string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, toolTimeout)
+	defer cancel()
+	return c.t.Get(ctx, sel).Output()
+}
+
+func (c *Clipboard) update(sel string, text []byte) {
+	c.mu.Lock()
+	if old, ok := c.seen[sel]; ok && bytes.Equal(old, text) {
+		c.mu.Unlock()
+		return
+	}
+	c.seen[sel] = text
+	c.tooBig = c.o.MaxBytes > 0 && len(text) > c.o.MaxBytes
+	c.items = nil
+	if !c.tooBig {
+		c.items = itemsFor(sel, text)
+	}
+	c.seq++
+	c.mu.Unlock()
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func itemsFor(sel string, text []byte) []core.Item {
+	switch {
+	case len(text) == 0:
+		return nil
+	case sel == selPrimary:
+		return []core.Item{core.PrimaryItem(text)}
+	}
+	return []core.Item{core.TextItem(text)}
+}
+
+func (c *Clipboard) Watch() (<-chan struct{}, string) { return c.changed, c.t.Name }
+
+// Read is the last change: one selection's text.
+func (c *Clipboard) Read() ([]core.Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tooBig {
+		return nil, clip.ErrTooLarge
+	}
+	return c.items, nil
+}
+
+// Write sets CLIPBOARD to the first text/plain item and PRIMARY to the
+// first core.MimePrimary one, leaving a selection without an item
+// alone.  nil empties CLIPBOARD.
+func (c *Clipboard) Write(items []core.Item) error {
+	texts := make(map[string][]byte)
+	if items == nil {
+		texts[selClipboard] = nil
+	}
+	for _, it := range items {
+		sel := ""
+		switch it.MimeType {
+		case "text/plain":
+			sel = selClipboard
+		case core.MimePrimary:
+			if c.t.Primary {
+				sel = selPrimary
+			}
+		}
+		if _, dup := texts[sel]; sel == "" || dup {
+			continue
+		}
+		text, err := base64.StdEncoding.DecodeString(it.Payload)
+		if err != nil {
+			return err
+		}
+		texts[sel] = text
+	}
+	if len(texts) == 0 {
+		return clip.ErrUnsupportedFormat
+	}
+	for sel, text := range texts {
+		ctx, cancel := context.WithTimeout(context.Background(), toolTimeout)
+		cmd := c.t.Set(ctx, sel)
+		cmd.Stdin = bytes.NewReader(text)
+		err := cmd.Run()
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	for sel, text := range texts {
+		c.seen[sel] = text
+	}
+	c.items, c.tooBig = items, false
+	c.seq++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Clipboard) Seq() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+func (c *Clipboard) Accessible() bool { return true }
+
+// Accepts is plain text, and PRIMARY's format with Options.Primary
+// where the tool has one.
+func (c *Clipboard) Accepts() []string {
+	if c.o.Primary && c.t.Primary {
+		return []string{"text/plain", core.MimePrimary}
+	}
+	return []string{"text/plain"}
+}
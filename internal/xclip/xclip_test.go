@@ -0,0 +1,98 @@
+package xclip
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core "clipsync/internal"
+)
+
+// fileTool keeps each selection in a file under dir.
+func fileTool(dir string) Tool {
+	path := func(sel string) string { return filepath.Join(dir, sel) }
+	return Tool{
+		Name: "files",
+		Get: func(ctx context.Context, sel string) *exec.Cmd {
+			return exec.CommandContext(ctx, "cat", path(sel))
+		},
+		Set: func(ctx context.Context, sel string) *exec.Cmd {
+			return exec.CommandContext(ctx, "sh", "-c", `cat > "$0"`, path(sel))
+		},
+		Primary: true,
+	}
+}
+
+func TestSelectionsAreCopiesOfTheirOwn(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "clipboard"), []byte("old"), 0o600)
+	c := New(fileTool(dir), Options{Primary: true, Interval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+	changes, _ := c.Watch()
+	time.Sleep(50 * time.Millisecond) // what's there at start is old
+	if items, _ := c.Read(); len(items) != 1 || items[0] != core.TextItem([]byte("old")) {
+		t.Fatalf("start: read %+v", items)
+	}
+
+	for _, w := range []struct {
+		sel, text string
+		want      core.Item
+	}{
+		{"primary", "selected", core.PrimaryItem([]byte("selected"))},
+		{"clipboard", "copied", core.TextItem([]byte("copied"))},
+	} {
+		seq := c.Seq()
+		os.WriteFile(filepath.Join(dir, w.sel), []byte(w.text), 0o600)
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s change never noticed", w.sel)
+		}
+		items, err := c.Read()
+		if err != nil || len(items) != 1 || items[0] != w.want || c.Seq() == seq {
+			t.Fatalf("%s: read %+v, %v", w.sel, items, err)
+		}
+	}
+}
+
+func TestWriteSplitsSelections(t *testing.T) {
+	dir := t.TempDir()
+	c := New(fileTool(dir), Options{Primary: true})
+	seq := c.Seq()
+	if err := c.Write([]core.Item{core.PrimaryItem([]byte("mid"))}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "primary")); string(got) != "mid" {
+		t.Fatalf("primary has %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "clipboard")); err == nil {
+		t.Fatalf("a PRIMARY write touched CLIPBOARD")
+	}
+	if c.Seq() == seq {
+		t.Fatalf("write didn't move Seq")
+	}
+	c.update("primary", []byte("mid")) // read back: not a change
+	if c.Seq() != seq+1 {
+		t.Fatalf("own write taken for a change")
+	}
+	if err := c.Write([]core.Item{{MimeType: "image/png"}}); err == nil {
+		t.Fatalf("image written to a text clipboard")
+	}
+}
+
+func TestTermuxHasNoPrimary(t *testing.T) {
+	tool := fileTool(t.TempDir())
+	tool.Primary, tool.Interval = false, 2*time.Second
+	c := New(tool, Options{Primary: true})
+	if len(c.Accepts()) != 1 || c.o.Interval != 2*time.Second {
+		t.Fatalf("accepts %v every %v", c.Accepts(), c.o.Interval)
+	}
+	if err := c.Write([]core.Item{core.PrimaryItem([]byte("mid"))}); err == nil {
+		t.Fatalf("PRIMARY written without one")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package clipsync
+
+import "clipsync/internal/xclip"
+
+// The desktop clipboard, through wl-clipboard or xclip, or Android's
+// through Termux:API; text only.
+func systemClipboard(o ClipOptions) Clipboard {
+	t, ok := xclip.Detect()
+	if !ok {
+		return nil
+	}
+	return xclip.New(t, xclip.Options{Primary: o.Primary, MaxBytes: o.MaxItemBytes})
+}
+
+func hasSystemClipboard() bool {
+	_, ok := xclip.Detect()
+	return ok
+}
+
+// fitImage would shrink an image item for a convert budget; the
+// desktop clipboard here carries no images, so it never can.
+func fitImage(it Item, limit int) (Item, bool) { return it, false }
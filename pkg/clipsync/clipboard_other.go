@@ -0,0 +1,12 @@
+//go:build !windows && !linux
+
+package clipsync
+
+// No built-in clipboard here yet; embedders bring one via WithClipboard.
+func systemClipboard(ClipOptions) Clipboard { return nil }
+
+func hasSystemClipboard() bool { return false }
+
+// fitImage would shrink an image item for a convert budget; the
+// clipboards here carry no images, so it never can.
+func fitImage(it Item, limit int) (Item, bool) { return it, false }
@@ -0,0 +1,59 @@
+//go:build windows
+
+package clipsync
+
+import (
+	"context"
+
+	"clipsync/internal/clip"
+)
+
+// winClipboard forwards to the internal clip thread, which Run owns.
+type winClipboard struct {
+	req chan clip.Req
+}
+
+func systemClipboard(o ClipOptions) Clipboard {
+	clip.Configure(clip.Options{
+		MaxItemBytes:  o.MaxItemBytes,
+		MaxPixels:     o.MaxPixels,
+		TextFileBytes: o.TextFileBytes,
+		JPEGQuality:   o.JPEGQuality,
+		WebPQuality:   o.WebPQuality,
+		LossyMinBytes: o.LossyMinBytes,
+		Passthrough:   o.Passthrough,
+	})
+	return &winClipboard{req: make(chan clip.Req)}
+}
+
+func hasSystemClipboard() bool { return true }
+
+func (c *winClipboard) Run(ctx context.Context) error {
+	err := clip.Serve(ctx, c.req)
+	if ctx.Err() != nil {
+		clip.StopNotify() // leave the viewer chain on the way out
+	}
+	return err
+}
+
+func (c *winClipboard) Watch() (<-chan struct{}, string) { return clip.Notify() }
+
+func (c *winClipboard) Read() ([]Item, error) {
+	reply := make(chan clip.Resp, 1)
+	c.req <- clip.Req{Kind: clip.ReqRead, Resp: reply}
+	r := <-reply
+	return r.Items, r.Err
+}
+
+func (c *winClipboard) Write(items []Item) error {
+	reply := make(chan clip.Resp, 1)
+	c.req <- clip.Req{Kind: clip.ReqWrite, WriteData: items, Resp: reply}
+	return (<-reply).Err
+}
+
+func (c *winClipboard) Seq() uint32       { return clip.GetSeq() }
+func (c *winClipboard) Accessible() bool  { return clip.Accessible() }
+func (c *winClipboard) Accepts() []string { return clip.Accepts() }
+
+// fitImage shrinks an image item for a convert budget.
+func fitImage(it Item, limit int) (Item, bool) { return clip.FitImage(it, limit) }
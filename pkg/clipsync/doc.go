@@ -0,0 +1,15 @@
+// Package clipsync is the embeddable face of clipsync: everything an
+// outside Go program may depend on lives here, while internal/ keeps
+// changing freely.  Syncer is the whole sync engine; see New.
+//
+// # Stability
+//
+// This package follows semantic versioning.  Within a major version
+// exported names are only added, never removed or changed in meaning;
+// in particular the error values below keep their identity, so
+//
+//	if errors.Is(err, clipsync.ErrTooLarge) { … }
+//
+// keeps working across internal refactors.  Match errors with errors.Is,
+// never by their text, which may be reworded at any time.
+package clipsync
@@ -0,0 +1,760 @@
+package clipsync
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	core "clipsync/internal"
+	"clipsync/internal/clip"
+	netw "clipsync/internal/net"
+	"clipsync/internal/netwatch"
+	"clipsync/internal/secret"
+)
+
+/*──────── watcher (local → send, seq-based) ───────────────────*/
+// A copy whose owner doesn't render it (see clip.ErrNotRendered) is
+// read again renderRetries times, renderRetry apart, before it's given up.
+const (
+	renderRetries = 3
+	renderRetry   = 250 * time.Millisecond
+)
+
+// changes (nil if unavailable) wakes the watcher early; the ticker
+// stays as a safety net.  A copy is only read once the clipboard has
+// been quiet for debounce, so a burst of copies sends just the last.
+func (s *Syncer) watcher(ctx context.Context, changes <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.interval)
+	defer ticker.Stop()
+
+	lastSeq := s.cb.Seq()       // cheap kernel counter
+	var settle <-chan time.Time // armed while a copy burst settles
+	changedAt := time.Now()     // when the clipboard last moved
+	renderTries := 0            // reads of this copy its owner didn't render
+
+	for {
+		settled := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changes:
+		case <-settle:
+			settle, settled = nil, true
+		}
+		seq := s.cb.Seq()
+		if seq == lastSeq && !settled {
+			continue // clipboard unchanged
+		}
+		changed := seq != lastSeq
+		lastSeq = seq
+
+		if s.echo.Ours(seq) {
+			settle = nil
+			continue // our own write of a remote snapshot
+		}
+		if changed {
+			changedAt, renderTries = time.Now(), 0
+		}
+		if s.paused.Load() {
+			settle = nil
+			continue // copies made while paused are never sent
+		}
+		if changed && s.cfg.debounce > 0 {
+			settle = time.After(s.cfg.debounce) // (re)start the quiet window
+			continue
+		}
+
+		items, err := s.cb.Read() // opens clipboard only now
+		if errors.Is(err, clip.ErrTooLarge) {
+			s.log.Printf("%s %s local copy over the item size limit, skipped", ts(), icLocal)
+		}
+		if errors.Is(err, clip.ErrNotRendered) {
+			if renderTries++; renderTries < renderRetries {
+				settle = time.After(renderRetry) // the app may be busy, not gone
+				continue
+			}
+			s.log.Printf("%s %s local copy never rendered by the app that made it, skipped", ts(), icLocal)
+		}
+		if err != nil || len(items) == 0 {
+			continue // sentinel / unsupported
+		}
+		if s.echo.Echoes(items, changedAt) {
+			continue // a late echo of a remote clip we just wrote
+		}
+		if s.cfg.urls {
+			items = core.TagURLs(items)
+		}
+		if items = s.fit(ctx, items); len(items) == 0 {
+			continue // all over budget
+		}
+		if items = s.syncable(items); len(items) == 0 {
+			continue // only formats we don't sync
+		}
+		if items = s.guard(ctx, items); len(items) == 0 {
+			continue // looks like a secret
+		}
+		if items = s.runFilter(ctx, "send", items); len(items) == 0 {
+			continue
+		}
+		kept := s.caps.Filter(items, time.Now())
+		if len(kept) == 0 {
+			if !primaryOnly(items) { // selecting text is no copy, no need to say
+				s.log.Printf("%s %s no peer accepts this format, skipped", ts(), icLocal)
+			}
+			continue
+		}
+		items = kept
+
+		if s.dup.Seen(core.QuickKey(items), time.Now()) && !s.cfg.force {
+			continue // duplicate copy within the dedupe horizon
+		}
+
+		s.log.Printf("%s %s local → %d (%d items)",
+			ts(), icLocal, items[0].Fmt, len(items))
+
+		snap := s.stamp(items)
+		snap.Force = s.cfg.force
+		if ttl := s.secretTTL(items); ttl > 0 {
+			snap.TTL = int((ttl + time.Second - 1) / time.Second)
+			s.clearAfter(ctx, seq, ttl)
+		}
+		s.emit(ctx, snap)
+	}
+}
+
+/*──────── uploader (send, queue while offline) ────────────────*/
+// Once ctx ends the uploader drains toUp before it returns; see drain.
+// Sends run under hard, which only ends when the drain runs out of time.
+func (s *Syncer) uploader(ctx, hard context.Context) {
+	retry := time.NewTicker(10 * time.Second)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain(hard, time.Now().Add(s.cfg.drainTimeout))
+			return
+		case snap := <-s.toUp:
+			s.upload(hard, snap)
+		case <-retry.C:
+			if s.q != nil && s.q.Len() > 0 {
+				s.replay(hard)
+			}
+		}
+	}
+}
+
+// upload sends one snapshot from toUp, queueing a data snapshot it
+// can't send.  A data send is called off when a newer copy is emitted
+// (see supersede): the peers would only overwrite it.
+func (s *Syncer) upload(ctx context.Context, snap Snapshot) {
+	if snap.Kind != "" {
+		_ = s.send(ctx, snap) // acks / caps: best effort, never queued
+		return
+	}
+	s.acks.SentTo(core.AckKey(snap), snap.To, time.Now())
+	// older offline copies go first, or they'd clobber this one
+	if s.q != nil && s.q.Len() > 0 && !s.replay(ctx) {
+		s.enqueue(snap)
+		return
+	}
+	start := time.Now()
+	sctx, stop := context.WithCancel(ctx)
+	s.upMu.Lock()
+	s.upStop = stop
+	s.upMu.Unlock()
+	err := s.send(sctx, snap)
+	s.upMu.Lock()
+	s.upStop = nil
+	s.upMu.Unlock()
+	superseded := sctx.Err() != nil && ctx.Err() == nil
+	stop()
+	switch {
+	case err == nil:
+		el := time.Since(start).Milliseconds()
+		s.log.Printf("%s %s sent snapshot  %d items (%d ms)",
+			ts(), icSend, len(snap.Items), el)
+		if s.hist != nil {
+			s.hist.add("sent", snap)
+		}
+		if s.cfg.onSend != nil {
+			spawn(func() { s.cfg.onSend(snap) })
+		}
+	case superseded:
+		s.log.Printf("%s %s upload called off: a newer copy replaces it", ts(), icSend)
+	case s.q != nil && !errors.Is(err, netw.ErrTooLarge):
+		s.log.Printf("%s %s send error: %v", ts(), icSend, err)
+		s.enqueue(snap)
+	default:
+		s.log.Printf("%s %s send error: %v", ts(), icSend, err)
+	}
+}
+
+// supersede calls off the data send under way, if any.
+func (s *Syncer) supersede() {
+	s.upMu.Lock()
+	defer s.upMu.Unlock()
+	if s.upStop != nil {
+		s.upStop()
+	}
+}
+
+// drain sends what is still waiting in toUp at shutdown, until
+// deadline.  Data snapshots left over after it go to the offline queue,
+// so the next run sends them; without one they are dropped.
+func (s *Syncer) drain(ctx context.Context, deadline time.Time) {
+	for time.Now().Before(deadline) {
+		select {
+		case snap := <-s.toUp:
+			s.upload(ctx, snap)
+		default:
+			return
+		}
+	}
+	for left := 0; ; {
+		select {
+		case snap := <-s.toUp:
+			if snap.Kind == "" && s.q != nil {
+				s.enqueue(snap)
+			} else if snap.Kind == "" {
+				left++
+			}
+		default:
+			if left > 0 {
+				s.log.Printf("%s %s shutdown: %d snapshots not sent", ts(), icSend, left)
+			}
+			return
+		}
+	}
+}
+
+func (s *Syncer) enqueue(snap Snapshot) {
+	if err := s.q.Put(snap); err != nil {
+		s.log.Printf("%s %s offline queue: %v", ts(), icSend, err)
+		return
+	}
+	s.log.Printf("%s %s queued offline (%d pending)", ts(), icSend, s.q.Len())
+}
+
+// replay flushes the offline queue; false if the transport is still down.
+func (s *Syncer) replay(ctx context.Context) bool {
+	n, err := s.q.Drain(func(snap Snapshot) error { return s.send(ctx, snap) })
+	if n > 0 {
+		s.log.Printf("%s %s replayed %d queued snapshots", ts(), icSend, n)
+	}
+	return err == nil
+}
+
+// send seals a data snapshot, if sealing is on, stamps it with the
+// content hash of its items as they go out, signs it, if signing is on,
+// and hands it over.  The queue and the hooks only ever see it in the
+// clear.
+func (s *Syncer) send(ctx context.Context, snap Snapshot) error {
+	if s.cfg.sealer != nil && snap.Kind == "" {
+		items, err := s.cfg.sealer.Seal(snap.Items)
+		if err != nil {
+			return err
+		}
+		snap.Items = items
+	}
+	if snap.Kind == "" {
+		snap.Hash = core.ContentHash(snap.Items)
+	}
+	if s.cfg.signer != nil {
+		if err := s.cfg.signer.Sign(&snap); err != nil {
+			return err
+		}
+	}
+	err := s.tr.Send(ctx, snap)
+	if err == nil && snap.Kind == "" {
+		s.traffic.Sent(snap.Items)
+	}
+	return err
+}
+
+/*──────── poller (recv → clipboard) ───────────────────────────*/
+func (s *Syncer) poller(ctx context.Context, in <-chan Snapshot) {
+	// a remote snapshot that arrived while the desktop was locked / busy
+	var pending *Snapshot
+	retry := time.NewTicker(time.Second)
+	defer retry.Stop()
+	var due <-chan time.Time // strict order: gaps given up on
+	if s.inorder != nil {
+		t := time.NewTicker(max(s.cfg.strictWait/4, 10*time.Millisecond))
+		defer t.Stop()
+		due = t.C
+	}
+
+	for {
+		var snap Snapshot
+		select {
+		case <-ctx.Done():
+			return
+		case <-due:
+			for _, r := range s.inorder.Due(time.Now()) {
+				s.apply(ctx, r, &pending)
+			}
+			continue
+		case snap = <-in:
+		case <-retry.C:
+			if pending == nil || !s.cb.Accessible() {
+				continue
+			}
+			if s.cfg.maxAge > 0 && s.age(*pending) > s.cfg.maxAge {
+				s.log.Printf("%s %s held snapshot too old by now, dropped", ts(), icRecv)
+				pending = nil
+				continue
+			}
+			if err := s.writeRemote(ctx, *pending); err == nil {
+				s.log.Printf("%s %s clipboard available again, held snapshot applied", ts(), icRecv)
+				pending = nil
+			}
+			continue
+		}
+
+		if snap.Kind == "" {
+			s.traffic.Received(snap.Items) // it cost the bytes, wanted or not
+		}
+		if s.cfg.signer != nil {
+			if err := s.cfg.signer.Verify(snap); err != nil {
+				s.log.Printf("%s %s snapshot from %s dropped: %v", ts(), icRecv, s.caps.Who(snap.Origin), err)
+				continue
+			}
+		}
+		s.caps.SetName(snap.Origin, snap.Name)
+		if snap.Kind == core.KindCaps {
+			if s.caps.Update(snap.Origin, snap.Caps, time.Now()) {
+				s.log.Printf("%s %s peer %s accepts %v", ts(), icRecv, s.caps.Who(snap.Origin), snap.Caps)
+				s.emit(ctx, s.capsSnapshot()) // let the newcomer learn ours
+			}
+			continue
+		}
+		if snap.Kind == core.KindAck {
+			if d, ok := s.acks.Ack(snap.Ack, snap.Origin, time.Now()); ok {
+				s.traffic.Receipt(d)
+				if to := s.acks.Target(snap.Ack); to != "" && to != snap.Origin {
+					s.log.Printf("%s %s clip sent to %s was applied by %s too (%d ms): it predates addressing",
+						ts(), icSend, s.caps.Who(to), s.caps.Who(snap.Origin), d.Milliseconds())
+				} else {
+					s.log.Printf("%s %s delivered to %s (%d ms)",
+						ts(), icSend, s.caps.Who(snap.Origin), d.Milliseconds())
+				}
+			}
+			continue
+		}
+		if snap.To != "" && snap.To != s.id {
+			continue // sent to another device
+		}
+		if age := s.age(snap); s.cfg.maxAge > 0 && age > s.cfg.maxAge {
+			s.log.Printf("%s %s clip from %s dropped: copied %v ago",
+				ts(), icRecv, s.caps.Who(snap.Origin), age.Round(time.Second))
+			continue
+		}
+		if s.paused.Load() {
+			s.log.Printf("%s %s remote snapshot dropped (paused)", ts(), icRecv)
+			continue
+		}
+		if snap.Hash != "" && core.ContentHash(snap.Items) != snap.Hash {
+			s.log.Printf("%s %s clip from %s dropped: content doesn't match its hash, damaged on the way",
+				ts(), icRecv, s.caps.Who(snap.Origin))
+			continue
+		}
+		if s.cfg.sealer != nil {
+			items, err := s.cfg.sealer.Open(snap.Items)
+			if err != nil {
+				s.log.Printf("%s %s clip from %s dropped: %v", ts(), icRecv, s.caps.Who(snap.Origin), err)
+				continue
+			}
+			snap.Items = items
+		}
+		if s.inorder == nil {
+			s.apply(ctx, snap, &pending)
+			continue
+		}
+		ready, ok := s.inorder.Push(snap, time.Now())
+		if !ok {
+			s.log.Printf("%s %s late snapshot from %s dropped (n %d)", ts(), icRecv, s.caps.Who(snap.Origin), snap.N)
+		}
+		for _, r := range ready {
+			s.apply(ctx, r, &pending)
+		}
+	}
+}
+
+// age is how long ago snap was taken, by server time; 0 if it carries
+// no timestamp.
+func (s *Syncer) age(snap Snapshot) time.Duration {
+	if snap.TS <= 0 {
+		return 0
+	}
+	return netw.Now().Sub(time.Unix(snap.TS, 0))
+}
+
+// apply puts a remote snapshot on the clipboard unless it is stale, a
+// duplicate or refused; while the clipboard is out of reach it becomes
+// *pending instead.
+func (s *Syncer) apply(ctx context.Context, snap Snapshot, pending **Snapshot) {
+	if snap.Items = s.syncable(snap.Items); len(snap.Items) == 0 {
+		return
+	}
+	if !slices.Contains(s.cb.Accepts(), core.MimePrimary) {
+		// a PRIMARY selection only lands where there is one
+		snap.Items = slices.DeleteFunc(slices.Clone(snap.Items), isPrimary)
+		if len(snap.Items) == 0 {
+			return
+		}
+	}
+	if s.cfg.urls {
+		snap.Items = core.URLText(snap.Items)
+	}
+	if !s.order.Accept(snap.Origin, snap.Seq) {
+		s.log.Printf("%s %s stale snapshot from %s dropped (seq %d)",
+			ts(), icRecv, s.caps.Who(snap.Origin), snap.Seq)
+		return
+	}
+	if s.dup.Dup(core.QuickKey(snap.Items), time.Now()) && !snap.Force {
+		return // recorded by writeRemote once it lands, so a retry isn't one
+	}
+	snap.Items = core.NormalizeItems(snap.Items, s.cfg.eol, s.cfg.trimSpace)
+
+	if snap.Items = s.runFilter(ctx, "receive", snap.Items); len(snap.Items) == 0 {
+		return
+	}
+
+	if s.cfg.confirm != nil && !s.cfg.confirm(ctx, snap) {
+		s.log.Printf("%s %s clip from %s skipped", ts(), icRecv, s.caps.Who(snap.Origin))
+		return
+	}
+	if *pending != nil {
+		*pending = &snap // still blocked: newest wins
+		return
+	}
+	err := s.writeRemote(ctx, snap)
+	if Temporary(err) {
+		s.log.Printf("%s %s %v; holding remote snapshots until it's back", ts(), icRecv, err)
+		*pending = &snap
+	}
+}
+
+// writeRemote puts snap on the clipboard and acks it to the origin.
+func (s *Syncer) writeRemote(ctx context.Context, snap Snapshot) error {
+	if err := s.write(snap.Items); err != nil {
+		switch {
+		case errors.Is(err, ErrOverwritten):
+			s.log.Printf("%s %s clip from %s didn't stick: another program replaced it as it landed (a clipboard manager?)",
+				ts(), icRecv, s.caps.Who(snap.Origin))
+		case !Temporary(err):
+			s.log.Printf("%s clipboard write: %v", ts(), err)
+		}
+		return err
+	}
+	s.dup.Add(core.QuickKey(snap.Items), time.Now())
+	seq := s.cb.Seq()
+	s.log.Printf("%s %s remote ← %d (%d items) from %s",
+		ts(), icRecv, snap.Items[0].Fmt, len(snap.Items), s.caps.Who(snap.Origin))
+	if ttl := time.Duration(snap.TTL) * time.Second; ttl > 0 {
+		s.clearAfter(ctx, seq, ttl)
+	} else if ttl := s.secretTTL(snap.Items); ttl > 0 {
+		s.clearAfter(ctx, seq, ttl) // sender predates TTLs, our rule says secret
+	}
+	if s.hist != nil {
+		s.hist.add("received", snap)
+	}
+	if s.cfg.onReceive != nil {
+		spawn(func() { s.cfg.onReceive(snap) })
+	}
+	return s.emit(ctx, Snapshot{
+		Origin: s.id,
+		TS:     netw.Now().Unix(),
+		Kind:   core.KindAck,
+		Ack:    core.AckKey(snap),
+	})
+}
+
+// write puts items on the clipboard as our own: the watcher takes the
+// change, and for a while the same content, for an echo (see core.Echo).
+func (s *Syncer) write(items []Item) error {
+	s.echo.Begin(s.cb.Seq())
+	err := s.cb.Write(items)
+	if err != nil {
+		items = nil
+	}
+	s.echo.Wrote(s.cb.Seq(), items, time.Now())
+	return err
+}
+
+/*──────── secrets (clear after a TTL) ─────────────────────────*/
+// secretTTL is how long items may stay on the clipboard (0 = for good).
+func (s *Syncer) secretTTL(items []Item) time.Duration {
+	if s.cfg.secretTTL <= 0 || s.cfg.secret != nil && !s.cfg.secret(items) {
+		return 0
+	}
+	return s.cfg.secretTTL
+}
+
+// clearAfter empties the clipboard once d has passed, unless it has
+// moved on from seq by then: a newer copy is not ours to clear.
+func (s *Syncer) clearAfter(ctx context.Context, seq uint32, d time.Duration) {
+	spawn(func() {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if s.cb.Seq() != seq {
+			return
+		}
+		if err := s.write(nil); err != nil { // the watcher mustn't send the blank
+			s.log.Printf("%s clipboard clear: %v", ts(), err)
+			return
+		}
+		s.log.Printf("%s %s secret cleared from the clipboard after %v", ts(), icLocal, d)
+	})
+}
+
+/*──────── format classes ──────────────────────────────────────*/
+// syncable drops the items WithSyncFormats excludes, and all but text
+// on a metered network.
+func (s *Syncer) syncable(items []Item) []Item {
+	if s.formats == nil && !s.metered.Load() {
+		return items
+	}
+	var kept []Item
+	for _, it := range items {
+		if s.synced(core.FormatClass(it)) {
+			kept = append(kept, it)
+		}
+	}
+	return kept
+}
+
+func (s *Syncer) synced(class string) bool {
+	if s.metered.Load() && class != core.ClassText {
+		return false
+	}
+	return s.formats == nil || s.formats[class]
+}
+
+func isPrimary(it Item) bool { return it.MimeType == core.MimePrimary }
+
+// primaryOnly is true for a change of the PRIMARY selection alone.
+func primaryOnly(items []Item) bool {
+	return len(items) > 0 && !slices.ContainsFunc(items, func(it Item) bool { return !isPrimary(it) })
+}
+
+/*──────── size budgets ────────────────────────────────────────*/
+// fit enforces WithSizeBudgets on a local read: items over their budget
+// are converted, dropped, or sent if WithOversizeAsk says so, with a log
+// line every time.
+func (s *Syncer) fit(ctx context.Context, items []Item) []Item {
+	if len(s.cfg.budgets) == 0 {
+		return items
+	}
+	var kept []Item
+	for _, it := range items {
+		b, ok := core.Budgets(s.cfg.budgets).For(it)
+		if !ok || it.ByteLen <= b.Max {
+			kept = append(kept, it)
+			continue
+		}
+		if b.Policy == core.BudgetConvert {
+			if small, ok := convert(it, b.Max); ok {
+				s.log.Printf("%s %s %s of %d bytes over its %d byte budget, sent as %s of %d",
+					ts(), icLocal, core.FormatKey(it), it.ByteLen, b.Max, core.FormatKey(small), small.ByteLen)
+				kept = append(kept, small)
+				continue
+			}
+		}
+		if b.Policy == core.BudgetAsk && s.cfg.ask != nil {
+			if s.cfg.ask(ctx, it, b) {
+				s.log.Printf("%s %s %s of %d bytes over its %d byte budget, sent as asked",
+					ts(), icLocal, core.FormatKey(it), it.ByteLen, b.Max)
+				kept = append(kept, it)
+				continue
+			}
+			s.log.Printf("%s %s %s of %d bytes over its %d byte budget, not sent: no go-ahead",
+				ts(), icLocal, core.FormatKey(it), it.ByteLen, b.Max)
+			continue
+		}
+		s.log.Printf("%s %s %s of %d bytes over its %d byte budget, skipped",
+			ts(), icLocal, core.FormatKey(it), it.ByteLen, b.Max)
+	}
+	return kept
+}
+
+// convert makes it fit in limit bytes, if its format allows.
+func convert(it Item, limit int) (Item, bool) {
+	switch {
+	case it.MimeType == "text/plain" && it.Blob == "":
+		raw, err := base64.StdEncoding.DecodeString(it.Payload)
+		if err != nil || len(raw) <= limit {
+			return it, false
+		}
+		n := limit
+		for n > 0 && !utf8.RuneStart(raw[n]) {
+			n--
+		}
+		it.Payload, it.ByteLen = base64.StdEncoding.EncodeToString(raw[:n]), n
+		return it, true
+	case core.FormatClass(it) == core.ClassImage:
+		return fitImage(it, limit)
+	}
+	return it, false
+}
+
+/*──────── secret guard ────────────────────────────────────────*/
+// guard enforces WithSecretGuard on a local read: nil if its text looks
+// like a secret and may not go out.
+func (s *Syncer) guard(ctx context.Context, items []Item) []Item {
+	if s.cfg.guard == "off" {
+		return items
+	}
+	text, ok := core.Text(items)
+	if !ok {
+		return items
+	}
+	kind, hit := secret.Detect(text)
+	if !hit {
+		return items
+	}
+	preview := secret.Redact(text)
+	if s.cfg.guard == "ask" && s.cfg.askSecret != nil && s.cfg.askSecret(ctx, kind, preview) {
+		s.log.Printf("%s %s local copy looks like a %s (%s), sent as asked", ts(), icLocal, kind, preview)
+		return items
+	}
+	s.log.Printf("%s %s local copy looks like a %s (%s), not sent", ts(), icLocal, kind, preview)
+	return nil
+}
+
+/*──────── user filter ─────────────────────────────────────────*/
+// runFilter passes items through the user's filter; nil means blocked.
+func (s *Syncer) runFilter(ctx context.Context, event string, items []Item) []Item {
+	if s.cfg.filter == nil {
+		return items
+	}
+	limit := s.cfg.filterLimit
+	if limit == 0 {
+		limit = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+	out, err := s.cfg.filter(ctx, event, items)
+	switch {
+	case err != nil:
+		s.log.Printf("%s %s filter: %v; clip dropped", ts(), icLocal, err)
+		return nil
+	case len(out) == 0:
+		s.log.Printf("%s %s filter blocked %s clip", ts(), icLocal, event)
+	}
+	return out
+}
+
+/*──────── capability announcements ─────────────────────────────*/
+func (s *Syncer) capsSnapshot() Snapshot {
+	accepts := s.cb.Accepts()
+	if s.metered.Load() { // so peers don't send what we'd drop
+		accepts = slices.DeleteFunc(slices.Clone(accepts), func(k string) bool {
+			return core.KeyClass(k) != core.ClassText
+		})
+	}
+	return Snapshot{
+		Origin: s.id,
+		TS:     netw.Now().Unix(),
+		Kind:   core.KindCaps,
+		Caps:   accepts,
+		Name:   s.cfg.name,
+	}
+}
+
+// announceCaps tells peers what we can paste, well inside their TTL.
+func (s *Syncer) announceCaps(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		if s.emit(ctx, s.capsSnapshot()) != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+/*──────── network changes (re-dial at once) ────────────────────*/
+func (s *Syncer) redialOnChange(ctx context.Context, changes <-chan struct{}) {
+	r, ok := s.tr.(interface{ Redial() })
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			s.log.Printf("%s %s network changed, re-dialing", ts(), icSend)
+			r.Redial()
+		}
+	}
+}
+
+/*──────── metered networks ─────────────────────────────────────*/
+// meteredWatch keeps the metered switch in line with WithMetered:
+// "auto" follows netwatch.WatchMetered.  If the OS can't tell, sync
+// stays unmetered.
+func (s *Syncer) meteredWatch(ctx context.Context) {
+	switch s.cfg.metered {
+	case "on":
+		s.setMetered(ctx, true)
+		return
+	case "auto":
+	default:
+		return
+	}
+	err := netwatch.WatchMetered(ctx, func(on bool) { s.setMetered(ctx, on) })
+	if err != nil && ctx.Err() == nil {
+		s.log.Printf("%s %s metered detection: %v; syncing as unmetered", ts(), icSend, err)
+	}
+}
+
+func (s *Syncer) setMetered(ctx context.Context, on bool) {
+	if s.metered.Swap(on) == on {
+		return
+	}
+	if m, ok := s.tr.(interface{ SetMetered(bool) }); ok {
+		m.SetMetered(on)
+	}
+	if on {
+		s.log.Printf("%s %s metered network: syncing text only, compressed", ts(), icSend)
+	} else {
+		s.log.Printf("%s %s unmetered network: syncing everything again", ts(), icSend)
+	}
+	s.emit(ctx, s.capsSnapshot())
+}
+
+/*──────── janitor (forget silent peers) ────────────────────────*/
+func (s *Syncer) janitor(ctx context.Context) {
+	if s.cfg.peerExpiry <= 0 {
+		return
+	}
+	t := time.NewTicker(min(s.cfg.peerExpiry, time.Hour))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if n := s.caps.Purge(time.Now(), s.cfg.peerExpiry); n > 0 {
+			s.purged.Add(int64(n))
+			s.log.Printf("%s %s forgot %d peers silent for %v", ts(), icRecv, n, s.cfg.peerExpiry)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package clipsync
+
+import (
+	"errors"
+
+	"clipsync/internal/clip"
+	netw "clipsync/internal/net"
+)
+
+/*──────── stable error values ─────────────────────────────────*/
+// These are the same values the internals return, re-exported so
+// embedders need no internal import.  New ones may be added; existing
+// ones never go away within a major version.
+var (
+	// ErrTooLarge: a snapshot did not fit the body cap even after moving
+	// big items out of band.  Permanent; retrying won't help.
+	ErrTooLarge = netw.ErrTooLarge
+
+	// ErrItemTooLarge: a local clipboard item was over the item limit.
+	ErrItemTooLarge = clip.ErrTooLarge
+
+	// ErrClipboardBusy: another program held the clipboard too long.
+	// Transient.
+	ErrClipboardBusy = clip.ErrClipboardBusy
+
+	// ErrNoDesktop: the session is locked or a secure desktop (UAC) is
+	// up.  Transient; clears once the user is back.
+	ErrNoDesktop = clip.ErrNoDesktop
+
+	// ErrOverwritten: a remote clip was written, but another program
+	// (a clipboard manager, say) replaced it at once, twice running.
+	// Not retried; the next clip gets a fresh try.
+	ErrOverwritten = clip.ErrOverwritten
+
+	// ErrNotRendered: the program that copied put formats on the
+	// clipboard but didn't produce their data when asked (delayed
+	// rendering; it may be busy or hung).  Transient.
+	ErrNotRendered = clip.ErrNotRendered
+
+	// ErrUnsupportedFormat: nothing on the clipboard can be synced.
+	ErrUnsupportedFormat = clip.ErrUnsupportedFormat
+)
+
+// Temporary reports whether err is expected to clear on its own, so the
+// operation is worth retrying later.
+func Temporary(err error) bool {
+	return errors.Is(err, ErrClipboardBusy) || errors.Is(err, ErrNoDesktop) ||
+		errors.Is(err, ErrNotRendered)
+}
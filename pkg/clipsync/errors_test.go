@@ -0,0 +1,19 @@
+package clipsync_test
+
+import (
+	"errors"
+	"fmt"
+
+	"clipsync/pkg/clipsync"
+)
+
+func ExampleTemporary() {
+	err := fmt.Errorf("write: %w", clipsync.ErrNoDesktop)
+	switch {
+	case clipsync.Temporary(err):
+		fmt.Println("retry later")
+	case errors.Is(err, clipsync.ErrTooLarge):
+		fmt.Println("give up")
+	}
+	// Output: retry later
+}
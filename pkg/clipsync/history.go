@@ -0,0 +1,217 @@
+package clipsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"clipsync/internal/fts"
+)
+
+/*──────── recent clips (WithHistory) ──────────────────────────*/
+
+// Clip is one entry of the recent-clip history.  It lives in memory,
+// and in the WithStorage storage if there is one.
+type Clip struct {
+	ID     int       `json:"id"`
+	Dir    string    `json:"dir"` // "sent" or "received"
+	Origin string    `json:"origin"`
+	Name   string    `json:"name,omitempty"` // origin's device name
+	At     time.Time `json:"at"`
+	Items  []Item    `json:"items"`
+	Pinned bool      `json:"pinned,omitempty"` // kept past WithHistory's n (Pin)
+}
+
+// historyNS is the history's namespace in a Storage; one value per
+// clip, keyed by its zero-padded ID so keys sort in order.
+const historyNS = "history"
+
+type history struct {
+	mu    sync.Mutex
+	n     int
+	next  int
+	clips []Clip  // oldest first
+	st    Storage // nil = memory only
+	idx   *fts.Index
+}
+
+// newHistory keeps n clips, picking up the ones st has from earlier
+// runs.
+func newHistory(n int, st Storage) *history {
+	h := &history{n: n, st: st, idx: fts.New()}
+	if st == nil {
+		return h
+	}
+	keys, _ := st.List(historyNS)
+	for _, k := range keys {
+		b, err := st.Get(historyNS, k)
+		var c Clip
+		if err != nil || json.Unmarshal(b, &c) != nil {
+			st.Delete(historyNS, k)
+			continue
+		}
+		h.clips = append(h.clips, c)
+		h.index(c)
+		h.next = max(h.next, c.ID)
+	}
+	h.trim()
+	return h
+}
+
+func (h *history) add(dir string, snap Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	c := Clip{ID: h.next, Dir: dir, Origin: snap.Origin, Name: snap.Name, At: time.Now(), Items: snap.Items}
+	h.clips = append(h.clips, c)
+	h.index(c)
+	h.save(c)
+	h.trim()
+}
+
+func (h *history) save(c Clip) {
+	if h.st != nil {
+		if b, err := json.Marshal(c); err == nil {
+			h.st.Put(historyNS, historyKey(c.ID), b)
+		}
+	}
+}
+
+// trim drops the oldest clips while more than n aren't pinned.
+func (h *history) trim() {
+	unpinned := 0
+	for _, c := range h.clips {
+		if !c.Pinned {
+			unpinned++
+		}
+	}
+	for i := 0; unpinned > h.n; {
+		if c := h.clips[i]; c.Pinned {
+			i++
+			continue
+		} else if h.st != nil {
+			h.st.Delete(historyNS, historyKey(c.ID))
+		}
+		h.idx.Remove(h.clips[i].ID)
+		h.clips = append(h.clips[:i:i], h.clips[i+1:]...)
+		unpinned--
+	}
+}
+
+// index makes c's text searchable; clips without text aren't.
+func (h *history) index(c Clip) {
+	if text, ok := Text(c.Items); ok {
+		h.idx.Add(c.ID, string(text))
+	}
+}
+
+func historyKey(id int) string { return fmt.Sprintf("%010d", id) }
+
+func (h *history) get(id int) (Clip, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.clips {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Clip{}, false
+}
+
+// History lists the recent clips, pinned ones included, newest first
+// (nil without WithHistory).
+func (s *Syncer) History() []Clip {
+	if s.hist == nil {
+		return nil
+	}
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	out := make([]Clip, len(s.hist.clips))
+	for i, c := range s.hist.clips {
+		out[len(out)-1-i] = c
+	}
+	return out
+}
+
+// SearchHistory lists the history clips whose text holds every word of
+// query, as a whole word or the start of one, ignoring case; newest
+// first.
+func (s *Syncer) SearchHistory(query string) []Clip {
+	if s.hist == nil {
+		return nil
+	}
+	s.hist.mu.Lock()
+	defer s.hist.mu.Unlock()
+	var out []Clip
+	for _, id := range s.hist.idx.Search(query) {
+		for _, c := range s.hist.clips {
+			if c.ID == id {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// Repush makes history clip id current again: it goes back on the
+// local clipboard and out to every peer, which apply it even if they
+// had it already.
+func (s *Syncer) Repush(ctx context.Context, id int) error {
+	c, ok := s.clip(id)
+	if !ok {
+		return fmt.Errorf("clipsync: no clip %d in the history", id)
+	}
+	if err := s.write(c.Items); err != nil { // sent below, not by the watcher
+		return err
+	}
+	snap := s.stamp(c.Items)
+	snap.Force = true
+	return s.emit(ctx, snap)
+}
+
+// Pin keeps clip id (true) however many clips come after it, or lets
+// it age out again (false) with the rest.
+func (s *Syncer) Pin(id int, on bool) error {
+	if s.hist != nil {
+		s.hist.mu.Lock()
+		defer s.hist.mu.Unlock()
+		for i, c := range s.hist.clips {
+			if c.ID == id {
+				s.hist.clips[i].Pinned = on
+				s.hist.save(s.hist.clips[i])
+				s.hist.trim()
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("clipsync: no clip %d in the history", id)
+}
+
+// Forget deletes clip id from the history.  Copies already on other
+// devices stay there.
+func (s *Syncer) Forget(id int) error {
+	if s.hist != nil {
+		s.hist.mu.Lock()
+		defer s.hist.mu.Unlock()
+		for i, c := range s.hist.clips {
+			if c.ID == id {
+				s.hist.clips = append(s.hist.clips[:i:i], s.hist.clips[i+1:]...)
+				s.hist.idx.Remove(id)
+				if s.hist.st != nil {
+					return s.hist.st.Delete(historyNS, historyKey(id))
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("clipsync: no clip %d in the history", id)
+}
+
+func (s *Syncer) clip(id int) (Clip, bool) {
+	if s.hist == nil {
+		return Clip{}, false
+	}
+	return s.hist.get(id)
+}
@@ -0,0 +1,46 @@
+package clipsync
+
+import "sync"
+
+// MemClipboard is a text clipboard that only lives in memory, for
+// hosts without a system one: what Copy puts there is sent, and what
+// peers send is kept for Paste (see `clipsync provider`).
+type MemClipboard struct {
+	mu      sync.Mutex
+	items   []Item
+	seq     uint32
+	changed chan struct{}
+}
+
+func NewMemClipboard() *MemClipboard {
+	return &MemClipboard{changed: make(chan struct{}, 1)}
+}
+
+func (c *MemClipboard) Read() ([]Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items, nil
+}
+
+func (c *MemClipboard) Write(items []Item) error {
+	c.mu.Lock()
+	c.items = items
+	c.seq++
+	c.mu.Unlock()
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *MemClipboard) Seq() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+func (c *MemClipboard) Watch() (<-chan struct{}, string) { return c.changed, "memory" }
+
+func (c *MemClipboard) Accessible() bool  { return true }
+func (c *MemClipboard) Accepts() []string { return []string{"text/plain"} }
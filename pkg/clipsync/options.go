@@ -0,0 +1,309 @@
+package clipsync
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+/*──────── Syncer options ──────────────────────────────────────*/
+
+// Option configures New.
+type Option func(*config)
+
+type config struct {
+	id        string
+	name      string
+	server    string
+	key       string
+	room      string
+	transport Transport
+	clipboard Clipboard
+	clipOpts  ClipOptions
+
+	interval     time.Duration
+	debounce     time.Duration
+	echoGrace    time.Duration
+	drainTimeout time.Duration
+	maxAge       time.Duration
+	dupN         int
+	dupWindow    time.Duration
+	force        bool
+	queueDir     string
+	storage      Storage
+	logger       *log.Logger
+
+	onSend    func(Snapshot)
+	onReceive func(Snapshot)
+	confirm   func(context.Context, Snapshot) bool
+
+	filter      Filter
+	filterLimit time.Duration
+
+	ephemeral bool
+	sealer    Sealer
+	signer    Signer
+
+	secretTTL time.Duration
+	secret    func([]Item) bool
+
+	peerExpiry time.Duration
+	formats    []string // format classes synced; nil = all
+	budgets    []Budget
+	ask        func(context.Context, Item, Budget) bool
+	strictWait time.Duration
+	netWatch   bool
+	history    int
+	metered    string // "off", "on" or "auto"
+	eol        string // received text's line endings: "keep", "lf", "crlf" or "auto"
+	trimSpace  bool
+	urls       bool
+	guard      string // "off", "block" or "ask"
+	askSecret  func(ctx context.Context, kind, preview string) bool
+}
+
+func defaults() config {
+	return config{
+		interval:     200 * time.Millisecond,
+		debounce:     300 * time.Millisecond,
+		echoGrace:    time.Second,
+		drainTimeout: 5 * time.Second,
+		dupN:         1,
+		logger:       log.Default(),
+		peerExpiry:   7 * 24 * time.Hour,
+		netWatch:     true,
+		metered:      "off",
+		eol:          "keep",
+		urls:         true,
+		guard:        "off",
+	}
+}
+
+// WithServer syncs through a clipsync server: ws:// and wss:// URLs use
+// the WebSocket transport, anything else HTTP polling.  key is the
+// 16-hex-char shared secret.  An s3://bucket[/prefix] URL syncs through
+// object storage instead (AWS_* environment), a redis:// or rediss://
+// URL through Redis pub/sub, a nats:// URL through NATS; these ignore
+// key.
+func WithServer(url, key string) Option {
+	return func(c *config) { c.server, c.key = url, key }
+}
+
+// WithTransport syncs through t instead of a server; it wins over
+// WithServer.
+func WithTransport(t Transport) Option { return func(c *config) { c.transport = t } }
+
+// WithDeviceName is what peers call this device in their logs, peer
+// lists and notifications; by default the host name.  It travels with
+// every snapshot, in the clear even with WithSealer.
+func WithDeviceName(name string) Option { return func(c *config) { c.name = name } }
+
+// WithRoom joins a sync room on the server ("" = default room).
+func WithRoom(room string) Option { return func(c *config) { c.room = room } }
+
+// WithDeviceID names this device; by default a random 8-char id.  It
+// must match the id a custom Transport filters its own echoes by.
+func WithDeviceID(id string) Option { return func(c *config) { c.id = id } }
+
+// WithClipboard replaces the system clipboard.  Required where there
+// is no built-in one (see HasSystemClipboard).
+func WithClipboard(cb Clipboard) Option { return func(c *config) { c.clipboard = cb } }
+
+// WithClipOptions tunes the system clipboard; ignored with WithClipboard.
+func WithClipOptions(o ClipOptions) Option { return func(c *config) { c.clipOpts = o } }
+
+// WithInterval is how often the clipboard is polled as a safety net
+// next to change notifications (default 200ms).
+func WithInterval(d time.Duration) Option { return func(c *config) { c.interval = d } }
+
+// WithDebounce sends a copy only after the clipboard has been quiet
+// this long (default 300ms, 0 = at once).
+func WithDebounce(d time.Duration) Option { return func(c *config) { c.debounce = d } }
+
+// WithEchoGrace is how long after writing a remote clip a local copy
+// with the same content is still taken for an echo of that write and
+// not sent back (default 1s, 0 = only the write's own sequence bumps).
+func WithEchoGrace(d time.Duration) Option { return func(c *config) { c.echoGrace = d } }
+
+// WithDrainTimeout bounds shutdown: once Run's context ends, copies not
+// yet sent, and a send under way, get this long to go out before Run
+// returns (default 5s).  What's left goes to the offline queue.
+func WithDrainTimeout(d time.Duration) Option { return func(c *config) { c.drainTimeout = d } }
+
+// WithMaxAge drops remote clips copied more than d ago (default 0 =
+// keep all), so a peer waking from sleep with a queue of old copies
+// doesn't overwrite the clipboard with one of them.  Age is taken from
+// the snapshot's timestamp against server time.
+func WithMaxAge(d time.Duration) Option { return func(c *config) { c.maxAge = d } }
+
+// WithDedupe skips clips identical to one of the last n (default 1,
+// 0 = off) seen less than window ago (0 = forever).
+func WithDedupe(n int, window time.Duration) Option {
+	return func(c *config) { c.dupN, c.dupWindow = n, window }
+}
+
+// WithForceResend sends every copy, identical or not, and makes peers
+// re-apply it.
+func WithForceResend(on bool) Option { return func(c *config) { c.force = on } }
+
+// WithQueueDir keeps unsent snapshots in dir while the transport is
+// down (default "" = drop them).
+func WithQueueDir(dir string) Option { return func(c *config) { c.queueDir = dir } }
+
+// WithStorage keeps the offline queue, the clip history (WithHistory)
+// and partial downloads of a WithServer HTTP transport in st, each in
+// its own namespace, so they survive a restart.  WithQueueDir, if set,
+// still holds the queue.
+func WithStorage(st Storage) Option { return func(c *config) { c.storage = st } }
+
+// WithLogger sends progress lines to l (default log.Default(); nil
+// silences them).
+func WithLogger(l *log.Logger) Option { return func(c *config) { c.logger = l } }
+
+// WithOnSend calls fn after each local copy reaches the transport, on a
+// goroutine of its own so a slow fn never holds up sync.
+func WithOnSend(fn func(Snapshot)) Option { return func(c *config) { c.onSend = fn } }
+
+// WithOnReceive calls fn after each remote snapshot is on the local
+// clipboard, like WithOnSend.
+func WithOnReceive(fn func(Snapshot)) Option { return func(c *config) { c.onReceive = fn } }
+
+// WithConfirm asks fn before each remote snapshot is applied; false
+// drops it.  Incoming clips wait while fn runs, so it should be quick
+// or bounded (a notification the user may click, say).
+func WithConfirm(fn func(ctx context.Context, snap Snapshot) bool) Option {
+	return func(c *config) { c.confirm = fn }
+}
+
+// Filter inspects or rewrites a clip's items on the way out (event
+// "send") or in ("receive").  Returning no items blocks the clip; so
+// does an error, or overrunning the time limit.
+type Filter func(ctx context.Context, event string, items []Item) ([]Item, error)
+
+// WithFilter runs f on every clip, cancelling it after limit (0 = 2s).
+func WithFilter(f Filter, limit time.Duration) Option {
+	return func(c *config) { c.filter, c.filterLimit = f, limit }
+}
+
+// Sealer encrypts clips end to end: Seal runs on every outgoing clip
+// just before the transport, Open on every incoming one first thing.
+// internal/seal has the built-in per-room one (-ring).
+type Sealer interface {
+	Seal(items []Item) ([]Item, error)
+	Open(items []Item) ([]Item, error)
+}
+
+// WithSealer encrypts every clip with x.  Clips x can't open (sent in
+// the clear, or under a key this device doesn't hold) are dropped.
+// Acks and capability lists stay readable to the transport.
+func WithSealer(x Sealer) Option { return func(c *config) { c.sealer = x } }
+
+// Signer proves where snapshots come from: Sign runs on everything
+// this device sends, after sealing, and Verify on everything received,
+// before anything else looks at it.  internal/sign has the built-in
+// Ed25519 one (-sign).
+type Signer interface {
+	Sign(snap *Snapshot) error
+	Verify(snap Snapshot) error
+}
+
+// WithSigner signs every snapshot with x, acks and capability lists
+// too, and drops received ones x rejects.
+func WithSigner(x Signer) Option { return func(c *config) { c.signer = x } }
+
+// WithSecretTTL clears a clip from the clipboard ttl after it was
+// copied, here and on every peer, like a password manager does.  Only
+// clips secret reports true for are cleared; nil means all of them.
+// Peers clear what the sender flagged even without this option; a
+// clip copied over in the meantime is left alone.
+func WithSecretTTL(ttl time.Duration, secret func(items []Item) bool) Option {
+	return func(c *config) { c.secretTTL, c.secret = ttl, secret }
+}
+
+// WithPeerExpiry forgets a peer (what it accepts, when it was last
+// heard from) once it has been silent for d (default 7 days), so a
+// long-running daemon doesn't collect every device that ever joined.
+func WithPeerExpiry(d time.Duration) Option { return func(c *config) { c.peerExpiry = d } }
+
+// WithSyncFormats syncs only items of these classes, both ways: "text",
+// "image", "files", or "all" (the default).  Clips left with nothing
+// are not sent, or not applied.
+func WithSyncFormats(classes ...string) Option {
+	return func(c *config) { c.formats = classes }
+}
+
+// WithSizeBudgets caps item sizes per format as they are read from the
+// clipboard.  Each budget names a format ("image/png", "raw:*"), a class
+// ("text", "image", "files") or "*"; the most specific one applies.  An
+// item over budget is dropped, or with policy "convert" made to fit
+// where possible: text/plain is cut short at a character boundary and
+// images are shrunk (Windows).  With policy "ask" it goes out only if
+// the WithOversizeAsk function agrees.  Items without a budget are sent
+// as is.
+func WithSizeBudgets(budgets ...Budget) Option {
+	return func(c *config) { c.budgets = budgets }
+}
+
+// WithOversizeAsk asks fn whether an item over an "ask" budget may be
+// sent anyway; without it such items are dropped like "skip".  The copy
+// waits while fn runs, so it should be bounded (a notification the user
+// may click, say).
+func WithOversizeAsk(fn func(ctx context.Context, it Item, b Budget) bool) Option {
+	return func(c *config) { c.ask = fn }
+}
+
+// WithSecretGuard checks every local copy for what looks like a secret
+// (a private key, a JWT, a known API token shape, a generated password;
+// see internal/secret) before it is sent.  mode "block" never sends
+// one, "ask" sends it only if ask agrees (blocks without an ask
+// function), "off" doesn't look (the default).  Either way the log says
+// what was held back with a redacted preview, e.g. "eyJh… (212 chars)".
+// ask gets the same preview and should be bounded, like WithOversizeAsk.
+func WithSecretGuard(mode string, ask func(ctx context.Context, kind, preview string) bool) Option {
+	return func(c *config) { c.guard, c.askSecret = mode, ask }
+}
+
+// WithStrictOrder applies each device's clips in the order it copied
+// them: one that overtakes an earlier one is held until the earlier one
+// arrives, or for at most wait (0 = off, the default).  Without it
+// a late clip is only dropped if something newer is already applied.
+func WithStrictOrder(wait time.Duration) Option { return func(c *config) { c.strictWait = wait } }
+
+// WithNetWatch re-dials the transport the moment the OS reports a
+// network change (Wi-Fi switch, docking, VPN); default on.  Off, a
+// connection that died with the old network is only noticed when it
+// times out.  Transports without a Redial method are left alone.
+func WithNetWatch(on bool) Option { return func(c *config) { c.netWatch = on } }
+
+// WithHistory keeps the last n clips sent or received, for History,
+// Repush and Forget (default 0 = none), and the ones pinned with Pin on
+// top of those.  They live in memory, and in WithStorage's storage if
+// there is one.
+func WithHistory(n int) Option { return func(c *config) { c.history = n } }
+
+// WithMetered saves bytes on metered networks: only text is synced,
+// both ways and in what peers are told we accept, bodies are gzipped at
+// the best level and polling transports slow down.  mode "on" always
+// does so, "auto" whenever the OS marks the connection as metered
+// (checked after every network change), "off" never (the default).
+func WithMetered(mode string) Option { return func(c *config) { c.metered = mode } }
+
+// WithTextNormalization rewrites received plain text before it is
+// pasted: eol "lf" or "crlf" makes every line end that way, "auto" the
+// way this platform does (CRLF on Windows, LF elsewhere), "keep" leaves
+// them (the default); trim drops spaces and tabs at the end of lines.
+// Other text formats (HTML, RTF) arrive as sent.
+func WithTextNormalization(eol string, trim bool) Option {
+	return func(c *config) { c.eol, c.trimSpace = eol, trim }
+}
+
+// WithURLs sends a copied link, or text that is nothing but links, as
+// text/uri-list too, and pastes a received uri-list as text as well as
+// in the clipboard's own link format (Windows: the URL formats browsers
+// use); default on.  Peers that don't accept uri-lists get the text.
+func WithURLs(on bool) Option { return func(c *config) { c.urls = on } }
+
+// WithEphemeral guarantees nothing reaches the disk: no offline queue,
+// no text-as-file spool, and every later write anywhere in clipsync
+// fails (the switch is process-wide and cannot be undone).
+func WithEphemeral(on bool) Option { return func(c *config) { c.ephemeral = on } }
@@ -0,0 +1,450 @@
+package clipsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "clipsync/internal"
+	"clipsync/internal/crash"
+	netw "clipsync/internal/net"
+	"clipsync/internal/netwatch"
+	"clipsync/internal/persist"
+	"clipsync/internal/queue"
+	"clipsync/internal/supervise"
+
+	"github.com/google/uuid"
+)
+
+/*──────── Syncer ──────────────────────────────────────────────*/
+
+// Syncer keeps the local clipboard in sync with other devices:
+//
+//	s, err := clipsync.New(clipsync.WithServer(url, key))
+//	…
+//	err = s.Run(ctx)
+//
+// It is the whole engine of the clipsync binary; the binary only adds
+// flags, the control socket and signal handling.
+type Syncer struct {
+	cfg config
+	id  string
+	tr  Transport
+	cb  Clipboard
+	q   *queue.Queue // nil = no offline queue
+	log *log.Logger
+
+	dup     *core.Dedupe
+	echo    *core.Echo
+	order   *core.Lamport
+	acks    *core.Acks
+	traffic *core.Traffic
+	caps    *core.Caps
+	inorder *core.InOrder // nil unless WithStrictOrder
+	hist    *history      // nil unless WithHistory
+	sup     *supervise.Supervisor
+
+	toUp    chan Snapshot
+	paused  atomic.Bool
+	metered atomic.Bool
+	formats map[string]bool // format classes synced; nil = all
+	purged  atomic.Int64    // peers forgotten by the janitor
+	sent    atomic.Uint64   // data snapshots stamped, for Snapshot.N
+
+	upMu   sync.Mutex
+	upStop context.CancelFunc // the data send under way, for supersede
+}
+
+// New builds a Syncer; nothing runs until Run.
+func New(opts ...Option) (*Syncer, error) {
+	cfg := defaults()
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.ephemeral {
+		persist.Disable()
+		cfg.queueDir, cfg.clipOpts.TextFileBytes = "", 0
+	}
+	s := &Syncer{
+		cfg:     cfg,
+		id:      cfg.id,
+		tr:      cfg.transport,
+		cb:      cfg.clipboard,
+		log:     cfg.logger,
+		dup:     core.NewDedupe(cfg.dupN, cfg.dupWindow),
+		echo:    core.NewEcho(cfg.echoGrace),
+		order:   core.NewLamport(),
+		acks:    core.NewAcks(20),
+		traffic: core.NewTraffic(time.Now()),
+		caps:    core.NewCaps(3 * time.Minute),
+		sup:     supervise.New(),
+		toUp:    make(chan Snapshot, 8),
+	}
+	if s.log == nil {
+		s.log = log.New(io.Discard, "", 0)
+	}
+	for _, c := range cfg.formats {
+		switch c {
+		case "all", core.ClassText, core.ClassImage, core.ClassFiles:
+		default:
+			return nil, fmt.Errorf("clipsync: unknown format class %q (text, image, files, all)", c)
+		}
+	}
+	switch cfg.metered {
+	case "off", "on", "auto":
+	default:
+		return nil, fmt.Errorf("clipsync: unknown metered mode %q (off, on, auto)", cfg.metered)
+	}
+	switch cfg.guard {
+	case "off", "block", "ask":
+	default:
+		return nil, fmt.Errorf("clipsync: unknown secret guard mode %q (off, block, ask)", cfg.guard)
+	}
+	switch cfg.eol {
+	case "auto":
+		s.cfg.eol = core.EOLLF
+		if runtime.GOOS == "windows" {
+			s.cfg.eol = core.EOLCRLF
+		}
+	case core.EOLKeep, core.EOLLF, core.EOLCRLF:
+	default:
+		return nil, fmt.Errorf("clipsync: unknown line ending %q (keep, lf, crlf, auto)", cfg.eol)
+	}
+	if len(cfg.formats) > 0 && !slices.Contains(cfg.formats, "all") {
+		s.formats = make(map[string]bool)
+		for _, c := range cfg.formats {
+			s.formats[c] = true
+		}
+	}
+	if s.id == "" {
+		s.id = uuid.NewString()[:8]
+	}
+	if s.cfg.name == "" {
+		s.cfg.name, _ = os.Hostname()
+	}
+	if s.cb == nil {
+		if s.cb = systemClipboard(cfg.clipOpts); s.cb == nil {
+			return nil, errors.New("clipsync: no system clipboard on this platform, use WithClipboard")
+		}
+	}
+	if s.tr == nil {
+		var err error
+		switch {
+		case cfg.server == "":
+			return nil, errors.New("clipsync: no transport, use WithServer or WithTransport")
+		case strings.HasPrefix(cfg.server, "nats://"):
+			s.tr, err = netw.NewNATS(cfg.server, s.id, netw.WithRoom(cfg.room))
+		case strings.HasPrefix(cfg.server, "redis"):
+			s.tr, err = netw.NewRedis(cfg.server, s.id, netw.WithRoom(cfg.room))
+		case strings.HasPrefix(cfg.server, "s3://"):
+			s.tr, err = netw.NewS3(cfg.server, s.id, netw.WithRoom(cfg.room))
+		case strings.HasPrefix(cfg.server, "ws"):
+			s.tr, err = netw.NewWS(cfg.server, s.id, cfg.key, netw.WithRoom(cfg.room))
+		default:
+			topts := []netw.Option{netw.WithRoom(cfg.room)}
+			if cfg.storage != nil {
+				topts = append(topts, netw.WithResumeStore(cfg.storage))
+			}
+			s.tr, err = netw.NewHTTP(cfg.server, s.id, cfg.key, topts...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.history > 0 {
+		s.hist = newHistory(cfg.history, cfg.storage)
+	}
+	if cfg.strictWait > 0 {
+		s.inorder = core.NewInOrder(cfg.strictWait)
+	}
+	if cfg.queueDir != "" {
+		q, err := queue.Open(cfg.queueDir)
+		if err != nil {
+			return nil, err
+		}
+		s.q = q
+	} else if cfg.storage != nil {
+		s.q = queue.New(cfg.storage)
+	}
+	if s.q != nil {
+		if n := s.q.Len(); n > 0 {
+			s.log.Printf("%s %s %d snapshots waiting in offline queue", ts(), icSend, n)
+		}
+	}
+	return s, nil
+}
+
+// ID is this device's id, as stamped into every snapshot it sends.
+func (s *Syncer) ID() string { return s.id }
+
+// Run syncs until ctx ends.  The clipboard owner, the uploader and the
+// transport are restarted on their own if they fail.  After ctx ends,
+// Run sends what is still waiting, closes the connection and returns,
+// within WithDrainTimeout.
+func (s *Syncer) Run(ctx context.Context) error {
+	fromSrv := make(chan Snapshot, 8)
+
+	if r, ok := s.cb.(clipRunner); ok {
+		s.sup.Go(ctx, "clip", r.Run)
+	}
+
+	var changes <-chan struct{}
+	mode := ""
+	if w, ok := s.cb.(clipWatcher); ok {
+		changes, mode = w.Watch()
+	}
+	if mode == "" {
+		mode = "polling only"
+	}
+	s.log.Printf("%s %s change detection: %s", ts(), icLocal, mode)
+
+	spawn(func() { s.announceCaps(ctx) })
+	spawn(func() { s.janitor(ctx) })
+	spawn(func() { s.meteredWatch(ctx) })
+	if s.cfg.netWatch {
+		spawn(func() { s.redialOnChange(ctx, netwatch.Changes(ctx)) })
+	}
+	spawn(func() { s.watcher(ctx, changes) })
+
+	// The transport outlives ctx until the uploader has drained, so the
+	// last copies still go out and the connection closes cleanly.
+	// Sends in flight are only called off once the drain runs out.
+	trCtx, trStop := context.WithCancel(context.WithoutCancel(ctx))
+	hard, hardStop := context.WithCancel(context.WithoutCancel(ctx))
+	defer hardStop()
+	var up, tr sync.WaitGroup // done by the run that sees its ctx end
+	up.Add(1)
+	tr.Add(1)
+	s.sup.Go(ctx, "uploader", func(ctx context.Context) error {
+		defer doneOnce(ctx, &up)
+		s.uploader(ctx, hard)
+		return nil
+	})
+	s.sup.Go(trCtx, "transport", func(ctx context.Context) error {
+		defer doneOnce(ctx, &tr)
+		s.tr.Poll(ctx, fromSrv)
+		return nil
+	})
+	spawn(func() { s.poller(ctx, fromSrv) })
+
+	<-ctx.Done()
+	deadline := time.Now().Add(s.cfg.drainTimeout)
+	if !waitUntil(&up, deadline) {
+		s.log.Printf("%s %s shutdown: a send still in flight after %v, calling it off", ts(), icSend, s.cfg.drainTimeout)
+		hardStop()
+		waitUntil(&up, time.Now().Add(time.Second)) // it goes to the offline queue
+	}
+	trStop()
+	waitUntil(&tr, time.Now().Add(time.Second)) // the close handshake
+	return nil
+}
+
+// doneOnce marks a supervised subsystem finished, unless it's about to
+// be restarted: only after ctx ends does the Supervisor stop calling it.
+func doneOnce(ctx context.Context, wg *sync.WaitGroup) {
+	if ctx.Err() != nil {
+		wg.Done()
+	}
+}
+
+// waitUntil waits for wg until deadline; false if it ran out.
+func waitUntil(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
+
+// spawn runs fn on its own goroutine; a panic there goes into a crash
+// report (when enabled) on its way to taking the process down.
+func spawn(fn func()) {
+	go func() {
+		defer crash.Recover()
+		fn()
+	}()
+}
+
+// SetPaused stops (true) or restarts syncing in both directions;
+// copies made while paused are never sent.  It reports whether the
+// state changed.
+func (s *Syncer) SetPaused(p bool) bool { return s.paused.Swap(p) != p }
+
+// Paused reports whether sync is paused.
+func (s *Syncer) Paused() bool { return s.paused.Load() }
+
+// Metered reports whether sync is saving bytes for a metered network
+// (WithMetered).
+func (s *Syncer) Metered() bool { return s.metered.Load() }
+
+// Resend sends the current clipboard again, forcing peers to apply it
+// even if they already have it.  It returns the number of items sent.
+func (s *Syncer) Resend(ctx context.Context) (int, error) { return s.resend(ctx, "") }
+
+// SendTo sends the current clipboard to one peer, named by its id or
+// its device name, and no other: the rest still receive the snapshot
+// (the relay fans out to the whole room) but drop it unread.  It
+// returns the number of items sent.
+func (s *Syncer) SendTo(ctx context.Context, device string) (int, error) {
+	to, err := s.peerID(device)
+	if err != nil {
+		return 0, err
+	}
+	return s.resend(ctx, to)
+}
+
+// peerID finds device in the peer table: an id, or else a name (any
+// case) no two peers share.
+func (s *Syncer) peerID(device string) (string, error) {
+	var named []string
+	for _, p := range s.caps.List(time.Now()) {
+		if p.ID == device {
+			return p.ID, nil
+		}
+		if p.Name != "" && strings.EqualFold(p.Name, device) {
+			named = append(named, p.ID)
+		}
+	}
+	switch len(named) {
+	case 0:
+		return "", fmt.Errorf("clipsync: no peer %q, see `clipsync peers`", device)
+	case 1:
+		return named[0], nil
+	}
+	return "", fmt.Errorf("clipsync: %d peers are called %q (%s): give an id", len(named), device, strings.Join(named, ", "))
+}
+
+func (s *Syncer) resend(ctx context.Context, to string) (int, error) {
+	items, err := s.cb.Read()
+	if err != nil {
+		return 0, err
+	}
+	if s.cfg.urls {
+		items = core.TagURLs(items)
+	}
+	items = s.caps.Filter(s.guard(ctx, s.syncable(s.fit(ctx, items))), time.Now())
+	snap := s.stamp(items)
+	snap.Force, snap.To = true, to
+	return len(items), s.emit(ctx, snap)
+}
+
+// Copy puts items on the clipboard as if the user had copied them, so
+// they are sent like any local copy (editor and terminal integrations).
+func (s *Syncer) Copy(items []Item) error { return s.cb.Write(items) }
+
+// Paste returns what is on the clipboard now, local or remote.
+func (s *Syncer) Paste() ([]Item, error) { return s.cb.Read() }
+
+// Deliveries lists which devices applied our last few sends, and how
+// fast; a send addressed to one device (SendTo) names it.
+func (s *Syncer) Deliveries() string { return s.acks.Status() }
+
+// Stats is what this Syncer has sent and received since New, and how
+// quickly peers confirmed its sends.
+func (s *Syncer) Stats() Stats { return s.traffic.Stats() }
+
+// Peers lists the devices heard from lately, newest first, as a table:
+// id, name, online or not, last seen and what they accept.  Every
+// device announces itself once a minute and counts as online for three.
+// Below it, how many of our recent sends meant for each peer it
+// applied, when it last did, and the devices the server sees polling
+// the room if it lists them (HTTP polling), announced or not.
+func (s *Syncer) Peers() string {
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString(s.caps.Peers(now))
+	for _, p := range s.caps.List(now) {
+		n, of, last := s.acks.Applied(p.ID)
+		if of == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\napplied by %s: %d of our last %d", s.caps.Who(p.ID), n, of)
+		if n > 0 {
+			fmt.Fprintf(&b, ", latest %s ago", now.Sub(last).Round(time.Second))
+		}
+	}
+	if d, ok := s.tr.(interface{ Devices() []netw.Device }); ok {
+		if devs := d.Devices(); devs != nil {
+			who := make([]string, len(devs))
+			for i, dv := range devs {
+				who[i] = s.caps.Who(dv.ID)
+			}
+			fmt.Fprintf(&b, "\nserver sees %d active: %s", len(devs), strings.Join(who, ", "))
+		}
+	}
+	return strings.TrimPrefix(b.String(), "\n")
+}
+
+// PeerList is Peers for programs.
+func (s *Syncer) PeerList() []Peer { return s.caps.List(time.Now()) }
+
+// Purged counts the state dropped so far to keep memory flat: silent
+// peers forgotten (WithPeerExpiry), and partial downloads abandoned by
+// the transport (HTTP polling; 0 for the others).
+func (s *Syncer) Purged() (peers, downloads int64) {
+	if a, ok := s.tr.(interface{ Abandoned() int64 }); ok {
+		downloads = a.Abandoned()
+	}
+	return s.purged.Load(), downloads
+}
+
+// Transfers lists the chunked uploads and downloads under way.  Only
+// the HTTP polling transport reports them; nil for the others.
+func (s *Syncer) Transfers() []Transfer {
+	if t, ok := s.tr.(interface{ Transfers() []Transfer }); ok {
+		return t.Transfers()
+	}
+	return nil
+}
+
+// Status lists the supervised parts and their restarts.
+func (s *Syncer) Status() string { return s.sup.Status() }
+
+// stamp wraps items in a data snapshot from this device.
+func (s *Syncer) stamp(items []Item) Snapshot {
+	return Snapshot{
+		Origin: s.id,
+		TS:     netw.Now().Unix(),
+		Seq:    s.order.Tick(s.id, uint64(netw.Now().UnixMilli())),
+		N:      s.sent.Add(1),
+		Name:   s.cfg.name,
+		Items:  items,
+	}
+}
+
+// emit hands snap to the uploader.
+func (s *Syncer) emit(ctx context.Context, snap Snapshot) error {
+	if snap.Kind == "" {
+		s.supersede() // whatever is uploading now is out of date
+	}
+	select {
+	case s.toUp <- snap:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*──────── pretty helpers ───────────────────────────────────────*/
+var (
+	icSend  = "↗"
+	icRecv  = "🛰 "
+	icLocal = "🖳"
+)
+
+func ts() string { return time.Now().Format("15:04:05.000") }
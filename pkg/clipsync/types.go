@@ -0,0 +1,141 @@
+package clipsync
+
+import (
+	"context"
+
+	core "clipsync/internal"
+	netw "clipsync/internal/net"
+	"clipsync/internal/queue"
+	"clipsync/internal/store"
+)
+
+/*──────── wire types ──────────────────────────────────────────*/
+// Snapshot and Item are aliases, not copies: values pass between this
+// package and a Transport without conversion.
+type (
+	Snapshot = core.Snapshot
+	Item     = core.Item
+)
+
+// Peer is a device heard from (PeerList).
+type Peer = core.Peer
+
+// Stats is what a session moved; see Syncer.Stats.
+type Stats = core.TrafficStats
+
+// Transfer is a chunked upload or download under way (Transfers).
+type Transfer = netw.Transfer
+
+// Budget caps the size of one format's items (WithSizeBudgets).
+type Budget = core.Budget
+
+// Storage keeps state by namespace and key (WithStorage): Put, Get,
+// List and Delete.  DirStorage, MemoryStorage and OpenBoltStorage are
+// built in; any other backend only needs the four methods.
+type Storage = store.Storage
+
+// DirStorage keeps each value as a file under dir, one subdirectory
+// per namespace.
+func DirStorage(dir string) Storage { return store.Dir(dir) }
+
+// MemoryStorage keeps everything in the process.
+func MemoryStorage() Storage { return store.Memory() }
+
+// BoltStorage is a Storage in one bbolt database file; Close it when
+// done.
+type BoltStorage = store.Bolt
+
+// OpenBoltStorage opens (or creates) the bbolt database at path.
+func OpenBoltStorage(path string) (*BoltStorage, error) { return store.OpenBolt(path) }
+
+// SealedStorage encrypts every value st holds with AES-256-GCM under
+// key (32 bytes).  History and queue entries st kept in the clear are
+// sealed in place first, so turning it on loses nothing; a value under
+// another key reads as an error, and the history drops it.
+func SealedStorage(st Storage, key []byte) (Storage, error) {
+	if _, err := store.Seal(st, key, historyNS, queue.Namespace); err != nil {
+		return nil, err
+	}
+	return store.Sealed(st, key)
+}
+
+// ParseBudgets reads budgets written as "image/png=8MiB:convert,
+// text=1MiB,files=100MiB"; see WithSizeBudgets.
+func ParseBudgets(spec string) ([]Budget, error) { return core.ParseBudgets(spec) }
+
+// MimePrimary is the format of the Linux PRIMARY selection's text
+// (ClipOptions.Primary).  A Clipboard that lists it in Accepts gets
+// those items; the Syncer keeps them off any other.
+const MimePrimary = core.MimePrimary
+
+// TextItem wraps text as an item every built-in clipboard can paste.
+func TextItem(text []byte) Item { return core.TextItem(text) }
+
+// VerboseKey spells out the dedupe key of items format by format, with
+// payload digests, for diagnostics.
+func VerboseKey(items []Item) string { return core.VerboseKey(items) }
+
+// ContentHash is what Snapshot.Hash must be for items; receivers drop a
+// data snapshot whose items don't match it.
+func ContentHash(items []Item) string { return core.ContentHash(items) }
+
+// Text is the first text item's text, if there is one.
+func Text(items []Item) ([]byte, bool) { return core.Text(items) }
+
+// Transport carries snapshots between devices.  Send uploads one, and
+// should give up soon after ctx ends: the Syncer calls a send off when a
+// newer copy supersedes it or shutdown runs out of time.  Poll delivers
+// everything other devices send until ctx ends, skipping our own.  The
+// built-in HTTP and WebSocket transports (WithServer) satisfy it, and so
+// may any third-party one.
+type Transport interface {
+	Send(ctx context.Context, snap Snapshot) error
+	Poll(ctx context.Context, out chan<- Snapshot)
+}
+
+// Clipboard is the local clipboard.  Read and Write may return the
+// errors in errors.go; ErrNoDesktop and ErrClipboardBusy make the Syncer
+// hold a remote snapshot and retry.
+//
+// An implementation may also have
+//
+//	Run(ctx context.Context) error          // owner thread, restarted if it fails
+//	Watch() (<-chan struct{}, string)       // change ticks and a mode name
+//
+// Without Watch the Syncer polls Seq.
+type Clipboard interface {
+	Read() ([]Item, error)
+	Write(items []Item) error
+	Seq() uint32       // changes whenever the clipboard does
+	Accessible() bool  // false while the desktop is locked
+	Accepts() []string // formats Write can paste, see caps.go
+}
+
+// optional Clipboard methods
+type (
+	clipRunner interface {
+		Run(ctx context.Context) error
+	}
+	clipWatcher interface {
+		Watch() (<-chan struct{}, string)
+	}
+)
+
+// ClipOptions tunes the built-in system clipboard.  Zero values keep
+// every item as is.
+type ClipOptions struct {
+	MaxItemBytes  int  // drop items larger than this
+	MaxPixels     int  // downscale images above this many pixels
+	TextFileBytes int  // paste received text above this as a .txt file
+	JPEGQuality   int  // re-encode photographic images as JPEG
+	WebPQuality   int  // ...or as WebP, which wins if both are set
+	LossyMinBytes int  // ...but only PNGs larger than this
+	Passthrough   bool // also carry app-specific formats verbatim
+	Primary       bool // Linux: also sync the PRIMARY selection
+}
+
+// HasSystemClipboard reports whether New has a clipboard of its own
+// here, without WithClipboard: always on Windows, on Linux in a Wayland
+// or X11 session with wl-clipboard or xclip installed, and on Android
+// under Termux with Termux:API.
+func HasSystemClipboard() bool { return hasSystemClipboard() }
@@ -0,0 +1,208 @@
+// Package mobile is the sync engine for gomobile bind, so an Android
+// (or iOS) app joins a sync group with the same protocol, keys and
+// chunking as the desktop binary:
+//
+//	gomobile bind -target=android -o clipsync.aar ./pkg/mobile
+//
+// The host app brings the clipboard: it implements Clipboard, calls
+// Syncer.Changed from its clipboard listener, and gets remote clips
+// through SetText.  Only types gomobile can carry appear here (strings,
+// bools, ints, interfaces of those), so everything else stays in
+// pkg/clipsync.
+package mobile
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"clipsync/internal/kdf"
+	"clipsync/pkg/clipsync"
+)
+
+// Clipboard is the host app's clipboard, text only.  GetText is ""
+// when it holds no text; SetText("") clears it.  Both are called from
+// Go threads: post to the main thread where the platform wants it.
+type Clipboard interface {
+	GetText() string
+	SetText(text string)
+}
+
+// Logger receives the engine's progress lines, one per call.
+type Logger interface {
+	Log(line string)
+}
+
+// Config is what NewSyncer needs.  Zero values are the binary's
+// defaults.
+type Config struct {
+	Server     string // ws://, wss:// or http(s):// server URL, as -http
+	Key        string // 16 hex characters or a passphrase, as -key
+	Room       string // sync room ("" = default)
+	DeviceName string // what peers call this device ("" = host name)
+	DeviceID   string // stable id across restarts ("" = random per Syncer)
+	History    int    // recent clips kept for Repush (0 = none)
+}
+
+// NewConfig is an empty Config, for hosts that can't build Go structs
+// by value.
+func NewConfig() *Config { return &Config{} }
+
+// Syncer is one running sync engine.
+type Syncer struct {
+	s  *clipsync.Syncer
+	cb *hostClipboard
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // nil while stopped
+	done   chan struct{}
+}
+
+// NewSyncer builds a Syncer on the host's clipboard; nothing runs
+// until Start.  l may be nil.
+func NewSyncer(c *Config, cb Clipboard, l Logger) (*Syncer, error) {
+	if c == nil || cb == nil {
+		return nil, errors.New("mobile: need a Config and a Clipboard")
+	}
+	key, _, err := kdf.TransportKey(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	hc := newHostClipboard(cb)
+	var lg *log.Logger
+	if l != nil {
+		lg = log.New(logWriter{l}, "", 0)
+	}
+	s, err := clipsync.New(
+		clipsync.WithServer(c.Server, key),
+		clipsync.WithRoom(c.Room),
+		clipsync.WithDeviceName(c.DeviceName),
+		clipsync.WithDeviceID(c.DeviceID),
+		clipsync.WithHistory(c.History),
+		clipsync.WithClipboard(hc),
+		clipsync.WithLogger(lg),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Syncer{s: s, cb: hc}, nil
+}
+
+// Start runs the engine in the background; a second Start while it
+// runs does nothing.
+func (m *Syncer) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel, m.done = cancel, make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		m.s.Run(ctx)
+	}(m.done)
+}
+
+// Stop ends the engine and returns once copies still waiting went out
+// (or the drain timed out).
+func (m *Syncer) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel = nil
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Changed tells the engine the clipboard changed; it reads GetText
+// shortly after.  Call it from the platform's clipboard listener
+// (Android: OnPrimaryClipChangedListener), or after the app copies.
+func (m *Syncer) Changed() { m.cb.changed() }
+
+// SetPaused pauses (true) or resumes sync; true if that changed it.
+func (m *Syncer) SetPaused(p bool) bool { return m.s.SetPaused(p) }
+
+// Paused reports whether sync is paused.
+func (m *Syncer) Paused() bool { return m.s.Paused() }
+
+// ID is this device's id on the wire.
+func (m *Syncer) ID() string { return m.s.ID() }
+
+// Peers is the peer table, one device per line.
+func (m *Syncer) Peers() string { return m.s.Peers() }
+
+// Status is the health of the engine's parts, one per line.
+func (m *Syncer) Status() string { return m.s.Status() }
+
+// Repush sends history clip id (1 = newest) to every peer again.
+func (m *Syncer) Repush(id int) error { return m.s.Repush(context.Background(), id) }
+
+/*──────── the host's clipboard as a clipsync.Clipboard ─────────*/
+type hostClipboard struct {
+	cb Clipboard
+
+	mu   sync.Mutex
+	seq  uint32
+	wake chan struct{}
+}
+
+func newHostClipboard(cb Clipboard) *hostClipboard {
+	return &hostClipboard{cb: cb, wake: make(chan struct{}, 1)}
+}
+
+func (h *hostClipboard) changed() {
+	h.mu.Lock()
+	h.seq++
+	h.mu.Unlock()
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (h *hostClipboard) Watch() (<-chan struct{}, string) { return h.wake, "host app" }
+
+func (h *hostClipboard) Read() ([]clipsync.Item, error) {
+	text := h.cb.GetText()
+	if text == "" {
+		return nil, nil
+	}
+	return []clipsync.Item{clipsync.TextItem([]byte(text))}, nil
+}
+
+func (h *hostClipboard) Write(items []clipsync.Item) error {
+	text, ok := clipsync.Text(items)
+	if !ok && items != nil {
+		return clipsync.ErrUnsupportedFormat
+	}
+	h.cb.SetText(string(text))
+	h.mu.Lock()
+	h.seq++
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *hostClipboard) Seq() uint32 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.seq
+}
+
+func (h *hostClipboard) Accessible() bool  { return true }
+func (h *hostClipboard) Accepts() []string { return []string{"text/plain"} }
+
+// logWriter hands each log line to the host, without its newline.
+type logWriter struct{ l Logger }
+
+func (w logWriter) Write(p []byte) (int, error) {
+	line := string(p)
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	w.l.Log(line)
+	return len(p), nil
+}
@@ -0,0 +1,66 @@
+package mobile
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"clipsync/internal/server"
+)
+
+// phone is a host app's clipboard.
+type phone struct {
+	mu   sync.Mutex
+	text string
+}
+
+func (p *phone) GetText() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.text
+}
+
+func (p *phone) SetText(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text = text
+}
+
+func TestPhonesSyncThroughServer(t *testing.T) {
+	const key = "00112233445566ff"
+	srv, err := server.New(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	var cbs [2]*phone
+	var phones [2]*Syncer
+	for i := range cbs {
+		cbs[i] = &phone{}
+		c := NewConfig()
+		c.Server, c.Key, c.DeviceName = hs.URL+"/clip", key, "phone"
+		if phones[i], err = NewSyncer(c, cbs[i], nil); err != nil {
+			t.Fatal(err)
+		}
+		phones[i].Start()
+		defer phones[i].Stop()
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	cbs[0].SetText("from the phone")
+	phones[0].Changed()
+	for end := time.Now().Add(5 * time.Second); cbs[1].GetText() != "from the phone"; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(end) {
+			t.Fatalf("peer has %q", cbs[1].GetText())
+		}
+	}
+}
+
+func TestNewSyncerNeedsClipboard(t *testing.T) {
+	if _, err := NewSyncer(&Config{Server: "http://localhost/clip", Key: "00112233445566ff"}, nil, nil); err == nil {
+		t.Fatalf("NewSyncer without a clipboard succeeded")
+	}
+}